@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/c-pro/wallet-test/models"
+	"github.com/shopspring/decimal"
+)
+
+const accountUsage = `Usage:
+  wallet account create [-tenant <tenant id>] -currency <currency id> [-amount <amount>] [-owner <owner id>] [-external-id <id>] [-metadata <json>] <name>
+  wallet account show [-tenant <tenant id>] <id>
+  wallet account freeze [-tenant <tenant id>] <id>
+  wallet account unfreeze [-tenant <tenant id>] <id>`
+
+// parseAccountID returns tenant and account ID arguments of a subcommand
+func parseAccountID(name string, args []string, out io.Writer) (int64, int64, error) {
+	fs, tenantID := newTenantFlagSet(name, out)
+	if err := fs.Parse(args); err != nil {
+		return 0, 0, err
+	}
+	if fs.NArg() != 1 {
+		return 0, 0, fmt.Errorf("account ID is required\n%s", accountUsage)
+	}
+	id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	return *tenantID, id, err
+}
+
+// accountError replaces sql.ErrNoRows with a message naming the missing account
+func accountError(err error, id int64) error {
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("account %d not found", id)
+	}
+	return err
+}
+
+// parseCreateAccountArgs returns account described by arguments of "create" subcommand
+func parseCreateAccountArgs(args []string, out io.Writer) (models.Account, error) {
+	fs, tenantID := newTenantFlagSet("create", out)
+	currencyID := fs.Int64("currency", 0, "currency ID")
+	amount := fs.String("amount", "0", "initial balance")
+	ownerID := fs.Int64("owner", 0, "owner ID")
+	externalID := fs.String("external-id", "", "ID of the account in an external system")
+	metadata := fs.String("metadata", "", "account metadata JSON object")
+	if err := fs.Parse(args); err != nil {
+		return models.Account{}, err
+	}
+	if fs.NArg() != 1 || *currencyID == 0 {
+		return models.Account{}, fmt.Errorf("account name and currency are required\n%s", accountUsage)
+	}
+	balance, err := decimal.NewFromString(*amount)
+	if err != nil {
+		return models.Account{}, fmt.Errorf("invalid amount %q", *amount)
+	}
+	if *metadata != "" && !json.Valid([]byte(*metadata)) {
+		return models.Account{}, fmt.Errorf("invalid metadata %q", *metadata)
+	}
+	return models.Account{TenantID: *tenantID,
+		Name:       fs.Arg(0),
+		ExternalID: *externalID,
+		Metadata:   json.RawMessage(*metadata),
+		OwnerID:    *ownerID,
+		CurrencyID: *currencyID,
+		Amount:     balance}, nil
+}
+
+// runAccountCommand manages accounts from the command line
+func runAccountCommand(ctx context.Context, svc AccountService, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%v\n%s", errUnknownCommand, accountUsage)
+	}
+	switch args[0] {
+	case "create":
+		account, err := parseCreateAccountArgs(args[1:], out)
+		if err != nil {
+			return err
+		}
+		account, err = svc.CreateAccount(ctx, account)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Created account %d\n", account.ID)
+		return nil
+	case "show":
+		tenantID, id, err := parseAccountID("show", args[1:], out)
+		if err != nil {
+			return err
+		}
+		account, err := svc.GetAccount(ctx, tenantID, id)
+		if err != nil {
+			return accountError(err, id)
+		}
+		body, err := json.MarshalIndent(account, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "%s\n", body)
+		return nil
+	case "freeze", "unfreeze":
+		frozen := args[0] == "freeze"
+		tenantID, id, err := parseAccountID(args[0], args[1:], out)
+		if err != nil {
+			return err
+		}
+		if err := svc.SetAccountFrozen(ctx, tenantID, id, frozen); err != nil {
+			return accountError(err, id)
+		}
+		if frozen {
+			fmt.Fprintf(out, "Froze account %d\n", id)
+		} else {
+			fmt.Fprintf(out, "Unfroze account %d\n", id)
+		}
+		return nil
+	}
+	return fmt.Errorf("%v %q\n%s", errUnknownCommand, args[0], accountUsage)
+}
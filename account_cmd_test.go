@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/c-pro/wallet-test/models"
+)
+
+func TestAccountCommand(t *testing.T) {
+	svc := &accountService{newMemoryRepository()}
+	ctx := context.Background()
+	out := &bytes.Buffer{}
+	args := []string{"create", "-currency", "1", "-amount", "10.5", "-metadata", `{"a":1}`, "savings"}
+	if err := runAccountCommand(ctx, svc, args, out); err != nil {
+		t.Fatalf("Unexpected error in account create: %v", err)
+	}
+	if out.String() != "Created account 1\n" {
+		t.Errorf("Unexpected account create output %q", out.String())
+	}
+
+	out.Reset()
+	if err := runAccountCommand(ctx, svc, []string{"freeze", "1"}, out); err != nil {
+		t.Fatalf("Unexpected error in account freeze: %v", err)
+	}
+	out.Reset()
+	if err := runAccountCommand(ctx, svc, []string{"show", "1"}, out); err != nil {
+		t.Fatalf("Unexpected error in account show: %v", err)
+	}
+	account := models.Account{}
+	if err := json.Unmarshal(out.Bytes(), &account); err != nil {
+		t.Fatalf("Failed to parse account show output %q: %v", out.String(), err)
+	}
+	if account.Name != "savings" || account.Amount.String() != "10.5" || account.CurrencyName != "USD" || !account.Frozen {
+		t.Errorf("Unexpected account %v", account)
+	}
+
+	if err := runAccountCommand(ctx, svc, []string{"unfreeze", "1"}, out); err != nil {
+		t.Fatalf("Unexpected error in account unfreeze: %v", err)
+	}
+	if account, _ := svc.GetAccount(ctx, models.DefaultTenantID, 1); account.Frozen {
+		t.Error("Expected account to be unfrozen")
+	}
+
+	err := runAccountCommand(ctx, svc, []string{"show", "-tenant", "2", "1"}, out)
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected account of another tenant not to be found, got %v", err)
+	}
+	if err := runAccountCommand(ctx, svc, []string{"create", "nocurrency"}, out); err == nil {
+		t.Error("Expected account create without currency to fail")
+	}
+	if err := runAccountCommand(ctx, svc, []string{"create", "-currency", "1", "-metadata", "{", "bad"}, out); err == nil {
+		t.Error("Expected account create with invalid metadata to fail")
+	}
+}
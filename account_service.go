@@ -1,52 +1,61 @@
 package main
 
 import (
-	"database/sql"
+	"context"
 
 	"github.com/c-pro/wallet-test/models"
+	"github.com/shopspring/decimal"
 )
 
 // AccountService provides methods to access accounts
 type AccountService interface {
-	GetAccounts() ([]models.Account, error)
-	GetAccount(int64) (models.Account, error)
-	CreateAccount(models.Account) error
+	GetAccounts(ctx context.Context, tenantID int64) ([]models.Account, error)
+	GetAccount(ctx context.Context, tenantID, id int64) (models.Account, error)
+	GetAccountByExternalID(ctx context.Context, tenantID int64, externalID string) (models.Account, error)
+	CreateAccount(ctx context.Context, account models.Account) (models.Account, error)
+	SetAccountShards(ctx context.Context, tenantID, id int64, shards int) error
+	SetAccountFrozen(ctx context.Context, tenantID, id int64, frozen bool) error
+	Deposit(ctx context.Context, tenantID, id int64, amount decimal.Decimal) (models.Deposit, error)
 }
 
 // accountService implements interface above
 type accountService struct {
-	db *sql.DB
-}
-
-// GetAccounts returns all accounts in database
-func (a *accountService) GetAccounts() ([]models.Account, error) {
-	tx, err := a.db.Begin()
-	if err != nil {
-		return []models.Account{}, err
-	}
-	defer models.RollbackWithLog(tx)
-	return models.GetAccounts(tx)
-}
-
-// GetAccount returns a particular account from the database
-func (a *accountService) GetAccount(id int64) (models.Account, error) {
-	tx, err := a.db.Begin()
-	if err != nil {
-		return models.Account{}, err
-	}
-	defer models.RollbackWithLog(tx)
-	return models.GetAccount(tx, id)
-}
-
-// CreateAccount creates a new account in the database
-func (a *accountService) CreateAccount(account models.Account) error {
-	tx, err := a.db.Begin()
-	if err != nil {
-		return err
-	}
-	defer models.RollbackWithLog(tx)
-	if err := account.Save(tx); err != nil {
-		return err
-	}
-	return tx.Commit()
+	repo models.Repository
+}
+
+// GetAccounts returns all tenant's accounts in repository
+func (a *accountService) GetAccounts(ctx context.Context, tenantID int64) ([]models.Account, error) {
+	return a.repo.GetAccounts(ctx, tenantID)
+}
+
+// GetAccount returns a particular account from the repository
+func (a *accountService) GetAccount(ctx context.Context, tenantID, id int64) (models.Account, error) {
+	return a.repo.GetAccount(ctx, tenantID, id)
+}
+
+// GetAccountByExternalID returns an account with a given external ID from the repository
+func (a *accountService) GetAccountByExternalID(ctx context.Context, tenantID int64, externalID string) (models.Account, error) {
+	return a.repo.GetAccountByExternalID(ctx, tenantID, externalID)
+}
+
+// CreateAccount creates a new account in the repository in account.TenantID tenant
+// and returns it with ID assigned
+func (a *accountService) CreateAccount(ctx context.Context, account models.Account) (models.Account, error) {
+	err := a.repo.CreateAccount(ctx, &account)
+	return account, err
+}
+
+// SetAccountShards splits balance of a hot account into given number of shards
+func (a *accountService) SetAccountShards(ctx context.Context, tenantID, id int64, shards int) error {
+	return a.repo.SetAccountShards(ctx, tenantID, id, shards)
+}
+
+// SetAccountFrozen freezes or unfreezes an account. Frozen account can not participate in payments.
+func (a *accountService) SetAccountFrozen(ctx context.Context, tenantID, id int64, frozen bool) error {
+	return a.repo.SetAccountFrozen(ctx, tenantID, id, frozen)
+}
+
+// Deposit adds money coming from outside the service to an account
+func (a *accountService) Deposit(ctx context.Context, tenantID, id int64, amount decimal.Decimal) (models.Deposit, error) {
+	return a.repo.MakeDeposit(ctx, tenantID, id, amount)
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 
 	"github.com/c-pro/wallet-test/models"
 	"github.com/go-kit/kit/endpoint"
@@ -13,10 +14,24 @@ type getAccountsResponse struct {
 	Accounts []models.Account `json:"Accounts,omitempty"`
 }
 
+type getAccountsRequest struct {
+	ExternalID string
+}
+
 type getAccountRequest struct {
 	AccountID int64
 }
 
+type setAccountShardsRequest struct {
+	AccountID int64 `json:"-"`
+	Shards    int
+}
+
+type depositRequest struct {
+	AccountID int64 `json:"-"`
+	Amount    decimal.Decimal
+}
+
 type errorResponse struct {
 	Error string `json:"Error,omitempty"`
 	Code  int    `json:"-"`
@@ -24,13 +39,27 @@ type errorResponse struct {
 
 type createAccountRequest struct {
 	Name       string
+	ExternalID string
+	Metadata   json.RawMessage
+	OwnerID    int64
 	CurrencyID int64
 	Amount     decimal.Decimal
 }
 
 func makeGetAccountsEndpoint(svc AccountService) endpoint.Endpoint {
-	return func(_ context.Context, request interface{}) (interface{}, error) {
-		accounts, err := svc.GetAccounts()
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getAccountsRequest)
+		if req.ExternalID != "" {
+			account, err := svc.GetAccountByExternalID(ctx, tenantFromContext(ctx), req.ExternalID)
+			if err != nil {
+				if err == sql.ErrNoRows {
+					return getAccountsResponse{}, nil
+				}
+				return errorResponse{err.Error(), 500}, nil
+			}
+			return getAccountsResponse{[]models.Account{account}}, nil
+		}
+		accounts, err := svc.GetAccounts(ctx, tenantFromContext(ctx))
 		if err != nil {
 			return errorResponse{err.Error(), 500}, nil
 		}
@@ -39,9 +68,9 @@ func makeGetAccountsEndpoint(svc AccountService) endpoint.Endpoint {
 }
 
 func makeGetAccountEndpoint(svc AccountService) endpoint.Endpoint {
-	return func(_ context.Context, request interface{}) (interface{}, error) {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(getAccountRequest)
-		account, err := svc.GetAccount(req.AccountID)
+		account, err := svc.GetAccount(ctx, tenantFromContext(ctx), req.AccountID)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				return errorResponse{"Account not found", 404}, nil
@@ -53,14 +82,61 @@ func makeGetAccountEndpoint(svc AccountService) endpoint.Endpoint {
 }
 
 func makeCreateAccountEndpoint(svc AccountService) endpoint.Endpoint {
-	return func(_ context.Context, request interface{}) (interface{}, error) {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(createAccountRequest)
-		err := svc.CreateAccount(models.Account{Name: req.Name,
+		_, err := svc.CreateAccount(ctx, models.Account{TenantID: tenantFromContext(ctx),
+			Name:       req.Name,
+			ExternalID: req.ExternalID,
+			Metadata:   req.Metadata,
+			OwnerID:    req.OwnerID,
 			CurrencyID: req.CurrencyID,
 			Amount:     req.Amount})
+		if err == models.ErrDuplicateExternalID {
+			return errorResponse{err.Error(), 409}, nil
+		}
+		if err == models.ErrOwnerNotFound ||
+			err == models.ErrCurrencyNotFound ||
+			err == models.ErrNegativeBalance {
+			return errorResponse{err.Error(), 400}, nil
+		}
 		if err != nil {
 			return errorResponse{err.Error(), 500}, err
 		}
 		return struct{}{}, nil
 	}
 }
+
+func makeSetAccountShardsEndpoint(svc AccountService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(setAccountShardsRequest)
+		err := svc.SetAccountShards(ctx, tenantFromContext(ctx), req.AccountID, req.Shards)
+		if err == sql.ErrNoRows {
+			return errorResponse{"Account not found", 404}, nil
+		}
+		if err == models.ErrInvalidShards {
+			return errorResponse{err.Error(), 400}, nil
+		}
+		if err != nil {
+			return errorResponse{err.Error(), 500}, nil
+		}
+		return struct{}{}, nil
+	}
+}
+
+func makeDepositEndpoint(svc AccountService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(depositRequest)
+		deposit, err := svc.Deposit(ctx, tenantFromContext(ctx), req.AccountID, req.Amount)
+		if err == sql.ErrNoRows {
+			return errorResponse{"Account not found", 404}, nil
+		}
+		if err == models.ErrNonPositiveAmount ||
+			err == models.ErrAccountFrozen {
+			return errorResponse{err.Error(), 400}, nil
+		}
+		if err != nil {
+			return errorResponse{err.Error(), 500}, nil
+		}
+		return deposit, nil
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"math/rand"
 	"net/http"
 	"testing"
+	"time"
 
 	"github.com/c-pro/wallet-test/models"
 	"github.com/shopspring/decimal"
@@ -25,7 +26,7 @@ func URL(route string) string {
 }
 
 func addTestAccount(t *testing.T, name string, amount decimal.Decimal) {
-	c := http.DefaultClient
+	c := client
 	req := []byte(fmt.Sprintf(`{
 		"Name": "%s",
 		"Amount": "%s",
@@ -45,7 +46,7 @@ func addTestAccount(t *testing.T, name string, amount decimal.Decimal) {
 }
 
 func getSomething(t *testing.T, route string, dest interface{}) {
-	c := http.DefaultClient
+	c := client
 	res, err := c.Get(URL(route))
 	if err != nil {
 		t.Fatalf("Unexpected error in Get request: %s", err)
@@ -119,3 +120,126 @@ func TestGetAccount(t *testing.T) {
 			accountResp.Name)
 	}
 }
+
+func TestGetAccountsByExternalID(t *testing.T) {
+	name := randomName()
+	externalID := randomName()
+	c := client
+	req := []byte(fmt.Sprintf(`{
+		"Name": "%s",
+		"ExternalID": "%s",
+		"Metadata": {"source": "test"},
+		"Amount": "1",
+		"CurrencyId": 3
+	}`, name, externalID))
+	res, err := c.Post(URL("/accounts"),
+		"Application/json",
+		bytes.NewBuffer(req))
+	if err != nil {
+		t.Fatalf("Unexpected error in Post request: %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 200 {
+		t.Fatalf("Error code %d", res.StatusCode)
+	}
+
+	accountsResp := getAccountsResponse{}
+	getSomething(t, "/accounts?external_id="+externalID, &accountsResp)
+	if len(accountsResp.Accounts) != 1 {
+		t.Fatalf("Expected 1 account, got %d", len(accountsResp.Accounts))
+	}
+	if accountsResp.Accounts[0].Name != name {
+		t.Errorf("Account name does not match. Expected %s, got %s",
+			name,
+			accountsResp.Accounts[0].Name)
+	}
+
+	accountsResp = getAccountsResponse{}
+	getSomething(t, "/accounts?external_id="+randomName(), &accountsResp)
+	if len(accountsResp.Accounts) != 0 {
+		t.Errorf("Expected no accounts for unknown external ID, got %d", len(accountsResp.Accounts))
+	}
+}
+
+func TestAccountShards(t *testing.T) {
+	requireDB(t)
+	owner := addTestOwner(t)
+	addTestOwnerAccount(t, owner.ID, decimal.New(10, 0))
+	addTestOwnerAccount(t, owner.ID, decimal.Zero)
+	accounts := getAccountsResponse{}
+	getSomething(t, fmt.Sprintf("/owner/%d/accounts", owner.ID), &accounts)
+	buyerID, hotID := accounts.Accounts[0].ID, accounts.Accounts[1].ID
+
+	route := fmt.Sprintf("/account/%d/shards", hotID)
+	if code, errResp := requestStatus(t, client, "PUT", route, `{"Shards": 4}`); code != 200 {
+		t.Fatalf("Expected PUT shards to get 200, got %d (%s)", code, errResp.Error)
+	}
+	if code, _ := requestStatus(t, client, "PUT", route, `{"Shards": 2}`); code != 400 {
+		t.Errorf("Expected decreasing shards to get 400, got %d", code)
+	}
+
+	pay := func(buyer, seller int64) {
+		body := fmt.Sprintf(`{"BuyerAccountID": %d, "SellerAccountID": %d, "Amount": "1"}`, buyer, seller)
+		if code, errResp := requestStatus(t, client, "POST", "/payments", body); code != 200 {
+			t.Fatalf("Expected payment to get 200, got %d (%s)", code, errResp.Error)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		pay(buyerID, hotID)
+	}
+	pay(hotID, buyerID)
+
+	hot := models.Account{}
+	getSomething(t, fmt.Sprintf("/account/%d", hotID), &hot)
+	if !hot.Amount.Equals(decimal.New(2, 0)) {
+		t.Errorf("Expected hot account amount to be 2, got %s", hot.Amount)
+	}
+}
+
+// roleClient returns client authenticated with JWT of a given role in default tenant
+func roleClient(role string) *http.Client {
+	return newClient(signTestToken(map[string]interface{}{
+		"iss": "test", "sub": role, "exp": time.Now().Add(time.Minute).Unix(),
+		"tenant_id": models.DefaultTenantID, "role": role, "owner_id": 1}))
+}
+
+func TestDeposit(t *testing.T) {
+	externalID := randomName()
+	body := fmt.Sprintf(`{"Name": "%s", "ExternalID": "%s", "Amount": "10", "CurrencyId": 3}`, randomName(), externalID)
+	if code, errResp := requestStatus(t, client, "POST", "/accounts", body); code != 200 {
+		t.Fatalf("Expected account to be created, got %d (%s)", code, errResp.Error)
+	}
+	accounts := getAccountsResponse{}
+	getSomething(t, "/accounts?external_id="+externalID, &accounts)
+	if len(accounts.Accounts) != 1 {
+		t.Fatalf("Expected 1 account, got %d", len(accounts.Accounts))
+	}
+	route := fmt.Sprintf("/account/%d/deposits", accounts.Accounts[0].ID)
+
+	for _, c := range []struct {
+		role string
+		code int
+	}{
+		{models.RoleAdmin, 200},
+		{models.RoleOperator, 200},
+		{models.RoleAuditor, 403},
+		{models.RoleClient, 403},
+	} {
+		if code, errResp := requestStatus(t, roleClient(c.role), "POST", route, `{"Amount": "2.5"}`); code != c.code {
+			t.Errorf("%s deposit: expected status code %d, got %d (%s)", c.role, c.code, code, errResp.Error)
+		}
+	}
+
+	account := models.Account{}
+	getSomething(t, fmt.Sprintf("/account/%d", accounts.Accounts[0].ID), &account)
+	if !account.Amount.Equals(decimal.New(15, 0)) {
+		t.Errorf("Expected amount 15 after 2 deposits, got %s", account.Amount)
+	}
+
+	if code, _ := requestStatus(t, client, "POST", route, `{"Amount": "0"}`); code != 400 {
+		t.Errorf("Expected zero deposit to get 400, got %d", code)
+	}
+	if code, _ := requestStatus(t, client, "POST", "/account/0/deposits", `{"Amount": "1"}`); code != 404 {
+		t.Errorf("Expected deposit to unknown account to get 404, got %d", code)
+	}
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/c-pro/wallet-test/models"
+	"github.com/go-kit/kit/endpoint"
+)
+
+type getAPIKeysResponse struct {
+	APIKeys []models.APIKey `json:"APIKeys,omitempty"`
+}
+
+type issueAPIKeyRequest struct {
+	Name    string
+	Role    string
+	OwnerID int64
+}
+
+// issueAPIKeyResponse is the only place where API key is shown to the client
+type issueAPIKeyResponse struct {
+	models.APIKey
+	Key string
+}
+
+type revokeAPIKeyRequest struct {
+	KeyID int64
+}
+
+func makeGetAPIKeysEndpoint(svc APIKeyService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		apiKeys, err := svc.GetAPIKeys(ctx, tenantFromContext(ctx))
+		if err != nil {
+			return errorResponse{err.Error(), 500}, nil
+		}
+		return getAPIKeysResponse{apiKeys}, nil
+	}
+}
+
+func makeIssueAPIKeyEndpoint(svc APIKeyService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(issueAPIKeyRequest)
+		if req.Name == "" {
+			return errorResponse{"Name is required", 400}, nil
+		}
+		apiKey, key, err := svc.IssueAPIKey(ctx, tenantFromContext(ctx), req.Name, req.Role, req.OwnerID)
+		if err != nil {
+			if err == models.ErrInvalidRole ||
+				err == models.ErrOwnerRequired ||
+				err == models.ErrOwnerNotFound {
+				return errorResponse{err.Error(), 400}, nil
+			}
+			return errorResponse{err.Error(), 500}, nil
+		}
+		return issueAPIKeyResponse{apiKey, key}, nil
+	}
+}
+
+func makeRevokeAPIKeyEndpoint(svc APIKeyService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(revokeAPIKeyRequest)
+		if err := svc.RevokeAPIKey(ctx, tenantFromContext(ctx), req.KeyID); err != nil {
+			if err == sql.ErrNoRows {
+				return errorResponse{"API key not found", 404}, nil
+			}
+			return errorResponse{err.Error(), 500}, nil
+		}
+		return struct{}{}, nil
+	}
+}
+
+type getHMACKeysResponse struct {
+	HMACKeys []models.HMACKey `json:"HMACKeys,omitempty"`
+}
+
+// issueHMACKeyResponse is the only place where HMAC secret is shown to the client
+type issueHMACKeyResponse struct {
+	models.HMACKey
+	Secret string
+}
+
+func makeGetHMACKeysEndpoint(svc HMACKeyService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		hmacKeys, err := svc.GetHMACKeys(ctx, tenantFromContext(ctx))
+		if err != nil {
+			return errorResponse{err.Error(), 500}, nil
+		}
+		return getHMACKeysResponse{hmacKeys}, nil
+	}
+}
+
+func makeIssueHMACKeyEndpoint(svc HMACKeyService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(issueAPIKeyRequest)
+		if req.Name == "" {
+			return errorResponse{"Name is required", 400}, nil
+		}
+		hmacKey, err := svc.IssueHMACKey(ctx, tenantFromContext(ctx), req.Name, req.Role, req.OwnerID)
+		if err != nil {
+			if err == models.ErrInvalidRole ||
+				err == models.ErrOwnerRequired ||
+				err == models.ErrOwnerNotFound {
+				return errorResponse{err.Error(), 400}, nil
+			}
+			return errorResponse{err.Error(), 500}, nil
+		}
+		return issueHMACKeyResponse{hmacKey, hmacKey.Secret}, nil
+	}
+}
+
+func makeRevokeHMACKeyEndpoint(svc HMACKeyService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(revokeAPIKeyRequest)
+		if err := svc.RevokeHMACKey(ctx, tenantFromContext(ctx), req.KeyID); err != nil {
+			if err == sql.ErrNoRows {
+				return errorResponse{"HMAC key not found", 404}, nil
+			}
+			return errorResponse{err.Error(), 500}, nil
+		}
+		return struct{}{}, nil
+	}
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/c-pro/wallet-test/models"
+)
+
+var errUnknownCommand = errors.New("unknown command")
+
+const apiKeyUsage = `Usage:
+  wallet apikey list [-tenant <tenant id>]
+  wallet apikey issue [-tenant <tenant id>] [-role admin|auditor|operator|client] [-owner <owner id>] <name>
+  wallet apikey revoke [-tenant <tenant id>] <id>`
+
+const hmacKeyUsage = `Usage:
+  wallet hmackey list [-tenant <tenant id>]
+  wallet hmackey issue [-tenant <tenant id>] [-role admin|auditor|operator|client] [-owner <owner id>] <name>
+  wallet hmackey revoke [-tenant <tenant id>] <id>`
+
+// issueArgs are arguments of "issue" subcommand shared by API and HMAC keys
+type issueArgs struct {
+	tenantID int64
+	name     string
+	role     string
+	ownerID  int64
+}
+
+// newTenantFlagSet returns flag set of a subcommand with -tenant flag defined
+func newTenantFlagSet(name string, out io.Writer) (*flag.FlagSet, *int64) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(out)
+	tenantID := fs.Int64("tenant", models.DefaultTenantID, "tenant ID")
+	return fs, tenantID
+}
+
+func parseTenantArgs(args []string, out io.Writer) (int64, error) {
+	fs, tenantID := newTenantFlagSet("list", out)
+	if err := fs.Parse(args); err != nil {
+		return 0, err
+	}
+	return *tenantID, nil
+}
+
+func parseIssueArgs(args []string, out io.Writer, usage string) (issueArgs, error) {
+	fs, tenantID := newTenantFlagSet("issue", out)
+	role := fs.String("role", models.RoleAdmin, "key role: admin, auditor, operator or client")
+	ownerID := fs.Int64("owner", 0, "owner ID for client role keys")
+	if err := fs.Parse(args); err != nil {
+		return issueArgs{}, err
+	}
+	if fs.NArg() != 1 {
+		return issueArgs{}, fmt.Errorf("key name is required\n%s", usage)
+	}
+	return issueArgs{*tenantID, fs.Arg(0), *role, *ownerID}, nil
+}
+
+// parseKeyID returns tenant and key ID arguments of "revoke" subcommand
+func parseKeyID(args []string, out io.Writer, usage string) (int64, int64, error) {
+	fs, tenantID := newTenantFlagSet("revoke", out)
+	if err := fs.Parse(args); err != nil {
+		return 0, 0, err
+	}
+	if fs.NArg() != 1 {
+		return 0, 0, fmt.Errorf("key ID is required\n%s", usage)
+	}
+	id, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+	return *tenantID, id, err
+}
+
+func keyStatus(revoked bool) string {
+	if revoked {
+		return "revoked"
+	}
+	return "active"
+}
+
+// runAPIKeyCommand manages API keys from the command line.
+// It is the way to issue the very first admin key.
+func runAPIKeyCommand(ctx context.Context, svc APIKeyService, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%v\n%s", errUnknownCommand, apiKeyUsage)
+	}
+	switch args[0] {
+	case "list":
+		tenantID, err := parseTenantArgs(args[1:], out)
+		if err != nil {
+			return err
+		}
+		apiKeys, err := svc.GetAPIKeys(ctx, tenantID)
+		if err != nil {
+			return err
+		}
+		for _, k := range apiKeys {
+			fmt.Fprintf(out, "%d\t%s\t%s\towner=%d\t%s\n",
+				k.ID, k.Name, k.Role, k.OwnerID, keyStatus(k.RevokedAt != nil))
+		}
+		return nil
+	case "issue":
+		a, err := parseIssueArgs(args[1:], out, apiKeyUsage)
+		if err != nil {
+			return err
+		}
+		apiKey, key, err := svc.IssueAPIKey(ctx, a.tenantID, a.name, a.role, a.ownerID)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Issued API key %d. Store it securely, it will not be shown again:\n%s\n",
+			apiKey.ID, key)
+		return nil
+	case "revoke":
+		tenantID, id, err := parseKeyID(args[1:], out, apiKeyUsage)
+		if err != nil {
+			return err
+		}
+		if err := svc.RevokeAPIKey(ctx, tenantID, id); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Revoked API key %d\n", id)
+		return nil
+	}
+	return fmt.Errorf("%v %q\n%s", errUnknownCommand, args[0], apiKeyUsage)
+}
+
+// runHMACKeyCommand manages HMAC keys for signed requests from the command line
+func runHMACKeyCommand(ctx context.Context, svc HMACKeyService, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%v\n%s", errUnknownCommand, hmacKeyUsage)
+	}
+	switch args[0] {
+	case "list":
+		tenantID, err := parseTenantArgs(args[1:], out)
+		if err != nil {
+			return err
+		}
+		hmacKeys, err := svc.GetHMACKeys(ctx, tenantID)
+		if err != nil {
+			return err
+		}
+		for _, k := range hmacKeys {
+			fmt.Fprintf(out, "%d\t%s\t%s\towner=%d\t%s\n",
+				k.ID, k.Name, k.Role, k.OwnerID, keyStatus(k.RevokedAt != nil))
+		}
+		return nil
+	case "issue":
+		a, err := parseIssueArgs(args[1:], out, hmacKeyUsage)
+		if err != nil {
+			return err
+		}
+		hmacKey, err := svc.IssueHMACKey(ctx, a.tenantID, a.name, a.role, a.ownerID)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Issued HMAC key %d. Share the secret with the partner securely:\n%s\n",
+			hmacKey.ID, hmacKey.Secret)
+		return nil
+	case "revoke":
+		tenantID, id, err := parseKeyID(args[1:], out, hmacKeyUsage)
+		if err != nil {
+			return err
+		}
+		if err := svc.RevokeHMACKey(ctx, tenantID, id); err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Revoked HMAC key %d\n", id)
+		return nil
+	}
+	return fmt.Errorf("%v %q\n%s", errUnknownCommand, args[0], hmacKeyUsage)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/c-pro/wallet-test/models"
+)
+
+func TestAPIKeyCommand(t *testing.T) {
+	requireDB(t)
+	svc := &apiKeyService{db}
+	out := &bytes.Buffer{}
+	if err := runAPIKeyCommand(context.Background(), svc, []string{"issue", "-role", "auditor", "cli-test"}, out); err != nil {
+		t.Fatalf("Unexpected error in apikey issue: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	key := lines[len(lines)-1]
+
+	apiKey, err := svc.Authenticate(context.Background(), key)
+	if err != nil {
+		t.Fatalf("Issued key does not authenticate: %v", err)
+	}
+	if apiKey.Role != models.RoleAuditor {
+		t.Errorf("Expected issued key to have auditor role, got %s", apiKey.Role)
+	}
+
+	out.Reset()
+	if err := runAPIKeyCommand(context.Background(), svc, []string{"list"}, out); err != nil {
+		t.Fatalf("Unexpected error in apikey list: %v", err)
+	}
+	if !strings.Contains(out.String(), "cli-test") {
+		t.Errorf("Expected issued key in apikey list output, got %q", out.String())
+	}
+
+	out.Reset()
+	revoke := []string{"revoke", strconv.FormatInt(apiKey.ID, 10)}
+	if err := runAPIKeyCommand(context.Background(), svc, revoke, out); err != nil {
+		t.Fatalf("Unexpected error in apikey revoke: %v", err)
+	}
+	if _, err := svc.Authenticate(context.Background(), key); err == nil {
+		t.Error("Expected revoked key to fail authentication")
+	}
+
+	if err := runAPIKeyCommand(context.Background(), svc, []string{"frobnicate"}, out); err == nil {
+		t.Error("Expected error for unknown subcommand")
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/c-pro/wallet-test/models"
+)
+
+// APIKeyService provides methods to manage API keys and authenticate requests
+type APIKeyService interface {
+	GetAPIKeys(ctx context.Context, tenantID int64) ([]models.APIKey, error)
+	IssueAPIKey(ctx context.Context, tenantID int64, name, role string, ownerID int64) (models.APIKey, string, error)
+	RevokeAPIKey(ctx context.Context, tenantID, id int64) error
+	Authenticate(ctx context.Context, key string) (models.APIKey, error)
+}
+
+// apiKeyService implements interface above
+type apiKeyService struct {
+	db *sql.DB
+}
+
+// GetAPIKeys returns all tenant's API keys in database
+func (k *apiKeyService) GetAPIKeys(ctx context.Context, tenantID int64) ([]models.APIKey, error) {
+	tx, err := k.db.BeginTx(ctx, nil)
+	if err != nil {
+		return []models.APIKey{}, err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	return models.GetAPIKeys(ctx, tx, tenantID)
+}
+
+// IssueAPIKey creates a new API key and returns it along with its record
+func (k *apiKeyService) IssueAPIKey(ctx context.Context, tenantID int64, name, role string, ownerID int64) (models.APIKey, string, error) {
+	tx, err := k.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.APIKey{}, "", err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	apiKey, key, err := models.IssueAPIKey(ctx, tx, tenantID, name, role, ownerID)
+	if err != nil {
+		return apiKey, "", err
+	}
+	return apiKey, key, models.Commit(ctx, tx, tenantID, models.AuditObject("api_key", apiKey.ID))
+}
+
+// RevokeAPIKey revokes tenant's API key with given ID
+func (k *apiKeyService) RevokeAPIKey(ctx context.Context, tenantID, id int64) error {
+	tx, err := k.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	if err := models.RevokeAPIKey(ctx, tx, tenantID, id); err != nil {
+		return err
+	}
+	return models.Commit(ctx, tx, tenantID, models.AuditObject("api_key", id))
+}
+
+// Authenticate returns active API key record matching the key
+func (k *apiKeyService) Authenticate(ctx context.Context, key string) (models.APIKey, error) {
+	tx, err := k.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.APIKey{}, err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	return models.GetAPIKeyByKey(ctx, tx, key)
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/c-pro/wallet-test/logging"
+	"github.com/c-pro/wallet-test/models"
+	"github.com/go-kit/kit/endpoint"
+)
+
+type getAuditLogResponse struct {
+	Entries []models.AuditEntry `json:"Entries,omitempty"`
+}
+
+// auditRequest is what audit log needs to know about HTTP request
+type auditRequest struct {
+	RemoteIP   string
+	BodySHA256 string
+}
+
+type auditRequestContextKey struct{}
+
+// withAuditRequest remembers client IP and SHA-256 of request body for audit log.
+// Body is read into memory and replaced with a copy, so it can be decoded as usual.
+// It runs after authentication, so bodies of anonymous requests are never buffered,
+// and bodies larger than maxRequestBody are rejected.
+func withAuditRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req := auditRequest{RemoteIP: r.RemoteAddr}
+		if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			req.RemoteIP = host
+		}
+		if r.Body != nil && r.Method != "GET" && r.Method != "HEAD" {
+			body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxRequestBody))
+			r.Body.Close()
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeError(w, r, errorResponse{"Request body is too large", 413})
+				return
+			}
+			if err != nil {
+				writeError(w, r, errorResponse{"Failed to read request body", 400})
+				return
+			}
+			r.Body = ioutil.NopCloser(bytes.NewReader(body))
+			sum := sha256.Sum256(body)
+			req.BodySHA256 = hex.EncodeToString(sum[:])
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), auditRequestContextKey{}, req)))
+	})
+}
+
+// audited is an endpoint middleware recording action in audit log.
+// Changes are recorded by models.Commit in the same transaction, failed attempts
+// including denied ones are recorded separately. It does nothing if svc is nil,
+// i.e. when storage backend has no audit log.
+func audited(svc AuditService, action string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		if svc == nil {
+			return next
+		}
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			p, _ := principalFromContext(ctx)
+			req, _ := ctx.Value(auditRequestContextKey{}).(auditRequest)
+			e := &models.AuditEntry{TenantID: p.TenantID,
+				Principal:  p.Name,
+				Role:       p.Role,
+				KeyID:      p.KeyID,
+				Action:     action,
+				RemoteIP:   req.RemoteIP,
+				RequestID:  logging.RequestID(ctx),
+				BodySHA256: req.BodySHA256}
+
+			response, err := next(models.WithAudit(ctx, e), request)
+			if e.Written() {
+				return response, err
+			}
+			e.Outcome = models.AuditOK
+			if errResp, ok := response.(errorResponse); ok {
+				e.Outcome = errResp.Error
+			}
+			if err != nil {
+				e.Outcome = err.Error()
+			}
+			// request context can already be canceled, but the attempt still has to be recorded
+			if recErr := svc.Record(context.Background(), e); recErr != nil {
+				logging.FromContext(ctx).Log("msg", "failed to write audit log", "action", action, "err", recErr)
+			}
+			return response, err
+		}
+	}
+}
+
+type getAuditLogRequest struct {
+	Filter models.AuditFilter
+}
+
+func makeGetAuditLogEndpoint(svc AuditService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getAuditLogRequest)
+		entries, err := svc.GetAuditLog(ctx, tenantFromContext(ctx), req.Filter)
+		if err != nil {
+			return errorResponse{err.Error(), 500}, nil
+		}
+		return getAuditLogResponse{entries}, nil
+	}
+}
+
+// decodeGetAuditLogRequest reads filter from action, principal, since, until
+// and limit query parameters. Times are in RFC 3339 format.
+func decodeGetAuditLogRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	filter := models.AuditFilter{Action: q.Get("action"), Principal: q.Get("principal")}
+	var err error
+	if s := q.Get("since"); s != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, s); err != nil {
+			return nil, errBadRequest
+		}
+	}
+	if s := q.Get("until"); s != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, s); err != nil {
+			return nil, errBadRequest
+		}
+	}
+	if s := q.Get("limit"); s != "" {
+		if filter.Limit, err = strconv.Atoi(s); err != nil {
+			return nil, errBadRequest
+		}
+	}
+	return getAuditLogRequest{filter}, nil
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/c-pro/wallet-test/models"
+)
+
+// auditRecorder keeps entries recorded outside of transactions
+type auditRecorder struct {
+	entries []*models.AuditEntry
+}
+
+func (a *auditRecorder) Record(_ context.Context, e *models.AuditEntry) error {
+	a.entries = append(a.entries, e)
+	return nil
+}
+
+func (a *auditRecorder) GetAuditLog(context.Context, int64, models.AuditFilter) ([]models.AuditEntry, error) {
+	return nil, nil
+}
+
+func TestWithAuditRequest(t *testing.T) {
+	body := `{"Name":"x"}`
+	var req auditRequest
+	var decoded string
+	h := withAuditRequest(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, _ = r.Context().Value(auditRequestContextKey{}).(auditRequest)
+		b, _ := ioutil.ReadAll(r.Body)
+		decoded = string(b)
+	}))
+	r := httptest.NewRequest("POST", "/owners", strings.NewReader(body))
+	r.RemoteAddr = "10.1.2.3:5555"
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	sum := sha256.Sum256([]byte(body))
+	if req.BodySHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected body hash %x, got %q", sum, req.BodySHA256)
+	}
+	if req.RemoteIP != "10.1.2.3" {
+		t.Errorf("Expected remote IP 10.1.2.3, got %q", req.RemoteIP)
+	}
+	if decoded != body {
+		t.Errorf("Expected handler to read the same body, got %q", decoded)
+	}
+
+	w := httptest.NewRecorder()
+	decoded = ""
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/owners", strings.NewReader(strings.Repeat("x", maxRequestBody+1))))
+	if w.Code != 413 || decoded != "" {
+		t.Errorf("Expected too large body to be rejected with 413, got %d", w.Code)
+	}
+}
+
+func TestAnonymousBodyIsNotRead(t *testing.T) {
+	h := makeHandlers(nil, newMemoryRepository(), testVerifier())
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("POST", "/accounts", strings.NewReader(strings.Repeat("x", maxRequestBody+1))))
+	if w.Code != 401 {
+		t.Errorf("Expected anonymous request to be rejected with 401 before reading body, got %d", w.Code)
+	}
+}
+
+func TestAudited(t *testing.T) {
+	rec := &auditRecorder{}
+	ctx := withPrincipal(context.Background(), principal{KeyID: 7, TenantID: 2, Name: "ops", Role: models.RoleAdmin})
+	ctx = context.WithValue(ctx, auditRequestContextKey{}, auditRequest{RemoteIP: "10.1.2.3"})
+
+	denied := audited(rec, "owner.create")(func(context.Context, interface{}) (interface{}, error) {
+		return errorResponse{"Forbidden", 403}, nil
+	})
+	if _, err := denied(ctx, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	failed := audited(rec, "owner.create")(func(context.Context, interface{}) (interface{}, error) {
+		return nil, errors.New("boom")
+	})
+	if _, err := failed(ctx, nil); err == nil {
+		t.Fatal("Expected endpoint error to be returned")
+	}
+	// entry was not written by models.Commit, e.g. nothing was committed
+	succeeded := audited(rec, "owner.create")(func(context.Context, interface{}) (interface{}, error) {
+		return nil, nil
+	})
+	if _, err := succeeded(ctx, nil); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if len(rec.entries) != 3 {
+		t.Fatalf("Expected 3 recorded entries, got %d", len(rec.entries))
+	}
+	e := rec.entries[0]
+	if e.Outcome != "Forbidden" || e.Principal != "ops" || e.TenantID != 2 || e.KeyID != 7 ||
+		e.Action != "owner.create" || e.RemoteIP != "10.1.2.3" {
+		t.Errorf("Unexpected entry of denied request %+v", e)
+	}
+	if rec.entries[1].Outcome != "boom" {
+		t.Errorf("Expected failed request outcome boom, got %q", rec.entries[1].Outcome)
+	}
+	if rec.entries[2].Outcome != models.AuditOK {
+		t.Errorf("Expected outcome %q, got %q", models.AuditOK, rec.entries[2].Outcome)
+	}
+}
+
+func TestDecodeGetAuditLogRequest(t *testing.T) {
+	r := httptest.NewRequest("GET", "/admin/audit?action=payment.create&since=2020-01-02T03:04:05Z&limit=10", nil)
+	req, err := decodeGetAuditLogRequest(context.Background(), r)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	filter := req.(getAuditLogRequest).Filter
+	if filter.Action != "payment.create" || filter.Limit != 10 || filter.Since.Year() != 2020 || !filter.Until.IsZero() {
+		t.Errorf("Unexpected filter %+v", filter)
+	}
+
+	for _, q := range []string{"since=yesterday", "until=1", "limit=ten"} {
+		if _, err := decodeGetAuditLogRequest(context.Background(), httptest.NewRequest("GET", "/admin/audit?"+q, nil)); err != errBadRequest {
+			t.Errorf("Expected errBadRequest for %s, got %v", q, err)
+		}
+	}
+}
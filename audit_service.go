@@ -0,0 +1,124 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/c-pro/wallet-test/models"
+)
+
+// AuditService provides methods to record and read audit log
+type AuditService interface {
+	Record(ctx context.Context, e *models.AuditEntry) error
+	GetAuditLog(ctx context.Context, tenantID int64, filter models.AuditFilter) ([]models.AuditEntry, error)
+}
+
+// auditService implements interface above
+type auditService struct {
+	db *sql.DB
+}
+
+// Record writes audit entry of an operation which did not commit its own,
+// e.g. because it failed
+func (a *auditService) Record(ctx context.Context, e *models.AuditEntry) error {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	if err := e.Save(ctx, tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetAuditLog returns tenant's audit entries matching filter
+func (a *auditService) GetAuditLog(ctx context.Context, tenantID int64, filter models.AuditFilter) ([]models.AuditEntry, error) {
+	tx, err := a.db.BeginTx(ctx, nil)
+	if err != nil {
+		return []models.AuditEntry{}, err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	return models.GetAuditLog(ctx, tx, tenantID, filter)
+}
+
+// cliActions are audit actions of admin commands changing data
+var cliActions = map[string]string{
+	"account create":   "account.create",
+	"account freeze":   "account.freeze",
+	"account unfreeze": "account.unfreeze",
+	"payment make":     "payment.create",
+	"currency add":     "currency.create",
+	"tenant add":       "tenant.create",
+	"apikey issue":     "api_key.issue",
+	"apikey revoke":    "api_key.revoke",
+	"hmackey issue":    "hmac_key.issue",
+	"hmackey revoke":   "hmac_key.revoke",
+	"chain link":       "payment_chain.link",
+	"chain checkpoint": "payment_chain.checkpoint",
+}
+
+// errAuditRequired is returned by commands changing data when audit log is not kept
+var errAuditRequired = errors.New("command changes data and requires audit log, which is kept only by postgres storage backend")
+
+// newCLIAuditEntry returns audit entry of admin command or nil if the command does not change data.
+// Principal is the OS user running the command, arguments are hashed like request body.
+func newCLIAuditEntry(command string, args []string) *models.AuditEntry {
+	if len(args) == 0 {
+		return nil
+	}
+	action, ok := cliActions[command+" "+args[0]]
+	if !ok {
+		return nil
+	}
+	name := "unknown"
+	if u, err := user.Current(); err == nil {
+		name = u.Username
+	}
+	sum := sha256.Sum256([]byte(strings.Join(append([]string{command}, args...), "\x00")))
+	return &models.AuditEntry{TenantID: cliTenantID(args[1:]),
+		Principal:  "cli:" + name,
+		Role:       models.RoleAdmin,
+		Action:     action,
+		BodySHA256: hex.EncodeToString(sum[:])}
+}
+
+// cliTenantID returns tenant given by -tenant flag of command arguments, default tenant if it is not given.
+// Entry of a command failed on invalid arguments is still recorded with a tenant.
+func cliTenantID(args []string) int64 {
+	for i, arg := range args {
+		name := strings.TrimLeft(arg, "-")
+		if name == arg || len(arg)-len(name) > 2 {
+			continue
+		}
+		value := ""
+		if strings.HasPrefix(name, "tenant=") {
+			value = strings.TrimPrefix(name, "tenant=")
+		} else if name == "tenant" && i+1 < len(args) {
+			value = args[i+1]
+		} else {
+			continue
+		}
+		if id, err := strconv.ParseInt(value, 10, 64); err == nil && id > 0 {
+			return id
+		}
+		return models.DefaultTenantID
+	}
+	return models.DefaultTenantID
+}
+
+// cliAudit returns audit entry of admin command or nil if the command does not change data.
+// Commands changing data are refused when audit log is not kept (db is nil).
+func cliAudit(db *sql.DB, command string, args []string) (*models.AuditEntry, error) {
+	audit := newCLIAuditEntry(command, args)
+	if audit != nil && db == nil {
+		return nil, errAuditRequired
+	}
+	return audit, nil
+}
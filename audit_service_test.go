@@ -0,0 +1,58 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/c-pro/wallet-test/models"
+)
+
+func TestNewCLIAuditEntry(t *testing.T) {
+	for _, c := range []struct {
+		command string
+		args    []string
+		action  string
+		tenant  int64
+	}{
+		{command: "account", args: []string{"show", "1"}},
+		{command: "chain", args: []string{"verify", "-tenant", "2"}},
+		{command: "account", args: []string{"create", "-owner", "1", "-currency", "USD"}, action: "account.create", tenant: models.DefaultTenantID},
+		{command: "payment", args: []string{"make", "-tenant", "3", "1", "2", "10"}, action: "payment.create", tenant: 3},
+		{command: "apikey", args: []string{"issue", "--tenant=4", "-role", "admin", "ci"}, action: "api_key.issue", tenant: 4},
+		{command: "chain", args: []string{"link", "-tenant=5"}, action: "payment_chain.link", tenant: 5},
+		// failed runs with invalid arguments are recorded with the default tenant
+		{command: "account", args: []string{"freeze", "-tenant", "many", "1"}, action: "account.freeze", tenant: models.DefaultTenantID},
+		{command: "tenant", args: []string{"add", "acme"}, action: "tenant.create", tenant: models.DefaultTenantID},
+	} {
+		e := newCLIAuditEntry(c.command, c.args)
+		name := c.command + " " + strings.Join(c.args, " ")
+		if c.action == "" {
+			if e != nil {
+				t.Errorf("%s: expected no audit entry, got %+v", name, e)
+			}
+			continue
+		}
+		if e == nil {
+			t.Errorf("%s: expected audit entry", name)
+			continue
+		}
+		if e.Action != c.action || e.TenantID != c.tenant || e.Role != models.RoleAdmin || !strings.HasPrefix(e.Principal, "cli:") {
+			t.Errorf("%s: unexpected audit entry %+v", name, e)
+		}
+	}
+}
+
+func TestCLIAuditWithoutLog(t *testing.T) {
+	if _, err := cliAudit(nil, "payment", []string{"make", "1", "2", "10"}); err != errAuditRequired {
+		t.Errorf("Expected errAuditRequired without audit log, got %v", err)
+	}
+	e, err := cliAudit(nil, "account", []string{"show", "1"})
+	if err != nil || e != nil {
+		t.Errorf("Expected read only command to run without audit log, got %+v, %v", e, err)
+	}
+	e, err = cliAudit(&sql.DB{}, "account", []string{"create", "-owner", "1"})
+	if err != nil || e == nil {
+		t.Errorf("Expected audit entry with audit log, got %+v, %v", e, err)
+	}
+}
@@ -0,0 +1,305 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/c-pro/wallet-test/jwt"
+	"github.com/c-pro/wallet-test/models"
+	"github.com/c-pro/wallet-test/signing"
+	"github.com/go-kit/kit/endpoint"
+)
+
+// principal is an authenticated API client.
+// KeyID is zero for principals authenticated with JWT or HMAC signature.
+// All data principal can access is limited to its tenant.
+type principal struct {
+	KeyID    int64
+	TenantID int64
+	Name     string
+	Role     string
+	OwnerID  int64
+}
+
+type principalContextKey struct{}
+
+// withPrincipal returns a copy of ctx carrying authenticated principal
+func withPrincipal(ctx context.Context, p principal) context.Context {
+	return context.WithValue(ctx, principalContextKey{}, p)
+}
+
+// principalFromContext returns principal authenticated for the request
+func principalFromContext(ctx context.Context) (principal, bool) {
+	p, ok := ctx.Value(principalContextKey{}).(principal)
+	return p, ok
+}
+
+// tenantFromContext returns tenant of the principal authenticated for the request.
+// Endpoints are wrapped with authorize, so principal is always present there.
+func tenantFromContext(ctx context.Context) int64 {
+	p, _ := principalFromContext(ctx)
+	return p.TenantID
+}
+
+// apiKeyFromRequest extracts API key or JWT from either
+// "Authorization: Bearer <key>" or "X-API-Key: <key>" header
+func apiKeyFromRequest(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		parts := strings.SplitN(auth, " ", 2)
+		if len(parts) == 2 && strings.EqualFold(parts[0], "Bearer") {
+			return strings.TrimSpace(parts[1])
+		}
+		return ""
+	}
+	return r.Header.Get("X-API-Key")
+}
+
+// writeError writes errorResponse in the same way endpoints do
+func writeError(w http.ResponseWriter, r *http.Request, resp errorResponse) {
+	_ = encodeResponse(r.Context(), w, resp)
+}
+
+// principalFromClaims maps JWT claims to principal.
+// Tenant is taken from required "tenant_id" claim, role from "role" claim,
+// client's owner from "owner_id" claim.
+func principalFromClaims(claims jwt.Claims) (principal, error) {
+	tenantID, _ := claims.Int64("tenant_id")
+	if tenantID <= 0 {
+		return principal{}, errTenantRequired
+	}
+	role, _ := claims.String("role")
+	if !models.ValidRole(role) {
+		return principal{}, models.ErrInvalidRole
+	}
+	ownerID, _ := claims.Int64("owner_id")
+	if role == models.RoleClient && ownerID == 0 {
+		return principal{}, models.ErrOwnerRequired
+	}
+	subject, _ := claims.String("sub")
+	return principal{TenantID: tenantID, Name: subject, Role: role, OwnerID: ownerID}, nil
+}
+
+// errTenantRequired is returned for tokens without tenant
+var errTenantRequired = errors.New("Tenant is required")
+
+// isJWT tells JWT from API key, which never contains dots
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// authError is an authentication failure reported to the client with 401
+type authError struct {
+	msg string
+}
+
+func (e authError) Error() string {
+	return e.msg
+}
+
+// Signed requests settings
+const (
+	// signatureWindow is maximum allowed difference between signature timestamp and server time
+	signatureWindow = time.Minute * 5
+	// maxRequestBody limits size of request body read into memory
+	// to verify signature or to hash it for audit log
+	maxRequestBody = 1 << 20
+)
+
+// authenticator resolves principal from request credentials:
+// HMAC signature, JWT or API key
+type authenticator struct {
+	// API keys and signed requests are rejected if corresponding service is nil
+	apiKeys  APIKeyService
+	hmacKeys HMACKeyService
+	// JWT authentication is enabled only if verifier is not nil
+	verifier *jwt.Verifier
+}
+
+// authenticate returns principal for the request.
+// Errors of authError type should be reported to the client with 401.
+func (a *authenticator) authenticate(r *http.Request) (principal, error) {
+	if signing.IsSigned(r) {
+		if a.hmacKeys == nil {
+			return principal{}, authError{"Signed requests are not supported"}
+		}
+		return a.authenticateSigned(r)
+	}
+	token := apiKeyFromRequest(r)
+	if token == "" {
+		return principal{}, authError{"API key required"}
+	}
+	if a.verifier != nil && isJWT(token) {
+		claims, err := a.verifier.Verify(token)
+		if err != nil {
+			return principal{}, authError{"Invalid token: " + err.Error()}
+		}
+		p, err := principalFromClaims(claims)
+		if err != nil {
+			return principal{}, authError{"Invalid token: " + err.Error()}
+		}
+		return p, nil
+	}
+	if a.apiKeys == nil {
+		return principal{}, authError{"Invalid API key"}
+	}
+	apiKey, err := a.apiKeys.Authenticate(r.Context(), token)
+	if err == sql.ErrNoRows {
+		return principal{}, authError{"Invalid API key"}
+	}
+	if err != nil {
+		return principal{}, err
+	}
+	return principal{
+		KeyID:    apiKey.ID,
+		TenantID: apiKey.TenantID,
+		Name:     apiKey.Name,
+		Role:     apiKey.Role,
+		OwnerID:  apiKey.OwnerID,
+	}, nil
+}
+
+// authenticateSigned verifies HMAC signature of the request.
+// Nonce is recorded only after signature is verified, so it is not
+// possible to exhaust nonces of another client.
+func (a *authenticator) authenticateSigned(r *http.Request) (principal, error) {
+	signed, err := signing.Parse(r, maxRequestBody)
+	if err != nil {
+		return principal{}, authError{err.Error()}
+	}
+	if !signed.Fresh(time.Now(), signatureWindow) {
+		return principal{}, authError{"Signature timestamp is out of allowed window"}
+	}
+	keyID, err := strconv.ParseInt(signed.KeyID, 10, 64)
+	if err != nil {
+		return principal{}, authError{"Invalid signature key"}
+	}
+	hmacKey, err := a.hmacKeys.GetActiveHMACKey(r.Context(), keyID)
+	if err == sql.ErrNoRows {
+		return principal{}, authError{"Invalid signature key"}
+	}
+	if err != nil {
+		return principal{}, err
+	}
+	if !signed.Valid(hmacKey.Secret) {
+		return principal{}, authError{"Invalid signature"}
+	}
+	err = a.hmacKeys.UseNonce(r.Context(), keyID, signed.Nonce, signed.Timestamp.Add(signatureWindow))
+	if err == models.ErrNonceReused {
+		return principal{}, authError{"Request replay detected"}
+	}
+	if err != nil {
+		return principal{}, err
+	}
+	return principal{
+		TenantID: hmacKey.TenantID,
+		Name:     hmacKey.Name,
+		Role:     hmacKey.Role,
+		OwnerID:  hmacKey.OwnerID,
+	}, nil
+}
+
+// middleware rejects requests without valid credentials
+// and puts authenticated principal into request context
+func (a *authenticator) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p, err := a.authenticate(r)
+		if _, ok := err.(authError); ok {
+			writeError(w, r, errorResponse{err.Error(), 401})
+			return
+		}
+		if err != nil {
+			writeError(w, r, errorResponse{err.Error(), 500})
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(withPrincipal(r.Context(), p)))
+	})
+}
+
+// policy decides if principal is allowed to call an endpoint with a given request
+type policy func(ctx context.Context, p principal, request interface{}) (bool, error)
+
+// authorize is an endpoint middleware enforcing access policy.
+// Denied requests get 403 in the errorResponse format.
+func authorize(pol policy) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			p, ok := principalFromContext(ctx)
+			if !ok {
+				return errorResponse{"Unauthorized", 401}, nil
+			}
+			allowed, err := pol(ctx, p, request)
+			if err != nil {
+				return errorResponse{err.Error(), 500}, nil
+			}
+			if !allowed {
+				return errorResponse{"Forbidden", 403}, nil
+			}
+			return next(ctx, request)
+		}
+	}
+}
+
+// allowRoles allows principals having one of the roles
+func allowRoles(roles ...string) policy {
+	return func(_ context.Context, p principal, _ interface{}) (bool, error) {
+		for _, role := range roles {
+			if p.Role == role {
+				return true, nil
+			}
+		}
+		return false, nil
+	}
+}
+
+// anyOf allows request if at least one of policies allows it
+func anyOf(policies ...policy) policy {
+	return func(ctx context.Context, p principal, request interface{}) (bool, error) {
+		for _, pol := range policies {
+			allowed, err := pol(ctx, p, request)
+			if err != nil || allowed {
+				return allowed, err
+			}
+		}
+		return false, nil
+	}
+}
+
+// clientOwnOwner allows clients to access their own owner resources
+func clientOwnOwner(_ context.Context, p principal, request interface{}) (bool, error) {
+	req, ok := request.(getOwnerRequest)
+	return ok && p.Role == models.RoleClient && req.OwnerID == p.OwnerID, nil
+}
+
+// clientOwnBuyer allows clients to make payments only from accounts of their owner
+func clientOwnBuyer(svc AccountService) policy {
+	return func(ctx context.Context, p principal, request interface{}) (bool, error) {
+		req, ok := request.(makePaymentRequest)
+		if !ok || p.Role != models.RoleClient {
+			return false, nil
+		}
+		if req.BuyerOwnerID != 0 {
+			return req.BuyerOwnerID == p.OwnerID, nil
+		}
+		buyer, err := svc.GetAccount(ctx, p.TenantID, req.BuyerAccountID)
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return buyer.OwnerID == p.OwnerID, nil
+	}
+}
+
+// Access policies shared by endpoints
+var (
+	canRead   = allowRoles(models.RoleAdmin, models.RoleAuditor, models.RoleOperator)
+	canCreate = allowRoles(models.RoleAdmin, models.RoleOperator)
+	canAdmin  = allowRoles(models.RoleAdmin)
+	canAudit  = allowRoles(models.RoleAdmin, models.RoleAuditor)
+)
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c-pro/wallet-test/models"
+	"github.com/shopspring/decimal"
+)
+
+func getStatus(t *testing.T, c *http.Client, method, route string) (int, errorResponse) {
+	return requestStatus(t, c, method, route, "")
+}
+
+func requestStatus(t *testing.T, c *http.Client, method, route, body string) (int, errorResponse) {
+	req, err := http.NewRequest(method, URL(route), strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := c.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error in %s request: %s", method, err)
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	errResp := errorResponse{}
+	if res.StatusCode != 200 {
+		if err := json.Unmarshal(b, &errResp); err != nil {
+			t.Fatalf("Failed to unmarshal error response %q: %v", b, err)
+		}
+	}
+	return res.StatusCode, errResp
+}
+
+func TestUnauthenticated(t *testing.T) {
+	code, errResp := getStatus(t, http.DefaultClient, "GET", "/accounts")
+	if code != 401 {
+		t.Errorf("Expected status code 401, got %d", code)
+	}
+	if errResp.Error == "" {
+		t.Error("Expected error message in response")
+	}
+
+	code, _ = getStatus(t, newClient("not a key"), "GET", "/accounts")
+	if code != 401 {
+		t.Errorf("Expected status code 401 for invalid key, got %d", code)
+	}
+}
+
+func TestAPIKeyLifecycle(t *testing.T) {
+	requireDB(t)
+	issued := issueAPIKeyResponse{}
+	postSomething(t, "/admin/api-keys", fmt.Sprintf(`{"Name": "%s", "Role": "auditor"}`, randomName()), &issued)
+	if issued.Key == "" || issued.ID == 0 {
+		t.Fatalf("Expected issued key and ID, got %+v", issued)
+	}
+
+	c := newClient(issued.Key)
+	if code, _ := getStatus(t, c, "GET", "/accounts"); code != 200 {
+		t.Errorf("Expected status code 200 with issued key, got %d", code)
+	}
+
+	if code, _ := getStatus(t, c, "GET", "/admin/api-keys"); code != 403 {
+		t.Errorf("Expected non admin key to get 403, got %d", code)
+	}
+
+	keysResp := getAPIKeysResponse{}
+	getSomething(t, "/admin/api-keys", &keysResp)
+	found := false
+	for _, k := range keysResp.APIKeys {
+		if k.ID == issued.ID {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Errorf("API key %d was not found in GET /admin/api-keys result", issued.ID)
+	}
+
+	route := fmt.Sprintf("/admin/api-key/%d", issued.ID)
+	if code, _ := getStatus(t, client, "DELETE", route); code != 200 {
+		t.Fatalf("Expected status code 200 on revoke, got %d", code)
+	}
+
+	if code, _ := getStatus(t, c, "GET", "/accounts"); code != 401 {
+		t.Errorf("Expected revoked key to get 401, got %d", code)
+	}
+
+	if code, _ := getStatus(t, client, "DELETE", route); code != 404 {
+		t.Errorf("Expected second revoke to return 404, got %d", code)
+	}
+}
+
+func issueTestKey(t *testing.T, role string, ownerID int64) *http.Client {
+	issued := issueAPIKeyResponse{}
+	postSomething(t, "/admin/api-keys", fmt.Sprintf(`{"Name": "%s", "Role": "%s", "OwnerID": %d}`,
+		randomName(), role, ownerID), &issued)
+	return newClient(issued.Key)
+}
+
+func TestRoles(t *testing.T) {
+	requireDB(t)
+	owner := addTestOwner(t)
+	other := addTestOwner(t)
+	addTestOwnerAccount(t, owner.ID, decimal.New(10, 0))
+	addTestOwnerAccount(t, other.ID, decimal.New(10, 0))
+
+	ownAccounts := getAccountsResponse{}
+	getSomething(t, fmt.Sprintf("/owner/%d/accounts", owner.ID), &ownAccounts)
+	otherAccounts := getAccountsResponse{}
+	getSomething(t, fmt.Sprintf("/owner/%d/accounts", other.ID), &otherAccounts)
+	ownID := ownAccounts.Accounts[0].ID
+	otherID := otherAccounts.Accounts[0].ID
+
+	newAccount := fmt.Sprintf(`{"Name": "%s", "Amount": "1", "CurrencyId": 3}`, randomName())
+	payment := func(buyer, seller int64) string {
+		return fmt.Sprintf(`{"BuyerAccountID": %d, "SellerAccountID": %d, "Amount": "1"}`, buyer, seller)
+	}
+	deposit := fmt.Sprintf("/account/%d/deposits", ownID)
+
+	cases := []struct {
+		role   string
+		method string
+		route  string
+		body   string
+		code   int
+	}{
+		{models.RoleAuditor, "GET", "/accounts", "", 200},
+		{models.RoleAuditor, "GET", "/payments", "", 200},
+		{models.RoleAuditor, "POST", "/accounts", newAccount, 403},
+		{models.RoleAuditor, "POST", "/payments", payment(ownID, otherID), 403},
+		{models.RoleAuditor, "GET", "/admin/api-keys", "", 403},
+		{models.RoleAuditor, "POST", deposit, `{"Amount": "1"}`, 403},
+		{models.RoleOperator, "GET", "/accounts", "", 200},
+		{models.RoleOperator, "POST", "/accounts", newAccount, 200},
+		{models.RoleOperator, "POST", "/owners", `{"Name": "op"}`, 200},
+		{models.RoleOperator, "POST", "/payments", payment(ownID, otherID), 403},
+		{models.RoleOperator, "POST", deposit, `{"Amount": "1"}`, 200},
+		{models.RoleClient, "GET", "/accounts", "", 403},
+		{models.RoleClient, "POST", "/accounts", newAccount, 403},
+		{models.RoleClient, "GET", fmt.Sprintf("/owner/%d/holdings", owner.ID), "", 200},
+		{models.RoleClient, "GET", fmt.Sprintf("/owner/%d/holdings", other.ID), "", 403},
+		{models.RoleClient, "POST", "/payments", payment(otherID, ownID), 403},
+		{models.RoleClient, "POST", "/payments", payment(ownID, otherID), 200},
+		{models.RoleClient, "POST", deposit, `{"Amount": "1"}`, 403},
+	}
+
+	clients := map[string]*http.Client{}
+	for _, c := range cases {
+		if _, ok := clients[c.role]; !ok {
+			clients[c.role] = issueTestKey(t, c.role, owner.ID)
+		}
+		code, errResp := requestStatus(t, clients[c.role], c.method, c.route, c.body)
+		if code != c.code {
+			t.Errorf("%s %s %s: expected status code %d, got %d (%s)",
+				c.role, c.method, c.route, c.code, code, errResp.Error)
+		}
+	}
+}
+
+// signTestToken makes HS256 token signed with jwtSecret
+func signTestToken(claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": "HS256", "kid": "test"})
+	payload, _ := json.Marshal(claims)
+	signed := base64.RawURLEncoding.EncodeToString(header) + "." +
+		base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, jwtSecret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+func TestJWTAuth(t *testing.T) {
+	requireDB(t)
+	owner := addTestOwner(t)
+	exp := time.Now().Add(time.Minute).Unix()
+
+	auditor := newClient(signTestToken(map[string]interface{}{
+		"iss": "test", "sub": "auditor", "exp": exp, "tenant_id": 1, "role": "auditor"}))
+	if code, errResp := getStatus(t, auditor, "GET", "/accounts"); code != 200 {
+		t.Errorf("Expected auditor token to get 200, got %d (%s)", code, errResp.Error)
+	}
+	if code, _ := requestStatus(t, auditor, "POST", "/owners", `{"Name": "x"}`); code != 403 {
+		t.Errorf("Expected auditor token to get 403 on POST, got %d", code)
+	}
+
+	ownerClient := newClient(signTestToken(map[string]interface{}{
+		"iss": "test", "sub": "user", "exp": exp, "tenant_id": 1, "role": "client", "owner_id": owner.ID}))
+	route := fmt.Sprintf("/owner/%d/holdings", owner.ID)
+	if code, errResp := getStatus(t, ownerClient, "GET", route); code != 200 {
+		t.Errorf("Expected client token to read own holdings, got %d (%s)", code, errResp.Error)
+	}
+
+	invalid := []map[string]interface{}{
+		{"iss": "test", "exp": time.Now().Add(-time.Minute).Unix(), "tenant_id": 1, "role": "auditor"},
+		{"iss": "other", "exp": exp, "tenant_id": 1, "role": "auditor"},
+		{"iss": "test", "exp": exp, "tenant_id": 1, "role": "root"},
+		{"iss": "test", "exp": exp, "tenant_id": 1, "role": "client"},
+		{"iss": "test", "exp": exp, "role": "auditor"},
+	}
+	for _, claims := range invalid {
+		c := newClient(signTestToken(claims))
+		if code, _ := getStatus(t, c, "GET", "/accounts"); code != 401 {
+			t.Errorf("Expected token with claims %v to get 401, got %d", claims, code)
+		}
+	}
+}
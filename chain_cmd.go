@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+const chainUsage = `Usage:
+  wallet chain link [-tenant <tenant id>]
+  wallet chain verify [-tenant <tenant id>] [-public-key <hex>]
+  wallet chain checkpoint [-tenant <tenant id>]
+  wallet chain checkpoints [-tenant <tenant id>]`
+
+var errChainBroken = errors.New("payment chain is broken")
+
+// runChainCommand verifies payment hash chain and manages its signed checkpoints
+func runChainCommand(ctx context.Context, svc ChainService, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%v\n%s", errUnknownCommand, chainUsage)
+	}
+	switch args[0] {
+	case "link":
+		tenantID, err := parseTenantArgs(args[1:], out)
+		if err != nil {
+			return err
+		}
+		linked, err := svc.ChainPayments(ctx, tenantID)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Linked %d payments\n", linked)
+		return nil
+	case "verify":
+		fs, tenantID := newTenantFlagSet("verify", out)
+		publicKey := fs.String("public-key", "", "checkpoint public key in hex, configured key is used by default")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		key := svc.PublicKey()
+		if *publicKey != "" {
+			var err error
+			if key, err = parsePublicKey(*publicKey); err != nil {
+				return err
+			}
+		}
+		report, err := svc.VerifyPaymentChain(ctx, *tenantID, key)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "payments=%d\tunchained=%d\tcheckpoints=%d\thead=%d\t%s\n",
+			report.Payments, report.Unchained, report.Checkpoints, report.HeadPaymentID, report.HeadHash)
+		if key == nil {
+			fmt.Fprintln(out, "checkpoint signatures were not verified, public key is not configured")
+		}
+		if report.Broken != nil {
+			fmt.Fprintf(out, "payment %d: %s\n", report.Broken.PaymentID, report.Broken.Reason)
+			return errChainBroken
+		}
+		return nil
+	case "checkpoint":
+		tenantID, err := parseTenantArgs(args[1:], out)
+		if err != nil {
+			return err
+		}
+		checkpoint, created, err := svc.MakeCheckpoint(ctx, tenantID)
+		if err != nil {
+			return err
+		}
+		if !created {
+			fmt.Fprintln(out, "No new payments since the last checkpoint")
+			return nil
+		}
+		fmt.Fprintf(out, "Checkpoint %d signed payment %d %s with public key %s\n",
+			checkpoint.ID, checkpoint.PaymentID, checkpoint.Hash, hex.EncodeToString(svc.PublicKey()))
+		return nil
+	case "checkpoints":
+		tenantID, err := parseTenantArgs(args[1:], out)
+		if err != nil {
+			return err
+		}
+		checkpoints, err := svc.GetCheckpoints(ctx, tenantID)
+		if err != nil {
+			return err
+		}
+		for _, c := range checkpoints {
+			fmt.Fprintf(out, "%d\t%s\tpayment=%d\t%s\tkey=%s\n",
+				c.ID, c.CreatedAt.UTC().Format(time.RFC3339), c.PaymentID, c.Hash, c.PublicKey)
+		}
+		return nil
+	}
+	return fmt.Errorf("%v %q\n%s", errUnknownCommand, args[0], chainUsage)
+}
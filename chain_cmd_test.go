@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/c-pro/wallet-test/models"
+)
+
+// fakeChainService reports the same chain for every tenant
+type fakeChainService struct {
+	report  models.ChainReport
+	usedKey ed25519.PublicKey
+	linked  int
+}
+
+func (f *fakeChainService) ChainPayments(context.Context, int64) (int, error) {
+	return f.linked, nil
+}
+
+func (f *fakeChainService) VerifyPaymentChain(_ context.Context, _ int64, key ed25519.PublicKey) (models.ChainReport, error) {
+	f.usedKey = key
+	return f.report, nil
+}
+
+func (f *fakeChainService) MakeCheckpoint(context.Context, int64) (models.Checkpoint, bool, error) {
+	return models.Checkpoint{}, false, nil
+}
+
+func (f *fakeChainService) GetCheckpoints(context.Context, int64) ([]models.Checkpoint, error) {
+	return nil, nil
+}
+
+func (f *fakeChainService) PublicKey() ed25519.PublicKey {
+	return nil
+}
+
+func TestChainVerifyCommand(t *testing.T) {
+	svc := &fakeChainService{report: models.ChainReport{Payments: 2, HeadPaymentID: 7, HeadHash: "ab"}}
+	out := &bytes.Buffer{}
+	if err := runChainCommand(context.Background(), svc, []string{"verify"}, out); err != nil {
+		t.Fatalf("Unexpected error in chain verify: %v", err)
+	}
+	if !strings.Contains(out.String(), "payments=2") || !strings.Contains(out.String(), "not verified") {
+		t.Errorf("Unexpected chain verify output %q", out.String())
+	}
+
+	public, _, _ := ed25519.GenerateKey(nil)
+	svc.report.Broken = &models.ChainBreak{PaymentID: 5, Reason: "hash does not match payment contents"}
+	out.Reset()
+	err := runChainCommand(context.Background(), svc, []string{"verify", "-public-key", hex.EncodeToString(public)}, out)
+	if err != errChainBroken {
+		t.Errorf("Expected errChainBroken, got %v", err)
+	}
+	if !bytes.Equal(svc.usedKey, public) {
+		t.Error("Expected chain to be verified with the given public key")
+	}
+	if !strings.Contains(out.String(), "payment 5: hash does not match") {
+		t.Errorf("Expected broken link in output, got %q", out.String())
+	}
+
+	if err := runChainCommand(context.Background(), svc, []string{"verify", "-public-key", "xyz"}, out); err == nil {
+		t.Error("Expected error for invalid public key")
+	}
+}
+
+func TestChainLinkCommand(t *testing.T) {
+	out := &bytes.Buffer{}
+	if err := runChainCommand(context.Background(), &fakeChainService{linked: 3}, []string{"link"}, out); err != nil {
+		t.Fatalf("Unexpected error in chain link: %v", err)
+	}
+	if out.String() != "Linked 3 payments\n" {
+		t.Errorf("Unexpected chain link output %q", out.String())
+	}
+}
+
+func TestLoadCheckpointKey(t *testing.T) {
+	if key, err := loadCheckpointKey(""); key != nil || err != nil {
+		t.Errorf("Expected no key if file is not configured, got %v, %v", key, err)
+	}
+
+	dir, err := ioutil.TempDir("", "chain")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	seed := bytes.Repeat([]byte{7}, ed25519.SeedSize)
+	path := filepath.Join(dir, "chain.key")
+	if err := ioutil.WriteFile(path, []byte(hex.EncodeToString(seed)+"\n"), 0600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+	key, err := loadCheckpointKey(path)
+	if err != nil {
+		t.Fatalf("Unexpected error in loadCheckpointKey: %v", err)
+	}
+	if !key.Equal(ed25519.NewKeyFromSeed(seed)) {
+		t.Error("Expected key derived from the seed in file")
+	}
+
+	if err := ioutil.WriteFile(path, []byte("abc"), 0600); err != nil {
+		t.Fatalf("Failed to write key file: %v", err)
+	}
+	if _, err := loadCheckpointKey(path); err == nil {
+		t.Error("Expected error for malformed key file")
+	}
+}
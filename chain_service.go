@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"time"
+
+	"github.com/c-pro/wallet-test/logging"
+	"github.com/c-pro/wallet-test/models"
+)
+
+var errNoCheckpointKey = errors.New("checkpoint key is not configured (chain.checkpoint_key_file)")
+
+// ChainService provides methods to verify payment chain and sign its checkpoints
+type ChainService interface {
+	// ChainPayments links new tenant's payments into the chain and returns how many were linked
+	ChainPayments(ctx context.Context, tenantID int64) (int, error)
+	VerifyPaymentChain(ctx context.Context, tenantID int64, key ed25519.PublicKey) (models.ChainReport, error)
+	MakeCheckpoint(ctx context.Context, tenantID int64) (models.Checkpoint, bool, error)
+	GetCheckpoints(ctx context.Context, tenantID int64) ([]models.Checkpoint, error)
+	// PublicKey returns public key of checkpoint signing key or nil if it is not configured
+	PublicKey() ed25519.PublicKey
+}
+
+// chainService implements interface above
+type chainService struct {
+	db *sql.DB
+	// key signs checkpoints, nil if not configured
+	key ed25519.PrivateKey
+}
+
+// loadCheckpointKey reads ed25519 private key seed in hex from file.
+// Returns nil key if file is not configured.
+func loadCheckpointKey(path string) (ed25519.PrivateKey, error) {
+	if path == "" {
+		return nil, nil
+	}
+	body, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	seed, err := hex.DecodeString(strings.TrimSpace(string(body)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, errors.New("checkpoint key file should contain 32 byte ed25519 seed in hex")
+	}
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+// parsePublicKey parses hex encoded ed25519 public key
+func parsePublicKey(s string) (ed25519.PublicKey, error) {
+	key, err := hex.DecodeString(s)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return nil, errors.New("public key should be 32 bytes in hex")
+	}
+	return ed25519.PublicKey(key), nil
+}
+
+// VerifyPaymentChain checks tenant's payment chain in a consistent snapshot of the database
+func (c *chainService) VerifyPaymentChain(ctx context.Context, tenantID int64, key ed25519.PublicKey) (models.ChainReport, error) {
+	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return models.ChainReport{}, err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	return models.VerifyPaymentChain(ctx, tx, tenantID, key)
+}
+
+// ChainPayments links new tenant's payments into the chain
+func (c *chainService) ChainPayments(ctx context.Context, tenantID int64) (int, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	linked, err := models.ChainPayments(ctx, tx, tenantID)
+	if err != nil || linked == 0 {
+		return 0, err
+	}
+	return linked, tx.Commit()
+}
+
+// MakeCheckpoint links new payments and signs current chain head of the tenant.
+// Returns false if nothing was paid since the last checkpoint.
+func (c *chainService) MakeCheckpoint(ctx context.Context, tenantID int64) (models.Checkpoint, bool, error) {
+	if c.key == nil {
+		return models.Checkpoint{}, false, errNoCheckpointKey
+	}
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Checkpoint{}, false, err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	checkpoint, created, err := models.MakeCheckpoint(ctx, tx, tenantID, c.key)
+	if err != nil || !created {
+		return checkpoint, created, err
+	}
+	return checkpoint, true, models.Commit(ctx, tx, tenantID, models.AuditObject("checkpoint", checkpoint.ID))
+}
+
+// GetCheckpoints returns all tenant's checkpoints
+func (c *chainService) GetCheckpoints(ctx context.Context, tenantID int64) ([]models.Checkpoint, error) {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return []models.Checkpoint{}, err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	return models.GetCheckpoints(ctx, tx, tenantID)
+}
+
+// PublicKey returns public key of checkpoint signing key
+func (c *chainService) PublicKey() ed25519.PublicKey {
+	if c.key == nil {
+		return nil
+	}
+	return c.key.Public().(ed25519.PublicKey)
+}
+
+// runPaymentChaining periodically links new payments of all tenants into their chains until ctx is done
+func runPaymentChaining(ctx context.Context, svc ChainService, tenants TenantService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			all, err := tenants.GetTenants(ctx)
+			if err != nil {
+				logging.FromContext(ctx).Log("msg", "failed to link payment chains", "err", err)
+				continue
+			}
+			for _, t := range all {
+				if _, err := svc.ChainPayments(ctx, t.ID); err != nil {
+					logging.FromContext(ctx).Log("msg", "failed to link payment chain", "tenant_id", t.ID, "err", err)
+				}
+			}
+		}
+	}
+}
+
+// runChainCheckpoints periodically signs chain heads of all tenants until ctx is done.
+// Tenants without new payments are skipped.
+func runChainCheckpoints(ctx context.Context, svc ChainService, tenants TenantService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			all, err := tenants.GetTenants(ctx)
+			if err != nil {
+				logging.FromContext(ctx).Log("msg", "failed to make payment chain checkpoints", "err", err)
+				continue
+			}
+			for _, t := range all {
+				if _, _, err := svc.MakeCheckpoint(ctx, t.ID); err != nil {
+					logging.FromContext(ctx).Log("msg", "failed to make payment chain checkpoint", "tenant_id", t.ID, "err", err)
+				}
+			}
+		}
+	}
+}
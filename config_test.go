@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfigFile writes configuration to a temporary file with given name
+func writeConfigFile(t *testing.T, name, body string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(body), 0600); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+// envMap returns getenv function looking up variables in a map
+func envMap(env map[string]string) func(string) string {
+	return func(name string) string { return env[name] }
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, args, err := loadConfig(nil, envMap(nil), io.Discard)
+	if err != nil {
+		t.Fatalf("Unexpected error in loadConfig: %v", err)
+	}
+	if len(args) != 0 {
+		t.Errorf("Expected no arguments, got %v", args)
+	}
+	if cfg != defaultConfig() {
+		t.Errorf("Expected default config, got %+v", cfg)
+	}
+	if cfg.ListenAddr != ":8080" || cfg.DB.MaxOpenConns != 20 || cfg.DB.LockRetries != 15 {
+		t.Errorf("Unexpected defaults %+v", cfg)
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	path := writeConfigFile(t, "wallet.json", `{
+		"listen_addr": ":9000",
+		"lock_strategy": "ordered",
+		"storage": {"backend": "sqlite", "sqlite_path": "file.db"},
+		"db": {"query_timeout": "1s", "lock_retries": 3, "max_open_conns": 5}
+	}`)
+	env := map[string]string{
+		"WALLET_CONFIG":    path,
+		"SQLITE_PATH":      "env.db",
+		"DB_QUERY_TIMEOUT": "2s",
+		"AUTO_MIGRATE":     "false",
+	}
+	args := []string{"-db-query-timeout", "3s", "-lock-retries=7", "account", "show", "1"}
+	cfg, rest, err := loadConfig(args, envMap(env), io.Discard)
+	if err != nil {
+		t.Fatalf("Unexpected error in loadConfig: %v", err)
+	}
+	if strings.Join(rest, " ") != "account show 1" {
+		t.Errorf("Expected command arguments to be returned, got %v", rest)
+	}
+	// file overrides defaults
+	if cfg.ListenAddr != ":9000" || cfg.LockStrategy != "ordered" || cfg.Storage.Backend != "sqlite" || cfg.DB.MaxOpenConns != 5 {
+		t.Errorf("Expected values from file, got %+v", cfg)
+	}
+	// keys missing in file keep defaults
+	if cfg.DB.ConnectRetries != 5 {
+		t.Errorf("Unexpected values %+v", cfg)
+	}
+	// environment overrides file
+	if cfg.Storage.SQLitePath != "env.db" || cfg.Storage.AutoMigrate {
+		t.Errorf("Expected values from environment, got %+v", cfg)
+	}
+	// flags override environment
+	if time.Duration(cfg.DB.QueryTimeout) != time.Second*3 || cfg.DB.LockRetries != 7 {
+		t.Errorf("Expected values from flags, got %+v", cfg)
+	}
+
+	// -config flag overrides WALLET_CONFIG
+	other := writeConfigFile(t, "wallet.json", `{"listen_addr": ":9001"}`)
+	cfg, _, err = loadConfig([]string{"-config", other}, envMap(env), io.Discard)
+	if err != nil {
+		t.Fatalf("Unexpected error in loadConfig: %v", err)
+	}
+	if cfg.ListenAddr != ":9001" {
+		t.Errorf("Expected listen address from -config file, got %q", cfg.ListenAddr)
+	}
+}
+
+func TestLoadConfigFileFormats(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		body string
+	}{
+		{name: "wallet.json", body: `{"listen_addr": ":9000", "storage": {"backend": "sqlite", "auto_migrate": false},
+			"db": {"query_timeout": "1s", "max_open_conns": 5}}`},
+		{name: "wallet.yaml", body: "listen_addr: \":9000\"\nstorage:\n  backend: sqlite\n  auto_migrate: false\n" +
+			"db:\n  query_timeout: 1s\n  max_open_conns: 5\n"},
+		{name: "wallet.YML", body: "# comments are allowed\nlisten_addr: \":9000\"\nstorage: {backend: sqlite, auto_migrate: false}\n" +
+			"db: {query_timeout: 1s, max_open_conns: 5}\n"},
+	} {
+		env := map[string]string{"WALLET_CONFIG": writeConfigFile(t, c.name, c.body)}
+		cfg, _, err := loadConfig(nil, envMap(env), io.Discard)
+		if err != nil {
+			t.Errorf("%s: unexpected error in loadConfig: %v", c.name, err)
+			continue
+		}
+		if cfg.ListenAddr != ":9000" || cfg.Storage.Backend != "sqlite" || cfg.Storage.AutoMigrate ||
+			time.Duration(cfg.DB.QueryTimeout) != time.Second || cfg.DB.MaxOpenConns != 5 {
+			t.Errorf("%s: expected values from file, got %+v", c.name, cfg)
+		}
+		// keys missing in file keep defaults
+		if cfg.DB.ConnectRetries != 5 {
+			t.Errorf("%s: unexpected values %+v", c.name, cfg)
+		}
+	}
+}
+
+func TestLoadConfigInvalid(t *testing.T) {
+	for _, c := range []struct {
+		name string
+		args []string
+		env  map[string]string
+		file string
+		// fileName is config file name, "wallet.json" if empty
+		fileName string
+		want     string
+	}{
+		{name: "unknown backend", env: map[string]string{"STORAGE_BACKEND": "mysql"}, want: `unknown storage backend "mysql"`},
+		{name: "bad number", env: map[string]string{"LOCK_RETRIES": "many"}, want: "invalid LOCK_RETRIES"},
+		{name: "bad flag", args: []string{"-db-retry-delay", "soon"}, want: "invalid value"},
+		{name: "stdout exporter", env: map[string]string{"TRACING_EXPORTER": "stdout"}, want: `unknown tracing exporter "stdout"`},
+		{name: "link interval", env: map[string]string{"CHAIN_LINK_INTERVAL": "0s"},
+			want: "chain link interval should be positive"},
+		{name: "chain on sqlite", env: map[string]string{"STORAGE_BACKEND": "sqlite", "CHAIN_CHECKPOINT_KEY_FILE": "chain.key"},
+			want: "payment chain checkpoints are supported only with postgres"},
+		{name: "no tracing file", env: map[string]string{"TRACING_EXPORTER": "file"}, want: "tracing file should be set"},
+		{name: "unknown key", file: `{"listen": ":80"}`, want: "unknown field"},
+		{name: "unknown yaml key", file: "listen: \":80\"\n", fileName: "wallet.yaml", want: "unknown field"},
+		{name: "bad yaml", file: "db: [\n", fileName: "wallet.yml", want: "invalid config file"},
+		{name: "bad yaml duration", file: "db:\n  query_timeout: soon\n", fileName: "wallet.yaml", want: "invalid config file"},
+		{name: "many problems", args: []string{"-lock-strategy", "random", "-db-max-open-conns", "0", "-listen", ""},
+			want: "listen address is required; lock strategy should be skip-locked or ordered; db max open connections should be positive"},
+	} {
+		env := c.env
+		if c.file != "" {
+			fileName := c.fileName
+			if fileName == "" {
+				fileName = "wallet.json"
+			}
+			env = map[string]string{"WALLET_CONFIG": writeConfigFile(t, fileName, c.file)}
+		}
+		_, _, err := loadConfig(c.args, envMap(env), io.Discard)
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: expected error containing %q, got %v", c.name, c.want, err)
+		}
+	}
+}
+
+func TestConfigPrint(t *testing.T) {
+	cfg := defaultConfig()
+	cfg.Storage.PostgresURL = "postgres://wallet:secret@db:5432/wallet"
+	out := &bytes.Buffer{}
+	if err := runConfigCommand(cfg, []string{"print"}, out); err != nil {
+		t.Fatalf("Unexpected error in config print: %v", err)
+	}
+	if strings.Contains(out.String(), "secret") {
+		t.Errorf("Expected password to be redacted, got %s", out.String())
+	}
+	if !strings.Contains(out.String(), `"query_timeout": "5s"`) {
+		t.Errorf("Expected durations to be printed as strings, got %s", out.String())
+	}
+
+	cfg.Storage.PostgresURL = "host=db user=wallet password=secret dbname=wallet"
+	if redacted := cfg.redacted().Storage.PostgresURL; redacted != "host=db user=wallet password=xxxxx dbname=wallet" {
+		t.Errorf("Expected password to be redacted, got %q", redacted)
+	}
+}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+)
+
+const currencyUsage = `Usage:
+  wallet currency list [-tenant <tenant id>]
+  wallet currency add [-tenant <tenant id>] <name>`
+
+// runCurrencyCommand manages tenant's currencies from the command line
+func runCurrencyCommand(ctx context.Context, svc CurrencyService, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%v\n%s", errUnknownCommand, currencyUsage)
+	}
+	switch args[0] {
+	case "list":
+		tenantID, err := parseTenantArgs(args[1:], out)
+		if err != nil {
+			return err
+		}
+		currencies, err := svc.GetCurrencies(ctx, tenantID)
+		if err != nil {
+			return err
+		}
+		for _, c := range currencies {
+			fmt.Fprintf(out, "%d\t%s\n", c.ID, c.Name)
+		}
+		return nil
+	case "add":
+		fs, tenantID := newTenantFlagSet("add", out)
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return fmt.Errorf("currency name is required\n%s", currencyUsage)
+		}
+		currency, err := svc.CreateCurrency(ctx, *tenantID, fs.Arg(0))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Created currency %d\t%s\n", currency.ID, currency.Name)
+		return nil
+	}
+	return fmt.Errorf("%v %q\n%s", errUnknownCommand, args[0], currencyUsage)
+}
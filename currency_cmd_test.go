@@ -0,0 +1,30 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/c-pro/wallet-test/models"
+)
+
+func TestCurrencyCommand(t *testing.T) {
+	svc := &currencyService{newMemoryRepository()}
+	ctx := context.Background()
+	out := &bytes.Buffer{}
+	if err := runCurrencyCommand(ctx, svc, []string{"add", "EUR"}, out); err != nil {
+		t.Fatalf("Unexpected error in currency add: %v", err)
+	}
+	if err := runCurrencyCommand(ctx, svc, []string{"add", "EUR"}, out); err != models.ErrDuplicateCurrency {
+		t.Errorf("Expected ErrDuplicateCurrency, got %v", err)
+	}
+
+	out.Reset()
+	if err := runCurrencyCommand(ctx, svc, []string{"list"}, out); err != nil {
+		t.Fatalf("Unexpected error in currency list: %v", err)
+	}
+	if !strings.Contains(out.String(), "5\tEUR\n") {
+		t.Errorf("Expected created currency in currency list output, got %q", out.String())
+	}
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"context"
+
+	"github.com/c-pro/wallet-test/models"
+)
+
+// CurrencyService provides methods to access currencies
+type CurrencyService interface {
+	GetCurrencies(ctx context.Context, tenantID int64) ([]models.Currency, error)
+	CreateCurrency(ctx context.Context, tenantID int64, name string) (models.Currency, error)
+}
+
+// currencyService implements interface above
+type currencyService struct {
+	repo models.Repository
+}
+
+// GetCurrencies returns all tenant's currencies in repository
+func (c *currencyService) GetCurrencies(ctx context.Context, tenantID int64) ([]models.Currency, error) {
+	return c.repo.GetCurrencies(ctx, tenantID)
+}
+
+// CreateCurrency creates a new tenant's currency in the repository
+func (c *currencyService) CreateCurrency(ctx context.Context, tenantID int64, name string) (models.Currency, error) {
+	currency := models.Currency{TenantID: tenantID, Name: name}
+	err := c.repo.CreateCurrency(ctx, &currency)
+	return currency, err
+}
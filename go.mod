@@ -1,10 +1,18 @@
 module github.com/c-pro/wallet-test
 
+go 1.27.1
+
 require (
 	github.com/go-kit/kit v0.8.0
-	github.com/go-logfmt/logfmt v0.4.0 // indirect
-	github.com/go-stack/stack v1.8.0 // indirect
 	github.com/gorilla/mux v1.7.2
 	github.com/lib/pq v1.1.1
+	github.com/mattn/go-sqlite3 v1.14.33
 	github.com/shopspring/decimal v0.0.0-20180709203117-cd690d0c9e24
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require (
+	github.com/go-logfmt/logfmt v0.4.0 // indirect
+	github.com/go-stack/stack v1.8.0 // indirect
+	github.com/kr/logfmt v0.0.0-20140226030751-b84e30acd515 // indirect
 )
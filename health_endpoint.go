@@ -0,0 +1,70 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	httptransport "github.com/go-kit/kit/transport/http"
+)
+
+const (
+	statusOK   = "ok"
+	statusFail = "fail"
+)
+
+type componentStatus struct {
+	Status string
+	Error  string `json:"Error,omitempty"`
+}
+
+type healthResponse struct {
+	Status     string
+	Components map[string]componentStatus `json:"Components,omitempty"`
+}
+
+func makeLiveEndpoint() endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		return healthResponse{Status: statusOK}, nil
+	}
+}
+
+func makeReadyEndpoint(svc HealthService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		resp := healthResponse{Status: statusOK, Components: map[string]componentStatus{}}
+		for name, err := range svc.Ready(ctx) {
+			if err != nil {
+				resp.Status = statusFail
+				resp.Components[name] = componentStatus{statusFail, err.Error()}
+				continue
+			}
+			resp.Components[name] = componentStatus{Status: statusOK}
+		}
+		return resp, nil
+	}
+}
+
+// encodeHealthResponse responds with 503 if any component is not ready
+func encodeHealthResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+	w.Header().Add("Content-Type", "application/json")
+	if resp := response.(healthResponse); resp.Status != statusOK {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	return json.NewEncoder(w).Encode(response)
+}
+
+// addHealthHandlers adds liveness and readiness probes to mux.
+// Probes do not require authentication.
+func addHealthHandlers(mux *http.ServeMux, svc HealthService) {
+	mux.Handle("/healthz", httptransport.NewServer(
+		makeLiveEndpoint(),
+		decodeNilRequest,
+		encodeHealthResponse,
+	))
+	mux.Handle("/readyz", httptransport.NewServer(
+		makeReadyEndpoint(svc),
+		decodeNilRequest,
+		encodeHealthResponse,
+	))
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/c-pro/wallet-test/models"
+	"github.com/c-pro/wallet-test/models/sqlite"
+)
+
+// fakePinger returns err on ping
+type fakePinger struct {
+	err error
+}
+
+func (p fakePinger) PingContext(ctx context.Context) error {
+	return p.err
+}
+
+// fakeSchema reports given schema version
+type fakeSchema struct {
+	version int
+}
+
+func (s fakeSchema) SchemaVersion(ctx context.Context) (int, error) {
+	return s.version, nil
+}
+
+func (s fakeSchema) Migrate(ctx context.Context, target int) (int, error) {
+	return s.version, nil
+}
+
+func (s fakeSchema) LatestSchemaVersion() int {
+	return models.LatestSchemaVersion()
+}
+
+// getHealth requests health route and returns status code and decoded response
+func getHealth(t *testing.T, svc HealthService, route string) (int, healthResponse) {
+	mux := http.NewServeMux()
+	addHealthHandlers(mux, svc)
+	s := httptest.NewServer(mux)
+	defer s.Close()
+	res, err := http.Get(s.URL + route)
+	if err != nil {
+		t.Fatalf("Unexpected error in GET %s: %v", route, err)
+	}
+	defer res.Body.Close()
+	resp := healthResponse{}
+	if err := json.NewDecoder(res.Body).Decode(&resp); err != nil {
+		t.Fatalf("Failed to decode %s response: %v", route, err)
+	}
+	return res.StatusCode, resp
+}
+
+func TestHealthz(t *testing.T) {
+	svc := &healthService{pool: fakePinger{errors.New("down")}, drain: &drainState{}}
+	if code, resp := getHealth(t, svc, "/healthz"); code != 200 || resp.Status != statusOK {
+		t.Errorf("Expected process to be alive regardless of database, got %d %v", code, resp)
+	}
+}
+
+func TestReadyz(t *testing.T) {
+	drain := &drainState{}
+	svc := &healthService{pool: fakePinger{}, schema: fakeSchema{models.LatestSchemaVersion()}, drain: drain}
+	code, resp := getHealth(t, svc, "/readyz")
+	if code != 200 || resp.Status != statusOK {
+		t.Errorf("Expected service to be ready, got %d %v", code, resp)
+	}
+	for _, name := range []string{"database", "schema", "server"} {
+		if resp.Components[name].Status != statusOK {
+			t.Errorf("Expected %s component to be ok, got %v", name, resp.Components)
+		}
+	}
+
+	for _, c := range []struct {
+		component string
+		svc       *healthService
+	}{
+		{"database", &healthService{pool: fakePinger{errors.New("connection refused")}, schema: fakeSchema{models.LatestSchemaVersion()}, drain: drain}},
+		{"schema", &healthService{pool: fakePinger{}, schema: fakeSchema{models.LatestSchemaVersion() - 1}, drain: drain}},
+	} {
+		code, resp := getHealth(t, c.svc, "/readyz")
+		if code != 503 || resp.Status != statusFail || resp.Components[c.component].Error == "" {
+			t.Errorf("Expected %s failure to make service not ready, got %d %v", c.component, code, resp)
+		}
+	}
+
+	drain.start()
+	code, resp = getHealth(t, svc, "/readyz")
+	if code != 503 || resp.Components["server"].Error != errDraining.Error() {
+		t.Errorf("Expected draining service not to be ready, got %d %v", code, resp)
+	}
+}
+
+func TestReadyzDB(t *testing.T) {
+	requireDB(t)
+	svc := &healthService{pool: db, schema: &schemaService{db}, drain: &drainState{}}
+	if code, resp := getHealth(t, svc, "/readyz"); code != 200 {
+		t.Errorf("Expected service to be ready, got %d %v", code, resp)
+	}
+}
+
+func TestReadyzSQLite(t *testing.T) {
+	pool, err := sqlite.Open(filepath.Join(t.TempDir(), "wallet.db"))
+	if err != nil {
+		t.Fatalf("Unexpected error in sqlite.Open: %v", err)
+	}
+	defer pool.Close()
+	svc := &healthService{pool: pool, schema: &sqliteSchemaService{pool}, drain: &drainState{}}
+	if code, resp := getHealth(t, svc, "/readyz"); code != 200 || resp.Components["schema"].Status != statusOK {
+		t.Errorf("Expected service to be ready, got %d %v", code, resp)
+	}
+
+	// file schema changed behind the service's back
+	if _, err := pool.Exec(fmt.Sprintf("pragma user_version = %d", sqlite.LatestSchemaVersion()-1)); err != nil {
+		t.Fatalf("Failed to set schema version: %v", err)
+	}
+	code, resp := getHealth(t, svc, "/readyz")
+	if code != 503 || resp.Components["schema"].Error != models.ErrSchemaBehind.Error() {
+		t.Errorf("Expected outdated schema to make service not ready, got %d %v", code, resp)
+	}
+}
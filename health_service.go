@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/c-pro/wallet-test/models"
+)
+
+// readyTimeout caps duration of readiness checks, so a hanging database
+// makes the service not ready instead of hanging the check
+const readyTimeout = time.Second
+
+var errDraining = errors.New("Service is shutting down")
+
+// HealthService checks if the service is ready to serve requests
+type HealthService interface {
+	// Ready returns result of every component check, nil error means component is ready
+	Ready(ctx context.Context) map[string]error
+}
+
+// pinger is satisfied by *sql.DB
+type pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// healthService implements interface above
+type healthService struct {
+	pool   pinger
+	schema schemaChecker
+	drain  *drainState
+}
+
+// Ready checks database connection, schema version and that service is not shutting down
+func (h *healthService) Ready(ctx context.Context) map[string]error {
+	ctx, cancel := context.WithTimeout(ctx, readyTimeout)
+	defer cancel()
+	result := map[string]error{"database": h.pool.PingContext(ctx), "schema": h.checkSchema(ctx)}
+	result["server"] = nil
+	if h.drain.isDraining() {
+		result["server"] = errDraining
+	}
+	return result
+}
+
+// checkSchema returns error if schema version differs from the latest migration of the storage
+func (h *healthService) checkSchema(ctx context.Context) error {
+	version, err := h.schema.SchemaVersion(ctx)
+	switch {
+	case err != nil:
+		return err
+	case version > h.schema.LatestSchemaVersion():
+		return models.ErrSchemaAhead
+	case version < h.schema.LatestSchemaVersion():
+		return models.ErrSchemaBehind
+	}
+	return nil
+}
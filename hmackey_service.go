@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/c-pro/wallet-test/logging"
+	"github.com/c-pro/wallet-test/models"
+)
+
+// HMACKeyService provides methods to manage HMAC keys and nonces of signed requests
+type HMACKeyService interface {
+	GetHMACKeys(ctx context.Context, tenantID int64) ([]models.HMACKey, error)
+	IssueHMACKey(ctx context.Context, tenantID int64, name, role string, ownerID int64) (models.HMACKey, error)
+	RevokeHMACKey(ctx context.Context, tenantID, id int64) error
+	GetActiveHMACKey(ctx context.Context, id int64) (models.HMACKey, error)
+	UseNonce(ctx context.Context, keyID int64, nonce string, expiresAt time.Time) error
+	DeleteExpiredNonces(ctx context.Context) (int64, error)
+}
+
+// hmacKeyService implements interface above
+type hmacKeyService struct {
+	db *sql.DB
+}
+
+// GetHMACKeys returns all tenant's HMAC keys in database without secrets
+func (k *hmacKeyService) GetHMACKeys(ctx context.Context, tenantID int64) ([]models.HMACKey, error) {
+	tx, err := k.db.BeginTx(ctx, nil)
+	if err != nil {
+		return []models.HMACKey{}, err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	return models.GetHMACKeys(ctx, tx, tenantID)
+}
+
+// IssueHMACKey creates a new HMAC key and returns it with the secret
+func (k *hmacKeyService) IssueHMACKey(ctx context.Context, tenantID int64, name, role string, ownerID int64) (models.HMACKey, error) {
+	tx, err := k.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.HMACKey{}, err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	hmacKey, err := models.IssueHMACKey(ctx, tx, tenantID, name, role, ownerID)
+	if err != nil {
+		return hmacKey, err
+	}
+	return hmacKey, models.Commit(ctx, tx, tenantID, models.AuditObject("hmac_key", hmacKey.ID))
+}
+
+// RevokeHMACKey revokes tenant's HMAC key with given ID
+func (k *hmacKeyService) RevokeHMACKey(ctx context.Context, tenantID, id int64) error {
+	tx, err := k.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	if err := models.RevokeHMACKey(ctx, tx, tenantID, id); err != nil {
+		return err
+	}
+	return models.Commit(ctx, tx, tenantID, models.AuditObject("hmac_key", id))
+}
+
+// GetActiveHMACKey returns not revoked HMAC key with its secret
+func (k *hmacKeyService) GetActiveHMACKey(ctx context.Context, id int64) (models.HMACKey, error) {
+	tx, err := k.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.HMACKey{}, err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	return models.GetActiveHMACKey(ctx, tx, id)
+}
+
+// UseNonce records signed request nonce, failing if it was seen before
+func (k *hmacKeyService) UseNonce(ctx context.Context, keyID int64, nonce string, expiresAt time.Time) error {
+	tx, err := k.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	if err := models.UseNonce(ctx, tx, keyID, nonce, expiresAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// DeleteExpiredNonces removes nonces which can not be replayed anymore
+func (k *hmacKeyService) DeleteExpiredNonces(ctx context.Context) (int64, error) {
+	tx, err := k.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	n, err := models.DeleteExpiredNonces(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
+
+// runNonceCleanup periodically deletes expired nonces until ctx is done
+func runNonceCleanup(ctx context.Context, svc HMACKeyService, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if _, err := svc.DeleteExpiredNonces(ctx); err != nil {
+				logging.FromContext(ctx).Log("msg", "failed to delete expired nonces", "err", err)
+			}
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/c-pro/wallet-test/metrics"
+	"github.com/c-pro/wallet-test/models"
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	httpRequests = metrics.DefaultRegistry.NewCounterVec("wallet_http_requests_total",
+		"Number of HTTP requests by route and response status.", "method", "route", "status")
+	httpDuration = metrics.DefaultRegistry.NewHistogramVec("wallet_http_request_duration_seconds",
+		"HTTP request latency by route.", metrics.DefaultBuckets, "method", "route")
+	payments = metrics.DefaultRegistry.NewCounterVec("wallet_payments_total",
+		"Number of payments by outcome.", "outcome")
+)
+
+// paymentOutcomes are metric labels of payment errors
+var paymentOutcomes = map[error]string{
+	models.ErrInsufficientAmount:   "insufficient_amount",
+	models.ErrLockFailed:           "lock_failed",
+	models.ErrCurrencyMismatch:     "currency_mismatch",
+	models.ErrNoPaymentToSelf:      "no_payment_to_self",
+	models.ErrNonPositiveAmount:    "non_positive_amount",
+	models.ErrAccountFrozen:        "account_frozen",
+	models.ErrOwnerAccountNotFound: "owner_account_not_found",
+	sql.ErrNoRows:                  "not_found",
+	context.Canceled:               "canceled",
+	context.DeadlineExceeded:       "timeout",
+}
+
+// paymentOutcome returns metric label of payment result
+func paymentOutcome(err error) string {
+	if err == nil {
+		return "ok"
+	}
+	for e, outcome := range paymentOutcomes {
+		if errors.Is(err, e) {
+			return outcome
+		}
+	}
+	return "error"
+}
+
+// statusRecorder remembers response status written by handler
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	s.status = status
+	s.ResponseWriter.WriteHeader(status)
+}
+
+// routeName returns template of router's route matching request, e.g. /account/{id},
+// so requests to different accounts are reported together
+func routeName(router *mux.Router, r *http.Request) string {
+	match := mux.RouteMatch{}
+	if router.Match(r, &match) && match.Route != nil {
+		if tpl, err := match.Route.GetPathTemplate(); err == nil {
+			return tpl
+		}
+	}
+	return "unmatched"
+}
+
+// instrumentHTTP counts requests handled by next and measures their latency.
+// Requests are labeled with route template of router, not the path,
+// so account IDs do not make a separate series each.
+func instrumentHTTP(router *mux.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := routeName(router, r)
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r)
+		httpDuration.Observe(time.Since(start).Seconds(), r.Method, route)
+		httpRequests.Inc(r.Method, route, strconv.Itoa(rec.status))
+	})
+}
+
+// instrumentedPaymentService counts payments made through PaymentService by outcome
+type instrumentedPaymentService struct {
+	PaymentService
+}
+
+// MakePayment makes payment and counts its outcome
+func (p *instrumentedPaymentService) MakePayment(ctx context.Context, tenantID,
+	buyerAccountID,
+	sellerAccountID int64,
+	amount decimal.Decimal) (models.Payment, error) {
+	payment, err := p.PaymentService.MakePayment(ctx, tenantID, buyerAccountID, sellerAccountID, amount)
+	payments.Inc(paymentOutcome(err))
+	return payment, err
+}
+
+// MakeOwnerPayment makes payment between owners and counts its outcome
+func (p *instrumentedPaymentService) MakeOwnerPayment(ctx context.Context, tenantID,
+	buyerOwnerID,
+	sellerOwnerID,
+	currencyID int64,
+	amount decimal.Decimal) (models.Payment, error) {
+	payment, err := p.PaymentService.MakeOwnerPayment(ctx, tenantID, buyerOwnerID, sellerOwnerID, currencyID, amount)
+	payments.Inc(paymentOutcome(err))
+	return payment, err
+}
+
+// registerDBStats exposes connection pool statistics of db in reg
+func registerDBStats(reg *metrics.Registry, db *sql.DB) {
+	stat := func(f func(s sql.DBStats) float64) func() float64 {
+		return func() float64 { return f(db.Stats()) }
+	}
+	reg.NewGaugeFunc("wallet_db_max_open_connections", "Maximum number of open connections to the database.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxOpenConnections) }))
+	reg.NewGaugeFunc("wallet_db_open_connections", "Number of established connections to the database.",
+		stat(func(s sql.DBStats) float64 { return float64(s.OpenConnections) }))
+	reg.NewGaugeFunc("wallet_db_in_use_connections", "Number of connections currently in use.",
+		stat(func(s sql.DBStats) float64 { return float64(s.InUse) }))
+	reg.NewGaugeFunc("wallet_db_idle_connections", "Number of idle connections.",
+		stat(func(s sql.DBStats) float64 { return float64(s.Idle) }))
+	reg.NewCounterFunc("wallet_db_wait_count_total", "Number of connections waited for.",
+		stat(func(s sql.DBStats) float64 { return float64(s.WaitCount) }))
+	reg.NewCounterFunc("wallet_db_wait_duration_seconds_total", "Time spent waiting for new connections.",
+		stat(func(s sql.DBStats) float64 { return s.WaitDuration.Seconds() }))
+	reg.NewCounterFunc("wallet_db_max_idle_closed_total", "Number of connections closed due to max idle connections limit.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxIdleClosed) }))
+	reg.NewCounterFunc("wallet_db_max_lifetime_closed_total", "Number of connections closed due to max connection lifetime.",
+		stat(func(s sql.DBStats) float64 { return float64(s.MaxLifetimeClosed) }))
+}
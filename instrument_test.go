@@ -0,0 +1,75 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/c-pro/wallet-test/metrics"
+	"github.com/c-pro/wallet-test/models"
+	"github.com/gorilla/mux"
+	"github.com/shopspring/decimal"
+)
+
+func TestInstrumentHTTP(t *testing.T) {
+	r := mux.NewRouter()
+	r.Handle("/things/{id}", http.NotFoundHandler()).Methods("GET")
+	s := httptest.NewServer(instrumentHTTP(r, r))
+	defer s.Close()
+
+	before := httpRequests.Value("GET", "/things/{id}", "404")
+	beforeUnmatched := httpRequests.Value("GET", "unmatched", "404")
+	for _, path := range []string{"/things/1", "/things/2", "/other"} {
+		res, err := http.Get(s.URL + path)
+		if err != nil {
+			t.Fatalf("Unexpected error in GET %s: %v", path, err)
+		}
+		res.Body.Close()
+	}
+	if n := httpRequests.Value("GET", "/things/{id}", "404") - before; n != 2 {
+		t.Errorf("Expected 2 requests counted by route template, got %v", n)
+	}
+	if n := httpRequests.Value("GET", "unmatched", "404") - beforeUnmatched; n != 1 {
+		t.Errorf("Expected 1 unmatched request, got %v", n)
+	}
+}
+
+func TestPaymentOutcome(t *testing.T) {
+	cases := map[error]string{
+		nil:                          "ok",
+		models.ErrInsufficientAmount: "insufficient_amount",
+		models.ErrLockFailed:         "lock_failed",
+		sql.ErrNoRows:                "not_found",
+		fmt.Errorf("wrapped: %w", models.ErrAccountFrozen): "account_frozen",
+		fmt.Errorf("something else"):                       "error",
+	}
+	for err, expected := range cases {
+		if outcome := paymentOutcome(err); outcome != expected {
+			t.Errorf("Expected outcome %s for %v, got %s", expected, err, outcome)
+		}
+	}
+}
+
+func TestMetricsEndpoint(t *testing.T) {
+	before := payments.Value("ok")
+	addTestPayment(t, decimal.New(1, 0))
+	if n := payments.Value("ok") - before; n != 1 {
+		t.Errorf("Expected 1 successful payment, got %v", n)
+	}
+
+	rec := httptest.NewRecorder()
+	metrics.DefaultRegistry.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	body := rec.Body.String()
+	for _, line := range []string{
+		`wallet_payments_total{outcome="ok"}`,
+		`wallet_http_requests_total{method="POST",route="/payments",status="200"}`,
+		`wallet_http_request_duration_seconds_bucket{method="POST",route="/payments",le="+Inf"}`,
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected %s in metrics", line)
+		}
+	}
+}
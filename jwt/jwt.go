@@ -0,0 +1,291 @@
+// Package jwt verifies HS256 and RS256 signed JSON Web Tokens
+// against a set of keys loaded from a JWKS document.
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// Constant errors
+var (
+	ErrMalformed        = errors.New("Malformed token")
+	ErrUnsupportedAlg   = errors.New("Unsupported signing algorithm")
+	ErrUnknownKey       = errors.New("Unknown signing key")
+	ErrInvalidSignature = errors.New("Invalid token signature")
+	ErrExpired          = errors.New("Token is expired")
+	ErrNotYetValid      = errors.New("Token is not valid yet")
+	ErrInvalidIssuer    = errors.New("Invalid token issuer")
+	ErrInvalidAudience  = errors.New("Invalid token audience")
+)
+
+// Supported signing algorithms
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+)
+
+// Claims is a set of claims from the token payload.
+// Numbers are decoded as json.Number.
+type Claims map[string]interface{}
+
+// String returns claim value if it is a string
+func (c Claims) String(name string) (string, bool) {
+	s, ok := c[name].(string)
+	return s, ok
+}
+
+// Int64 returns claim value if it is an integer number or a string containing one
+func (c Claims) Int64(name string) (int64, bool) {
+	switch v := c[name].(type) {
+	case json.Number:
+		i, err := v.Int64()
+		return i, err == nil
+	case string:
+		i, err := json.Number(v).Int64()
+		return i, err == nil
+	}
+	return 0, false
+}
+
+// key is a verification key from JWKS
+type key struct {
+	alg    string
+	secret []byte
+	public *rsa.PublicKey
+}
+
+// KeySet is a set of verification keys indexed by key ID
+type KeySet struct {
+	keys map[string]key
+}
+
+// jwk is a JSON Web Key as defined in RFC 7517
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	K   string `json:"k"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// ParseJWKS parses JWKS document. Symmetric ("oct") keys are used for HS256,
+// RSA keys are used for RS256.
+func ParseJWKS(data []byte) (*KeySet, error) {
+	doc := struct {
+		Keys []jwk `json:"keys"`
+	}{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	ks := &KeySet{keys: make(map[string]key)}
+	for i, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		var parsed key
+		switch k.Kty {
+		case "oct":
+			secret, err := decodeSegment(k.K)
+			if err != nil || len(secret) == 0 {
+				return nil, fmt.Errorf("key %d: invalid symmetric key", i)
+			}
+			parsed = key{alg: HS256, secret: secret}
+		case "RSA":
+			n, err := decodeSegment(k.N)
+			if err != nil || len(n) == 0 {
+				return nil, fmt.Errorf("key %d: invalid RSA modulus", i)
+			}
+			e, err := decodeSegment(k.E)
+			if err != nil || len(e) == 0 || len(e) > 4 {
+				return nil, fmt.Errorf("key %d: invalid RSA exponent", i)
+			}
+			parsed = key{alg: RS256, public: &rsa.PublicKey{
+				N: new(big.Int).SetBytes(n),
+				E: int(new(big.Int).SetBytes(e).Int64()),
+			}}
+		default:
+			return nil, fmt.Errorf("key %d: unsupported key type %q", i, k.Kty)
+		}
+		if k.Alg != "" && k.Alg != parsed.alg {
+			return nil, fmt.Errorf("key %d: algorithm %q does not match key type %q", i, k.Alg, k.Kty)
+		}
+		if _, ok := ks.keys[k.Kid]; ok {
+			return nil, fmt.Errorf("key %d: duplicate key ID %q", i, k.Kid)
+		}
+		ks.keys[k.Kid] = parsed
+	}
+	if len(ks.keys) == 0 {
+		return nil, errors.New("JWKS does not contain signing keys")
+	}
+	return ks, nil
+}
+
+// LoadJWKS reads and parses JWKS file
+func LoadJWKS(path string) (*KeySet, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseJWKS(data)
+}
+
+// lookup finds a key by ID. Token without key ID can be used only when
+// there is exactly one key in the set.
+func (ks *KeySet) lookup(kid string) (key, bool) {
+	if k, ok := ks.keys[kid]; ok {
+		return k, true
+	}
+	if kid == "" && len(ks.keys) == 1 {
+		for _, k := range ks.keys {
+			return k, true
+		}
+	}
+	return key{}, false
+}
+
+// Verifier validates tokens signature and standard time, issuer and audience claims
+type Verifier struct {
+	Keys *KeySet
+	// Issuer is an expected "iss" claim. Not checked if empty.
+	Issuer string
+	// Audience is a value expected in "aud" claim. Not checked if empty.
+	Audience string
+	// Leeway is allowed clock skew for "exp" and "nbf" claims
+	Leeway time.Duration
+	// Now returns current time, time.Now is used if nil
+	Now func() time.Time
+}
+
+// Verify checks token and returns its claims.
+// Tokens without "exp" claim are rejected.
+func (v *Verifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, ErrMalformed
+	}
+
+	header := struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}{}
+	if err := decodeJSONSegment(parts[0], &header); err != nil {
+		return nil, ErrMalformed
+	}
+	if header.Alg != HS256 && header.Alg != RS256 {
+		return nil, ErrUnsupportedAlg
+	}
+	k, ok := v.Keys.lookup(header.Kid)
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	// algorithm is dictated by the key, not by the token
+	// so RSA public key can not be used as HMAC secret
+	if k.alg != header.Alg {
+		return nil, ErrUnsupportedAlg
+	}
+
+	signature, err := decodeSegment(parts[2])
+	if err != nil {
+		return nil, ErrMalformed
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+	switch k.alg {
+	case HS256:
+		mac := hmac.New(sha256.New, k.secret)
+		mac.Write(signed)
+		if !hmac.Equal(mac.Sum(nil), signature) {
+			return nil, ErrInvalidSignature
+		}
+	case RS256:
+		digest := sha256.Sum256(signed)
+		if err := rsa.VerifyPKCS1v15(k.public, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, ErrInvalidSignature
+		}
+	}
+
+	claims := Claims{}
+	if err := decodeJSONSegment(parts[1], &claims); err != nil {
+		return nil, ErrMalformed
+	}
+	if err := v.validate(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+// validate checks registered claims
+func (v *Verifier) validate(claims Claims) error {
+	now := time.Now()
+	if v.Now != nil {
+		now = v.Now()
+	}
+
+	exp, ok := claims.Int64("exp")
+	if !ok {
+		return ErrMalformed
+	}
+	if now.Add(-v.Leeway).Unix() >= exp {
+		return ErrExpired
+	}
+	if _, present := claims["nbf"]; present {
+		nbf, ok := claims.Int64("nbf")
+		if !ok {
+			return ErrMalformed
+		}
+		if now.Add(v.Leeway).Unix() < nbf {
+			return ErrNotYetValid
+		}
+	}
+
+	if v.Issuer != "" {
+		if iss, _ := claims.String("iss"); iss != v.Issuer {
+			return ErrInvalidIssuer
+		}
+	}
+
+	if v.Audience != "" {
+		switch aud := claims["aud"].(type) {
+		case string:
+			if aud == v.Audience {
+				return nil
+			}
+		case []interface{}:
+			for _, a := range aud {
+				if s, ok := a.(string); ok && s == v.Audience {
+					return nil
+				}
+			}
+		}
+		return ErrInvalidAudience
+	}
+	return nil
+}
+
+// decodeSegment decodes base64url encoded token part or key parameter
+func decodeSegment(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
+
+func decodeJSONSegment(s string, dest interface{}) error {
+	b, err := decodeSegment(s)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(dest)
+}
@@ -0,0 +1,172 @@
+package jwt
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"testing"
+	"time"
+)
+
+var (
+	hsSecret = []byte("0123456789abcdef0123456789abcdef")
+	rsaKey   *rsa.PrivateKey
+	now      = time.Unix(1560000000, 0)
+)
+
+func init() {
+	var err error
+	rsaKey, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func jwks() []byte {
+	return []byte(fmt.Sprintf(`{"keys": [
+		{"kty": "oct", "kid": "hs", "alg": "HS256", "k": "%s"},
+		{"kty": "RSA", "kid": "rs", "use": "sig", "n": "%s", "e": "%s"}
+	]}`,
+		encode(hsSecret),
+		encode(rsaKey.N.Bytes()),
+		encode(big.NewInt(int64(rsaKey.E)).Bytes())))
+}
+
+func sign(t *testing.T, alg, kid string, claims map[string]interface{}) string {
+	header, _ := json.Marshal(map[string]string{"alg": alg, "kid": kid, "typ": "JWT"})
+	payload, _ := json.Marshal(claims)
+	signed := encode(header) + "." + encode(payload)
+	var signature []byte
+	switch alg {
+	case HS256:
+		mac := hmac.New(sha256.New, hsSecret)
+		mac.Write([]byte(signed))
+		signature = mac.Sum(nil)
+	case RS256:
+		digest := sha256.Sum256([]byte(signed))
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+		if err != nil {
+			t.Fatalf("Failed to sign token: %v", err)
+		}
+	}
+	return signed + "." + encode(signature)
+}
+
+func newVerifier(t *testing.T) *Verifier {
+	keys, err := ParseJWKS(jwks())
+	if err != nil {
+		t.Fatalf("Unexpected error in ParseJWKS: %v", err)
+	}
+	return &Verifier{Keys: keys,
+		Issuer:   "gateway",
+		Audience: "wallet",
+		Now:      func() time.Time { return now }}
+}
+
+func validClaims() map[string]interface{} {
+	return map[string]interface{}{
+		"iss":      "gateway",
+		"aud":      []string{"other", "wallet"},
+		"sub":      "user-1",
+		"exp":      now.Add(time.Minute).Unix(),
+		"role":     "client",
+		"owner_id": 42,
+	}
+}
+
+func TestVerify(t *testing.T) {
+	v := newVerifier(t)
+	for _, tc := range []struct{ alg, kid string }{{HS256, "hs"}, {RS256, "rs"}} {
+		claims, err := v.Verify(sign(t, tc.alg, tc.kid, validClaims()))
+		if err != nil {
+			t.Fatalf("%s: unexpected error in Verify: %v", tc.alg, err)
+		}
+		if role, _ := claims.String("role"); role != "client" {
+			t.Errorf("%s: expected role claim to be client, got %q", tc.alg, role)
+		}
+		if ownerID, _ := claims.Int64("owner_id"); ownerID != 42 {
+			t.Errorf("%s: expected owner_id claim to be 42, got %d", tc.alg, ownerID)
+		}
+	}
+}
+
+func TestVerifyErrors(t *testing.T) {
+	v := newVerifier(t)
+
+	expired := validClaims()
+	expired["exp"] = now.Add(-time.Second).Unix()
+
+	notYet := validClaims()
+	notYet["nbf"] = now.Add(time.Minute).Unix()
+
+	noExp := validClaims()
+	delete(noExp, "exp")
+
+	wrongIss := validClaims()
+	wrongIss["iss"] = "someone"
+
+	wrongAud := validClaims()
+	wrongAud["aud"] = "other"
+
+	valid := sign(t, HS256, "hs", validClaims())
+	tampered := valid[:len(valid)-2] + "AA"
+
+	cases := []struct {
+		name  string
+		token string
+		err   error
+	}{
+		{"expired", sign(t, HS256, "hs", expired), ErrExpired},
+		{"not yet valid", sign(t, HS256, "hs", notYet), ErrNotYetValid},
+		{"no exp", sign(t, HS256, "hs", noExp), ErrMalformed},
+		{"wrong issuer", sign(t, HS256, "hs", wrongIss), ErrInvalidIssuer},
+		{"wrong audience", sign(t, HS256, "hs", wrongAud), ErrInvalidAudience},
+		{"tampered", tampered, ErrInvalidSignature},
+		{"unknown kid", sign(t, HS256, "nope", validClaims()), ErrUnknownKey},
+		{"alg none", sign(t, "none", "hs", validClaims()), ErrUnsupportedAlg},
+		{"alg confusion", sign(t, HS256, "rs", validClaims()), ErrUnsupportedAlg},
+		{"garbage", "not.a.token", ErrMalformed},
+		{"two parts", "abc.def", ErrMalformed},
+	}
+	for _, c := range cases {
+		if _, err := v.Verify(c.token); err != c.err {
+			t.Errorf("%s: expected %v, got %v", c.name, c.err, err)
+		}
+	}
+}
+
+func TestParseJWKS(t *testing.T) {
+	bad := []string{
+		`{"keys": []}`,
+		`{"keys": [{"kty": "EC", "kid": "ec"}]}`,
+		`{"keys": [{"kty": "oct", "kid": "a", "alg": "RS256", "k": "c2VjcmV0"}]}`,
+		`{"keys": [{"kty": "oct", "kid": "a", "k": "c2VjcmV0"}, {"kty": "oct", "kid": "a", "k": "c2VjcmV0"}]}`,
+		`not json`,
+	}
+	for _, doc := range bad {
+		if _, err := ParseJWKS([]byte(doc)); err == nil {
+			t.Errorf("Expected ParseJWKS to fail on %s", doc)
+		}
+	}
+
+	// single key can be used by tokens without kid
+	keys, err := ParseJWKS([]byte(fmt.Sprintf(`{"keys": [{"kty": "oct", "k": "%s"}]}`, encode(hsSecret))))
+	if err != nil {
+		t.Fatalf("Unexpected error in ParseJWKS: %v", err)
+	}
+	v := &Verifier{Keys: keys, Now: func() time.Time { return now }}
+	if _, err := v.Verify(sign(t, HS256, "", validClaims())); err != nil {
+		t.Errorf("Unexpected error in Verify: %v", err)
+	}
+}
@@ -0,0 +1,107 @@
+// Package logging provides structured service logger and request IDs.
+// Log lines written while serving a request carry its ID, so all of them
+// including errors in models can be found by X-Request-ID response header.
+package logging
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+
+	"github.com/go-kit/kit/log"
+)
+
+// ErrUnknownFormat is returned by NewLogger for formats other than logfmt and json
+var ErrUnknownFormat = errors.New("Log format should be one of logfmt or json")
+
+// root is a logger all log lines are written to
+var root log.SwapLogger
+
+func init() {
+	root.Swap(defaultLogger())
+}
+
+// defaultLogger writes logfmt to stderr until SetLogger is called
+func defaultLogger() log.Logger {
+	return New(log.NewLogfmtLogger(log.NewSyncWriter(os.Stderr)))
+}
+
+// NewLogger returns logger writing to w in given format, logfmt or json
+func NewLogger(format string, w io.Writer) (log.Logger, error) {
+	w = log.NewSyncWriter(w)
+	switch format {
+	case "logfmt":
+		return New(log.NewLogfmtLogger(w)), nil
+	case "json":
+		return New(log.NewJSONLogger(w)), nil
+	}
+	return nil, ErrUnknownFormat
+}
+
+// New adds UTC timestamp to log lines of logger
+func New(logger log.Logger) log.Logger {
+	return log.With(logger, "ts", log.DefaultTimestampUTC)
+}
+
+// SetLogger replaces logger used by the service. Safe for concurrent use.
+func SetLogger(logger log.Logger) {
+	root.Swap(logger)
+}
+
+// Default returns the service logger for lines not related to any request
+func Default() log.Logger {
+	return &root
+}
+
+type contextKey int
+
+const requestIDKey contextKey = iota
+
+// WithRequestID returns context with request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID returns ID of the request ctx belongs to or empty string
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// FromContext returns the service logger adding request ID to lines if ctx has one
+func FromContext(ctx context.Context) log.Logger {
+	if id := RequestID(ctx); id != "" {
+		return log.With(&root, "request_id", id)
+	}
+	return &root
+}
+
+// NewRequestID returns random 128 bit request ID in hex
+func NewRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// ValidRequestID tells if request ID received from a client can be used.
+// It should be 1 to 128 characters: letters, digits, '-', '_', '.', ':' or '/',
+// so it can not break log lines.
+func ValidRequestID(id string) bool {
+	if len(id) == 0 || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-' || c == '_' || c == '.' || c == ':' || c == '/':
+		default:
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,68 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestFromContext(t *testing.T) {
+	buf := bytes.Buffer{}
+	logger, err := NewLogger("json", &buf)
+	if err != nil {
+		t.Fatalf("Unexpected error in NewLogger: %v", err)
+	}
+	SetLogger(logger)
+	defer SetLogger(defaultLogger())
+
+	ctx := WithRequestID(context.Background(), "abc")
+	FromContext(ctx).Log("msg", "hello")
+	line := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("Expected JSON log line, got %q: %v", buf.String(), err)
+	}
+	if line["request_id"] != "abc" || line["msg"] != "hello" || line["ts"] == nil {
+		t.Errorf("Unexpected log line %v", line)
+	}
+
+	buf.Reset()
+	FromContext(context.Background()).Log("msg", "hello")
+	if strings.Contains(buf.String(), "request_id") {
+		t.Errorf("Expected no request ID without request, got %s", buf.String())
+	}
+}
+
+func TestNewLogger(t *testing.T) {
+	buf := bytes.Buffer{}
+	logger, err := NewLogger("logfmt", &buf)
+	if err != nil {
+		t.Fatalf("Unexpected error in NewLogger: %v", err)
+	}
+	logger.Log("msg", "hello world")
+	if !strings.Contains(buf.String(), `msg="hello world"`) {
+		t.Errorf("Expected logfmt line, got %q", buf.String())
+	}
+	if _, err := NewLogger("xml", &buf); err != ErrUnknownFormat {
+		t.Errorf("Expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func TestValidRequestID(t *testing.T) {
+	cases := map[string]bool{
+		NewRequestID():           true,
+		"req-1_a.b:c/d":          true,
+		"":                       false,
+		"with space":             false,
+		"quote\"":                false,
+		"new\nline":              false,
+		strings.Repeat("a", 129): false,
+		strings.Repeat("a", 128): true,
+	}
+	for id, valid := range cases {
+		if ValidRequestID(id) != valid {
+			t.Errorf("Expected ValidRequestID(%q) to be %v", id, valid)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+// Package metrics implements counters, histograms and gauges with labels
+// exposed in Prometheus text format, so the service can be scraped without
+// depending on Prometheus client library.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are histogram buckets suitable for request latencies in seconds
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// collector writes samples of one metric family
+type collector interface {
+	name() string
+	write(w io.Writer) error
+}
+
+// Registry is a set of metrics exposed together. Registry is a http.Handler serving them.
+type Registry struct {
+	mu         sync.Mutex
+	collectors map[string]collector
+}
+
+// DefaultRegistry is a registry metrics of the service are exposed from
+var DefaultRegistry = NewRegistry()
+
+// NewRegistry returns an empty registry
+func NewRegistry() *Registry {
+	return &Registry{collectors: map[string]collector{}}
+}
+
+// register adds collector to the registry. Registering the same name twice is a programming error.
+func (r *Registry) register(c collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.collectors[c.name()]; ok {
+		panic(fmt.Sprintf("metric %s is already registered", c.name()))
+	}
+	r.collectors[c.name()] = c
+}
+
+// WriteText writes all metrics in Prometheus text format ordered by name
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	collectors := make([]collector, 0, len(r.collectors))
+	for _, c := range r.collectors {
+		collectors = append(collectors, c)
+	}
+	r.mu.Unlock()
+	sort.Slice(collectors, func(i, j int) bool { return collectors[i].name() < collectors[j].name() })
+	for _, c := range collectors {
+		if err := c.write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ServeHTTP serves metrics to Prometheus scraper
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if err := r.WriteText(w); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// desc is a name, help and label names of a metric family
+type desc struct {
+	metricName string
+	help       string
+	typ        string
+	labels     []string
+}
+
+func (d *desc) name() string {
+	return d.metricName
+}
+
+func (d *desc) writeHeader(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", d.metricName, escapeHelp(d.help), d.metricName, d.typ)
+	return err
+}
+
+// key joins label values into a map key
+func (d *desc) key(values []string) string {
+	if len(values) != len(d.labels) {
+		panic(fmt.Sprintf("metric %s has %d labels, got %d values", d.metricName, len(d.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+// labelPairs formats labels as {name="value",...}, extra pair is appended if given
+func (d *desc) labelPairs(values []string, extra ...string) string {
+	pairs := []string{}
+	for i, l := range d.labels {
+		pairs = append(pairs, l+`="`+escapeLabel(values[i])+`"`)
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, extra[0]+`="`+escapeLabel(extra[1])+`"`)
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// series are label values of a metric with the value
+type series struct {
+	values []string
+	value  float64
+}
+
+// CounterVec is a family of counters partitioned by labels
+type CounterVec struct {
+	desc
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+// NewCounterVec creates and registers a counter family
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{desc: desc{name, help, "counter", labels}, series: map[string]*series{}}
+	r.register(c)
+	return c
+}
+
+// Add adds non-negative v to the counter with given label values
+func (c *CounterVec) Add(v float64, values ...string) {
+	if v < 0 {
+		panic("counter can not decrease")
+	}
+	key := c.key(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	s, ok := c.series[key]
+	if !ok {
+		s = &series{values: append([]string{}, values...)}
+		c.series[key] = s
+	}
+	s.value += v
+}
+
+// Inc increments the counter with given label values
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Value returns current value of the counter with given label values
+func (c *CounterVec) Value(values ...string) float64 {
+	key := c.key(values)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if s, ok := c.series[key]; ok {
+		return s.value
+	}
+	return 0
+}
+
+func (c *CounterVec) write(w io.Writer) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.writeHeader(w); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(c.series))
+	for key := range c.series {
+		keys = append(keys, key)
+	}
+	// sorted, so output is stable
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := c.series[key]
+		if _, err := fmt.Fprintf(w, "%s%s %s\n", c.metricName, c.labelPairs(s.values), formatFloat(s.value)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// histogramSeries are bucket counts of one histogram
+type histogramSeries struct {
+	values []string
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// HistogramVec is a family of histograms partitioned by labels
+type HistogramVec struct {
+	desc
+	buckets []float64
+	mu      sync.Mutex
+	series  map[string]*histogramSeries
+}
+
+// NewHistogramVec creates and registers a histogram family with given upper bounds of buckets
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	h := &HistogramVec{desc: desc{name, help, "histogram", labels},
+		buckets: append([]float64{}, buckets...),
+		series:  map[string]*histogramSeries{}}
+	sort.Float64s(h.buckets)
+	r.register(h)
+	return h
+}
+
+// Observe adds v to the histogram with given label values
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	key := h.key(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	s, ok := h.series[key]
+	if !ok {
+		s = &histogramSeries{values: append([]string{}, values...), counts: make([]uint64, len(h.buckets))}
+		h.series[key] = s
+	}
+	for i, upper := range h.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.sum += v
+}
+
+// Count returns number of observations of the histogram with given label values
+func (h *HistogramVec) Count(values ...string) uint64 {
+	key := h.key(values)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if s, ok := h.series[key]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) write(w io.Writer) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.writeHeader(w); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(h.series))
+	for key := range h.series {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		s := h.series[key]
+		// bucket counts are cumulative, as every observation is counted in all buckets it fits
+		for i, upper := range h.buckets {
+			if _, err := fmt.Fprintf(w, "%s_bucket%s %d\n",
+				h.metricName, h.labelPairs(s.values, "le", formatFloat(upper)), s.counts[i]); err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintf(w, "%s_bucket%s %d\n%s_sum%s %s\n%s_count%s %d\n",
+			h.metricName, h.labelPairs(s.values, "le", "+Inf"), s.count,
+			h.metricName, h.labelPairs(s.values), formatFloat(s.sum),
+			h.metricName, h.labelPairs(s.values), s.count)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// valueFunc is a metric which value is read when metrics are collected
+type valueFunc struct {
+	desc
+	value func() float64
+}
+
+// NewGaugeFunc registers a gauge which value is returned by f on every collection
+func (r *Registry) NewGaugeFunc(name, help string, f func() float64) {
+	r.register(&valueFunc{desc{name, help, "gauge", nil}, f})
+}
+
+// NewCounterFunc registers a counter which value is returned by f on every collection.
+// f should return monotonically increasing values.
+func (r *Registry) NewCounterFunc(name, help string, f func() float64) {
+	r.register(&valueFunc{desc{name, help, "counter", nil}, f})
+}
+
+func (v *valueFunc) write(w io.Writer) error {
+	if err := v.writeHeader(w); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "%s %s\n", v.metricName, formatFloat(v.value()))
+	return err
+}
@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"bytes"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCounterVec(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("requests_total", "Number of requests.", "route", "status")
+	c.Inc("/b", "200")
+	c.Add(2, "/a", "500")
+	c.Inc("/b", "200")
+
+	if v := c.Value("/b", "200"); v != 2 {
+		t.Errorf("Expected counter value 2, got %v", v)
+	}
+	buf := bytes.Buffer{}
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatalf("Unexpected error in WriteText: %v", err)
+	}
+	expected := `# HELP requests_total Number of requests.
+# TYPE requests_total counter
+requests_total{route="/a",status="500"} 2
+requests_total{route="/b",status="200"} 2
+`
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 0.1}, "route")
+	h.Observe(0.05, "/a")
+	h.Observe(0.5, "/a")
+	h.Observe(5, "/a")
+
+	if n := h.Count("/a"); n != 3 {
+		t.Errorf("Expected 3 observations, got %d", n)
+	}
+	buf := bytes.Buffer{}
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatalf("Unexpected error in WriteText: %v", err)
+	}
+	expected := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a",le="0.1"} 1
+latency_seconds_bucket{route="/a",le="1"} 2
+latency_seconds_bucket{route="/a",le="+Inf"} 3
+latency_seconds_sum{route="/a"} 5.55
+latency_seconds_count{route="/a"} 3
+`
+	if buf.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, buf.String())
+	}
+}
+
+func TestEscaping(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("escaped_total", "Back\\slash and\nnew line.", "value")
+	c.Inc("quote \" back\\slash \n")
+
+	buf := bytes.Buffer{}
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatalf("Unexpected error in WriteText: %v", err)
+	}
+	for _, line := range []string{
+		`# HELP escaped_total Back\\slash and\nnew line.`,
+		`escaped_total{value="quote \" back\\slash \n"} 1`,
+	} {
+		if !strings.Contains(buf.String(), line+"\n") {
+			t.Errorf("Expected line %s in:\n%s", line, buf.String())
+		}
+	}
+}
+
+func TestFuncsAndHandler(t *testing.T) {
+	r := NewRegistry()
+	r.NewGaugeFunc("b_gauge", "Gauge.", func() float64 { return 1.5 })
+	r.NewCounterFunc("a_total", "Counter.", func() float64 { return 7 })
+
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %q", ct)
+	}
+	expected := `# HELP a_total Counter.
+# TYPE a_total counter
+a_total 7
+# HELP b_gauge Gauge.
+# TYPE b_gauge gauge
+b_gauge 1.5
+`
+	if rec.Body.String() != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, rec.Body.String())
+	}
+}
+
+func TestDuplicateName(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounterVec("dup_total", "Counter.")
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering the same name twice to panic")
+		}
+	}()
+	r.NewGaugeFunc("dup_total", "Gauge.", func() float64 { return 0 })
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/c-pro/wallet-test/models"
+)
+
+const migrateUsage = `Usage:
+  wallet migrate [up]
+  wallet migrate down <version>
+  wallet migrate status`
+
+// runMigrateCommand applies or reverts schema migrations from the command line
+func runMigrateCommand(ctx context.Context, svc SchemaService, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		args = []string{"up"}
+	}
+	switch args[0] {
+	case "up":
+		return migrateTo(ctx, svc, models.LatestSchemaVersion(), out)
+	case "down":
+		if len(args) != 2 {
+			return fmt.Errorf("target version is required\n%s", migrateUsage)
+		}
+		target, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("invalid version %q\n%s", args[1], migrateUsage)
+		}
+		return migrateTo(ctx, svc, target, out)
+	case "status":
+		version, err := svc.SchemaVersion(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Schema version %d, latest %d\n", version, models.LatestSchemaVersion())
+		for _, m := range models.Migrations() {
+			state := "pending"
+			if m.Version <= version {
+				state = "applied"
+			}
+			fmt.Fprintf(out, "%d\t%s\t%s\n", m.Version, m.Name, state)
+		}
+		return nil
+	}
+	return fmt.Errorf("%v %q\n%s", errUnknownCommand, args[0], migrateUsage)
+}
+
+// migrateTo migrates schema to target version and reports the change
+func migrateTo(ctx context.Context, svc SchemaService, target int, out io.Writer) error {
+	version, err := svc.Migrate(ctx, target)
+	if err != nil {
+		return err
+	}
+	if version == target {
+		fmt.Fprintf(out, "Schema is already at version %d\n", target)
+		return nil
+	}
+	fmt.Fprintf(out, "Migrated schema from version %d to %d\n", version, target)
+	return nil
+}
@@ -0,0 +1,35 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/c-pro/wallet-test/models"
+)
+
+func TestMigrateCommand(t *testing.T) {
+	requireDB(t)
+	out := &bytes.Buffer{}
+	if err := runMigrateCommand(context.Background(), &schemaService{db}, nil, out); err != nil {
+		t.Fatalf("Unexpected error in migrate: %v", err)
+	}
+	if !strings.Contains(out.String(), "already") {
+		t.Errorf("Expected schema to be up to date, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := runMigrateCommand(context.Background(), &schemaService{db}, []string{"status"}, out); err != nil {
+		t.Fatalf("Unexpected error in migrate status: %v", err)
+	}
+	latest := models.LatestSchemaVersion()
+	if !strings.Contains(out.String(), fmt.Sprintf("Schema version %d, latest %d", latest, latest)) {
+		t.Errorf("Unexpected migrate status output %q", out.String())
+	}
+
+	if err := runMigrateCommand(context.Background(), &schemaService{db}, []string{"down"}, out); err == nil {
+		t.Error("Expected migrate down without version to fail")
+	}
+}
@@ -3,46 +3,114 @@ package models
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 
+	"github.com/lib/pq"
 	"github.com/shopspring/decimal"
 )
 
+// Constant errors
+var (
+	ErrDuplicateExternalID = errors.New("Account with this external ID already exists")
+	ErrOwnerNotFound       = errors.New("Owner not found")
+	ErrCurrencyNotFound    = errors.New("Currency not found")
+	ErrNegativeBalance     = errors.New("Account balance can not be negative")
+	ErrAccountFrozen       = errors.New("Account is frozen")
+)
+
+// postgres error codes
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503"
+	checkViolation      = "23514"
+)
+
 // Account is a representation of a particular account balance in currency
 type Account struct {
 	ID           int64
+	TenantID     int64 `json:"-"`
 	Name         string
+	ExternalID   string          `json:"ExternalID,omitempty"`
+	Metadata     json.RawMessage `json:"Metadata,omitempty"`
+	OwnerID      int64           `json:"OwnerID,omitempty"`
 	CurrencyID   int64
 	CurrencyName string
 	Amount       decimal.Decimal
+	Frozen       bool `json:"Frozen,omitempty"`
 }
 
-// GetAccounts returns all accounts from the database
-func GetAccounts(tx *sql.Tx) ([]Account, error) {
-	accounts := []Account{}
-	query := `select a.id,
+// accountBalance is an expression for account balance visible to clients:
+// main balance plus balances of all its shards (see SetAccountShards)
+const accountBalance = `(a.amount + coalesce((select sum(s.amount)
+					 from account_shards s
+					 where s.account_id = a.id), 0))`
+
+// accountColumns is a list of columns scanAccount expects to be selected
+const accountColumns = `a.id,
+					 a.tenant_id,
 					 a.currency_id,
 					 c.name,
-					 a.amount,
-					 a.name
+					 ` + accountBalance + `,
+					 a.name,
+					 coalesce(a.external_id, ''),
+					 a.metadata,
+					 coalesce(a.owner_id, 0),
+					 a.frozen`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanAccount reads accountColumns from a row into account
+func scanAccount(row rowScanner, account *Account) error {
+	var metadata []byte
+	err := row.Scan(&account.ID,
+		&account.TenantID,
+		&account.CurrencyID,
+		&account.CurrencyName,
+		&account.Amount,
+		&account.Name,
+		&account.ExternalID,
+		&metadata,
+		&account.OwnerID,
+		&account.Frozen,
+	)
+	if err != nil {
+		return err
+	}
+	account.Metadata = json.RawMessage(metadata)
+	return nil
+}
+
+// metadataParam converts account metadata to a query parameter.
+// Empty metadata is stored as an empty JSON object.
+func (a *Account) metadataParam() string {
+	if len(a.Metadata) == 0 {
+		return "{}"
+	}
+	return string(a.Metadata)
+}
+
+// GetAccounts returns all tenant's accounts from the database
+func GetAccounts(ctx context.Context, tx *sql.Tx, tenantID int64) ([]Account, error) {
+	accounts := []Account{}
+	query := `select ` + accountColumns + `
 				from accounts a
 				join currencies c on (a.currency_id = c.id)
+				where a.tenant_id = $1
 				order by a.id`
-	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
-	rows, err := tx.QueryContext(ctx, query)
+	rows, err := tx.QueryContext(ctx, query, tenantID)
 	if err != nil {
 		return accounts, err
 	}
 	defer rows.Close()
 	for rows.Next() {
 		account := Account{}
-		err := rows.Scan(&account.ID,
-			&account.CurrencyID,
-			&account.CurrencyName,
-			&account.Amount,
-			&account.Name,
-		)
-		if err != nil {
+		if err := scanAccount(rows, &account); err != nil {
 			// If it was a context timeout, return context error
 			if ctx.Err() != nil {
 				err = ctx.Err()
@@ -55,53 +123,78 @@ func GetAccounts(tx *sql.Tx) ([]Account, error) {
 }
 
 // Save inserts or updates Account record in the database
-// if Account.ID is zero, new record is created
-// otherwise existing record is updated
-func (a *Account) Save(tx *sql.Tx) error {
+// if Account.ID is zero, new record is created in Account.TenantID tenant
+// with Amount as its opening amount, otherwise existing record of the tenant is updated.
+// Amount is saved to the main balance, so shards of the account
+// have to be consolidated before update (see consolidateShards).
+func (a *Account) Save(ctx context.Context, tx *sql.Tx) error {
 	query := `update accounts
 			  set amount = $1,
-			      name = $2
-			  where id = $3
+			      name = $2,
+			      external_id = nullif($3, ''),
+			      metadata = $4,
+			      owner_id = nullif($5::bigint, 0)
+			  where id = $6
+			    and tenant_id = $7
 			  returning id`
-	params := []interface{}{a.Amount, a.Name, a.ID}
+	params := []interface{}{a.Amount, a.Name, a.ExternalID, a.metadataParam(), a.OwnerID, a.ID, a.TenantID}
 	if a.ID == 0 {
-		query = `insert into accounts(currency_id, amount, name)
-			  values($1, $2, $3)
+		query = `insert into accounts(tenant_id, currency_id, amount, opening_amount, name, external_id, metadata, owner_id)
+			  values($1, $2, $3, $3, $4, nullif($5, ''), $6, nullif($7::bigint, 0))
 			  returning id`
-		params = []interface{}{a.CurrencyID, a.Amount, a.Name}
+		params = []interface{}{a.TenantID,
+			a.CurrencyID,
+			a.Amount,
+			a.Name,
+			a.ExternalID,
+			a.metadataParam(),
+			a.OwnerID}
 	}
-	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
+	ctx, span := startQuerySpan(ctx, "save account", query)
 	err := tx.QueryRowContext(ctx, query, params...).Scan(&a.ID)
+	span.End(err)
 	if err != nil {
 		// If it was a context timeout, return context error
 		if ctx.Err() != nil {
 			err = ctx.Err()
 		}
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch {
+			case pqErr.Code == uniqueViolation &&
+				pqErr.Constraint == "accounts_external_id_key":
+				err = ErrDuplicateExternalID
+			case pqErr.Code == foreignKeyViolation &&
+				pqErr.Constraint == "accounts_owner_id_fkey":
+				err = ErrOwnerNotFound
+			case pqErr.Code == foreignKeyViolation &&
+				pqErr.Constraint == "accounts_currency_id_fkey":
+				err = ErrCurrencyNotFound
+			case pqErr.Code == checkViolation &&
+				pqErr.Constraint == "accounts_balance_check":
+				err = ErrNegativeBalance
+			}
+		}
 		return err
 	}
 
 	return nil
 }
 
-// GetAccount returns account with given ID from the database
-func GetAccount(tx *sql.Tx, id int64) (Account, error) {
+// GetAccount returns tenant's account with given ID from the database
+func GetAccount(ctx context.Context, tx *sql.Tx, tenantID, id int64) (Account, error) {
 	account := Account{}
-	query := `select a.id,
-					 a.currency_id,
-					 c.name,
-					 a.amount,
-					 a.name
+	query := `select ` + accountColumns + `
 				from accounts a
 				join currencies c on (a.currency_id = c.id)
-				where a.id = $1`
-	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+				where a.id = $1
+				  and a.tenant_id = $2`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
-	err := tx.QueryRowContext(ctx, query, id).Scan(&account.ID,
-		&account.CurrencyID,
-		&account.CurrencyName,
-		&account.Amount,
-		&account.Name)
+	ctx, span := startQuerySpan(ctx, "select account", query)
+	err := scanAccount(tx.QueryRowContext(ctx, query, id, tenantID), &account)
+	span.End(err)
 	if err != nil {
 		// If it was a context timeout, return context error
 		if ctx.Err() != nil {
@@ -112,43 +205,133 @@ func GetAccount(tx *sql.Tx, id int64) (Account, error) {
 	return account, nil
 }
 
-// lockAccountsForTransaction acquires lock for a pair of accounts and returns true.
-// If one or both of accounts are locked it will return false and we need to retry attempt later.
-// Transaction should be rolled back if we get false, otherwise we can hold lock for one of
+// GetAccountByExternalID returns tenant's account with given external ID from the database
+func GetAccountByExternalID(ctx context.Context, tx *sql.Tx, tenantID int64, externalID string) (Account, error) {
+	account := Account{}
+	query := `select ` + accountColumns + `
+				from accounts a
+				join currencies c on (a.currency_id = c.id)
+				where a.external_id = $1
+				  and a.tenant_id = $2`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	err := scanAccount(tx.QueryRowContext(ctx, query, externalID, tenantID), &account)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return account, err
+	}
+	return account, nil
+}
+
+// SetAccountFrozen freezes or unfreezes tenant's account.
+// Frozen account can not participate in payments.
+func SetAccountFrozen(ctx context.Context, tx *sql.Tx, tenantID, id int64, frozen bool) error {
+	query := `update accounts
+			  set frozen = $1
+			  where id = $2
+			    and tenant_id = $3
+			  returning id`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	err := tx.QueryRowContext(ctx, query, frozen, id, tenantID).Scan(&id)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// lockAccountsForTransaction acquires lock for a set of accounts and returns true.
+// If some of accounts are locked it will return false and we need to retry attempt later.
+// Transaction should be rolled back if we get false, otherwise we can hold lock for some of
 // the accounts for no reason.
-func lockAccountsForTransaction(tx *sql.Tx, id1, id2 int64) (bool, error) {
+// Accounts of other tenants are treated as nonexistent.
+func lockAccountsForTransaction(ctx context.Context, tx *sql.Tx, tenantID int64, ids []int64) (bool, error) {
 	count := 0
 
 	query := `select count(*) from accounts
-			   where id in ($1, $2)`
-	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
-	err := tx.QueryRowContext(ctx, query, id1, id2).Scan(&count)
+			   where id = any($1)
+			     and tenant_id = $2`
+	queryCtx, cancel := context.WithTimeout(ctx, queryTimeout)
+	queryCtx, span := startQuerySpan(queryCtx, "check accounts", query)
+	err := tx.QueryRowContext(queryCtx, query, pq.Array(ids), tenantID).Scan(&count)
+	span.End(err)
 	if err != nil {
 		// If it was a context timeout, return context error
-		if ctx.Err() != nil {
-			err = ctx.Err()
+		if queryCtx.Err() != nil {
+			err = queryCtx.Err()
 		}
 		cancel()
 		return false, err
 	}
 	cancel()
-	if count != 2 {
+	if count != len(ids) {
 		return false, sql.ErrNoRows
 	}
 
 	query = `select count(*) from
 			  (select * from accounts
-			   where id in ($1, $2)
+			   where id = any($1)
+			     and tenant_id = $2
 			  for update skip locked) v`
-	ctx, cancel = context.WithTimeout(context.Background(), queryTimeout)
+	queryCtx, cancel = context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
-	err = tx.QueryRowContext(ctx, query, id1, id2).Scan(&count)
+	queryCtx, span = startQuerySpan(queryCtx, "lock accounts", query)
+	err = tx.QueryRowContext(queryCtx, query, pq.Array(ids), tenantID).Scan(&count)
+	span.End(err)
 	if err != nil {
+		// If it was a context timeout, return context error
+		if queryCtx.Err() != nil {
+			err = queryCtx.Err()
+		}
+		return false, err
+	}
+	return count == len(ids), nil
+}
+
+// lockAccountsOrdered locks a set of accounts waiting for locks held by other transactions.
+// Rows are locked in ascending ID order, so two transactions locking the same accounts
+// in any order can not deadlock.
+// Accounts of other tenants are treated as nonexistent.
+func lockAccountsOrdered(ctx context.Context, tx *sql.Tx, tenantID int64, ids []int64) error {
+	// rows are locked after sorting, i.e. in the order they are returned
+	query := `select id from accounts
+			   where id = any($1)
+			     and tenant_id = $2
+			   order by id
+			  for update`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	ctx, span := startQuerySpan(ctx, "lock accounts ordered", query)
+	rows, err := tx.QueryContext(ctx, query, pq.Array(ids), tenantID)
+	if err != nil {
+		span.End(err)
 		// If it was a context timeout, return context error
 		if ctx.Err() != nil {
 			err = ctx.Err()
 		}
-		return false, err
+		return err
 	}
-	return count == 2, nil
+	defer rows.Close()
+	count := 0
+	for rows.Next() {
+		count++
+	}
+	span.End(rows.Err())
+	if err := rows.Err(); err != nil {
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return err
+	}
+	if count != len(ids) {
+		return sql.ErrNoRows
+	}
+	return nil
 }
@@ -1,6 +1,9 @@
 package models
 
 import (
+	"context"
+	"database/sql"
+	"encoding/json"
 	"fmt"
 	"math/rand"
 	"testing"
@@ -17,21 +20,34 @@ func randomName() string {
 
 func TestSaveAccount(t *testing.T) {
 	amount, _ := decimal.NewFromString("123.321")
-	a := &Account{ID: 0, CurrencyID: 1, Amount: amount, Name: randomName()}
+	a := &Account{TenantID: DefaultTenantID, ID: 0, CurrencyID: 1, Amount: amount, Name: randomName()}
 	tx, err := db.Begin()
 	if err != nil {
 		t.Fatalf("Unexpected error in db.Begin(): %v", err)
 	}
 	defer tx.Rollback()
 
-	if err := a.Save(tx); err != nil {
+	if err := a.Save(context.Background(), tx); err != nil {
 		t.Errorf("Unexpected error in Account.Save: %v", err)
 	}
 }
 
+func TestSaveAccountNegativeBalance(t *testing.T) {
+	a := &Account{TenantID: DefaultTenantID, CurrencyID: 1, Amount: decimal.New(-1, 0), Name: randomName()}
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := a.Save(context.Background(), tx); err != ErrNegativeBalance {
+		t.Errorf("Expected Account.Save to return ErrNegativeBalance, got %v", err)
+	}
+}
+
 func TestGetAccount(t *testing.T) {
 	amount, _ := decimal.NewFromString("123.321")
-	a := &Account{CurrencyID: 1, Amount: amount}
+	a := &Account{TenantID: DefaultTenantID, CurrencyID: 1, Amount: amount}
 	tx, err := db.Begin()
 	if err != nil {
 		t.Fatalf("Unexpected error in db.Begin(): %v", err)
@@ -39,11 +55,11 @@ func TestGetAccount(t *testing.T) {
 	defer tx.Rollback()
 
 	// insert new
-	if err := a.Save(tx); err != nil {
+	if err := a.Save(context.Background(), tx); err != nil {
 		t.Errorf("Unexpected error in Account.Save: %v", err)
 	}
 
-	a2, err := GetAccount(tx, a.ID)
+	a2, err := GetAccount(context.Background(), tx, DefaultTenantID, a.ID)
 	if err != nil {
 		t.Errorf("Unexpected error in GetAccount: %v", err)
 	}
@@ -59,11 +75,11 @@ func TestGetAccount(t *testing.T) {
 	a2.Amount = a2.Amount.Sub(a.Amount) // shoud be zero
 
 	// update existing
-	if err := a2.Save(tx); err != nil {
+	if err := a2.Save(context.Background(), tx); err != nil {
 		t.Errorf("Unexpected error in Account.Save: %v", err)
 	}
 
-	a3, err := GetAccount(tx, a.ID)
+	a3, err := GetAccount(context.Background(), tx, DefaultTenantID, a.ID)
 	if err != nil {
 		t.Errorf("Unexpected error in GetAccount: %v", err)
 	}
@@ -85,14 +101,14 @@ func TestGetAccounts(t *testing.T) {
 	accNumber := 100
 
 	for i := 0; i < accNumber; i++ {
-		a := &Account{CurrencyID: 1, Amount: amount, Name: randomName()}
+		a := &Account{TenantID: DefaultTenantID, CurrencyID: 1, Amount: amount, Name: randomName()}
 		// insert new
-		if err := a.Save(tx); err != nil {
+		if err := a.Save(context.Background(), tx); err != nil {
 			t.Fatalf("Unexpected error in Account.Save: %v", err)
 		}
 	}
 
-	accounts, err := GetAccounts(tx)
+	accounts, err := GetAccounts(context.Background(), tx, DefaultTenantID)
 	if err != nil {
 		t.Errorf("Unexpected error in GetAccounts: %v", err)
 	}
@@ -115,3 +131,46 @@ func TestGetAccounts(t *testing.T) {
 	}
 
 }
+
+func TestGetAccountByExternalID(t *testing.T) {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+
+	a := &Account{TenantID: DefaultTenantID, CurrencyID: 1,
+		Amount:     decimal.Zero,
+		Name:       randomName(),
+		ExternalID: randomName(),
+		Metadata:   json.RawMessage(`{"tier": "gold"}`)}
+	if err := a.Save(context.Background(), tx); err != nil {
+		t.Fatalf("Unexpected error in Account.Save: %v", err)
+	}
+
+	a2, err := GetAccountByExternalID(context.Background(), tx, DefaultTenantID, a.ExternalID)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetAccountByExternalID: %v", err)
+	}
+
+	if a2.ID != a.ID {
+		t.Errorf("Returned account id %d does not match one we saved %d", a2.ID, a.ID)
+	}
+
+	metadata := map[string]string{}
+	if err := json.Unmarshal(a2.Metadata, &metadata); err != nil {
+		t.Fatalf("Failed to unmarshal metadata %q: %v", a2.Metadata, err)
+	}
+	if metadata["tier"] != "gold" {
+		t.Errorf("Expected metadata tier to be gold, but got %q", metadata["tier"])
+	}
+
+	if _, err := GetAccountByExternalID(context.Background(), tx, DefaultTenantID, randomName()); err != sql.ErrNoRows {
+		t.Errorf("Expected GetAccountByExternalID to return sql.ErrNoRows, got %v", err)
+	}
+
+	dup := &Account{TenantID: DefaultTenantID, CurrencyID: 1, Amount: decimal.Zero, ExternalID: a.ExternalID}
+	if err := dup.Save(context.Background(), tx); err != ErrDuplicateExternalID {
+		t.Errorf("Expected Account.Save to return ErrDuplicateExternalID, got %v", err)
+	}
+}
@@ -0,0 +1,211 @@
+package models
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// apiKeyBytes is a number of random bytes in a generated API key
+const apiKeyBytes = 32
+
+// Roles API key can have
+const (
+	// RoleAdmin can do anything including API key management
+	RoleAdmin = "admin"
+	// RoleAuditor has read only access
+	RoleAuditor = "auditor"
+	// RoleOperator can read everything, create owners and accounts and make deposits
+	RoleOperator = "operator"
+	// RoleClient can only make payments from accounts of its owner
+	RoleClient = "client"
+)
+
+// Constant errors
+var (
+	ErrInvalidRole   = errors.New("Role should be one of admin, auditor, operator or client")
+	ErrOwnerRequired = errors.New("Client role requires owner")
+)
+
+// ValidRole returns true if role is one of known roles
+func ValidRole(role string) bool {
+	switch role {
+	case RoleAdmin, RoleAuditor, RoleOperator, RoleClient:
+		return true
+	}
+	return false
+}
+
+// APIKey is a credential used by clients to authenticate API requests.
+// Key itself is shown only once when issued, database stores only its hash.
+type APIKey struct {
+	ID        int64
+	TenantID  int64 `json:"-"`
+	Name      string
+	Role      string
+	OwnerID   int64 `json:"OwnerID,omitempty"`
+	CreatedAt time.Time
+	RevokedAt *time.Time `json:"RevokedAt,omitempty"`
+}
+
+// validateRole checks role of a key to be issued
+func validateRole(role string, ownerID int64) error {
+	if !ValidRole(role) {
+		return ErrInvalidRole
+	}
+	if role == RoleClient && ownerID == 0 {
+		return ErrOwnerRequired
+	}
+	return nil
+}
+
+// HashAPIKey returns a hash of API key as it is stored in the database
+func HashAPIKey(key string) []byte {
+	sum := sha256.Sum256([]byte(key))
+	return sum[:]
+}
+
+// generateSecret returns a new random API key or HMAC secret
+func generateSecret() (string, error) {
+	b := make([]byte, apiKeyBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// IssueAPIKey generates a new API key with given role and stores its hash in the database.
+// Client role keys must be bound to an owner of the same tenant.
+// Returns key record and the key itself.
+func IssueAPIKey(ctx context.Context, tx *sql.Tx, tenantID int64, name, role string, ownerID int64) (APIKey, string, error) {
+	apiKey := APIKey{TenantID: tenantID, Name: name, Role: role, OwnerID: ownerID}
+	if err := validateRole(role, ownerID); err != nil {
+		return apiKey, "", err
+	}
+	key, err := generateSecret()
+	if err != nil {
+		return apiKey, "", err
+	}
+	query := `insert into api_keys(tenant_id, name, key_hash, role, owner_id)
+			  values($1, $2, $3, $4, nullif($5::bigint, 0))
+			  returning id, created_at`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	err = tx.QueryRowContext(ctx, query, tenantID, name, HashAPIKey(key), role, ownerID).
+		Scan(&apiKey.ID, &apiKey.CreatedAt)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return apiKey, "", keyForeignKeyError(err)
+	}
+	return apiKey, key, nil
+}
+
+// keyForeignKeyError maps foreign key violations on key insert to constant errors
+func keyForeignKeyError(err error) error {
+	pqErr, ok := err.(*pq.Error)
+	if !ok || pqErr.Code != foreignKeyViolation {
+		return err
+	}
+	switch pqErr.Constraint {
+	case "api_keys_owner_id_fkey", "hmac_keys_owner_id_fkey":
+		return ErrOwnerNotFound
+	case "api_keys_tenant_id_fkey", "hmac_keys_tenant_id_fkey":
+		return ErrTenantNotFound
+	}
+	return err
+}
+
+// GetAPIKeys returns all tenant's API keys including revoked ones
+func GetAPIKeys(ctx context.Context, tx *sql.Tx, tenantID int64) ([]APIKey, error) {
+	apiKeys := []APIKey{}
+	query := `select id, tenant_id, name, role, coalesce(owner_id, 0), created_at, revoked_at
+				from api_keys
+				where tenant_id = $1
+				order by id`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	rows, err := tx.QueryContext(ctx, query, tenantID)
+	if err != nil {
+		return apiKeys, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		apiKey := APIKey{}
+		err := rows.Scan(&apiKey.ID,
+			&apiKey.TenantID,
+			&apiKey.Name,
+			&apiKey.Role,
+			&apiKey.OwnerID,
+			&apiKey.CreatedAt,
+			&apiKey.RevokedAt,
+		)
+		if err != nil {
+			// If it was a context timeout, return context error
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return apiKeys, err
+		}
+		apiKeys = append(apiKeys, apiKey)
+	}
+	return apiKeys, nil
+}
+
+// GetAPIKeyByKey finds active (not revoked) API key record by the key itself.
+// Key is looked up across all tenants, TenantID of the record defines tenant of the client.
+func GetAPIKeyByKey(ctx context.Context, tx *sql.Tx, key string) (APIKey, error) {
+	apiKey := APIKey{}
+	query := `select id, tenant_id, name, role, coalesce(owner_id, 0), created_at, revoked_at
+				from api_keys
+				where key_hash = $1
+				  and revoked_at is null`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	err := tx.QueryRowContext(ctx, query, HashAPIKey(key)).Scan(&apiKey.ID,
+		&apiKey.TenantID,
+		&apiKey.Name,
+		&apiKey.Role,
+		&apiKey.OwnerID,
+		&apiKey.CreatedAt,
+		&apiKey.RevokedAt,
+	)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return apiKey, err
+	}
+	return apiKey, nil
+}
+
+// RevokeAPIKey marks API key as revoked so it can not be used anymore.
+// Returns sql.ErrNoRows if tenant has no active key with given ID.
+func RevokeAPIKey(ctx context.Context, tx *sql.Tx, tenantID, id int64) error {
+	query := `update api_keys
+			  set revoked_at = now()
+			  where id = $1
+			    and tenant_id = $2
+			    and revoked_at is null
+			  returning id`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	err := tx.QueryRowContext(ctx, query, id, tenantID).Scan(&id)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,111 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestIssueAPIKey(t *testing.T) {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+
+	apiKey, key, err := IssueAPIKey(context.Background(), tx, DefaultTenantID, randomName(), RoleAdmin, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error in IssueAPIKey: %v", err)
+	}
+	if apiKey.ID == 0 || key == "" {
+		t.Fatalf("Expected key and its ID to be set, got %q and %d", key, apiKey.ID)
+	}
+
+	found, err := GetAPIKeyByKey(context.Background(), tx, key)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetAPIKeyByKey: %v", err)
+	}
+	if found.ID != apiKey.ID || found.Role != RoleAdmin {
+		t.Errorf("Expected to find admin key %d, got %+v", apiKey.ID, found)
+	}
+
+	if _, err := GetAPIKeyByKey(context.Background(), tx, key+"0"); err != sql.ErrNoRows {
+		t.Errorf("Expected GetAPIKeyByKey to return sql.ErrNoRows, got %v", err)
+	}
+
+	var stored []byte
+	if err := tx.QueryRow("select key_hash from api_keys where id = $1", apiKey.ID).Scan(&stored); err != nil {
+		t.Fatalf("Failed to read key hash: %v", err)
+	}
+	if string(stored) == key {
+		t.Error("API key should not be stored in plain text")
+	}
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+
+	apiKey, key, err := IssueAPIKey(context.Background(), tx, DefaultTenantID, randomName(), RoleAuditor, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error in IssueAPIKey: %v", err)
+	}
+
+	if err := RevokeAPIKey(context.Background(), tx, DefaultTenantID, apiKey.ID); err != nil {
+		t.Fatalf("Unexpected error in RevokeAPIKey: %v", err)
+	}
+
+	if _, err := GetAPIKeyByKey(context.Background(), tx, key); err != sql.ErrNoRows {
+		t.Errorf("Expected revoked key lookup to return sql.ErrNoRows, got %v", err)
+	}
+
+	if err := RevokeAPIKey(context.Background(), tx, DefaultTenantID, apiKey.ID); err != sql.ErrNoRows {
+		t.Errorf("Expected second RevokeAPIKey to return sql.ErrNoRows, got %v", err)
+	}
+
+	keys, err := GetAPIKeys(context.Background(), tx, DefaultTenantID)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetAPIKeys: %v", err)
+	}
+	for _, k := range keys {
+		if k.ID == apiKey.ID && k.RevokedAt == nil {
+			t.Error("Expected revoked key to have RevokedAt set")
+		}
+	}
+}
+
+func TestIssueAPIKeyValidation(t *testing.T) {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, _, err := IssueAPIKey(context.Background(), tx, DefaultTenantID, randomName(), "root", 0); err != ErrInvalidRole {
+		t.Errorf("Expected IssueAPIKey to return ErrInvalidRole, got %v", err)
+	}
+
+	if _, _, err := IssueAPIKey(context.Background(), tx, DefaultTenantID, randomName(), RoleClient, 0); err != ErrOwnerRequired {
+		t.Errorf("Expected IssueAPIKey to return ErrOwnerRequired, got %v", err)
+	}
+
+	o := makeOwner(tx)
+	apiKey, key, err := IssueAPIKey(context.Background(), tx, DefaultTenantID, randomName(), RoleClient, o.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error in IssueAPIKey: %v", err)
+	}
+	found, err := GetAPIKeyByKey(context.Background(), tx, key)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetAPIKeyByKey: %v", err)
+	}
+	if found.ID != apiKey.ID || found.OwnerID != o.ID {
+		t.Errorf("Expected client key %d of owner %d, got %+v", apiKey.ID, o.ID, found)
+	}
+
+	if _, _, err := IssueAPIKey(context.Background(), tx, DefaultTenantID, randomName(), RoleClient, -1); err != ErrOwnerNotFound {
+		t.Errorf("Expected IssueAPIKey to return ErrOwnerNotFound, got %v", err)
+	}
+}
@@ -0,0 +1,197 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// AuditOK is outcome of successful operations
+const AuditOK = "ok"
+
+// AuditEntry is a record of a mutating operation: who did what, when, from where and with what outcome.
+// Audit log is append-only.
+type AuditEntry struct {
+	ID         int64
+	TenantID   int64
+	OccurredAt time.Time
+	// Principal is a name of authenticated API client or "cli" for admin commands
+	Principal string
+	Role      string
+	KeyID     int64 `json:",omitempty"`
+	// Action is an operation, e.g. account.create or payment.create
+	Action string
+	// Object is a record the operation changed, e.g. account/12
+	Object     string `json:",omitempty"`
+	RemoteIP   string `json:",omitempty"`
+	RequestID  string `json:",omitempty"`
+	BodySHA256 string `json:",omitempty"`
+	// Outcome is "ok" or error the operation failed with
+	Outcome string
+
+	written bool
+}
+
+// AuditFilter selects audit entries of a tenant, zero fields do not filter
+type AuditFilter struct {
+	Action    string
+	Principal string
+	Since     time.Time
+	Until     time.Time
+	Limit     int
+}
+
+// maxAuditEntries limits number of entries GetAuditLog returns
+const maxAuditEntries = 1000
+
+type auditContextKey struct{}
+
+// WithAudit returns context of an operation to be audited.
+// The entry is recorded by Commit in the transaction making the change.
+func WithAudit(ctx context.Context, e *AuditEntry) context.Context {
+	return context.WithValue(ctx, auditContextKey{}, e)
+}
+
+// AuditFromContext returns audit entry of the operation or nil
+func AuditFromContext(ctx context.Context) *AuditEntry {
+	e, _ := ctx.Value(auditContextKey{}).(*AuditEntry)
+	return e
+}
+
+// Written tells if the entry was committed along with the change it describes
+func (e *AuditEntry) Written() bool {
+	return e.written
+}
+
+// Commit commits tx changing object of the tenant. If ctx carries an audit entry (see WithAudit),
+// it is recorded in tx first, so the change can not be committed without its audit record.
+// Object is a record the change is about, e.g. account/12.
+func Commit(ctx context.Context, tx *sql.Tx, tenantID int64, object string) error {
+	e := AuditFromContext(ctx)
+	if e == nil || e.written {
+		return tx.Commit()
+	}
+	e.TenantID, e.Object, e.Outcome = tenantID, object, AuditOK
+	if err := e.Save(ctx, tx); err != nil {
+		return fmt.Errorf("failed to write audit log: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		e.ID = 0
+		return err
+	}
+	e.written = true
+	return nil
+}
+
+// Save inserts audit entry in the database. Entries can not be updated.
+func (e *AuditEntry) Save(ctx context.Context, tx *sql.Tx) error {
+	query := `insert into audit_log(tenant_id,
+									principal,
+									role,
+									key_id,
+									action,
+									object,
+									remote_ip,
+									request_id,
+									body_sha256,
+									outcome)
+			  values(nullif($1::bigint, 0), $2, $3, nullif($4::bigint, 0), $5,
+					 nullif($6, ''), nullif($7, ''), nullif($8, ''), nullif($9, ''), $10)
+			  returning id, occurred_at`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	err := tx.QueryRowContext(ctx, query,
+		e.TenantID,
+		e.Principal,
+		e.Role,
+		e.KeyID,
+		e.Action,
+		e.Object,
+		e.RemoteIP,
+		e.RequestID,
+		e.BodySHA256,
+		e.Outcome).Scan(&e.ID, &e.OccurredAt)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// GetAuditLog returns tenant's audit entries matching filter, oldest first.
+// At most filter.Limit entries are returned, and never more than 1000.
+func GetAuditLog(ctx context.Context, tx *sql.Tx, tenantID int64, filter AuditFilter) ([]AuditEntry, error) {
+	entries := []AuditEntry{}
+	limit := filter.Limit
+	if limit <= 0 || limit > maxAuditEntries {
+		limit = maxAuditEntries
+	}
+	var since, until *time.Time
+	if !filter.Since.IsZero() {
+		since = &filter.Since
+	}
+	if !filter.Until.IsZero() {
+		until = &filter.Until
+	}
+	query := `select id,
+					 coalesce(tenant_id, 0),
+					 occurred_at,
+					 principal,
+					 role,
+					 coalesce(key_id, 0),
+					 action,
+					 coalesce(object, ''),
+					 coalesce(remote_ip, ''),
+					 coalesce(request_id, ''),
+					 coalesce(body_sha256, ''),
+					 outcome
+				from audit_log
+				where tenant_id = $1
+				  and ($2 = '' or action = $2)
+				  and ($3 = '' or principal = $3)
+				  and ($4::timestamptz is null or occurred_at >= $4)
+				  and ($5::timestamptz is null or occurred_at < $5)
+				order by id
+				limit $6`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	rows, err := tx.QueryContext(ctx, query, tenantID, filter.Action, filter.Principal, since, until, limit)
+	if err != nil {
+		return entries, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		e := AuditEntry{written: true}
+		err := rows.Scan(&e.ID,
+			&e.TenantID,
+			&e.OccurredAt,
+			&e.Principal,
+			&e.Role,
+			&e.KeyID,
+			&e.Action,
+			&e.Object,
+			&e.RemoteIP,
+			&e.RequestID,
+			&e.BodySHA256,
+			&e.Outcome,
+		)
+		if err != nil {
+			// If it was a context timeout, return context error
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return entries, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// AuditObject returns audit reference to a record of given kind, e.g. account/12
+func AuditObject(kind string, id int64) string {
+	return fmt.Sprintf("%s/%d", kind, id)
+}
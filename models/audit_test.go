@@ -0,0 +1,41 @@
+package models
+
+import (
+	"context"
+	"testing"
+)
+
+func TestCommitWritesAuditEntry(t *testing.T) {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+
+	action := "test." + randomName()
+	e := &AuditEntry{Principal: "test", Role: RoleAdmin, Action: action}
+	ctx := WithAudit(context.Background(), e)
+	if err := Commit(ctx, tx, DefaultTenantID, AuditObject("account", 1)); err != nil {
+		t.Fatalf("Unexpected error in Commit: %v", err)
+	}
+	if !e.Written() || e.ID == 0 {
+		t.Fatalf("Expected entry to be written, got %+v", e)
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+	entries, err := GetAuditLog(context.Background(), tx, DefaultTenantID, AuditFilter{Action: action})
+	if err != nil {
+		t.Fatalf("Unexpected error in GetAuditLog: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Object != "account/1" || entries[0].Outcome != AuditOK {
+		t.Fatalf("Expected committed entry in audit log, got %+v", entries)
+	}
+
+	if _, err := tx.Exec("update audit_log set outcome = 'changed' where id = $1", e.ID); err == nil {
+		t.Error("Expected audit log update to fail")
+	}
+}
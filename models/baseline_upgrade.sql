@@ -0,0 +1,127 @@
+-- Upgrades schema of the first release (sql/01_schema.sql with currencies, accounts
+-- and payments only) to the layout of migration 0001_initial.
+-- Existing currencies, accounts and payments go to the default tenant.
+
+create table tenants (
+    id serial primary key,
+    name varchar not null unique
+);
+
+comment on table tenants is 'Brands sharing the service. All other data is isolated per tenant';
+
+insert into tenants(name)
+    values('default');
+
+-- foreign keys to single columns are replaced with composite ones below
+alter table accounts drop constraint accounts_currency_id_fkey;
+alter table payments drop constraint payments_currency_id_fkey;
+alter table payments drop constraint payments_buyer_account_id_fkey;
+alter table payments drop constraint payments_seller_account_id_fkey;
+
+alter table currencies add column tenant_id integer not null default 1 references tenants(id);
+alter table currencies alter column tenant_id drop default;
+alter table currencies drop constraint currencies_name_key;
+alter table currencies add constraint currencies_name_key unique (tenant_id, name);
+alter table currencies add constraint currencies_tenant_id_key unique (tenant_id, id);
+
+create table owners (
+    id bigserial primary key,
+    tenant_id integer not null references tenants(id),
+    name varchar not null,
+    constraint owners_tenant_id_key unique (tenant_id, id)
+);
+
+comment on table owners is 'Users or organizations owning one or more accounts';
+
+-- account names are not unique anymore, accounts are identified by external IDs
+alter table accounts drop constraint accounts_name_key;
+alter table accounts add column tenant_id integer not null default 1 references tenants(id);
+alter table accounts alter column tenant_id drop default;
+alter table accounts add column external_id varchar;
+alter table accounts add column metadata jsonb not null default '{}';
+alter table accounts add column owner_id bigint;
+alter table accounts add constraint accounts_external_id_key unique (tenant_id, external_id);
+alter table accounts add constraint accounts_tenant_id_key unique (tenant_id, id);
+alter table accounts add constraint accounts_owner_id_fkey foreign key (tenant_id, owner_id) references owners(tenant_id, id);
+alter table accounts add constraint accounts_currency_id_fkey foreign key (tenant_id, currency_id) references currencies(tenant_id, id);
+
+comment on column accounts.external_id is 'Optional client side identifier (e.g. user ID in an external system)';
+comment on column accounts.metadata is 'Arbitrary client supplied JSON attributes';
+
+create index accounts_owner_idx on accounts(tenant_id, owner_id, currency_id);
+
+create table account_shards (
+    tenant_id integer not null,
+    account_id bigint not null,
+    shard integer not null,
+    amount numeric(30,15) not null default 0,
+    primary key (account_id, shard),
+    constraint account_shards_amount_check check (amount >= 0),
+    constraint account_shards_account_id_fkey foreign key (tenant_id, account_id) references accounts(tenant_id, id)
+);
+
+comment on table account_shards is 'Sub-balances of hot accounts. Account balance is accounts.amount plus sum of its shards';
+
+-- account references were mistakenly declared as bigserial
+alter table payments alter column buyer_account_id drop default;
+alter table payments alter column seller_account_id drop default;
+drop sequence payments_buyer_account_id_seq;
+drop sequence payments_seller_account_id_seq;
+alter table payments add column tenant_id integer not null default 1 references tenants(id);
+alter table payments alter column tenant_id drop default;
+alter table payments add constraint payments_currency_id_fkey foreign key (tenant_id, currency_id) references currencies(tenant_id, id);
+alter table payments add constraint payments_buyer_account_id_fkey foreign key (tenant_id, buyer_account_id) references accounts(tenant_id, id);
+alter table payments add constraint payments_seller_account_id_fkey foreign key (tenant_id, seller_account_id) references accounts(tenant_id, id);
+
+create index payments_tenant_idx on payments(tenant_id, operation_timestamp);
+
+create table api_keys (
+    id bigserial primary key,
+    tenant_id integer not null references tenants(id),
+    name varchar not null,
+    key_hash bytea not null unique,
+    role varchar not null,
+    owner_id bigint,
+    created_at timestamp not null default now(),
+    revoked_at timestamp,
+    constraint api_keys_role_check check (role in ('admin', 'auditor', 'operator', 'client')),
+    constraint api_keys_client_owner_check check (role != 'client' or owner_id is not null),
+    constraint api_keys_owner_id_fkey foreign key (tenant_id, owner_id) references owners(tenant_id, id)
+);
+
+comment on table api_keys is 'API keys for client authentication. Only SHA-256 hashes of keys are stored';
+comment on column api_keys.owner_id is 'Owner whose accounts client role key may spend from';
+
+create table hmac_keys (
+    id bigserial primary key,
+    tenant_id integer not null references tenants(id),
+    name varchar not null,
+    secret varchar not null,
+    role varchar not null,
+    owner_id bigint,
+    created_at timestamp not null default now(),
+    revoked_at timestamp,
+    constraint hmac_keys_role_check check (role in ('admin', 'auditor', 'operator', 'client')),
+    constraint hmac_keys_client_owner_check check (role != 'client' or owner_id is not null),
+    constraint hmac_keys_owner_id_fkey foreign key (tenant_id, owner_id) references owners(tenant_id, id)
+);
+
+comment on table hmac_keys is 'Shared secrets for HMAC signed server-to-server requests';
+
+create table request_nonces (
+    key_id bigint not null references hmac_keys(id),
+    nonce varchar(64) not null,
+    expires_at timestamptz not null,
+    primary key (key_id, nonce)
+);
+
+comment on table request_nonces is 'Nonces of signed requests seen recently, for replay protection. Tenant is defined by the key';
+
+create index request_nonces_expires_idx on request_nonces(expires_at);
+
+insert into currencies(tenant_id, name)
+    values(1, 'USD'),
+          (1, 'RUB'),
+          (1, 'BTC'),
+          (1, 'ETC')
+    on conflict do nothing;
@@ -0,0 +1,490 @@
+package models
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Payments of a tenant form a hash chain: every payment stores hash of its contents
+// and of the previous payment, so editing or deleting a payment in the database
+// breaks the chain at that payment. Checkpoints sign the chain head with ed25519 key,
+// so the chain can not be rewritten from the edited payment on without the key either.
+//
+// Payments are inserted unchained and linked later in batches by ChainPayments,
+// so payment transactions never wait for the tenant's chain head.
+
+// chainBatchSize is how many payments ChainPayments links and VerifyPaymentChain reads with one query
+const chainBatchSize = 1000
+
+// ChainHash returns hex encoded SHA-256 of payment contents and previous payment hash
+func (p *Payment) ChainHash() string {
+	s := strings.Join([]string{
+		strconv.FormatInt(p.ID, 10),
+		strconv.FormatInt(p.TenantID, 10),
+		strconv.FormatInt(p.CurrencyID, 10),
+		// scale of payments.amount column
+		p.Amount.StringFixed(15),
+		strconv.FormatInt(p.BuyerAccountID, 10),
+		strconv.FormatInt(p.SellerAccountID, 10),
+		p.OperationTimestamp.UTC().Format(time.RFC3339Nano),
+		p.PrevHash,
+	}, "\n")
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// lockChainHead locks chain head of the tenant until tx ends and returns hash
+// and position of the last chained payment, empty and 0 if nothing is chained yet
+func lockChainHead(ctx context.Context, tx *sql.Tx, tenantID int64) (string, int64, error) {
+	query := `insert into payment_chain_heads(tenant_id, hash)
+			  values($1, '')
+			  on conflict (tenant_id) do update set tenant_id = excluded.tenant_id
+			  returning hash, seq`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	ctx, span := startQuerySpan(ctx, "lock payment chain", query)
+	var hash string
+	var seq int64
+	err := tx.QueryRowContext(ctx, query, tenantID).Scan(&hash, &seq)
+	span.End(err)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return "", 0, err
+	}
+	return hash, seq, nil
+}
+
+// getUnchainedBatch returns up to chainBatchSize committed tenant's payments
+// which are not linked into the chain yet, oldest first
+func getUnchainedBatch(ctx context.Context, tx *sql.Tx, tenantID int64) ([]Payment, error) {
+	payments := []Payment{}
+	query := `select id,
+					 tenant_id,
+					 currency_id,
+					 amount,
+					 buyer_account_id,
+					 seller_account_id,
+					 operation_timestamp
+				from payments
+				where tenant_id = $1
+				  and chain_seq is null
+				order by id
+				limit $2`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	ctx, span := startQuerySpan(ctx, "select unchained payments", query)
+	rows, err := tx.QueryContext(ctx, query, tenantID, chainBatchSize)
+	span.End(err)
+	if err != nil {
+		return payments, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		p := Payment{}
+		err := rows.Scan(&p.ID,
+			&p.TenantID,
+			&p.CurrencyID,
+			&p.Amount,
+			&p.BuyerAccountID,
+			&p.SellerAccountID,
+			&p.OperationTimestamp,
+		)
+		if err != nil {
+			// If it was a context timeout, return context error
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return payments, err
+		}
+		payments = append(payments, p)
+	}
+	return payments, rows.Err()
+}
+
+// linkPayments stores chain links of payments following position seq and moves chain head
+// to the last of them. Chain head should be locked by tx.
+func linkPayments(ctx context.Context, tx *sql.Tx, tenantID, seq int64, payments []Payment) error {
+	ids := make([]int64, len(payments))
+	prevHashes := make([]string, len(payments))
+	hashes := make([]string, len(payments))
+	seqs := make([]int64, len(payments))
+	for i, p := range payments {
+		ids[i], prevHashes[i], hashes[i], seqs[i] = p.ID, p.PrevHash, p.Hash, seq+int64(i)+1
+	}
+	last := len(payments) - 1
+	query := `with linked as (
+				update payments p
+				   set prev_hash = l.prev_hash, hash = l.hash, chain_seq = l.seq
+				  from unnest($1::bigint[], $2::text[], $3::text[], $4::bigint[]) as l(id, prev_hash, hash, seq)
+				 where p.id = l.id
+			  )
+			  update payment_chain_heads set payment_id = $5, hash = $6, seq = $7 where tenant_id = $8`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	ctx, span := startQuerySpan(ctx, "chain payments", query)
+	_, err := tx.ExecContext(ctx, query,
+		pq.Array(ids),
+		pq.Array(prevHashes),
+		pq.Array(hashes),
+		pq.Array(seqs),
+		ids[last],
+		hashes[last],
+		seqs[last],
+		tenantID)
+	span.End(err)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// ChainPayments links committed tenant's payments which are not chained yet into the chain
+// and returns how many were linked. Payments are linked in ID order, but a payment committed
+// after a later one was linked goes after it, chain order is kept in chain_seq.
+// Chain head stays locked until tx ends, so payments are linked by one transaction at a time
+// and payment transactions do not touch the chain head at all.
+func ChainPayments(ctx context.Context, tx *sql.Tx, tenantID int64) (int, error) {
+	prevHash, seq, err := lockChainHead(ctx, tx, tenantID)
+	if err != nil {
+		return 0, err
+	}
+	linked := 0
+	for {
+		payments, err := getUnchainedBatch(ctx, tx, tenantID)
+		if err != nil || len(payments) == 0 {
+			return linked, err
+		}
+		for i := range payments {
+			payments[i].PrevHash = prevHash
+			payments[i].Hash = payments[i].ChainHash()
+			prevHash = payments[i].Hash
+		}
+		if err := linkPayments(ctx, tx, tenantID, seq, payments); err != nil {
+			return linked, err
+		}
+		seq += int64(len(payments))
+		linked += len(payments)
+		if len(payments) < chainBatchSize {
+			return linked, nil
+		}
+	}
+}
+
+// Checkpoint is a signed statement that the chain of tenant's payments ended
+// with payment PaymentID having hash Hash at CreatedAt. Checkpoints can not be updated.
+type Checkpoint struct {
+	ID        int64
+	TenantID  int64
+	PaymentID int64
+	Hash      string
+	CreatedAt time.Time
+	// PublicKey is hex encoded ed25519 key the checkpoint is signed with
+	PublicKey string
+	Signature string
+}
+
+// signedString returns checkpoint contents covered by signature
+func (c *Checkpoint) signedString() string {
+	return strings.Join([]string{
+		"wallet payment chain checkpoint",
+		strconv.FormatInt(c.TenantID, 10),
+		strconv.FormatInt(c.PaymentID, 10),
+		c.Hash,
+		c.CreatedAt.UTC().Format(time.RFC3339Nano),
+	}, "\n")
+}
+
+// Sign signs checkpoint with the key
+func (c *Checkpoint) Sign(key ed25519.PrivateKey) {
+	c.PublicKey = hex.EncodeToString(key.Public().(ed25519.PublicKey))
+	c.Signature = hex.EncodeToString(ed25519.Sign(key, []byte(c.signedString())))
+}
+
+// Verify tells if checkpoint is signed with the key
+func (c *Checkpoint) Verify(key ed25519.PublicKey) bool {
+	sig, err := hex.DecodeString(c.Signature)
+	return err == nil && ed25519.Verify(key, []byte(c.signedString()), sig)
+}
+
+// MakeCheckpoint links pending payments of the tenant, signs the chain head with the key
+// and saves the checkpoint. Chain head is locked until tx ends, so checkpoints made
+// concurrently (e.g. by several replicas) are made one after another and the later one
+// sees the checkpoint of the earlier. Returns false if there are no chained payments
+// or no new ones since the last checkpoint.
+func MakeCheckpoint(ctx context.Context, tx *sql.Tx, tenantID int64, key ed25519.PrivateKey) (Checkpoint, bool, error) {
+	c := Checkpoint{TenantID: tenantID}
+	if _, err := ChainPayments(ctx, tx, tenantID); err != nil {
+		return c, false, err
+	}
+	query := `select h.payment_id,
+					 h.hash,
+					 coalesce((select c.payment_id
+								 from payment_checkpoints c
+								where c.tenant_id = h.tenant_id
+								order by c.id desc
+								limit 1), 0)
+				from payment_chain_heads h
+				where h.tenant_id = $1
+				  and h.payment_id is not null`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	var lastID int64
+	err := tx.QueryRowContext(ctx, query, tenantID).Scan(&c.PaymentID, &c.Hash, &lastID)
+	if err == sql.ErrNoRows {
+		return c, false, nil
+	}
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return c, false, err
+	}
+	if c.PaymentID == lastID {
+		return c, false, nil
+	}
+
+	// postgres keeps microseconds, signed time should be the same as stored
+	c.CreatedAt = time.Now().UTC().Truncate(time.Microsecond)
+	c.Sign(key)
+	query = `insert into payment_checkpoints(tenant_id, payment_id, hash, created_at, public_key, signature)
+			 values($1, $2, $3, $4, $5, $6)
+			 returning id`
+	err = tx.QueryRowContext(ctx, query, c.TenantID, c.PaymentID, c.Hash, c.CreatedAt, c.PublicKey, c.Signature).Scan(&c.ID)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return c, false, err
+	}
+	return c, true, nil
+}
+
+// GetCheckpoints returns all tenant's checkpoints, oldest first
+func GetCheckpoints(ctx context.Context, tx *sql.Tx, tenantID int64) ([]Checkpoint, error) {
+	checkpoints := []Checkpoint{}
+	query := `select id, tenant_id, payment_id, hash, created_at, public_key, signature
+				from payment_checkpoints
+				where tenant_id = $1
+				order by id`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	rows, err := tx.QueryContext(ctx, query, tenantID)
+	if err != nil {
+		return checkpoints, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		c := Checkpoint{}
+		err := rows.Scan(&c.ID, &c.TenantID, &c.PaymentID, &c.Hash, &c.CreatedAt, &c.PublicKey, &c.Signature)
+		if err != nil {
+			// If it was a context timeout, return context error
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return checkpoints, err
+		}
+		checkpoints = append(checkpoints, c)
+	}
+	return checkpoints, rows.Err()
+}
+
+// ChainBreak is the first broken link of payment chain
+type ChainBreak struct {
+	PaymentID int64
+	Reason    string
+}
+
+// ChainReport is a result of payment chain verification
+type ChainReport struct {
+	// Payments is number of chained payments checked
+	Payments int
+	// Unchained is number of payments not linked into the chain yet (see ChainPayments)
+	Unchained int
+	// Checkpoints is number of checkpoints matched against the chain
+	Checkpoints   int
+	HeadPaymentID int64
+	HeadHash      string
+	// Broken is nil if the chain is intact
+	Broken *ChainBreak
+}
+
+// chainLink is a chained payment as stored
+type chainLink struct {
+	Payment
+	seq int64
+}
+
+// getChainLinks returns up to chainBatchSize tenant's payments following position afterSeq of the chain
+func getChainLinks(ctx context.Context, tx *sql.Tx, tenantID, afterSeq int64) ([]chainLink, error) {
+	links := []chainLink{}
+	query := `select id,
+					 tenant_id,
+					 currency_id,
+					 amount,
+					 buyer_account_id,
+					 seller_account_id,
+					 operation_timestamp,
+					 chain_seq,
+					 coalesce(prev_hash, ''),
+					 coalesce(hash, '')
+				from payments
+				where tenant_id = $1
+				  and chain_seq > $2
+				order by chain_seq
+				limit $3`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	rows, err := tx.QueryContext(ctx, query, tenantID, afterSeq, chainBatchSize)
+	if err != nil {
+		return links, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		l := chainLink{}
+		err := rows.Scan(&l.ID,
+			&l.TenantID,
+			&l.CurrencyID,
+			&l.Amount,
+			&l.BuyerAccountID,
+			&l.SellerAccountID,
+			&l.OperationTimestamp,
+			&l.seq,
+			&l.PrevHash,
+			&l.Hash,
+		)
+		if err != nil {
+			// If it was a context timeout, return context error
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return links, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+// getUnchained returns number of tenant's payments which are not linked into the chain yet
+func getUnchained(ctx context.Context, tx *sql.Tx, tenantID int64) (int, error) {
+	query := `select count(*)
+				from payments
+				where tenant_id = $1
+				  and chain_seq is null`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	var count int
+	if err := tx.QueryRowContext(ctx, query, tenantID).Scan(&count); err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return 0, err
+	}
+	return count, nil
+}
+
+// VerifyPaymentChain walks tenant's payments in chain order and reports the first broken link:
+// a payment which contents do not match its hash, which previous hash does not match
+// the previous payment, or which hash differs from a checkpoint. Payments not linked yet
+// are only counted: unlinking a chained payment breaks the link of the next one or the head.
+// Checkpoint signatures are verified if key is not nil. tx should be a repeatable read
+// transaction, so payments made during verification are not seen.
+func VerifyPaymentChain(ctx context.Context, tx *sql.Tx, tenantID int64, key ed25519.PublicKey) (ChainReport, error) {
+	report := ChainReport{}
+	checkpoints, err := GetCheckpoints(ctx, tx, tenantID)
+	if err != nil {
+		return report, err
+	}
+	byPayment := map[int64][]Checkpoint{}
+	for _, c := range checkpoints {
+		byPayment[c.PaymentID] = append(byPayment[c.PaymentID], c)
+	}
+	broken := func(id int64, format string, args ...interface{}) (ChainReport, error) {
+		report.Broken = &ChainBreak{id, fmt.Sprintf(format, args...)}
+		return report, nil
+	}
+
+	if report.Unchained, err = getUnchained(ctx, tx, tenantID); err != nil {
+		return report, err
+	}
+
+	prevSeq, prevID, prevHash := int64(0), int64(0), ""
+	for {
+		links, err := getChainLinks(ctx, tx, tenantID, prevSeq)
+		if err != nil {
+			return report, err
+		}
+		for _, l := range links {
+			switch {
+			case l.PrevHash != prevHash && report.Payments == 0:
+				return broken(l.ID, "previous hash does not match the chain start")
+			case l.PrevHash != prevHash:
+				return broken(l.ID, "previous hash does not match payment %d", prevID)
+			case l.ChainHash() != l.Hash:
+				return broken(l.ID, "hash does not match payment contents")
+			}
+			for _, c := range byPayment[l.ID] {
+				if key != nil && !c.Verify(key) {
+					return broken(l.ID, "checkpoint %d signature is invalid", c.ID)
+				}
+				if c.Hash != l.Hash {
+					return broken(l.ID, "hash does not match checkpoint %d", c.ID)
+				}
+				report.Checkpoints++
+			}
+			delete(byPayment, l.ID)
+			report.Payments++
+			prevSeq, prevID, prevHash = l.seq, l.ID, l.Hash
+		}
+		if len(links) < chainBatchSize {
+			break
+		}
+	}
+
+	// checkpoints of deleted payments
+	for _, c := range checkpoints {
+		if _, ok := byPayment[c.PaymentID]; ok {
+			return broken(c.PaymentID, "payment of checkpoint %d is missing", c.ID)
+		}
+	}
+
+	query := `select coalesce(payment_id, 0), hash
+				from payment_chain_heads
+				where tenant_id = $1`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	err = tx.QueryRowContext(ctx, query, tenantID).Scan(&report.HeadPaymentID, &report.HeadHash)
+	if err == sql.ErrNoRows && report.Payments == 0 {
+		return report, nil
+	}
+	if err != nil && err != sql.ErrNoRows {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return report, err
+	}
+	if report.HeadPaymentID != prevID || report.HeadHash != prevHash {
+		// payments at the end of the chain were deleted
+		return broken(report.HeadPaymentID, "chain head does not match the last payment %d", prevID)
+	}
+	return report, nil
+}
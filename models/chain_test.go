@@ -0,0 +1,152 @@
+package models
+
+import (
+	"context"
+	"crypto/ed25519"
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+// makeChain saves n payments between two accounts of a new tenant and links them into the chain
+func makeChain(t *testing.T, tx *sql.Tx, n int) []Payment {
+	tenant := Tenant{Name: randomName()}
+	if err := tenant.Save(context.Background(), tx); err != nil {
+		t.Fatalf("Unexpected error in Tenant.Save: %v", err)
+	}
+	currency := Currency{TenantID: tenant.ID, Name: "USD"}
+	if err := currency.Save(context.Background(), tx); err != nil {
+		t.Fatalf("Unexpected error in Currency.Save: %v", err)
+	}
+	accounts := []Account{}
+	for i := 0; i < 2; i++ {
+		a := Account{TenantID: tenant.ID, CurrencyID: currency.ID, Amount: decimal.New(100, 0), Name: randomName()}
+		if err := a.Save(context.Background(), tx); err != nil {
+			t.Fatalf("Unexpected error in Account.Save: %v", err)
+		}
+		accounts = append(accounts, a)
+	}
+	payments := []Payment{}
+	for i := 0; i < n; i++ {
+		p := Payment{TenantID: tenant.ID,
+			CurrencyID:      currency.ID,
+			Amount:          decimal.New(int64(i+1), -1),
+			BuyerAccountID:  accounts[i%2].ID,
+			SellerAccountID: accounts[(i+1)%2].ID}
+		if err := p.Save(context.Background(), tx); err != nil {
+			t.Fatalf("Unexpected error in Payment.Save: %v", err)
+		}
+	}
+	if linked, err := ChainPayments(context.Background(), tx, tenant.ID); err != nil || linked != n {
+		t.Fatalf("Expected %d payments to be linked, got %d (%v)", n, linked, err)
+	}
+	links, err := getChainLinks(context.Background(), tx, tenant.ID, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error in getChainLinks: %v", err)
+	}
+	for _, l := range links {
+		payments = append(payments, l.Payment)
+	}
+	return payments
+}
+
+func TestPaymentChain(t *testing.T) {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+
+	payments := makeChain(t, tx, 3)
+	tenantID := payments[0].TenantID
+	if payments[0].PrevHash != "" || payments[1].PrevHash != payments[0].Hash || payments[2].PrevHash != payments[1].Hash {
+		t.Fatalf("Expected payments to be chained, got %+v", payments)
+	}
+
+	_, key, _ := ed25519.GenerateKey(nil)
+	checkpoint, created, err := MakeCheckpoint(context.Background(), tx, tenantID, key)
+	if err != nil || !created {
+		t.Fatalf("Expected checkpoint to be made, got %v, %v", created, err)
+	}
+	if checkpoint.PaymentID != payments[2].ID || !checkpoint.Verify(key.Public().(ed25519.PublicKey)) {
+		t.Errorf("Expected signed checkpoint of the last payment, got %+v", checkpoint)
+	}
+	if _, created, _ := MakeCheckpoint(context.Background(), tx, tenantID, key); created {
+		t.Error("Expected no checkpoint without new payments")
+	}
+
+	report, err := VerifyPaymentChain(context.Background(), tx, tenantID, key.Public().(ed25519.PublicKey))
+	if err != nil {
+		t.Fatalf("Unexpected error in VerifyPaymentChain: %v", err)
+	}
+	if report.Broken != nil || report.Payments != 3 || report.Checkpoints != 1 || report.HeadHash != payments[2].Hash {
+		t.Fatalf("Expected intact chain of 3 payments, got %+v", report)
+	}
+
+	// payments not linked yet are only counted
+	p := Payment{TenantID: tenantID, CurrencyID: payments[0].CurrencyID, Amount: decimal.New(1, 0),
+		BuyerAccountID: payments[0].BuyerAccountID, SellerAccountID: payments[0].SellerAccountID}
+	if err := p.Save(context.Background(), tx); err != nil {
+		t.Fatalf("Unexpected error in Payment.Save: %v", err)
+	}
+	report, err = VerifyPaymentChain(context.Background(), tx, tenantID, nil)
+	if err != nil || report.Broken != nil || report.Payments != 3 || report.Unchained != 1 {
+		t.Fatalf("Expected intact chain of 3 payments and 1 pending, got %+v (%v)", report, err)
+	}
+	checkpoint, created, err = MakeCheckpoint(context.Background(), tx, tenantID, key)
+	if err != nil || !created || checkpoint.PaymentID != p.ID {
+		t.Fatalf("Expected checkpoint to link and sign pending payment %d, got %+v, %v, %v", p.ID, checkpoint, created, err)
+	}
+
+	if _, err := tx.Exec("update payments set amount = amount + 1 where id = $1", payments[1].ID); err != nil {
+		t.Fatalf("Failed to edit payment: %v", err)
+	}
+	report, err = VerifyPaymentChain(context.Background(), tx, tenantID, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error in VerifyPaymentChain: %v", err)
+	}
+	if report.Broken == nil || report.Broken.PaymentID != payments[1].ID {
+		t.Fatalf("Expected chain to break at edited payment %d, got %+v", payments[1].ID, report)
+	}
+}
+
+func TestPaymentChainRewritten(t *testing.T) {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+
+	payments := makeChain(t, tx, 2)
+	tenantID := payments[0].TenantID
+	_, key, _ := ed25519.GenerateKey(nil)
+	if _, _, err := MakeCheckpoint(context.Background(), tx, tenantID, key); err != nil {
+		t.Fatalf("Unexpected error in MakeCheckpoint: %v", err)
+	}
+
+	// the last payment is edited and its hash recalculated, so only checkpoint can tell
+	p := payments[1]
+	p.Amount = p.Amount.Add(decimal.New(1, 0))
+	p.Hash = p.ChainHash()
+	_, err = tx.Exec(`update payments set amount = $2, hash = $3 where id = $1`, p.ID, p.Amount, p.Hash)
+	if err != nil {
+		t.Fatalf("Failed to edit payment: %v", err)
+	}
+	if _, err := tx.Exec("update payment_chain_heads set hash = $2 where tenant_id = $1", tenantID, p.Hash); err != nil {
+		t.Fatalf("Failed to edit chain head: %v", err)
+	}
+
+	report, err := VerifyPaymentChain(context.Background(), tx, tenantID, key.Public().(ed25519.PublicKey))
+	if err != nil {
+		t.Fatalf("Unexpected error in VerifyPaymentChain: %v", err)
+	}
+	if report.Broken == nil || !strings.Contains(report.Broken.Reason, "checkpoint") {
+		t.Fatalf("Expected rewritten chain to break at checkpoint, got %+v", report)
+	}
+
+	if _, err := tx.Exec("delete from payment_checkpoints"); err == nil {
+		t.Error("Expected checkpoint delete to fail")
+	}
+}
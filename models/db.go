@@ -5,13 +5,47 @@ import (
 	"database/sql"
 	"time"
 
+	"github.com/c-pro/wallet-test/tracing"
 	// blind import postgres driver
 	_ "github.com/lib/pq"
 )
 
-const queryTimeout = time.Second * 5
-const numRetries = 5
-const retryDelay = time.Second * 2
+// Config holds database access parameters
+type Config struct {
+	// MaxOpenConns limits size of the connection pool
+	MaxOpenConns int
+	// QueryTimeout caps duration of a single query
+	QueryTimeout time.Duration
+	// ConnectRetries is how many times OpenDB tries to connect
+	ConnectRetries int
+	// RetryDelay is a pause between connection attempts
+	RetryDelay time.Duration
+	// LockRetries is how many times MakePayment tries to lock accounts with skip-locked strategy
+	LockRetries int
+}
+
+// DefaultConfig is used unless Configure is called
+var DefaultConfig = Config{
+	MaxOpenConns:   20,
+	QueryTimeout:   time.Second * 5,
+	ConnectRetries: 5,
+	RetryDelay:     time.Second * 2,
+	LockRetries:    15,
+}
+
+var config = DefaultConfig
+
+// queryTimeout caps duration of a single query.
+// It is applied on top of the caller's context, so the query is also
+// canceled when the request is canceled or its deadline is exceeded.
+var queryTimeout = config.QueryTimeout
+
+// Configure sets database access parameters.
+// It is not safe for concurrent use and should be called on startup before any other function of the package.
+func Configure(c Config) {
+	config = c
+	queryTimeout = c.QueryTimeout
+}
 
 // OpenDB connects to postgresql database
 func OpenDB(dsn string) (*sql.DB, error) {
@@ -20,10 +54,10 @@ func OpenDB(dsn string) (*sql.DB, error) {
 		err error
 	)
 
-	for i := 0; i < numRetries; i++ {
+	for i := 0; i < config.ConnectRetries; i++ {
 		db, err = sql.Open("postgres", dsn)
 		if err != nil {
-			time.Sleep(retryDelay)
+			time.Sleep(config.RetryDelay)
 			continue
 		}
 
@@ -31,7 +65,7 @@ func OpenDB(dsn string) (*sql.DB, error) {
 		err = db.PingContext(ctx)
 		cancel()
 		if err != nil {
-			time.Sleep(retryDelay)
+			time.Sleep(config.RetryDelay)
 			continue
 		}
 		break
@@ -42,7 +76,15 @@ func OpenDB(dsn string) (*sql.DB, error) {
 	}
 
 	db.SetConnMaxLifetime(0)
-	db.SetMaxOpenConns(20)
+	db.SetMaxOpenConns(config.MaxOpenConns)
 
 	return db, nil
 }
+
+// startQuerySpan starts span of a SQL statement, it should be ended with statement error
+func startQuerySpan(ctx context.Context, name, query string) (context.Context, *tracing.Span) {
+	ctx, span := tracing.Start(ctx, name, tracing.SpanKindClient)
+	span.SetAttribute("db.system", "postgresql")
+	span.SetAttribute("db.statement", query)
+	return ctx, span
+}
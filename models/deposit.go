@@ -0,0 +1,115 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/c-pro/wallet-test/tracing"
+	"github.com/shopspring/decimal"
+)
+
+// ErrDepositNotUpdatable is returned when saving already stored deposit
+var ErrDepositNotUpdatable = errors.New("Deposits can not be updated")
+
+// Deposit is a representation of money coming into an account from outside the service
+type Deposit struct {
+	ID                 int64
+	TenantID           int64 `json:"-"`
+	AccountID          int64
+	CurrencyID         int64
+	Amount             decimal.Decimal
+	OperationTimestamp time.Time
+}
+
+// Save inserts Deposit record in the database
+func (d *Deposit) Save(ctx context.Context, tx *sql.Tx) error {
+	if d.ID != 0 {
+		return ErrDepositNotUpdatable
+	}
+	query := `insert into deposits(tenant_id, account_id, amount)
+			  values($1, $2, $3)
+			  returning id, amount, operation_timestamp`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	ctx, span := startQuerySpan(ctx, "insert deposit", query)
+	err := tx.QueryRowContext(ctx, query, d.TenantID, d.AccountID, d.Amount).Scan(&d.ID, &d.Amount, &d.OperationTimestamp)
+	span.End(err)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// creditAccount adds amount to the main balance of tenant's account and returns
+// its currency and whether it is frozen. Account row stays locked until tx ends.
+func creditAccount(ctx context.Context, tx *sql.Tx, tenantID, id int64, amount decimal.Decimal) (int64, bool, error) {
+	query := `update accounts
+			  set amount = amount + $1
+			  where id = $2
+			    and tenant_id = $3
+			  returning currency_id, frozen`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	ctx, span := startQuerySpan(ctx, "credit account", query)
+	var currencyID int64
+	var frozen bool
+	err := tx.QueryRowContext(ctx, query, amount, id, tenantID).Scan(&currencyID, &frozen)
+	span.End(err)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return 0, false, err
+	}
+	return currencyID, frozen, nil
+}
+
+// MakeDeposit adds amount coming from outside the service to tenant's account balance
+// and records the deposit. Amount goes to the main balance, so the account is locked
+// only by the update itself and payments to its shards are not blocked.
+// Missing (or belonging to another tenant) account is reported with sql.ErrNoRows.
+func MakeDeposit(ctx context.Context, db *sql.DB, tenantID, accountID int64, amount decimal.Decimal) (Deposit, error) {
+	deposit := Deposit{}
+
+	// amount should be greater then zero
+	if amount.Cmp(decimal.Zero) <= 0 {
+		return deposit, ErrNonPositiveAmount
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return deposit, err
+	}
+	defer RollbackWithLog(ctx, tx)
+
+	currencyID, frozen, err := creditAccount(ctx, tx, tenantID, accountID, amount)
+	if err != nil {
+		return deposit, err
+	}
+
+	// frozen accounts can neither pay nor be paid
+	if frozen {
+		return deposit, ErrAccountFrozen
+	}
+
+	deposit.TenantID = tenantID
+	deposit.AccountID = accountID
+	deposit.CurrencyID = currencyID
+	deposit.Amount = amount
+
+	if err := deposit.Save(ctx, tx); err != nil {
+		return deposit, err
+	}
+
+	_, span := tracing.Start(ctx, "commit", tracing.SpanKindClient)
+	err = Commit(ctx, tx, tenantID, AuditObject("deposit", deposit.ID))
+	span.End(err)
+	return deposit, err
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestSaveDeposit(t *testing.T) {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+
+	a := makeAccount(tx, 1, "0")
+	d := Deposit{TenantID: DefaultTenantID, AccountID: a.ID, CurrencyID: a.CurrencyID, Amount: decimal.New(5, 0)}
+	if err := d.Save(context.Background(), tx); err != nil {
+		t.Fatalf("Unexpected error in Deposit.Save: %v", err)
+	}
+	if d.ID == 0 {
+		t.Error("Deposit ID should not be zero")
+	}
+	if time.Now().Sub(d.OperationTimestamp) > time.Minute {
+		t.Errorf("Operation timestamp is far from Now: %s", d.OperationTimestamp)
+	}
+	if err := d.Save(context.Background(), tx); err != ErrDepositNotUpdatable {
+		t.Errorf("Attempt to save existing deposit should fail with ErrDepositNotUpdatable. Got %v", err)
+	}
+}
+
+func TestMakeDepositAudited(t *testing.T) {
+	cleanDb(t)
+	defer cleanDb(t)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	a := makeAccount(tx, 1, "10")
+	tx.Commit()
+
+	action := "test." + randomName()
+	e := &AuditEntry{Principal: "test", Role: RoleOperator, Action: action}
+	d, err := MakeDeposit(WithAudit(context.Background(), e), db, DefaultTenantID, a.ID, decimal.New(5, 0))
+	if err != nil {
+		t.Fatalf("Unexpected error in MakeDeposit: %v", err)
+	}
+	if !e.Written() {
+		t.Fatalf("Expected audit entry to be written, got %+v", e)
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+	entries, err := GetAuditLog(context.Background(), tx, DefaultTenantID, AuditFilter{Action: action})
+	if err != nil {
+		t.Fatalf("Unexpected error in GetAuditLog: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Object != AuditObject("deposit", d.ID) {
+		t.Fatalf("Expected audit entry of deposit %d, got %+v", d.ID, entries)
+	}
+	account, err := GetAccount(context.Background(), tx, DefaultTenantID, a.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetAccount: %v", err)
+	}
+	if !account.Amount.Equals(decimal.New(15, 0)) {
+		t.Errorf("Expected amount 15 after deposit, got %s", account.Amount)
+	}
+}
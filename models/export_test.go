@@ -0,0 +1,8 @@
+package models
+
+import "database/sql"
+
+// TestingDB returns database connection of package tests to external tests
+func TestingDB() *sql.DB {
+	return db
+}
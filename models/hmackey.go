@@ -0,0 +1,180 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrNonceReused is returned when signed request nonce was already seen
+var ErrNonceReused = errors.New("Nonce was already used")
+
+// HMACKey is a shared secret used by server-to-server clients to sign requests.
+// Unlike API keys, secret has to be stored as is to verify signatures.
+type HMACKey struct {
+	ID        int64
+	TenantID  int64 `json:"-"`
+	Name      string
+	Role      string
+	OwnerID   int64  `json:"OwnerID,omitempty"`
+	Secret    string `json:"-"`
+	CreatedAt time.Time
+	RevokedAt *time.Time `json:"RevokedAt,omitempty"`
+}
+
+// IssueHMACKey generates a new HMAC key secret with given role and stores it in the database
+func IssueHMACKey(ctx context.Context, tx *sql.Tx, tenantID int64, name, role string, ownerID int64) (HMACKey, error) {
+	hmacKey := HMACKey{TenantID: tenantID, Name: name, Role: role, OwnerID: ownerID}
+	if err := validateRole(role, ownerID); err != nil {
+		return hmacKey, err
+	}
+	secret, err := generateSecret()
+	if err != nil {
+		return hmacKey, err
+	}
+	hmacKey.Secret = secret
+	query := `insert into hmac_keys(tenant_id, name, secret, role, owner_id)
+			  values($1, $2, $3, $4, nullif($5::bigint, 0))
+			  returning id, created_at`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	err = tx.QueryRowContext(ctx, query, tenantID, name, secret, role, ownerID).
+		Scan(&hmacKey.ID, &hmacKey.CreatedAt)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return hmacKey, keyForeignKeyError(err)
+	}
+	return hmacKey, nil
+}
+
+// GetHMACKeys returns all tenant's HMAC keys including revoked ones. Secrets are not returned.
+func GetHMACKeys(ctx context.Context, tx *sql.Tx, tenantID int64) ([]HMACKey, error) {
+	hmacKeys := []HMACKey{}
+	query := `select id, tenant_id, name, role, coalesce(owner_id, 0), created_at, revoked_at
+				from hmac_keys
+				where tenant_id = $1
+				order by id`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	rows, err := tx.QueryContext(ctx, query, tenantID)
+	if err != nil {
+		return hmacKeys, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		hmacKey := HMACKey{}
+		err := rows.Scan(&hmacKey.ID,
+			&hmacKey.TenantID,
+			&hmacKey.Name,
+			&hmacKey.Role,
+			&hmacKey.OwnerID,
+			&hmacKey.CreatedAt,
+			&hmacKey.RevokedAt,
+		)
+		if err != nil {
+			// If it was a context timeout, return context error
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return hmacKeys, err
+		}
+		hmacKeys = append(hmacKeys, hmacKey)
+	}
+	return hmacKeys, nil
+}
+
+// GetActiveHMACKey returns not revoked HMAC key with its secret.
+// Key is looked up across all tenants, TenantID of the record defines tenant of the client.
+func GetActiveHMACKey(ctx context.Context, tx *sql.Tx, id int64) (HMACKey, error) {
+	hmacKey := HMACKey{}
+	query := `select id, tenant_id, name, role, coalesce(owner_id, 0), secret, created_at, revoked_at
+				from hmac_keys
+				where id = $1
+				  and revoked_at is null`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	err := tx.QueryRowContext(ctx, query, id).Scan(&hmacKey.ID,
+		&hmacKey.TenantID,
+		&hmacKey.Name,
+		&hmacKey.Role,
+		&hmacKey.OwnerID,
+		&hmacKey.Secret,
+		&hmacKey.CreatedAt,
+		&hmacKey.RevokedAt,
+	)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return hmacKey, err
+	}
+	return hmacKey, nil
+}
+
+// RevokeHMACKey marks HMAC key as revoked.
+// Returns sql.ErrNoRows if tenant has no active key with given ID.
+func RevokeHMACKey(ctx context.Context, tx *sql.Tx, tenantID, id int64) error {
+	query := `update hmac_keys
+			  set revoked_at = now()
+			  where id = $1
+			    and tenant_id = $2
+			    and revoked_at is null
+			  returning id`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	err := tx.QueryRowContext(ctx, query, id, tenantID).Scan(&id)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// UseNonce records nonce of a signed request until it expires.
+// Returns ErrNonceReused if the nonce was already recorded for this key.
+func UseNonce(ctx context.Context, tx *sql.Tx, keyID int64, nonce string, expiresAt time.Time) error {
+	query := `insert into request_nonces(key_id, nonce, expires_at)
+			  values($1, $2, $3)
+			  on conflict do nothing
+			  returning key_id`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	err := tx.QueryRowContext(ctx, query, keyID, nonce, expiresAt).Scan(&keyID)
+	if err == sql.ErrNoRows {
+		return ErrNonceReused
+	}
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// DeleteExpiredNonces removes nonces which can not be replayed anymore
+// and returns number of deleted records
+func DeleteExpiredNonces(ctx context.Context, tx *sql.Tx) (int64, error) {
+	query := `delete from request_nonces
+			  where expires_at < now()`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	res, err := tx.ExecContext(ctx, query)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return 0, err
+	}
+	return res.RowsAffected()
+}
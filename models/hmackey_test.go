@@ -0,0 +1,87 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestIssueHMACKey(t *testing.T) {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+
+	hmacKey, err := IssueHMACKey(context.Background(), tx, DefaultTenantID, randomName(), RoleOperator, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error in IssueHMACKey: %v", err)
+	}
+	if hmacKey.ID == 0 || hmacKey.Secret == "" {
+		t.Fatalf("Expected key ID and secret to be set, got %+v", hmacKey)
+	}
+
+	found, err := GetActiveHMACKey(context.Background(), tx, hmacKey.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetActiveHMACKey: %v", err)
+	}
+	if found.Secret != hmacKey.Secret || found.Role != RoleOperator {
+		t.Errorf("Expected to find operator key with the same secret, got %+v", found)
+	}
+
+	if _, err := IssueHMACKey(context.Background(), tx, DefaultTenantID, randomName(), RoleClient, 0); err != ErrOwnerRequired {
+		t.Errorf("Expected IssueHMACKey to return ErrOwnerRequired, got %v", err)
+	}
+
+	if err := RevokeHMACKey(context.Background(), tx, DefaultTenantID, hmacKey.ID); err != nil {
+		t.Fatalf("Unexpected error in RevokeHMACKey: %v", err)
+	}
+	if _, err := GetActiveHMACKey(context.Background(), tx, hmacKey.ID); err != sql.ErrNoRows {
+		t.Errorf("Expected revoked key lookup to return sql.ErrNoRows, got %v", err)
+	}
+
+	keys, err := GetHMACKeys(context.Background(), tx, DefaultTenantID)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetHMACKeys: %v", err)
+	}
+	for _, k := range keys {
+		if k.Secret != "" {
+			t.Error("GetHMACKeys should not return secrets")
+		}
+	}
+}
+
+func TestUseNonce(t *testing.T) {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+
+	hmacKey, err := IssueHMACKey(context.Background(), tx, DefaultTenantID, randomName(), RoleAuditor, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error in IssueHMACKey: %v", err)
+	}
+
+	if err := UseNonce(context.Background(), tx, hmacKey.ID, "nonce", time.Now().Add(time.Minute)); err != nil {
+		t.Fatalf("Unexpected error in UseNonce: %v", err)
+	}
+	if err := UseNonce(context.Background(), tx, hmacKey.ID, "nonce", time.Now().Add(time.Minute)); err != ErrNonceReused {
+		t.Errorf("Expected UseNonce to return ErrNonceReused, got %v", err)
+	}
+	if err := UseNonce(context.Background(), tx, hmacKey.ID, "expired", time.Now().Add(-time.Minute)); err != nil {
+		t.Fatalf("Unexpected error in UseNonce: %v", err)
+	}
+
+	n, err := DeleteExpiredNonces(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("Unexpected error in DeleteExpiredNonces: %v", err)
+	}
+	if n < 1 {
+		t.Errorf("Expected expired nonce to be deleted, deleted %d", n)
+	}
+	if err := UseNonce(context.Background(), tx, hmacKey.ID, "nonce", time.Now().Add(time.Minute)); err != ErrNonceReused {
+		t.Errorf("Expected not expired nonce to survive cleanup, got %v", err)
+	}
+}
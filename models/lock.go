@@ -0,0 +1,172 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"math/rand"
+	"sync/atomic"
+	"time"
+
+	"github.com/c-pro/wallet-test/metrics"
+	"github.com/c-pro/wallet-test/tracing"
+)
+
+// LockStrategy defines how MakePayment locks buyer and seller accounts
+type LockStrategy int32
+
+// Lock strategies
+const (
+	// LockSkipLocked tries to lock both accounts with FOR UPDATE SKIP LOCKED
+	// and retries with exponential backoff if any of them is already locked
+	LockSkipLocked LockStrategy = iota
+	// LockOrdered waits for locks with blocking FOR UPDATE. Accounts are always
+	// locked in ascending ID order, so concurrent payments can not deadlock
+	LockOrdered
+)
+
+// ErrUnknownLockStrategy is returned for lock strategy names not known to ParseLockStrategy
+var ErrUnknownLockStrategy = errors.New("Lock strategy should be one of skip-locked or ordered")
+
+// lockStrategy is a strategy used by MakePayment
+var lockStrategy = int32(LockSkipLocked)
+
+// String returns name of the strategy as accepted by ParseLockStrategy
+func (s LockStrategy) String() string {
+	switch s {
+	case LockSkipLocked:
+		return "skip-locked"
+	case LockOrdered:
+		return "ordered"
+	}
+	return "unknown"
+}
+
+// ParseLockStrategy returns lock strategy by its name
+func ParseLockStrategy(name string) (LockStrategy, error) {
+	switch name {
+	case "skip-locked":
+		return LockSkipLocked, nil
+	case "ordered":
+		return LockOrdered, nil
+	}
+	return LockSkipLocked, ErrUnknownLockStrategy
+}
+
+// SetLockStrategy sets strategy MakePayment uses to lock accounts
+func SetLockStrategy(s LockStrategy) {
+	atomic.StoreInt32(&lockStrategy, int32(s))
+}
+
+// GetLockStrategy returns strategy MakePayment uses to lock accounts
+func GetLockStrategy() LockStrategy {
+	return LockStrategy(atomic.LoadInt32(&lockStrategy))
+}
+
+var (
+	lockAttempts = metrics.DefaultRegistry.NewHistogramVec("wallet_payment_lock_attempts",
+		"Number of attempts to lock payment accounts.",
+		[]float64{1, 2, 3, 4, 5, 7, 10, 15, 20, 30}, "strategy", "result")
+	lockWait = metrics.DefaultRegistry.NewHistogramVec("wallet_payment_lock_wait_seconds",
+		"Time spent locking payment accounts, including retries.",
+		metrics.DefaultBuckets, "strategy", "result")
+)
+
+// observeLock records lock attempts and wait time of a payment
+func observeLock(strategy LockStrategy, attempts int, wait time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "failed"
+	}
+	lockAttempts.Observe(float64(attempts), strategy.String(), result)
+	lockWait.Observe(wait.Seconds(), strategy.String(), result)
+}
+
+// paymentLocks returns IDs of accounts payment has to lock and number of seller's shards.
+// Payments to sharded accounts credit one of the shards, so seller account itself is not locked.
+func paymentLocks(ctx context.Context, tx *sql.Tx, tenantID, buyerID, sellerID int64) ([]int64, int, error) {
+	shards, err := GetAccountShards(ctx, tx, tenantID, sellerID)
+	if err != nil {
+		return nil, 0, err
+	}
+	if shards > 0 {
+		return []int64{buyerID}, shards, nil
+	}
+	return []int64{buyerID, sellerID}, 0, nil
+}
+
+// lockPayment locks payment accounts with given strategy and consolidates their shards.
+// Returns false if accounts are locked by another transaction and skip-locked strategy is used.
+func lockPayment(ctx context.Context,
+	tx *sql.Tx,
+	strategy LockStrategy,
+	tenantID,
+	buyerID,
+	sellerID int64) (bool, int, error) {
+
+	ids, shards, err := paymentLocks(ctx, tx, tenantID, buyerID, sellerID)
+	if err != nil {
+		return false, 0, err
+	}
+	locked := true
+	if strategy == LockOrdered {
+		err = lockAccountsOrdered(ctx, tx, tenantID, ids)
+	} else {
+		locked, err = lockAccountsForTransaction(ctx, tx, tenantID, ids)
+	}
+	if err != nil || !locked {
+		return false, 0, err
+	}
+	return true, shards, consolidateShards(ctx, tx, ids)
+}
+
+// beginLocked starts a transaction holding locks on payment accounts using current lock strategy.
+// With skip-locked strategy, if any of accounts is locked by another transaction,
+// it retries after increasing delay and gives up with ErrLockFailed after Config.LockRetries attempts.
+// With ordered strategy waiting is limited by ctx and queryTimeout.
+// Returns number of seller's shards (see paymentLocks).
+func beginLocked(ctx context.Context, db *sql.DB, tenantID, buyerID, sellerID int64) (tx *sql.Tx, shards int, err error) {
+	strategy := GetLockStrategy()
+	start, attempts := time.Now(), 0
+	ctx, span := tracing.Start(ctx, "lock payment accounts", tracing.SpanKindInternal)
+	span.SetAttribute("lock.strategy", strategy.String())
+	defer func() {
+		observeLock(strategy, attempts, time.Since(start), err)
+		span.SetAttribute("lock.attempts", attempts)
+		span.End(err)
+	}()
+
+	numRetries := uint(config.LockRetries)
+	for tryNum := uint(1); tryNum <= numRetries; tryNum++ {
+		attempts = int(tryNum)
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		locked, shards, err := lockPayment(ctx, tx, strategy, tenantID, buyerID, sellerID)
+		if err != nil {
+			RollbackWithLog(ctx, tx)
+			return nil, 0, err
+		}
+
+		// if lock for all accounts is acquired, proceed
+		if locked {
+			return tx, shards, nil
+		}
+		RollbackWithLog(ctx, tx)
+
+		// failed to acquire after numRetries
+		if tryNum == numRetries {
+			break
+		}
+
+		interval := (1<<tryNum)*5 + rand.Intn((1<<tryNum)*5)
+		select {
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		case <-time.After(time.Millisecond * time.Duration(interval)):
+		}
+	}
+	return nil, 0, ErrLockFailed
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"context"
+	"math/rand"
+	"sync/atomic"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestParseLockStrategy(t *testing.T) {
+	for _, s := range []LockStrategy{LockSkipLocked, LockOrdered} {
+		parsed, err := ParseLockStrategy(s.String())
+		if err != nil {
+			t.Errorf("Unexpected error in ParseLockStrategy(%q): %v", s, err)
+		}
+		if parsed != s {
+			t.Errorf("Expected ParseLockStrategy(%q) to return %d, got %d", s, s, parsed)
+		}
+	}
+	if _, err := ParseLockStrategy("optimistic"); err != ErrUnknownLockStrategy {
+		t.Errorf("Expected ErrUnknownLockStrategy, got %v", err)
+	}
+}
+
+func TestMakePaymentParallelOrdered(t *testing.T) {
+	SetLockStrategy(LockOrdered)
+	defer SetLockStrategy(LockSkipLocked)
+	TestMakePaymentParallel(t)
+}
+
+func TestMakePaymentOrdered(t *testing.T) {
+	SetLockStrategy(LockOrdered)
+	defer SetLockStrategy(LockSkipLocked)
+	TestMakePayment(t)
+}
+
+// benchmarkHotAccount makes payments from 100 buyers to a single seller account,
+// so every payment contends for the seller account lock. Payments are linked
+// into the chain concurrently, as the service does.
+func benchmarkHotAccount(b *testing.B, strategy LockStrategy) {
+	SetLockStrategy(strategy)
+	defer SetLockStrategy(LockSkipLocked)
+	cleanDb(nil)
+	defer cleanDb(nil)
+	tx, err := db.Begin()
+	if err != nil {
+		b.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	seller := makeAccount(tx, 1, "0")
+	buyers := []Account{}
+	for i := 0; i < 100; i++ {
+		buyers = append(buyers, makeAccount(tx, 1, "1000000"))
+	}
+	tx.Commit()
+	stopLinker := startLinker(b, DefaultTenantID)
+	defer stopLinker()
+	b.ResetTimer()
+
+	var lockFailures int64
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			bID := buyers[rand.Intn(len(buyers))].ID
+			_, err := MakePayment(context.Background(), db, DefaultTenantID, bID, seller.ID, decimal.New(1, -2))
+			if err == ErrLockFailed {
+				atomic.AddInt64(&lockFailures, 1)
+				continue
+			}
+			if err != nil {
+				b.Fatalf("Unexpected error in MakePayment: %v", err)
+			}
+		}
+	})
+	b.StopTimer()
+	stopLinker()
+	b.ReportMetric(float64(lockFailures)/float64(b.N), "lockfail/op")
+}
+
+func BenchmarkHotAccount(b *testing.B) {
+	b.Run("skip-locked", func(b *testing.B) { benchmarkHotAccount(b, LockSkipLocked) })
+	b.Run("ordered", func(b *testing.B) { benchmarkHotAccount(b, LockOrdered) })
+}
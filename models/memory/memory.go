@@ -0,0 +1,502 @@
+// Package memory implements models.Repository keeping all data in memory.
+// It is meant for tests and local development without a database.
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/c-pro/wallet-test/models"
+	"github.com/shopspring/decimal"
+)
+
+// record is a stored account along with its number of balance shards
+type record struct {
+	models.Account
+	shards int
+	// opening is the balance account was created with
+	opening decimal.Decimal
+	created time.Time
+}
+
+// Repository is an in-memory models.Repository.
+// All operations are serialized with a single lock, so transfers are atomic.
+// Tenants are not stored, any tenant ID is accepted, but data of different tenants is isolated.
+// Owners are not stored either, so account owner IDs are not checked.
+type Repository struct {
+	mu         sync.RWMutex
+	currencies []models.Currency
+	accounts   []*record
+	payments   []models.Payment
+	deposits   []models.Deposit
+}
+
+var _ models.Repository = (*Repository)(nil)
+
+// NewRepository returns an empty repository
+func NewRepository() *Repository {
+	return &Repository{}
+}
+
+// copyAccount returns a copy of stored account safe to give out
+func copyAccount(a *record) models.Account {
+	result := a.Account
+	if a.Metadata != nil {
+		result.Metadata = append(json.RawMessage{}, a.Metadata...)
+	}
+	return result
+}
+
+// currency returns tenant's currency with given ID
+func (r *Repository) currency(tenantID, id int64) (models.Currency, bool) {
+	for _, c := range r.currencies {
+		if c.ID == id && c.TenantID == tenantID {
+			return c, true
+		}
+	}
+	return models.Currency{}, false
+}
+
+// account returns tenant's account with given ID
+func (r *Repository) account(tenantID, id int64) (*record, bool) {
+	// IDs are assigned sequentially starting from 1
+	if id < 1 || id > int64(len(r.accounts)) {
+		return nil, false
+	}
+	a := r.accounts[id-1]
+	return a, a.TenantID == tenantID
+}
+
+// GetCurrencies returns all tenant's currencies
+func (r *Repository) GetCurrencies(ctx context.Context, tenantID int64) ([]models.Currency, error) {
+	currencies := []models.Currency{}
+	if err := ctx.Err(); err != nil {
+		return currencies, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, c := range r.currencies {
+		if c.TenantID == tenantID {
+			currencies = append(currencies, c)
+		}
+	}
+	return currencies, nil
+}
+
+// CreateCurrency creates a new currency in currency.TenantID tenant
+func (r *Repository) CreateCurrency(ctx context.Context, currency *models.Currency) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, c := range r.currencies {
+		if c.TenantID == currency.TenantID && c.Name == currency.Name {
+			return models.ErrDuplicateCurrency
+		}
+	}
+	currency.ID = int64(len(r.currencies) + 1)
+	r.currencies = append(r.currencies, *currency)
+	return nil
+}
+
+// GetAccounts returns all tenant's accounts ordered by ID
+func (r *Repository) GetAccounts(ctx context.Context, tenantID int64) ([]models.Account, error) {
+	accounts := []models.Account{}
+	if err := ctx.Err(); err != nil {
+		return accounts, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, a := range r.accounts {
+		if a.TenantID == tenantID {
+			accounts = append(accounts, copyAccount(a))
+		}
+	}
+	return accounts, nil
+}
+
+// GetAccount returns tenant's account with given ID
+func (r *Repository) GetAccount(ctx context.Context, tenantID, id int64) (models.Account, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Account{}, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	a, ok := r.account(tenantID, id)
+	if !ok {
+		return models.Account{}, sql.ErrNoRows
+	}
+	return copyAccount(a), nil
+}
+
+// GetAccountByExternalID returns tenant's account with given external ID
+func (r *Repository) GetAccountByExternalID(ctx context.Context, tenantID int64, externalID string) (models.Account, error) {
+	if err := ctx.Err(); err != nil {
+		return models.Account{}, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, a := range r.accounts {
+		if a.TenantID == tenantID && externalID != "" && a.ExternalID == externalID {
+			return copyAccount(a), nil
+		}
+	}
+	return models.Account{}, sql.ErrNoRows
+}
+
+// GetOwnerAccountID returns ID of tenant's owner primary (oldest) account in given currency
+func (r *Repository) GetOwnerAccountID(ctx context.Context, tenantID, ownerID, currencyID int64) (int64, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	for _, a := range r.accounts {
+		if a.TenantID == tenantID && a.OwnerID == ownerID && a.CurrencyID == currencyID {
+			return a.ID, nil
+		}
+	}
+	return 0, models.ErrOwnerAccountNotFound
+}
+
+// CreateAccount creates a new account in account.TenantID tenant
+func (r *Repository) CreateAccount(ctx context.Context, account *models.Account) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if account.Amount.Sign() < 0 {
+		return models.ErrNegativeBalance
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.currency(account.TenantID, account.CurrencyID)
+	if !ok {
+		return models.ErrCurrencyNotFound
+	}
+	if account.ExternalID != "" {
+		for _, a := range r.accounts {
+			if a.TenantID == account.TenantID && a.ExternalID == account.ExternalID {
+				return models.ErrDuplicateExternalID
+			}
+		}
+	}
+	account.ID = int64(len(r.accounts) + 1)
+	account.CurrencyName = c.Name
+	if len(account.Metadata) == 0 {
+		// empty metadata is stored as an empty JSON object, same as in postgres
+		account.Metadata = json.RawMessage("{}")
+	}
+	stored := &record{Account: *account, opening: account.Amount, created: time.Now()}
+	stored.Metadata = append(json.RawMessage{}, account.Metadata...)
+	r.accounts = append(r.accounts, stored)
+	return nil
+}
+
+// SetAccountShards records number of balance shards of tenant's account.
+// Balance is not actually split, as there is no lock contention to relieve,
+// but number of shards is validated the same way.
+func (r *Repository) SetAccountShards(ctx context.Context, tenantID, id int64, shards int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if shards < 1 || shards > models.MaxAccountShards {
+		return models.ErrInvalidShards
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.account(tenantID, id)
+	if !ok {
+		return sql.ErrNoRows
+	}
+	if shards < a.shards {
+		return models.ErrInvalidShards
+	}
+	a.shards = shards
+	return nil
+}
+
+// SetAccountFrozen freezes or unfreezes tenant's account
+func (r *Repository) SetAccountFrozen(ctx context.Context, tenantID, id int64, frozen bool) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	a, ok := r.account(tenantID, id)
+	if !ok {
+		return sql.ErrNoRows
+	}
+	a.Frozen = frozen
+	return nil
+}
+
+// GetPayments returns all tenant's payments in order they were made
+func (r *Repository) GetPayments(ctx context.Context, tenantID int64) ([]models.Payment, error) {
+	if err := ctx.Err(); err != nil {
+		return []models.Payment{}, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.tenantPayments(tenantID), nil
+}
+
+// tenantPayments returns copies of tenant's payments, r.mu should be held
+func (r *Repository) tenantPayments(tenantID int64) []models.Payment {
+	payments := []models.Payment{}
+	for _, p := range r.payments {
+		if p.TenantID == tenantID {
+			c, _ := r.currency(tenantID, p.CurrencyID)
+			p.CurrencyName = c.Name
+			payments = append(payments, p)
+		}
+	}
+	return payments
+}
+
+// Reconcile checks tenant's balances against deposits and payments under the same lock.
+// Accounts are always created with known opening amount, so all are verifiable.
+func (r *Repository) Reconcile(ctx context.Context, tenantID int64) (models.Reconciliation, error) {
+	result := models.Reconciliation{
+		Currencies: []models.ReconcileTotals{},
+		Payments:   []models.PaymentMismatch{},
+		Accounts:   []models.BalanceMismatch{},
+	}
+	if err := ctx.Err(); err != nil {
+		return result, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	totals := map[int64]*models.ReconcileTotals{}
+	total := func(currencyID int64) *models.ReconcileTotals {
+		t, ok := totals[currencyID]
+		if !ok {
+			c, _ := r.currency(tenantID, currencyID)
+			t = &models.ReconcileTotals{CurrencyID: currencyID, CurrencyName: c.Name}
+			totals[currencyID] = t
+		}
+		return t
+	}
+	paid := map[int64]decimal.Decimal{}
+	received := map[int64]decimal.Decimal{}
+	for _, p := range r.payments {
+		if p.TenantID != tenantID {
+			continue
+		}
+		t := total(p.CurrencyID)
+		t.Payments++
+		t.Volume = t.Volume.Add(p.Amount)
+		for _, id := range []int64{p.BuyerAccountID, p.SellerAccountID} {
+			if a, ok := r.account(tenantID, id); !ok || a.CurrencyID != p.CurrencyID {
+				result.Payments = append(result.Payments, models.PaymentMismatch{PaymentID: p.ID, AccountID: id, CurrencyName: t.CurrencyName})
+			}
+		}
+		paid[p.BuyerAccountID] = paid[p.BuyerAccountID].Add(p.Amount)
+		received[p.SellerAccountID] = received[p.SellerAccountID].Add(p.Amount)
+	}
+	deposited := map[int64]decimal.Decimal{}
+	for _, d := range r.deposits {
+		if d.TenantID != tenantID {
+			continue
+		}
+		t := total(d.CurrencyID)
+		t.Deposits++
+		t.Deposited = t.Deposited.Add(d.Amount)
+		deposited[d.AccountID] = deposited[d.AccountID].Add(d.Amount)
+	}
+	for _, a := range r.accounts {
+		if a.TenantID != tenantID {
+			continue
+		}
+		t := total(a.CurrencyID)
+		t.Accounts++
+		t.Opening = t.Opening.Add(a.opening)
+		t.Balance = t.Balance.Add(a.Amount)
+		m := models.BalanceMismatch{AccountID: a.ID,
+			Balance:   a.Amount,
+			Opening:   a.opening,
+			Deposited: deposited[a.ID],
+			Received:  received[a.ID],
+			Paid:      paid[a.ID]}
+		if !m.Expected().Equal(a.Amount) {
+			result.Accounts = append(result.Accounts, m)
+		}
+	}
+	for _, t := range totals {
+		result.Currencies = append(result.Currencies, *t)
+	}
+	sort.Slice(result.Currencies, func(i, j int) bool { return result.Currencies[i].CurrencyID < result.Currencies[j].CurrencyID })
+	return result, nil
+}
+
+// GetCurrencyTotals returns totals of tenant's currencies ordered by ID
+// with deposits and payments made from from (inclusive) to to (exclusive) and balances at to
+func (r *Repository) GetCurrencyTotals(ctx context.Context, tenantID int64, from, to time.Time) ([]models.CurrencyTotals, error) {
+	totals := []models.CurrencyTotals{}
+	if err := ctx.Err(); err != nil {
+		return totals, err
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	byCurrency := map[int64]int{}
+	for _, c := range r.currencies {
+		if c.TenantID == tenantID {
+			byCurrency[c.ID] = len(totals)
+			totals = append(totals, models.CurrencyTotals{CurrencyID: c.ID, CurrencyName: c.Name})
+		}
+	}
+	// balance at to is the current one with deposits and payments made since then reverted
+	existing := map[int64]bool{}
+	for _, a := range r.accounts {
+		if i, ok := byCurrency[a.CurrencyID]; ok && a.TenantID == tenantID && a.created.Before(to) {
+			existing[a.ID] = true
+			totals[i].Accounts++
+			totals[i].Balance = totals[i].Balance.Add(a.Amount)
+		}
+	}
+	for _, p := range r.payments {
+		i, ok := byCurrency[p.CurrencyID]
+		if !ok || p.TenantID != tenantID || p.OperationTimestamp.Before(to) {
+			continue
+		}
+		if existing[p.BuyerAccountID] {
+			totals[i].Balance = totals[i].Balance.Add(p.Amount)
+		}
+		if existing[p.SellerAccountID] {
+			totals[i].Balance = totals[i].Balance.Sub(p.Amount)
+		}
+	}
+	for _, d := range r.deposits {
+		i, ok := byCurrency[d.CurrencyID]
+		if !ok || d.TenantID != tenantID {
+			continue
+		}
+		if !d.OperationTimestamp.Before(to) {
+			if existing[d.AccountID] {
+				totals[i].Balance = totals[i].Balance.Sub(d.Amount)
+			}
+		} else if !d.OperationTimestamp.Before(from) {
+			totals[i].Deposits++
+			totals[i].Deposited = totals[i].Deposited.Add(d.Amount)
+		}
+	}
+	active := map[int64]bool{}
+	for _, p := range r.payments {
+		i, ok := byCurrency[p.CurrencyID]
+		if !ok || p.TenantID != tenantID || p.OperationTimestamp.Before(from) || !p.OperationTimestamp.Before(to) {
+			continue
+		}
+		totals[i].Payments++
+		totals[i].Volume = totals[i].Volume.Add(p.Amount)
+		for _, id := range []int64{p.BuyerAccountID, p.SellerAccountID} {
+			if !active[id] {
+				active[id] = true
+				totals[i].ActiveAccounts++
+			}
+		}
+	}
+	return totals, nil
+}
+
+// MakePayment atomically transfers amount from buyer account to seller account.
+// Checks are made in the same order as in models.MakePayment, so both report the same errors.
+func (r *Repository) MakePayment(ctx context.Context,
+	tenantID,
+	buyerAccountID,
+	sellerAccountID int64,
+	amount decimal.Decimal) (models.Payment, error) {
+
+	payment := models.Payment{}
+
+	if buyerAccountID == sellerAccountID {
+		return payment, models.ErrNoPaymentToSelf
+	}
+
+	if amount.Cmp(decimal.Zero) <= 0 {
+		return payment, models.ErrNonPositiveAmount
+	}
+
+	if err := ctx.Err(); err != nil {
+		return payment, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	buyer, ok := r.account(tenantID, buyerAccountID)
+	if !ok {
+		return payment, sql.ErrNoRows
+	}
+	seller, ok := r.account(tenantID, sellerAccountID)
+	if !ok {
+		return payment, sql.ErrNoRows
+	}
+
+	if buyer.Frozen || seller.Frozen {
+		return payment, models.ErrAccountFrozen
+	}
+
+	if buyer.Amount.Cmp(amount) < 0 {
+		return payment, models.ErrInsufficientAmount
+	}
+
+	if buyer.CurrencyID != seller.CurrencyID {
+		return payment, models.ErrCurrencyMismatch
+	}
+
+	buyer.Amount = buyer.Amount.Sub(amount)
+	seller.Amount = seller.Amount.Add(amount)
+
+	payment.ID = int64(len(r.payments) + 1)
+	payment.TenantID = tenantID
+	payment.CurrencyID = buyer.CurrencyID
+	payment.BuyerAccountID = buyerAccountID
+	payment.SellerAccountID = sellerAccountID
+	payment.Amount = amount
+	payment.OperationTimestamp = time.Now()
+	r.payments = append(r.payments, payment)
+
+	return payment, nil
+}
+
+// MakeDeposit adds amount coming from outside the service to tenant's account.
+// Checks are made in the same order as in models.MakeDeposit, so both report the same errors.
+func (r *Repository) MakeDeposit(ctx context.Context, tenantID, accountID int64, amount decimal.Decimal) (models.Deposit, error) {
+	deposit := models.Deposit{}
+
+	if amount.Cmp(decimal.Zero) <= 0 {
+		return deposit, models.ErrNonPositiveAmount
+	}
+
+	if err := ctx.Err(); err != nil {
+		return deposit, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	account, ok := r.account(tenantID, accountID)
+	if !ok {
+		return deposit, sql.ErrNoRows
+	}
+
+	if account.Frozen {
+		return deposit, models.ErrAccountFrozen
+	}
+
+	account.Amount = account.Amount.Add(amount)
+
+	deposit.ID = int64(len(r.deposits) + 1)
+	deposit.TenantID = tenantID
+	deposit.AccountID = accountID
+	deposit.CurrencyID = account.CurrencyID
+	deposit.Amount = amount
+	deposit.OperationTimestamp = time.Now()
+	r.deposits = append(r.deposits, deposit)
+
+	return deposit, nil
+}
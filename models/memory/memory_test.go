@@ -0,0 +1,69 @@
+package memory
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/c-pro/wallet-test/models"
+	"github.com/c-pro/wallet-test/models/repotest"
+	"github.com/shopspring/decimal"
+)
+
+// newTestRepository returns repository with USD and RUB currencies in default tenant
+func newTestRepository(t *testing.T) (*Repository, int64, int64) {
+	r := NewRepository()
+	usd := models.Currency{TenantID: models.DefaultTenantID, Name: "USD"}
+	rub := models.Currency{TenantID: models.DefaultTenantID, Name: "RUB"}
+	for _, c := range []*models.Currency{&usd, &rub} {
+		if err := r.CreateCurrency(context.Background(), c); err != nil {
+			t.Fatalf("Unexpected error in CreateCurrency: %v", err)
+		}
+	}
+	return r, usd.ID, rub.ID
+}
+
+func TestCreateAccount(t *testing.T) {
+	r, usd, _ := newTestRepository(t)
+	ctx := context.Background()
+
+	account := models.Account{TenantID: models.DefaultTenantID, CurrencyID: usd, ExternalID: "ext"}
+	if err := r.CreateAccount(ctx, &account); err != nil {
+		t.Fatalf("Unexpected error in CreateAccount: %v", err)
+	}
+	if account.ID == 0 {
+		t.Error("Account ID should not be zero")
+	}
+
+	cases := []struct {
+		account models.Account
+		err     error
+	}{
+		{models.Account{TenantID: models.DefaultTenantID, CurrencyID: usd, ExternalID: "ext"}, models.ErrDuplicateExternalID},
+		{models.Account{TenantID: models.DefaultTenantID, CurrencyID: 42}, models.ErrCurrencyNotFound},
+		{models.Account{TenantID: 2, CurrencyID: usd}, models.ErrCurrencyNotFound},
+		{models.Account{TenantID: models.DefaultTenantID, CurrencyID: usd, Amount: decimal.New(-1, 0)}, models.ErrNegativeBalance},
+	}
+	for _, c := range cases {
+		if err := r.CreateAccount(ctx, &c.account); err != c.err {
+			t.Errorf("Expected CreateAccount to return %v, got %v", c.err, err)
+		}
+	}
+
+	if _, err := r.GetAccount(ctx, 2, account.ID); err != sql.ErrNoRows {
+		t.Errorf("Expected GetAccount of other tenant to return sql.ErrNoRows, got %v", err)
+	}
+	found, err := r.GetAccountByExternalID(ctx, models.DefaultTenantID, "ext")
+	if err != nil {
+		t.Fatalf("Unexpected error in GetAccountByExternalID: %v", err)
+	}
+	if found.ID != account.ID || found.CurrencyName != "USD" {
+		t.Errorf("Expected account %d in USD, got %d in %s", account.ID, found.ID, found.CurrencyName)
+	}
+}
+
+func TestRepository(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) models.Repository {
+		return NewRepository()
+	})
+}
@@ -0,0 +1,288 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/c-pro/wallet-test/logging"
+)
+
+// migrationFiles are versioned schema migrations named <version>_<name>.<up|down>.sql
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// baselineUpgrade upgrades schema of the first release to the layout of the first migration
+//
+//go:embed baseline_upgrade.sql
+var baselineUpgrade string
+
+// migrationLockID is a key of postgres advisory lock held while migrating,
+// so only one replica applies migrations at a time
+const migrationLockID = 0x77616c6c6574 // "wallet"
+
+// Constant errors
+var (
+	ErrSchemaAhead      = errors.New("Database schema is newer than this version of the service supports")
+	ErrSchemaBehind     = errors.New("Database schema is outdated, migrations have to be applied")
+	ErrUnknownMigration = errors.New("Unknown schema version")
+	ErrUnknownSchema    = errors.New("Database has tables of unknown layout, schema can not be migrated")
+)
+
+// Migration is a versioned schema change with SQL to apply and to revert it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+var migrationName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// migrations are embedded migrations sorted by version
+var migrations = mustParseMigrations()
+
+// mustParseMigrations reads embedded migrations. Versions should start with 1
+// and have no gaps, and every migration should have both up and down files.
+// Migrations are embedded at compile time, so any error here is a programming error.
+func mustParseMigrations() []Migration {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		panic(err)
+	}
+	byVersion := map[int]*Migration{}
+	for _, e := range entries {
+		m := migrationName.FindStringSubmatch(e.Name())
+		if m == nil {
+			panic(fmt.Sprintf("bad migration file name %q", e.Name()))
+		}
+		version, _ := strconv.Atoi(m[1])
+		body, err := migrationFiles.ReadFile(path.Join("migrations", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: m[2]}
+			byVersion[version] = migration
+		}
+		if m[3] == "up" {
+			migration.Up = string(body)
+		} else {
+			migration.Down = string(body)
+		}
+	}
+	result := []Migration{}
+	for _, m := range byVersion {
+		result = append(result, *m)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Version < result[j].Version })
+	for i, m := range result {
+		if m.Version != i+1 || m.Up == "" || m.Down == "" {
+			panic(fmt.Sprintf("migration %d_%s is out of order or incomplete", m.Version, m.Name))
+		}
+	}
+	return result
+}
+
+// Migrations returns all schema migrations known to the service ordered by version
+func Migrations() []Migration {
+	return append([]Migration{}, migrations...)
+}
+
+// LatestSchemaVersion returns version of the latest migration known to the service
+func LatestSchemaVersion() int {
+	return len(migrations)
+}
+
+// querier is satisfied by *sql.DB, *sql.Conn and *sql.Tx
+type querier interface {
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// schemaVersion returns version of the latest applied migration.
+// Zero means no migrations were applied.
+func schemaVersion(ctx context.Context, q querier) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	exists := false
+	err := q.QueryRowContext(ctx, `select to_regclass('schema_migrations') is not null`).Scan(&exists)
+	if err != nil || !exists {
+		return 0, err
+	}
+	version := 0
+	err = q.QueryRowContext(ctx, `select coalesce(max(version), 0) from schema_migrations`).Scan(&version)
+	return version, err
+}
+
+// SchemaVersion returns version of the latest migration applied to the database
+func SchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	return schemaVersion(ctx, db)
+}
+
+// CheckSchemaVersion returns ErrSchemaAhead or ErrSchemaBehind
+// if database schema version does not match the latest migration
+func CheckSchemaVersion(ctx context.Context, db *sql.DB) error {
+	return checkSchemaVersion(ctx, db)
+}
+
+func checkSchemaVersion(ctx context.Context, q querier) error {
+	version, err := schemaVersion(ctx, q)
+	if err != nil {
+		return err
+	}
+	switch {
+	case version > LatestSchemaVersion():
+		return ErrSchemaAhead
+	case version < LatestSchemaVersion():
+		return ErrSchemaBehind
+	}
+	return nil
+}
+
+// MigrateUp applies all pending migrations. See Migrate.
+func MigrateUp(ctx context.Context, db *sql.DB) (int, error) {
+	return Migrate(ctx, db, LatestSchemaVersion())
+}
+
+// Migrate applies up or down migrations until database schema has target version.
+// Every migration is applied in its own transaction. Advisory lock is held
+// during migration, so concurrently started replicas wait for each other.
+// Database with version newer than the latest known migration is never touched
+// and ErrSchemaAhead is returned.
+// Database created before migrations were introduced is brought to version 1 first,
+// see createMigrationsTable.
+// Returns schema version before migration.
+func Migrate(ctx context.Context, db *sql.DB, target int) (int, error) {
+	if target < 0 || target > LatestSchemaVersion() {
+		return 0, ErrUnknownMigration
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	// advisory lock belongs to the session, so everything is done on one connection
+	if _, err := conn.ExecContext(ctx, `select pg_advisory_lock($1)`, migrationLockID); err != nil {
+		return 0, err
+	}
+	defer func() {
+		// use background context, so lock is released even if ctx is canceled
+		if _, err := conn.ExecContext(context.Background(), `select pg_advisory_unlock($1)`, migrationLockID); err != nil {
+			logging.FromContext(ctx).Log("msg", "failed to release migration lock", "err", err)
+		}
+	}()
+
+	if err := createMigrationsTable(ctx, conn); err != nil {
+		return 0, err
+	}
+	version, err := schemaVersion(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+	if version > LatestSchemaVersion() {
+		return version, ErrSchemaAhead
+	}
+
+	for current := version; current != target; {
+		if current < target {
+			err = applyMigration(ctx, conn, migrations[current], true)
+			current++
+		} else {
+			err = applyMigration(ctx, conn, migrations[current-1], false)
+			current--
+		}
+		if err != nil {
+			return version, err
+		}
+	}
+	return version, nil
+}
+
+// createMigrationsTable creates schema_migrations table if it does not exist yet.
+// If other tables already exist, the schema was created by sql/01_schema.sql
+// before migrations were introduced. Schema of the first release (no tenants)
+// is upgraded to the layout of the first migration, and the latest layout of
+// sql/01_schema.sql already is that layout, so both are marked with version 1.
+// Any other layout is not touched and ErrUnknownSchema is returned.
+func createMigrationsTable(ctx context.Context, conn *sql.Conn) error {
+	version, err := schemaVersion(ctx, conn)
+	if err != nil || version > 0 {
+		return err
+	}
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer RollbackWithLog(ctx, tx)
+
+	query := `create table if not exists schema_migrations (
+				  version integer primary key,
+				  applied_at timestamptz not null default now()
+			  )`
+	if _, err := tx.ExecContext(ctx, query); err != nil {
+		return err
+	}
+	var accounts, tenants, complete bool
+	query = `select to_regclass('accounts') is not null,
+					exists (select 1
+							  from information_schema.columns
+							 where table_schema = current_schema()
+							   and table_name = 'accounts'
+							   and column_name = 'tenant_id'),
+					to_regclass('account_shards') is not null and to_regclass('request_nonces') is not null`
+	if err := tx.QueryRowContext(ctx, query).Scan(&accounts, &tenants, &complete); err != nil {
+		return err
+	}
+	switch {
+	case !accounts:
+		// empty database, all migrations will be applied
+		return tx.Commit()
+	case !tenants:
+		// migrations are not limited by queryTimeout, they can take long on big tables
+		if _, err := tx.ExecContext(ctx, baselineUpgrade); err != nil {
+			return fmt.Errorf("upgrade of the first release schema: %v", err)
+		}
+		logging.FromContext(ctx).Log("msg", "upgraded first release schema")
+	case !complete:
+		return ErrUnknownSchema
+	}
+	if _, err := tx.ExecContext(ctx, `insert into schema_migrations(version) values(1)`); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// applyMigration applies up or down part of the migration and records schema version
+func applyMigration(ctx context.Context, conn *sql.Conn, m Migration, up bool) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer RollbackWithLog(ctx, tx)
+
+	script, record, direction := m.Up, `insert into schema_migrations(version) values($1)`, "up"
+	if !up {
+		script, record, direction = m.Down, `delete from schema_migrations where version = $1`, "down"
+	}
+	// migrations are not limited by queryTimeout, they can take long on big tables
+	if _, err := tx.ExecContext(ctx, script); err != nil {
+		return fmt.Errorf("migration %d_%s %s: %v", m.Version, m.Name, direction, err)
+	}
+	if _, err := tx.ExecContext(ctx, record, m.Version); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	logging.FromContext(ctx).Log("msg", "applied migration", "version", m.Version, "name", m.Name, "direction", direction)
+	return nil
+}
@@ -0,0 +1,153 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestMigrations(t *testing.T) {
+	all := Migrations()
+	if len(all) != LatestSchemaVersion() {
+		t.Fatalf("Expected %d migrations, got %d", LatestSchemaVersion(), len(all))
+	}
+	if !strings.Contains(all[0].Up, "create table accounts") {
+		t.Errorf("Expected initial migration to create accounts table")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	ctx := context.Background()
+	version, err := MigrateUp(ctx, db)
+	if err != nil {
+		t.Fatalf("Unexpected error in MigrateUp: %v", err)
+	}
+	if version != LatestSchemaVersion() {
+		t.Errorf("Expected schema to be migrated by TestMain, got version %d", version)
+	}
+	if err := CheckSchemaVersion(ctx, db); err != nil {
+		t.Errorf("Unexpected error in CheckSchemaVersion: %v", err)
+	}
+
+	if _, err := Migrate(ctx, db, LatestSchemaVersion()+1); err != ErrUnknownMigration {
+		t.Errorf("Expected Migrate to return ErrUnknownMigration, got %v", err)
+	}
+	if _, err := Migrate(ctx, db, -1); err != ErrUnknownMigration {
+		t.Errorf("Expected Migrate to return ErrUnknownMigration, got %v", err)
+	}
+}
+
+func TestSchemaAhead(t *testing.T) {
+	// version is changed in a transaction, so tests running concurrently
+	// in other packages do not see it
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+	ahead := LatestSchemaVersion() + 1
+	if _, err := tx.Exec(`insert into schema_migrations(version) values($1)`, ahead); err != nil {
+		t.Fatalf("Failed to insert schema version: %v", err)
+	}
+	if err := checkSchemaVersion(context.Background(), tx); err != ErrSchemaAhead {
+		t.Errorf("Expected checkSchemaVersion to return ErrSchemaAhead, got %v", err)
+	}
+}
+
+// openSchema creates an empty postgres schema and returns connection pool using it,
+// so a database layout can be migrated without touching the shared test schema
+func openSchema(t *testing.T) *sql.DB {
+	t.Helper()
+	name := fmt.Sprintf("test_%d", rand.Int63())
+	if _, err := db.Exec(`create schema ` + name); err != nil {
+		t.Fatalf("Failed to create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		if _, err := db.Exec(`drop schema ` + name + ` cascade`); err != nil {
+			t.Errorf("Failed to drop schema: %v", err)
+		}
+	})
+	u, err := url.Parse(dbURL)
+	if err != nil {
+		t.Fatalf("Bad database URL: %v", err)
+	}
+	q := u.Query()
+	q.Set("search_path", name)
+	u.RawQuery = q.Encode()
+	schemaDB, err := sql.Open("postgres", u.String())
+	if err != nil {
+		t.Fatalf("Unexpected error in sql.Open: %v", err)
+	}
+	t.Cleanup(func() { schemaDB.Close() })
+	return schemaDB
+}
+
+func TestMigrateFirstRelease(t *testing.T) {
+	ctx := context.Background()
+	old := openSchema(t)
+	script, err := ioutil.ReadFile("testdata/first_release.sql")
+	if err != nil {
+		t.Fatalf("Failed to read first release schema: %v", err)
+	}
+	if _, err := old.Exec(string(script)); err != nil {
+		t.Fatalf("Failed to create first release schema: %v", err)
+	}
+	_, err = old.Exec(`insert into accounts(name, currency_id, amount) values('alice', 1, 90), ('bob', 1, 10);
+					   insert into payments(currency_id, amount, buyer_account_id, seller_account_id) values(1, 10, 1, 2)`)
+	if err != nil {
+		t.Fatalf("Failed to insert first release data: %v", err)
+	}
+
+	if _, err := MigrateUp(ctx, old); err != nil {
+		t.Fatalf("Unexpected error in MigrateUp: %v", err)
+	}
+	if err := CheckSchemaVersion(ctx, old); err != nil {
+		t.Errorf("Unexpected error in CheckSchemaVersion: %v", err)
+	}
+
+	// existing data belongs to the default tenant and works as usual
+	r := NewPostgresRepository(old)
+	accounts, err := r.GetAccounts(ctx, DefaultTenantID)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetAccounts: %v", err)
+	}
+	if len(accounts) != 2 || accounts[0].Name != "alice" || !accounts[0].Amount.Equals(decimal.New(90, 0)) {
+		t.Errorf("Expected first release accounts, got %+v", accounts)
+	}
+	if _, err := r.MakePayment(ctx, DefaultTenantID, 2, 1, decimal.New(5, 0)); err != nil {
+		t.Errorf("Unexpected error in MakePayment: %v", err)
+	}
+	payments, err := r.GetPayments(ctx, DefaultTenantID)
+	if err != nil || len(payments) != 2 {
+		t.Errorf("Expected 2 payments, got %+v (%v)", payments, err)
+	}
+	// account names are not unique anymore
+	dup := Account{TenantID: DefaultTenantID, CurrencyID: 1, Name: "alice"}
+	if err := r.CreateAccount(ctx, &dup); err != nil {
+		t.Errorf("Unexpected error in CreateAccount: %v", err)
+	}
+
+	if _, err := Migrate(ctx, old, 0); err != nil {
+		t.Errorf("Unexpected error in Migrate down: %v", err)
+	}
+}
+
+func TestMigrateUnknownSchema(t *testing.T) {
+	unknown := openSchema(t)
+	if _, err := unknown.Exec(`create table accounts (id bigserial primary key, tenant_id integer not null)`); err != nil {
+		t.Fatalf("Failed to create accounts table: %v", err)
+	}
+	if _, err := MigrateUp(context.Background(), unknown); err != ErrUnknownSchema {
+		t.Errorf("Expected MigrateUp to return ErrUnknownSchema, got %v", err)
+	}
+	if _, err := unknown.Exec(`select 1 from accounts`); err != nil {
+		t.Errorf("Unknown schema should not be touched: %v", err)
+	}
+}
@@ -0,0 +1,9 @@
+drop table request_nonces;
+drop table hmac_keys;
+drop table api_keys;
+drop table payments;
+drop table account_shards;
+drop table accounts;
+drop table owners;
+drop table currencies;
+drop table tenants;
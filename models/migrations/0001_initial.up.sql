@@ -0,0 +1,133 @@
+create table tenants (
+    id serial primary key,
+    name varchar not null unique
+);
+
+comment on table tenants is 'Brands sharing the service. All other data is isolated per tenant';
+
+create table currencies (
+    id serial primary key,
+    tenant_id integer not null references tenants(id),
+    name varchar not null,
+    constraint currencies_name_key unique (tenant_id, name),
+    constraint currencies_tenant_id_key unique (tenant_id, id)
+);
+
+comment on table currencies is 'Currencies dictionary';
+
+create table owners (
+    id bigserial primary key,
+    tenant_id integer not null references tenants(id),
+    name varchar not null,
+    constraint owners_tenant_id_key unique (tenant_id, id)
+);
+
+comment on table owners is 'Users or organizations owning one or more accounts';
+
+-- composite foreign keys (tenant_id, ...) guarantee that rows can only
+-- reference rows of the same tenant
+create table accounts (
+    id bigserial primary key,
+    tenant_id integer not null references tenants(id),
+    name varchar not null,
+    external_id varchar,
+    metadata jsonb not null default '{}',
+    owner_id bigint,
+    currency_id integer not null,
+    amount numeric(30,15) not null, -- crazy magnitude and precision because crypto 🤑
+    constraint accounts_balance_check check (amount >= 0),
+    constraint accounts_external_id_key unique (tenant_id, external_id),
+    constraint accounts_tenant_id_key unique (tenant_id, id),
+    constraint accounts_owner_id_fkey foreign key (tenant_id, owner_id) references owners(tenant_id, id),
+    constraint accounts_currency_id_fkey foreign key (tenant_id, currency_id) references currencies(tenant_id, id)
+);
+
+comment on table accounts is 'Accounts with their corresponding balances';
+comment on column accounts.external_id is 'Optional client side identifier (e.g. user ID in an external system)';
+comment on column accounts.metadata is 'Arbitrary client supplied JSON attributes';
+
+create index accounts_owner_idx on accounts(tenant_id, owner_id, currency_id);
+
+create table account_shards (
+    tenant_id integer not null,
+    account_id bigint not null,
+    shard integer not null,
+    amount numeric(30,15) not null default 0,
+    primary key (account_id, shard),
+    constraint account_shards_amount_check check (amount >= 0),
+    constraint account_shards_account_id_fkey foreign key (tenant_id, account_id) references accounts(tenant_id, id)
+);
+
+comment on table account_shards is 'Sub-balances of hot accounts. Account balance is accounts.amount plus sum of its shards';
+
+create table payments (
+    id bigserial primary key,
+    tenant_id integer not null references tenants(id),
+    currency_id integer not null,
+    amount numeric(30,15) not null,
+    buyer_account_id bigint not null,
+    seller_account_id bigint not null,
+    operation_timestamp timestamp not null default now(),
+    constraint payments_amount_check check (amount > 0),
+    constraint payments_diff_account_check check (buyer_account_id != seller_account_id),
+    constraint payments_currency_id_fkey foreign key (tenant_id, currency_id) references currencies(tenant_id, id),
+    constraint payments_buyer_account_id_fkey foreign key (tenant_id, buyer_account_id) references accounts(tenant_id, id),
+    constraint payments_seller_account_id_fkey foreign key (tenant_id, seller_account_id) references accounts(tenant_id, id)
+);
+
+comment on table payments is 'Payments log table';
+
+create index payments_tenant_idx on payments(tenant_id, operation_timestamp);
+
+create table api_keys (
+    id bigserial primary key,
+    tenant_id integer not null references tenants(id),
+    name varchar not null,
+    key_hash bytea not null unique,
+    role varchar not null,
+    owner_id bigint,
+    created_at timestamp not null default now(),
+    revoked_at timestamp,
+    constraint api_keys_role_check check (role in ('admin', 'auditor', 'operator', 'client')),
+    constraint api_keys_client_owner_check check (role != 'client' or owner_id is not null),
+    constraint api_keys_owner_id_fkey foreign key (tenant_id, owner_id) references owners(tenant_id, id)
+);
+
+comment on table api_keys is 'API keys for client authentication. Only SHA-256 hashes of keys are stored';
+comment on column api_keys.owner_id is 'Owner whose accounts client role key may spend from';
+
+create table hmac_keys (
+    id bigserial primary key,
+    tenant_id integer not null references tenants(id),
+    name varchar not null,
+    secret varchar not null,
+    role varchar not null,
+    owner_id bigint,
+    created_at timestamp not null default now(),
+    revoked_at timestamp,
+    constraint hmac_keys_role_check check (role in ('admin', 'auditor', 'operator', 'client')),
+    constraint hmac_keys_client_owner_check check (role != 'client' or owner_id is not null),
+    constraint hmac_keys_owner_id_fkey foreign key (tenant_id, owner_id) references owners(tenant_id, id)
+);
+
+comment on table hmac_keys is 'Shared secrets for HMAC signed server-to-server requests';
+
+create table request_nonces (
+    key_id bigint not null references hmac_keys(id),
+    nonce varchar(64) not null,
+    expires_at timestamptz not null,
+    primary key (key_id, nonce)
+);
+
+comment on table request_nonces is 'Nonces of signed requests seen recently, for replay protection. Tenant is defined by the key';
+
+create index request_nonces_expires_idx on request_nonces(expires_at);
+
+insert into tenants(name)
+    values('default');
+
+insert into currencies(tenant_id, name)
+    values(1, 'USD'),
+          (1, 'RUB'),
+          (1, 'BTC'),
+          (1, 'ETC');
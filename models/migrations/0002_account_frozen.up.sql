@@ -0,0 +1 @@
+alter table accounts add column frozen boolean not null default false;
@@ -0,0 +1,28 @@
+create table audit_log (
+    id bigserial primary key,
+    -- no foreign key: audit records outlive anything they refer to
+    tenant_id bigint,
+    occurred_at timestamptz not null default now(),
+    principal text not null,
+    role text not null,
+    key_id bigint,
+    action text not null,
+    object text,
+    remote_ip text,
+    request_id text,
+    body_sha256 text,
+    outcome text not null
+);
+
+create index audit_log_tenant_id_occurred_at_idx on audit_log(tenant_id, occurred_at);
+
+-- audit log is append-only
+create function audit_log_append_only() returns trigger as $$
+begin
+    raise exception 'audit_log is append-only';
+end;
+$$ language plpgsql;
+
+create trigger audit_log_append_only
+    before update or delete or truncate on audit_log
+    for each statement execute procedure audit_log_append_only();
@@ -0,0 +1,5 @@
+drop table payment_checkpoints;
+drop function payment_checkpoints_append_only();
+drop table payment_chain_heads;
+alter table payments drop column hash;
+alter table payments drop column prev_hash;
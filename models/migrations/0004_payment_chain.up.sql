@@ -0,0 +1,35 @@
+-- every payment carries a hash of its contents and of the previous payment of the tenant,
+-- payments made before this migration are not chained
+alter table payments add column prev_hash text;
+alter table payments add column hash text;
+
+-- last chained payment of a tenant, the row is locked while a payment is made,
+-- so payments of a tenant are chained one after another
+create table payment_chain_heads (
+    tenant_id integer primary key references tenants(id),
+    payment_id bigint,
+    hash text not null
+);
+
+create table payment_checkpoints (
+    id bigserial primary key,
+    tenant_id integer not null references tenants(id),
+    payment_id bigint not null,
+    hash text not null,
+    created_at timestamptz not null,
+    public_key text not null,
+    signature text not null
+);
+
+create index payment_checkpoints_tenant_idx on payment_checkpoints(tenant_id, payment_id);
+
+-- checkpoints are append-only
+create function payment_checkpoints_append_only() returns trigger as $$
+begin
+    raise exception 'payment_checkpoints is append-only';
+end;
+$$ language plpgsql;
+
+create trigger payment_checkpoints_append_only
+    before update or delete or truncate on payment_checkpoints
+    for each statement execute procedure payment_checkpoints_append_only();
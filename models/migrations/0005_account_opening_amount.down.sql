@@ -0,0 +1 @@
+alter table accounts drop column opening_amount;
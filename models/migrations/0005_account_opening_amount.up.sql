@@ -0,0 +1,5 @@
+-- opening amount is the balance an account was created with,
+-- reconciliation expects balance to be opening amount plus received minus paid.
+-- It was not recorded before, so it is left null for existing accounts:
+-- their balances can not be verified against payments.
+alter table accounts add column opening_amount numeric(30,15);
@@ -0,0 +1,3 @@
+drop index payments_chain_seq_idx;
+alter table payment_chain_heads drop column seq;
+alter table payments drop column chain_seq;
@@ -0,0 +1,17 @@
+-- payments are chained at the end of payment transaction, after all account locks,
+-- so chain order can differ from id order; chain_seq is position in tenant's chain
+alter table payments add column chain_seq bigint;
+alter table payment_chain_heads add column seq bigint not null default 0;
+
+-- payments chained so far were chained in id order
+update payments p
+   set chain_seq = c.seq
+  from (select id, row_number() over (partition by tenant_id order by id) as seq
+          from payments
+         where hash is not null) c
+ where p.id = c.id;
+
+update payment_chain_heads h
+   set seq = (select count(*) from payments p where p.tenant_id = h.tenant_id and p.chain_seq is not null);
+
+create unique index payments_chain_seq_idx on payments(tenant_id, chain_seq);
@@ -0,0 +1 @@
+alter table accounts drop column created_at;
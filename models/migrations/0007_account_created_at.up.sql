@@ -0,0 +1,5 @@
+-- creation time tells which accounts existed at the end of a past day, so trial balance
+-- can be reported as it was then. It was not recorded before, so existing accounts
+-- have null and are counted as existing on every day.
+alter table accounts add column created_at timestamp;
+alter table accounts alter column created_at set default now();
@@ -0,0 +1,13 @@
+create table deposits (
+    id bigserial primary key,
+    tenant_id integer not null references tenants(id),
+    account_id bigint not null,
+    amount numeric(30,15) not null,
+    operation_timestamp timestamp not null default now(),
+    constraint deposits_amount_check check (amount > 0),
+    constraint deposits_account_id_fkey foreign key (tenant_id, account_id) references accounts(tenant_id, id)
+);
+
+comment on table deposits is 'Money coming into accounts from outside the service. Account balance is its opening amount plus deposits plus received minus paid';
+
+create index deposits_account_idx on deposits(tenant_id, account_id, operation_timestamp);
@@ -0,0 +1,198 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrOwnerAccountNotFound is returned when owner has no account in requested currency
+var ErrOwnerAccountNotFound = errors.New("Owner does not have an account in this currency")
+
+// Owner is a user or an organization holding one or more accounts
+type Owner struct {
+	ID       int64
+	TenantID int64 `json:"-"`
+	Name     string
+}
+
+// Holding is a total amount owner has in a particular currency across all owned accounts
+type Holding struct {
+	CurrencyID   int64
+	CurrencyName string
+	Amount       decimal.Decimal
+	Accounts     int64
+}
+
+// GetOwners returns all tenant's owners from the database
+func GetOwners(ctx context.Context, tx *sql.Tx, tenantID int64) ([]Owner, error) {
+	owners := []Owner{}
+	query := `select id, tenant_id, name
+				from owners
+				where tenant_id = $1
+				order by id`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	rows, err := tx.QueryContext(ctx, query, tenantID)
+	if err != nil {
+		return owners, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		owner := Owner{}
+		if err := rows.Scan(&owner.ID, &owner.TenantID, &owner.Name); err != nil {
+			// If it was a context timeout, return context error
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return owners, err
+		}
+		owners = append(owners, owner)
+	}
+	return owners, nil
+}
+
+// GetOwner returns tenant's owner with given ID from the database
+func GetOwner(ctx context.Context, tx *sql.Tx, tenantID, id int64) (Owner, error) {
+	owner := Owner{}
+	query := `select id, tenant_id, name
+				from owners
+				where id = $1
+				  and tenant_id = $2`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	err := tx.QueryRowContext(ctx, query, id, tenantID).Scan(&owner.ID, &owner.TenantID, &owner.Name)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return owner, err
+	}
+	return owner, nil
+}
+
+// Save inserts or updates Owner record in the database
+// if Owner.ID is zero, new record is created in Owner.TenantID tenant
+// otherwise existing record of the tenant is updated
+func (o *Owner) Save(ctx context.Context, tx *sql.Tx) error {
+	query := `update owners
+			  set name = $1
+			  where id = $2
+			    and tenant_id = $3
+			  returning id`
+	params := []interface{}{o.Name, o.ID, o.TenantID}
+	if o.ID == 0 {
+		query = `insert into owners(tenant_id, name)
+			  values($1, $2)
+			  returning id`
+		params = []interface{}{o.TenantID, o.Name}
+	}
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	err := tx.QueryRowContext(ctx, query, params...).Scan(&o.ID)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// GetOwnerAccounts returns all accounts belonging to the tenant's owner
+func GetOwnerAccounts(ctx context.Context, tx *sql.Tx, tenantID, ownerID int64) ([]Account, error) {
+	accounts := []Account{}
+	query := `select ` + accountColumns + `
+				from accounts a
+				join currencies c on (a.currency_id = c.id)
+				where a.owner_id = $1
+				  and a.tenant_id = $2
+				order by a.id`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	rows, err := tx.QueryContext(ctx, query, ownerID, tenantID)
+	if err != nil {
+		return accounts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		account := Account{}
+		if err := scanAccount(rows, &account); err != nil {
+			// If it was a context timeout, return context error
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return accounts, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, nil
+}
+
+// GetOwnerHoldings returns tenant's owner total balances grouped by currency
+func GetOwnerHoldings(ctx context.Context, tx *sql.Tx, tenantID, ownerID int64) ([]Holding, error) {
+	holdings := []Holding{}
+	query := `select a.currency_id,
+					 c.name,
+					 sum(` + accountBalance + `),
+					 count(*)
+				from accounts a
+				join currencies c on (a.currency_id = c.id)
+				where a.owner_id = $1
+				  and a.tenant_id = $2
+				group by a.currency_id, c.name
+				order by a.currency_id`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	rows, err := tx.QueryContext(ctx, query, ownerID, tenantID)
+	if err != nil {
+		return holdings, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		holding := Holding{}
+		err := rows.Scan(&holding.CurrencyID,
+			&holding.CurrencyName,
+			&holding.Amount,
+			&holding.Accounts,
+		)
+		if err != nil {
+			// If it was a context timeout, return context error
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return holdings, err
+		}
+		holdings = append(holdings, holding)
+	}
+	return holdings, nil
+}
+
+// GetOwnerAccountID returns ID of tenant's owner primary account in given currency.
+// If owner has several accounts in the same currency, the oldest one is considered primary.
+func GetOwnerAccountID(ctx context.Context, tx *sql.Tx, tenantID, ownerID, currencyID int64) (int64, error) {
+	query := `select min(id)
+				from accounts
+				where owner_id = $1
+				  and currency_id = $2
+				  and tenant_id = $3`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	var nullID sql.NullInt64
+	err := tx.QueryRowContext(ctx, query, ownerID, currencyID, tenantID).Scan(&nullID)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return 0, err
+	}
+	if !nullID.Valid {
+		return 0, ErrOwnerAccountNotFound
+	}
+	return nullID.Int64, nil
+}
@@ -0,0 +1,128 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func makeOwner(tx *sql.Tx) Owner {
+	o := Owner{TenantID: DefaultTenantID, Name: randomName()}
+	if err := o.Save(context.Background(), tx); err != nil {
+		// checking error in test helper function does not worth all the fuss
+		panic(fmt.Sprintf("Unexpected error in Owner.Save: %v", err))
+	}
+	return o
+}
+
+func makeOwnerAccount(tx *sql.Tx, ownerID, currencyID int64, amount string) Account {
+	amountD, _ := decimal.NewFromString(amount)
+	a := Account{TenantID: DefaultTenantID, OwnerID: ownerID, CurrencyID: currencyID, Amount: amountD, Name: randomName()}
+	if err := a.Save(context.Background(), tx); err != nil {
+		panic(fmt.Sprintf("Unexpected error in Account.Save: %v", err))
+	}
+	return a
+}
+
+func TestSaveOwner(t *testing.T) {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+
+	o := makeOwner(tx)
+	if o.ID == 0 {
+		t.Fatal("Owner ID should not be zero")
+	}
+
+	o.Name = randomName()
+	if err := o.Save(context.Background(), tx); err != nil {
+		t.Fatalf("Unexpected error in Owner.Save: %v", err)
+	}
+
+	o2, err := GetOwner(context.Background(), tx, DefaultTenantID, o.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetOwner: %v", err)
+	}
+	if o2.Name != o.Name {
+		t.Errorf("Expected owner name to be %s, got %s", o.Name, o2.Name)
+	}
+
+	if _, err := GetOwner(context.Background(), tx, DefaultTenantID, -1); err != sql.ErrNoRows {
+		t.Errorf("Expected GetOwner to return sql.ErrNoRows, got %v", err)
+	}
+}
+
+func TestGetOwnerAccounts(t *testing.T) {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+
+	o := makeOwner(tx)
+	makeOwnerAccount(tx, o.ID, 1, "10.5")
+	makeOwnerAccount(tx, o.ID, 1, "0.5")
+	makeOwnerAccount(tx, o.ID, 2, "100")
+	makeAccount(tx, 1, "1000")
+
+	accounts, err := GetOwnerAccounts(context.Background(), tx, DefaultTenantID, o.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetOwnerAccounts: %v", err)
+	}
+	if len(accounts) != 3 {
+		t.Fatalf("Expected 3 accounts, got %d", len(accounts))
+	}
+	for _, a := range accounts {
+		if a.OwnerID != o.ID {
+			t.Errorf("Expected account owner to be %d, got %d", o.ID, a.OwnerID)
+		}
+	}
+
+	holdings, err := GetOwnerHoldings(context.Background(), tx, DefaultTenantID, o.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetOwnerHoldings: %v", err)
+	}
+	if len(holdings) != 2 {
+		t.Fatalf("Expected holdings in 2 currencies, got %d", len(holdings))
+	}
+	if !holdings[0].Amount.Equals(decimal.New(11, 0)) || holdings[0].Accounts != 2 {
+		t.Errorf("Expected 11 USD in 2 accounts, got %s in %d", holdings[0].Amount, holdings[0].Accounts)
+	}
+	if !holdings[1].Amount.Equals(decimal.New(100, 0)) || holdings[1].Accounts != 1 {
+		t.Errorf("Expected 100 RUB in 1 account, got %s in %d", holdings[1].Amount, holdings[1].Accounts)
+	}
+}
+
+func TestGetOwnerAccountID(t *testing.T) {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+
+	o := makeOwner(tx)
+	primary := makeOwnerAccount(tx, o.ID, 1, "1")
+	makeOwnerAccount(tx, o.ID, 1, "2")
+
+	id, err := GetOwnerAccountID(context.Background(), tx, DefaultTenantID, o.ID, 1)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetOwnerAccountID: %v", err)
+	}
+	if id != primary.ID {
+		t.Errorf("Expected primary account to be %d, got %d", primary.ID, id)
+	}
+
+	if _, err := GetOwnerAccountID(context.Background(), tx, DefaultTenantID, o.ID, 2); err != ErrOwnerAccountNotFound {
+		t.Errorf("Expected GetOwnerAccountID to return ErrOwnerAccountNotFound, got %v", err)
+	}
+
+	a := Account{TenantID: DefaultTenantID, OwnerID: -1, CurrencyID: 1, Amount: decimal.Zero}
+	if err := a.Save(context.Background(), tx); err != ErrOwnerNotFound {
+		t.Errorf("Expected Account.Save to return ErrOwnerNotFound, got %v", err)
+	}
+}
@@ -4,10 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"errors"
-	"log"
 	"math/rand"
 	"time"
 
+	"github.com/c-pro/wallet-test/logging"
+	"github.com/c-pro/wallet-test/tracing"
 	"github.com/shopspring/decimal"
 )
 
@@ -24,30 +25,39 @@ var (
 // Payment is a representation of a payment operation, transferring amount from buyer account to seller account
 type Payment struct {
 	ID                 int64
+	TenantID           int64 `json:"-"`
 	CurrencyID         int64
 	CurrencyName       string `json:"CurrencyName,omitempty"`
 	Amount             decimal.Decimal
 	BuyerAccountID     int64
 	SellerAccountID    int64
 	OperationTimestamp time.Time
+	// PrevHash and Hash link payment into tenant's payment chain (see ChainHash),
+	// they are empty for payments made before the chain was introduced
+	PrevHash string `json:"PrevHash,omitempty"`
+	Hash     string `json:"Hash,omitempty"`
 }
 
-// GetPayments returns all payments from a database
-func GetPayments(tx *sql.Tx) ([]Payment, error) {
+// GetPayments returns all tenant's payments from a database
+func GetPayments(ctx context.Context, tx *sql.Tx, tenantID int64) ([]Payment, error) {
 	payments := []Payment{}
 	query := `select p.id,
+					 p.tenant_id,
 					 p.currency_id,
 					 c.name,
 					 p.amount,
 					 p.buyer_account_id,
 					 p.seller_account_id,
-					 p.operation_timestamp
+					 p.operation_timestamp,
+					 coalesce(p.prev_hash, ''),
+					 coalesce(p.hash, '')
 				from payments p
 				join currencies c on (p.currency_id = c.id)
+				where p.tenant_id = $1
 				order by p.operation_timestamp`
-	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
-	rows, err := tx.QueryContext(ctx, query)
+	rows, err := tx.QueryContext(ctx, query, tenantID)
 	if err != nil {
 		return payments, err
 	}
@@ -55,12 +65,15 @@ func GetPayments(tx *sql.Tx) ([]Payment, error) {
 	for rows.Next() {
 		payment := Payment{}
 		err := rows.Scan(&payment.ID,
+			&payment.TenantID,
 			&payment.CurrencyID,
 			&payment.CurrencyName,
 			&payment.Amount,
 			&payment.BuyerAccountID,
 			&payment.SellerAccountID,
 			&payment.OperationTimestamp,
+			&payment.PrevHash,
+			&payment.Hash,
 		)
 		if err != nil {
 			// If it was a context timeout, return context error
@@ -74,25 +87,31 @@ func GetPayments(tx *sql.Tx) ([]Payment, error) {
 	return payments, nil
 }
 
-// Save inserts Payment record in the database
-func (p *Payment) Save(tx *sql.Tx) error {
+// Save inserts Payment record in the database.
+// It is linked into tenant's payment chain after commit by ChainPayments.
+func (p *Payment) Save(ctx context.Context, tx *sql.Tx) error {
 	if p.ID != 0 {
 		return ErrPaymentNotUpdatable
 	}
-	query := `insert into payments(currency_id,
+	// amount is read back as stored, so it is hashed with the column scale
+	query := `insert into payments(tenant_id,
+								  currency_id,
 								  amount,
 								  buyer_account_id,
 								  seller_account_id)
-			values($1, $2, $3, $4)
-			returning id, operation_timestamp`
+			values($1, $2, $3, $4, $5)
+			returning id, amount, operation_timestamp`
 
-	ctx, cancel := context.WithTimeout(context.Background(), queryTimeout)
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
 	defer cancel()
+	ctx, span := startQuerySpan(ctx, "insert payment", query)
 	err := tx.QueryRowContext(ctx, query,
+		p.TenantID,
 		p.CurrencyID,
 		p.Amount,
 		p.BuyerAccountID,
-		p.SellerAccountID).Scan(&p.ID, &p.OperationTimestamp)
+		p.SellerAccountID).Scan(&p.ID, &p.Amount, &p.OperationTimestamp)
+	span.End(err)
 	if err != nil {
 		// If it was a context timeout, return context error
 		if ctx.Err() != nil {
@@ -104,8 +123,13 @@ func (p *Payment) Save(tx *sql.Tx) error {
 }
 
 // MakePayment makes atomic payment operation for given amount between seller and buyer accounts
-// Prior to commencing operation lock on both accounts is acquired and some sanity checks are performed
-func MakePayment(db *sql.DB,
+// Prior to commencing operation lock on both accounts is acquired (see LockStrategy) and some sanity checks are performed
+// Payment to a sharded account locks only the buyer and credits a random shard (see SetAccountShards)
+// Both accounts must belong to the tenant, otherwise sql.ErrNoRows is returned
+// Canceling ctx aborts the operation including waiting for locks.
+func MakePayment(ctx context.Context,
+	db *sql.DB,
+	tenantID,
 	buyerAccountID,
 	sellerAccountID int64,
 	amount decimal.Decimal) (Payment, error) {
@@ -122,53 +146,28 @@ func MakePayment(db *sql.DB,
 		return payment, ErrNonPositiveAmount
 	}
 
-	var tx *sql.Tx
-
-	// try to lock both accounts
-	numRetries := uint(15)
-	for tryNum := uint(1); tryNum <= numRetries; tryNum++ {
-		var err error
-		tx, err = db.Begin()
-		if err != nil {
-			return payment, err
-		}
-
-		// lock both accounts
-		success, err := lockAccountsForTransaction(tx, buyerAccountID, sellerAccountID)
-		if err != nil || !success {
-			RollbackWithLog(tx)
-		}
-
-		if err != nil {
-			return payment, err
-		}
-
-		// if lock for both accounts is acquired, proceed
-		if success {
-			break
-		}
-
-		// failed to acquire after numRetries
-		if tryNum == numRetries {
-			return payment, ErrLockFailed
-		}
-
-		interval := (1<<tryNum)*5 + rand.Intn((1<<tryNum)*5)
-		time.Sleep(time.Millisecond * time.Duration(interval))
+	// lock both accounts
+	tx, sellerShards, err := beginLocked(ctx, db, tenantID, buyerAccountID, sellerAccountID)
+	if err != nil {
+		return payment, err
 	}
+	defer RollbackWithLog(ctx, tx)
 
-	defer RollbackWithLog(tx)
-
-	buyer, err := GetAccount(tx, buyerAccountID)
+	buyer, err := GetAccount(ctx, tx, tenantID, buyerAccountID)
 	if err != nil {
 		return payment, err
 	}
 
-	seller, err := GetAccount(tx, sellerAccountID)
+	seller, err := GetAccount(ctx, tx, tenantID, sellerAccountID)
 	if err != nil {
 		return payment, err
 	}
 
+	// frozen accounts can neither pay nor be paid
+	if buyer.Frozen || seller.Frozen {
+		return payment, ErrAccountFrozen
+	}
+
 	// buyer account should have enough money
 	if buyer.Amount.Cmp(amount) < 0 {
 		return payment, ErrInsufficientAmount
@@ -180,31 +179,46 @@ func MakePayment(db *sql.DB,
 	}
 
 	buyer.Amount = buyer.Amount.Sub(amount)
-	seller.Amount = seller.Amount.Add(amount)
 
-	if err := buyer.Save(tx); err != nil {
+	if err := buyer.Save(ctx, tx); err != nil {
 		return payment, err
 	}
 
-	if err := seller.Save(tx); err != nil {
-		return payment, err
+	if sellerShards == 0 {
+		seller.Amount = seller.Amount.Add(amount)
+		if err := seller.Save(ctx, tx); err != nil {
+			return payment, err
+		}
 	}
 
+	payment.TenantID = tenantID
 	payment.CurrencyID = buyer.CurrencyID
 	payment.BuyerAccountID = buyerAccountID
 	payment.SellerAccountID = sellerAccountID
 	payment.Amount = amount
 
-	if err := payment.Save(tx); err != nil {
+	if err := payment.Save(ctx, tx); err != nil {
 		return payment, err
 	}
 
-	return payment, tx.Commit()
+	// Shard is credited after payment insert has locked seller account key,
+	// so it can not deadlock with a payment from the seller consolidating shards.
+	if sellerShards > 0 {
+		if err := creditShard(ctx, tx, sellerAccountID, rand.Intn(sellerShards), amount); err != nil {
+			return payment, err
+		}
+	}
+
+	_, span := tracing.Start(ctx, "commit", tracing.SpanKindClient)
+	err = Commit(ctx, tx, tenantID, AuditObject("payment", payment.ID))
+	span.End(err)
+	return payment, err
 }
 
-// RollbackWithLog rolls back transaction and logs error if any. For use in defer statement.
-func RollbackWithLog(tx *sql.Tx) {
+// RollbackWithLog rolls back transaction and logs error if any with request ID from ctx.
+// For use in defer statement.
+func RollbackWithLog(ctx context.Context, tx *sql.Tx) {
 	if err := tx.Rollback(); err != nil && err != sql.ErrTxDone {
-		log.Printf("Error on tx.Rollback: %v", err)
+		logging.FromContext(ctx).Log("msg", "failed to roll back transaction", "err", err)
 	}
 }
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"math/rand"
@@ -13,8 +14,8 @@ import (
 
 func makeAccount(tx *sql.Tx, currencyID int64, amount string) Account {
 	amountD, _ := decimal.NewFromString(amount)
-	a := Account{CurrencyID: currencyID, Amount: amountD, Name: randomName()}
-	if err := a.Save(tx); err != nil {
+	a := Account{TenantID: DefaultTenantID, CurrencyID: currencyID, Amount: amountD, Name: randomName()}
+	if err := a.Save(context.Background(), tx); err != nil {
 		// checking error in test helper function does not worth all the fuss
 		panic(fmt.Sprintf("Unexpected error in Account.Save: %v", err))
 	}
@@ -32,12 +33,12 @@ func TestSavePayment(t *testing.T) {
 	b := makeAccount(tx, 1, "500.0")
 	s := makeAccount(tx, 1, "0")
 
-	p := Payment{CurrencyID: b.CurrencyID,
+	p := Payment{TenantID: DefaultTenantID, CurrencyID: b.CurrencyID,
 		Amount:          amount,
 		BuyerAccountID:  b.ID,
 		SellerAccountID: s.ID}
 
-	if err := p.Save(tx); err != nil {
+	if err := p.Save(context.Background(), tx); err != nil {
 		t.Fatalf("Unexpected error in Account.Save: %v", err)
 	}
 
@@ -49,7 +50,7 @@ func TestSavePayment(t *testing.T) {
 		t.Errorf("Operation timestamp is far from Now: %s", p.OperationTimestamp)
 	}
 
-	if err := p.Save(tx); err != ErrPaymentNotUpdatable {
+	if err := p.Save(context.Background(), tx); err != ErrPaymentNotUpdatable {
 		t.Errorf("Attempt to save existing payment should fail with ErrPaymentNotUpdatable. Got %v", err)
 	}
 }
@@ -65,16 +66,16 @@ func TestGetPayments(t *testing.T) {
 	b := makeAccount(tx, 1, "500.0")
 	s := makeAccount(tx, 1, "0")
 
-	p := Payment{CurrencyID: b.CurrencyID,
+	p := Payment{TenantID: DefaultTenantID, CurrencyID: b.CurrencyID,
 		Amount:          amount,
 		BuyerAccountID:  b.ID,
 		SellerAccountID: s.ID}
 
-	if err := p.Save(tx); err != nil {
+	if err := p.Save(context.Background(), tx); err != nil {
 		t.Fatalf("Unexpected error in Account.Save: %v", err)
 	}
 
-	payments, err := GetPayments(tx)
+	payments, err := GetPayments(context.Background(), tx, DefaultTenantID)
 	if err != nil {
 		t.Fatalf("Unexpected error in GetPayments: %v", err)
 	}
@@ -92,6 +93,27 @@ func cleanDb(t *testing.T) {
 		t.Fatalf("Failed to clean up payments table")
 	}
 
+	if _, err := db.Exec("delete from payment_chain_heads"); err != nil {
+		if t == nil {
+			panic("Failed to clean up payment_chain_heads table")
+		}
+		t.Fatalf("Failed to clean up payment_chain_heads table")
+	}
+
+	if _, err := db.Exec("delete from account_shards"); err != nil {
+		if t == nil {
+			panic("Failed to clean up account_shards table")
+		}
+		t.Fatalf("Failed to clean up account_shards table")
+	}
+
+	if _, err := db.Exec("delete from deposits"); err != nil {
+		if t == nil {
+			panic("Failed to clean up deposits table")
+		}
+		t.Fatalf("Failed to clean up deposits table")
+	}
+
 	if _, err := db.Exec("delete from accounts"); err != nil {
 		if t == nil {
 			panic("Failed to clean up accounts table")
@@ -115,22 +137,22 @@ func TestMakePayment(t *testing.T) {
 
 	defer cleanDb(t)
 
-	_, err = MakePayment(db, b.ID, s2.ID, amount)
+	_, err = MakePayment(context.Background(), db, DefaultTenantID, b.ID, s2.ID, amount)
 	if err != ErrCurrencyMismatch {
 		t.Errorf("Expected MakePayment to return ErrCurrencyMismatch, got %v", err)
 	}
 
-	_, err = MakePayment(db, b.ID, b.ID, amount)
+	_, err = MakePayment(context.Background(), db, DefaultTenantID, b.ID, b.ID, amount)
 	if err != ErrNoPaymentToSelf {
 		t.Errorf("Expected MakePayment to return ErrNoPaymentToSelf, got %v", err)
 	}
 
-	_, err = MakePayment(db, b.ID, s.ID, decimal.Zero)
+	_, err = MakePayment(context.Background(), db, DefaultTenantID, b.ID, s.ID, decimal.Zero)
 	if err != ErrNonPositiveAmount {
 		t.Errorf("Expected MakePayment to return ErrNonPositiveAmount, got %v", err)
 	}
 
-	p, err := MakePayment(db, b.ID, s.ID, amount)
+	p, err := MakePayment(context.Background(), db, DefaultTenantID, b.ID, s.ID, amount)
 	if err != nil {
 		t.Errorf("Unexpected error in MakePayment: %v", err)
 	}
@@ -144,7 +166,7 @@ func TestMakePayment(t *testing.T) {
 		t.Fatalf("Unexpected error in db.Begin(): %v", err)
 	}
 
-	b1, err := GetAccount(tx, b.ID)
+	b1, err := GetAccount(context.Background(), tx, DefaultTenantID, b.ID)
 	if err != nil {
 		t.Fatalf("Unexpected error in GetAccount: %v", err)
 	}
@@ -154,7 +176,7 @@ func TestMakePayment(t *testing.T) {
 		t.Errorf("Buyer amount expected to be %s, got %s", expected, b1.Amount)
 	}
 
-	s1, err := GetAccount(tx, s.ID)
+	s1, err := GetAccount(context.Background(), tx, DefaultTenantID, s.ID)
 	if err != nil {
 		t.Fatalf("Unexpected error in GetAccount: %v", err)
 	}
@@ -165,7 +187,7 @@ func TestMakePayment(t *testing.T) {
 
 	tx.Rollback()
 
-	_, err = MakePayment(db, b.ID, s.ID, amount)
+	_, err = MakePayment(context.Background(), db, DefaultTenantID, b.ID, s.ID, amount)
 	if err != ErrInsufficientAmount {
 		t.Errorf("Expected MakePayment to return ErrInsufficientAmount, got %v", err)
 	}
@@ -205,9 +227,10 @@ func TestMakePaymentParallel(t *testing.T) {
 				amount := decimal.New(rand.Int63n(1000), -2)
 				bID := accounts[rand.Int63n(int64(len(accounts)))].ID
 				sID := accounts[rand.Int63n(int64(len(accounts)))].ID
-				_, err := MakePayment(db, bID, sID, amount)
+				_, err := MakePayment(context.Background(), db, DefaultTenantID, bID, sID, amount)
 				if _, ok := goodErrors[err]; !ok && err != nil {
-					t.Fatalf("Unexpected error in MakePayment: %v", err)
+					t.Errorf("Unexpected error in MakePayment: %v", err)
+					return
 				}
 			}
 		}()
@@ -224,7 +247,7 @@ func TestMakePaymentParallel(t *testing.T) {
 	sumRUB := decimal.Zero
 
 	for _, a := range accounts {
-		account, err := GetAccount(tx, a.ID)
+		account, err := GetAccount(context.Background(), tx, DefaultTenantID, a.ID)
 		if err != nil {
 			t.Fatalf("Unexpected error in GetAccount: %v", err)
 		}
@@ -275,7 +298,7 @@ func BenchmarkMakePaymentParallel(b *testing.B) {
 			amount := decimal.NewFromFloat(rand.Float64() * 10.0)
 			bID := accounts[rand.Int63n(int64(len(accounts)))].ID
 			sID := accounts[rand.Int63n(int64(len(accounts)))].ID
-			_, err := MakePayment(db, bID, sID, amount)
+			_, err := MakePayment(context.Background(), db, DefaultTenantID, bID, sID, amount)
 			if _, ok := goodErrors[err]; !ok && err != nil {
 				b.Fatalf("Unexpected error in MakePayment: %v", err)
 			}
@@ -283,3 +306,35 @@ func BenchmarkMakePaymentParallel(b *testing.B) {
 	})
 
 }
+
+func TestMakePaymentCanceled(t *testing.T) {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	b := makeAccount(tx, 1, "500.0")
+	s := makeAccount(tx, 1, "0")
+	tx.Commit()
+
+	defer cleanDb(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	amount, _ := decimal.NewFromString("1")
+	if _, err := MakePayment(ctx, db, DefaultTenantID, b.ID, s.ID, amount); err != context.Canceled {
+		t.Errorf("Expected MakePayment to return context.Canceled, got %v", err)
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+	b1, err := GetAccount(context.Background(), tx, DefaultTenantID, b.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetAccount: %v", err)
+	}
+	if !b1.Amount.Equals(b.Amount) {
+		t.Errorf("Expected buyer amount to stay %s, got %s", b.Amount, b1.Amount)
+	}
+}
@@ -0,0 +1,247 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/shopspring/decimal"
+)
+
+// ReconcileTotals are sums over all tenant's accounts, deposits and payments in a currency
+type ReconcileTotals struct {
+	CurrencyID   int64
+	CurrencyName string
+	Accounts     int
+	// Unverifiable is number of accounts created before opening amounts were recorded,
+	// their balances can not be checked against payments
+	Unverifiable int
+	// Opening is total opening amount of verifiable accounts
+	Opening   decimal.Decimal
+	Balance   decimal.Decimal
+	Payments  int
+	Volume    decimal.Decimal
+	Deposits  int
+	Deposited decimal.Decimal
+}
+
+// BalanceMismatch is an account which balance is not its opening amount plus deposited
+// plus received minus paid
+type BalanceMismatch struct {
+	AccountID int64
+	Balance   decimal.Decimal
+	Opening   decimal.Decimal
+	Deposited decimal.Decimal
+	Received  decimal.Decimal
+	Paid      decimal.Decimal
+}
+
+// Expected returns balance expected from opening amount, deposits and payments
+func (m BalanceMismatch) Expected() decimal.Decimal {
+	return m.Opening.Add(m.Deposited).Add(m.Received).Sub(m.Paid)
+}
+
+// PaymentMismatch is a payment to or from an account of another currency
+type PaymentMismatch struct {
+	PaymentID    int64
+	AccountID    int64
+	CurrencyName string
+}
+
+// Reconciliation is a result of checking tenant's balances against payments.
+// Only mismatching accounts and payments are listed.
+type Reconciliation struct {
+	Currencies []ReconcileTotals
+	Payments   []PaymentMismatch
+	Accounts   []BalanceMismatch
+}
+
+// Reconcile checks balances of tenant's accounts against deposits and payments. Every verifiable
+// account balance is expected to be exactly its opening amount plus deposited plus received
+// minus paid, and every
+// payment should move money between accounts of the payment currency. Sums are computed
+// by the database, only mismatches are read. tx should be a repeatable read transaction,
+// so queries see the same deposits and payments.
+func Reconcile(ctx context.Context, tx *sql.Tx, tenantID int64) (Reconciliation, error) {
+	r := Reconciliation{}
+	var err error
+	if r.Currencies, err = getReconcileTotals(ctx, tx, tenantID); err != nil {
+		return r, err
+	}
+	if r.Payments, err = getPaymentMismatches(ctx, tx, tenantID); err != nil {
+		return r, err
+	}
+	r.Accounts, err = getBalanceMismatches(ctx, tx, tenantID)
+	return r, err
+}
+
+// getReconcileTotals returns totals of currencies having accounts or payments ordered by currency ID.
+// Deposits are made only to accounts, so their currencies have accounts.
+func getReconcileTotals(ctx context.Context, tx *sql.Tx, tenantID int64) ([]ReconcileTotals, error) {
+	totals := []ReconcileTotals{}
+	query := `with balances as (
+				select a.currency_id,
+					   count(*) as accounts,
+					   count(*) filter (where a.opening_amount is null) as unverifiable,
+					   coalesce(sum(a.opening_amount), 0) as opening,
+					   sum(` + accountBalance + `) as balance
+				  from accounts a
+				 where a.tenant_id = $1
+				 group by a.currency_id
+			  ), volumes as (
+				select p.currency_id,
+					   count(*) as payments,
+					   sum(p.amount) as volume
+				  from payments p
+				 where p.tenant_id = $1
+				 group by p.currency_id
+			  ), deposited as (
+				select a.currency_id,
+					   count(*) as deposits,
+					   sum(d.amount) as amount
+				  from deposits d
+				  join accounts a on (a.id = d.account_id)
+				 where d.tenant_id = $1
+				 group by a.currency_id
+			  )
+			  select c.id,
+					 c.name,
+					 coalesce(b.accounts, 0),
+					 coalesce(b.unverifiable, 0),
+					 coalesce(b.opening, 0),
+					 coalesce(b.balance, 0),
+					 coalesce(v.payments, 0),
+					 coalesce(v.volume, 0),
+					 coalesce(d.deposits, 0),
+					 coalesce(d.amount, 0)
+				from currencies c
+				left join balances b on (b.currency_id = c.id)
+				left join volumes v on (v.currency_id = c.id)
+				left join deposited d on (d.currency_id = c.id)
+				where c.tenant_id = $1
+				  and (b.currency_id is not null or v.currency_id is not null)
+				order by c.id`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	ctx, span := startQuerySpan(ctx, "select reconcile totals", query)
+	rows, err := tx.QueryContext(ctx, query, tenantID)
+	span.End(err)
+	if err != nil {
+		return totals, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		t := ReconcileTotals{}
+		err := rows.Scan(&t.CurrencyID,
+			&t.CurrencyName,
+			&t.Accounts,
+			&t.Unverifiable,
+			&t.Opening,
+			&t.Balance,
+			&t.Payments,
+			&t.Volume,
+			&t.Deposits,
+			&t.Deposited,
+		)
+		if err != nil {
+			// If it was a context timeout, return context error
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return totals, err
+		}
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
+
+// getPaymentMismatches returns payments to or from accounts of another currency
+func getPaymentMismatches(ctx context.Context, tx *sql.Tx, tenantID int64) ([]PaymentMismatch, error) {
+	mismatches := []PaymentMismatch{}
+	query := `select p.id, a.id, c.name
+				from payments p
+				join accounts a on (a.id in (p.buyer_account_id, p.seller_account_id))
+				join currencies c on (c.id = p.currency_id)
+				where p.tenant_id = $1
+				  and a.currency_id <> p.currency_id
+				order by p.id, a.id`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	ctx, span := startQuerySpan(ctx, "select payment mismatches", query)
+	rows, err := tx.QueryContext(ctx, query, tenantID)
+	span.End(err)
+	if err != nil {
+		return mismatches, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		m := PaymentMismatch{}
+		if err := rows.Scan(&m.PaymentID, &m.AccountID, &m.CurrencyName); err != nil {
+			// If it was a context timeout, return context error
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return mismatches, err
+		}
+		mismatches = append(mismatches, m)
+	}
+	return mismatches, rows.Err()
+}
+
+// getBalanceMismatches returns verifiable accounts which balances do not match deposits and payments
+func getBalanceMismatches(ctx context.Context, tx *sql.Tx, tenantID int64) ([]BalanceMismatch, error) {
+	mismatches := []BalanceMismatch{}
+	query := `with deposited as (
+				select d.account_id, sum(d.amount) as amount
+				  from deposits d
+				 where d.tenant_id = $1
+				 group by d.account_id
+			  ), paid as (
+				select p.buyer_account_id as account_id, sum(p.amount) as amount
+				  from payments p
+				 where p.tenant_id = $1
+				 group by p.buyer_account_id
+			  ), received as (
+				select p.seller_account_id as account_id, sum(p.amount) as amount
+				  from payments p
+				 where p.tenant_id = $1
+				 group by p.seller_account_id
+			  ), checked as (
+				select a.id,
+					   ` + accountBalance + ` as balance,
+					   a.opening_amount as opening,
+					   coalesce(d.amount, 0) as deposited,
+					   coalesce(r.amount, 0) as received,
+					   coalesce(pd.amount, 0) as paid
+				  from accounts a
+				  left join deposited d on (d.account_id = a.id)
+				  left join paid pd on (pd.account_id = a.id)
+				  left join received r on (r.account_id = a.id)
+				 where a.tenant_id = $1
+				   and a.opening_amount is not null
+			  )
+			  select id, balance, opening, deposited, received, paid
+				from checked
+				where opening + deposited + received - paid <> balance
+				order by id`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	ctx, span := startQuerySpan(ctx, "select balance mismatches", query)
+	rows, err := tx.QueryContext(ctx, query, tenantID)
+	span.End(err)
+	if err != nil {
+		return mismatches, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		m := BalanceMismatch{}
+		if err := rows.Scan(&m.AccountID, &m.Balance, &m.Opening, &m.Deposited, &m.Received, &m.Paid); err != nil {
+			// If it was a context timeout, return context error
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return mismatches, err
+		}
+		mismatches = append(mismatches, m)
+	}
+	return mismatches, rows.Err()
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"context"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestReconcile(t *testing.T) {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+
+	buyer := makeAccount(tx, 1, "10")
+	seller := makeAccount(tx, 1, "0")
+	legacy := makeAccount(tx, 1, "5")
+	p := Payment{TenantID: DefaultTenantID, CurrencyID: 1, Amount: decimal.New(4, 0), BuyerAccountID: buyer.ID, SellerAccountID: seller.ID}
+	if err := p.Save(context.Background(), tx); err != nil {
+		t.Fatalf("Unexpected error in Payment.Save: %v", err)
+	}
+	// balances are changed directly: buyer is not debited, legacy account has no opening amount
+	if _, err := tx.Exec("update accounts set amount = amount + 4 where id = $1", seller.ID); err != nil {
+		t.Fatalf("Failed to edit balance: %v", err)
+	}
+	if _, err := tx.Exec("update accounts set opening_amount = null, amount = 7 where id = $1", legacy.ID); err != nil {
+		t.Fatalf("Failed to edit balance: %v", err)
+	}
+
+	result, err := Reconcile(context.Background(), tx, DefaultTenantID)
+	if err != nil {
+		t.Fatalf("Unexpected error in Reconcile: %v", err)
+	}
+	mismatches := map[int64]BalanceMismatch{}
+	for _, m := range result.Accounts {
+		mismatches[m.AccountID] = m
+	}
+	if m, ok := mismatches[buyer.ID]; !ok || !m.Expected().Equals(decimal.New(6, 0)) || !m.Balance.Equals(decimal.New(10, 0)) {
+		t.Errorf("Expected buyer balance 10 to mismatch expected 6, got %+v", m)
+	}
+	if _, ok := mismatches[seller.ID]; ok {
+		t.Errorf("Unexpected mismatch of seller %+v", mismatches[seller.ID])
+	}
+	if _, ok := mismatches[legacy.ID]; ok {
+		t.Errorf("Account without opening amount should not be checked, got %+v", mismatches[legacy.ID])
+	}
+	if len(result.Currencies) == 0 || result.Currencies[0].CurrencyID != 1 || result.Currencies[0].Unverifiable == 0 {
+		t.Errorf("Expected unverifiable accounts in USD totals, got %+v", result.Currencies)
+	}
+}
@@ -0,0 +1,143 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// CurrencyTotals is a trial balance line of a currency: totals over all tenant's accounts
+// and over deposits and payments of a period
+type CurrencyTotals struct {
+	CurrencyID   int64
+	CurrencyName string
+	// Accounts is number of accounts existing at the end of the period
+	Accounts int
+	// ActiveAccounts is number of accounts which paid or were paid in the period
+	ActiveAccounts int
+	// Balance is total balance of the accounts at the end of the period
+	Balance decimal.Decimal
+	// Payments and Volume are number and total amount of payments in the period
+	Payments int
+	Volume   decimal.Decimal
+	// Deposits and Deposited are number and total amount of deposits in the period
+	Deposits  int
+	Deposited decimal.Decimal
+}
+
+// GetCurrencyTotals returns totals of every tenant's currency ordered by currency ID.
+// Deposits and payments made from from (inclusive) to to (exclusive) are counted.
+// Balances change only with deposits and payments, so balance at to is the current one
+// minus amounts deposited and received since then plus amounts paid since then.
+// Accounts created before creation time was recorded are counted as existing at to.
+// Everything is aggregated by the database.
+func GetCurrencyTotals(ctx context.Context, tx *sql.Tx, tenantID int64, from, to time.Time) ([]CurrencyTotals, error) {
+	totals := []CurrencyTotals{}
+	query := `with existing as (
+				select a.id,
+					   a.currency_id,
+					   ` + accountBalance + ` as balance
+				  from accounts a
+				 where a.tenant_id = $1
+				   and (a.created_at is null or a.created_at < $3)
+			  ), later as (
+				select id, sum(paid) as paid
+				  from (select e.id,
+							   case when p.buyer_account_id = e.id then p.amount else -p.amount end as paid
+						  from existing e
+						  join payments p on (e.id in (p.buyer_account_id, p.seller_account_id))
+						 where p.tenant_id = $1
+						   and p.operation_timestamp >= $3
+						 union all
+						select e.id, -d.amount
+						  from existing e
+						  join deposits d on (d.account_id = e.id)
+						 where d.tenant_id = $1
+						   and d.operation_timestamp >= $3) as changes
+				 group by id
+			  ), balances as (
+				select e.currency_id,
+					   count(*) as accounts,
+					   sum(e.balance + coalesce(l.paid, 0)) as balance
+				  from existing e
+				  left join later l on (l.id = e.id)
+				 group by e.currency_id
+			  ), period as (
+				select p.currency_id,
+					   count(*) as payments,
+					   sum(p.amount) as volume
+				  from payments p
+				 where p.tenant_id = $1
+				   and p.operation_timestamp >= $2
+				   and p.operation_timestamp < $3
+				 group by p.currency_id
+			  ), active as (
+				select currency_id,
+					   count(distinct account_id) as accounts
+				  from (select p.currency_id, unnest(array[p.buyer_account_id, p.seller_account_id]) as account_id
+						  from payments p
+						 where p.tenant_id = $1
+						   and p.operation_timestamp >= $2
+						   and p.operation_timestamp < $3) as participants
+				 group by currency_id
+			  ), deposited as (
+				select a.currency_id,
+					   count(*) as deposits,
+					   sum(d.amount) as amount
+				  from deposits d
+				  join accounts a on (a.id = d.account_id)
+				 where d.tenant_id = $1
+				   and d.operation_timestamp >= $2
+				   and d.operation_timestamp < $3
+				 group by a.currency_id
+			  )
+			  select c.id,
+					 c.name,
+					 coalesce(b.accounts, 0),
+					 coalesce(act.accounts, 0),
+					 coalesce(b.balance, 0),
+					 coalesce(pp.payments, 0),
+					 coalesce(pp.volume, 0),
+					 coalesce(d.deposits, 0),
+					 coalesce(d.amount, 0)
+				from currencies c
+				left join balances b on (b.currency_id = c.id)
+				left join period pp on (pp.currency_id = c.id)
+				left join active act on (act.currency_id = c.id)
+				left join deposited d on (d.currency_id = c.id)
+				where c.tenant_id = $1
+				order by c.id`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	ctx, span := startQuerySpan(ctx, "select currency totals", query)
+	rows, err := tx.QueryContext(ctx, query, tenantID, from, to)
+	span.End(err)
+	if err != nil {
+		return totals, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		t := CurrencyTotals{}
+		err := rows.Scan(&t.CurrencyID,
+			&t.CurrencyName,
+			&t.Accounts,
+			&t.ActiveAccounts,
+			&t.Balance,
+			&t.Payments,
+			&t.Volume,
+			&t.Deposits,
+			&t.Deposited,
+		)
+		if err != nil {
+			// If it was a context timeout, return context error
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return totals, err
+		}
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
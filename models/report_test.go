@@ -0,0 +1,71 @@
+package models
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestGetCurrencyTotalsYesterday(t *testing.T) {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+
+	tenant := Tenant{Name: randomName()}
+	if err := tenant.Save(context.Background(), tx); err != nil {
+		t.Fatalf("Unexpected error in Tenant.Save: %v", err)
+	}
+	c := Currency{TenantID: tenant.ID, Name: "USD"}
+	if err := c.Save(context.Background(), tx); err != nil {
+		t.Fatalf("Unexpected error in Currency.Save: %v", err)
+	}
+	accounts := []Account{}
+	for _, amount := range []int64{10, 0, 3} {
+		a := Account{TenantID: tenant.ID, CurrencyID: c.ID, Amount: decimal.New(amount, 0), Name: randomName()}
+		if err := a.Save(context.Background(), tx); err != nil {
+			t.Fatalf("Unexpected error in Account.Save: %v", err)
+		}
+		accounts = append(accounts, a)
+	}
+	// the first two accounts were opened two days ago, the last one today
+	_, err = tx.Exec("update accounts set created_at = created_at - interval '2 days' where id in ($1, $2)", accounts[0].ID, accounts[1].ID)
+	if err != nil {
+		t.Fatalf("Failed to backdate accounts: %v", err)
+	}
+	// today the first account paid 4 to the second and 1 to the new one
+	for _, p := range []Payment{
+		{TenantID: tenant.ID, CurrencyID: c.ID, Amount: decimal.New(4, 0), BuyerAccountID: accounts[0].ID, SellerAccountID: accounts[1].ID},
+		{TenantID: tenant.ID, CurrencyID: c.ID, Amount: decimal.New(1, 0), BuyerAccountID: accounts[0].ID, SellerAccountID: accounts[2].ID},
+	} {
+		if err := p.Save(context.Background(), tx); err != nil {
+			t.Fatalf("Unexpected error in Payment.Save: %v", err)
+		}
+		_, err := tx.Exec(`update accounts
+						   set amount = amount + case when id = $1 then -$3::numeric else $3::numeric end
+						   where id in ($1, $2)`, p.BuyerAccountID, p.SellerAccountID, p.Amount)
+		if err != nil {
+			t.Fatalf("Failed to update balances: %v", err)
+		}
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	totals, err := GetCurrencyTotals(context.Background(), tx, tenant.ID, today.AddDate(0, 0, -1), today)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetCurrencyTotals: %v", err)
+	}
+	if len(totals) != 1 || totals[0].Accounts != 2 || totals[0].Payments != 0 || !totals[0].Balance.Equals(decimal.New(10, 0)) {
+		t.Errorf("Expected yesterday's balance 10 of 2 accounts and no payments, got %+v", totals)
+	}
+
+	totals, err = GetCurrencyTotals(context.Background(), tx, tenant.ID, today, today.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("Unexpected error in GetCurrencyTotals: %v", err)
+	}
+	if len(totals) != 1 || totals[0].Accounts != 3 || totals[0].Payments != 2 || !totals[0].Balance.Equals(decimal.New(13, 0)) {
+		t.Errorf("Expected today's balance 13 of 3 accounts and 2 payments, got %+v", totals)
+	}
+}
@@ -0,0 +1,192 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+// Repository is a storage of currencies, accounts and payments.
+// Implementations must be safe for concurrent use and keep the same invariants:
+// account balances never go negative, payments are made only between accounts
+// of the same currency and both balances are changed atomically, deposits change
+// a balance together with recording the deposit.
+// Missing (or belonging to another tenant) records are reported with sql.ErrNoRows.
+type Repository interface {
+	GetCurrencies(ctx context.Context, tenantID int64) ([]Currency, error)
+	CreateCurrency(ctx context.Context, currency *Currency) error
+	GetAccounts(ctx context.Context, tenantID int64) ([]Account, error)
+	GetAccount(ctx context.Context, tenantID, id int64) (Account, error)
+	GetAccountByExternalID(ctx context.Context, tenantID int64, externalID string) (Account, error)
+	GetOwnerAccountID(ctx context.Context, tenantID, ownerID, currencyID int64) (int64, error)
+	CreateAccount(ctx context.Context, account *Account) error
+	SetAccountShards(ctx context.Context, tenantID, id int64, shards int) error
+	SetAccountFrozen(ctx context.Context, tenantID, id int64, frozen bool) error
+	GetPayments(ctx context.Context, tenantID int64) ([]Payment, error)
+	Reconcile(ctx context.Context, tenantID int64) (Reconciliation, error)
+	GetCurrencyTotals(ctx context.Context, tenantID int64, from, to time.Time) ([]CurrencyTotals, error)
+	MakePayment(ctx context.Context, tenantID, buyerAccountID, sellerAccountID int64, amount decimal.Decimal) (Payment, error)
+	MakeDeposit(ctx context.Context, tenantID, accountID int64, amount decimal.Decimal) (Deposit, error)
+}
+
+// PostgresRepository implements Repository on top of postgresql database.
+// Every method runs in its own transaction.
+type PostgresRepository struct {
+	db *sql.DB
+}
+
+var _ Repository = (*PostgresRepository)(nil)
+
+// NewPostgresRepository returns repository using given database connection pool
+func NewPostgresRepository(db *sql.DB) *PostgresRepository {
+	return &PostgresRepository{db}
+}
+
+// GetCurrencies returns all tenant's currencies
+func (r *PostgresRepository) GetCurrencies(ctx context.Context, tenantID int64) ([]Currency, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return []Currency{}, err
+	}
+	defer RollbackWithLog(ctx, tx)
+	return GetCurrencies(ctx, tx, tenantID)
+}
+
+// CreateCurrency creates a new currency in currency.TenantID tenant
+func (r *PostgresRepository) CreateCurrency(ctx context.Context, currency *Currency) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer RollbackWithLog(ctx, tx)
+	if err := currency.Save(ctx, tx); err != nil {
+		return err
+	}
+	return Commit(ctx, tx, currency.TenantID, AuditObject("currency", currency.ID))
+}
+
+// GetAccounts returns all tenant's accounts
+func (r *PostgresRepository) GetAccounts(ctx context.Context, tenantID int64) ([]Account, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return []Account{}, err
+	}
+	defer RollbackWithLog(ctx, tx)
+	return GetAccounts(ctx, tx, tenantID)
+}
+
+// GetAccount returns tenant's account with given ID
+func (r *PostgresRepository) GetAccount(ctx context.Context, tenantID, id int64) (Account, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Account{}, err
+	}
+	defer RollbackWithLog(ctx, tx)
+	return GetAccount(ctx, tx, tenantID, id)
+}
+
+// GetAccountByExternalID returns tenant's account with given external ID
+func (r *PostgresRepository) GetAccountByExternalID(ctx context.Context, tenantID int64, externalID string) (Account, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return Account{}, err
+	}
+	defer RollbackWithLog(ctx, tx)
+	return GetAccountByExternalID(ctx, tx, tenantID, externalID)
+}
+
+// GetOwnerAccountID returns ID of tenant's owner primary account in given currency
+func (r *PostgresRepository) GetOwnerAccountID(ctx context.Context, tenantID, ownerID, currencyID int64) (int64, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer RollbackWithLog(ctx, tx)
+	return GetOwnerAccountID(ctx, tx, tenantID, ownerID, currencyID)
+}
+
+// CreateAccount creates a new account in account.TenantID tenant
+func (r *PostgresRepository) CreateAccount(ctx context.Context, account *Account) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer RollbackWithLog(ctx, tx)
+	account.ID = 0
+	if err := account.Save(ctx, tx); err != nil {
+		return err
+	}
+	return Commit(ctx, tx, account.TenantID, AuditObject("account", account.ID))
+}
+
+// SetAccountShards splits balance of tenant's account into given number of shards
+func (r *PostgresRepository) SetAccountShards(ctx context.Context, tenantID, id int64, shards int) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer RollbackWithLog(ctx, tx)
+	if err := SetAccountShards(ctx, tx, tenantID, id, shards); err != nil {
+		return err
+	}
+	return Commit(ctx, tx, tenantID, AuditObject("account", id))
+}
+
+// SetAccountFrozen freezes or unfreezes tenant's account
+func (r *PostgresRepository) SetAccountFrozen(ctx context.Context, tenantID, id int64, frozen bool) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer RollbackWithLog(ctx, tx)
+	if err := SetAccountFrozen(ctx, tx, tenantID, id, frozen); err != nil {
+		return err
+	}
+	return Commit(ctx, tx, tenantID, AuditObject("account", id))
+}
+
+// GetPayments returns all tenant's payments
+func (r *PostgresRepository) GetPayments(ctx context.Context, tenantID int64) ([]Payment, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return []Payment{}, err
+	}
+	defer RollbackWithLog(ctx, tx)
+	return GetPayments(ctx, tx, tenantID)
+}
+
+// Reconcile checks tenant's balances against payments in one snapshot of the database
+func (r *PostgresRepository) Reconcile(ctx context.Context, tenantID int64) (Reconciliation, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead, ReadOnly: true})
+	if err != nil {
+		return Reconciliation{}, err
+	}
+	defer RollbackWithLog(ctx, tx)
+	return Reconcile(ctx, tx, tenantID)
+}
+
+// GetCurrencyTotals returns totals of tenant's currencies with payments made from from till to
+func (r *PostgresRepository) GetCurrencyTotals(ctx context.Context, tenantID int64, from, to time.Time) ([]CurrencyTotals, error) {
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return []CurrencyTotals{}, err
+	}
+	defer RollbackWithLog(ctx, tx)
+	return GetCurrencyTotals(ctx, tx, tenantID, from, to)
+}
+
+// MakePayment makes payment between two tenant's accounts
+func (r *PostgresRepository) MakePayment(ctx context.Context,
+	tenantID,
+	buyerAccountID,
+	sellerAccountID int64,
+	amount decimal.Decimal) (Payment, error) {
+	return MakePayment(ctx, r.db, tenantID, buyerAccountID, sellerAccountID, amount)
+}
+
+// MakeDeposit adds amount coming from outside the service to tenant's account
+func (r *PostgresRepository) MakeDeposit(ctx context.Context, tenantID, accountID int64, amount decimal.Decimal) (Deposit, error) {
+	return MakeDeposit(ctx, r.db, tenantID, accountID, amount)
+}
@@ -0,0 +1,14 @@
+package models_test
+
+import (
+	"testing"
+
+	"github.com/c-pro/wallet-test/models"
+	"github.com/c-pro/wallet-test/models/repotest"
+)
+
+func TestPostgresRepository(t *testing.T) {
+	repotest.Run(t, func(t *testing.T) models.Repository {
+		return models.NewPostgresRepository(models.TestingDB())
+	})
+}
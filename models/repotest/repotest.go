@@ -0,0 +1,738 @@
+// Package repotest is a conformance test suite for models.Repository implementations.
+// Every backend runs the same scenarios, so a new backend is proven correct
+// by the same checks as the existing ones:
+//
+//	func TestRepository(t *testing.T) {
+//		repotest.Run(t, func(t *testing.T) models.Repository {
+//			return NewRepository()
+//		})
+//	}
+//
+// Scenarios work in models.DefaultTenantID tenant and create their own currencies
+// and accounts, so they can run against a database shared with other tests.
+package repotest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/c-pro/wallet-test/models"
+	"github.com/shopspring/decimal"
+)
+
+// otherTenantID is a tenant no scenario creates data in
+const otherTenantID = -1
+
+// Run runs all scenarios, each against a repository returned by newRepository
+func Run(t *testing.T, newRepository func(t *testing.T) models.Repository) {
+	scenarios := []struct {
+		name string
+		test func(t *testing.T, r models.Repository)
+	}{
+		{"Currencies", testCurrencies},
+		{"CreateAccount", testCreateAccount},
+		{"GetAccountByExternalID", testGetAccountByExternalID},
+		{"SetAccountShards", testSetAccountShards},
+		{"MakePayment", testMakePayment},
+		{"MakePaymentOtherTenant", testMakePaymentOtherTenant},
+		{"MakePaymentFrozen", testMakePaymentFrozen},
+		{"MakePaymentCanceled", testMakePaymentCanceled},
+		{"GetPayments", testGetPayments},
+		{"MakeDeposit", testMakeDeposit},
+		{"MakeDepositTotals", testMakeDepositTotals},
+		{"Reconcile", testReconcile},
+		{"GetCurrencyTotals", testGetCurrencyTotals},
+		{"MakePaymentParallel", testMakePaymentParallel},
+		{"MakePaymentHotAccount", testMakePaymentHotAccount},
+	}
+	for _, s := range scenarios {
+		s := s
+		t.Run(s.name, func(t *testing.T) {
+			s.test(t, newRepository(t))
+		})
+	}
+}
+
+// randomName returns a name unlikely to clash with names created by other runs
+func randomName(prefix string) string {
+	return fmt.Sprintf("%s%d", prefix, rand.Int63())
+}
+
+// makeCurrency creates a currency with a random name in default tenant
+func makeCurrency(t *testing.T, r models.Repository) models.Currency {
+	c := models.Currency{TenantID: models.DefaultTenantID, Name: randomName("C")}
+	if err := r.CreateCurrency(context.Background(), &c); err != nil {
+		t.Fatalf("Unexpected error in CreateCurrency: %v", err)
+	}
+	return c
+}
+
+// makeAccount creates an account in default tenant
+func makeAccount(t *testing.T, r models.Repository, currencyID int64, amount string) models.Account {
+	a := models.Account{TenantID: models.DefaultTenantID,
+		CurrencyID: currencyID,
+		Amount:     decimal.RequireFromString(amount),
+		Name:       randomName("account")}
+	if err := r.CreateAccount(context.Background(), &a); err != nil {
+		t.Fatalf("Unexpected error in CreateAccount: %v", err)
+	}
+	return a
+}
+
+// getAmount returns current balance of default tenant's account
+func getAmount(t *testing.T, r models.Repository, id int64) decimal.Decimal {
+	a, err := r.GetAccount(context.Background(), models.DefaultTenantID, id)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetAccount: %v", err)
+	}
+	return a.Amount
+}
+
+func testCurrencies(t *testing.T, r models.Repository) {
+	c := makeCurrency(t, r)
+	if c.ID == 0 {
+		t.Error("Currency ID should not be zero")
+	}
+
+	dup := models.Currency{TenantID: models.DefaultTenantID, Name: c.Name}
+	if err := r.CreateCurrency(context.Background(), &dup); err != models.ErrDuplicateCurrency {
+		t.Errorf("Expected CreateCurrency to return ErrDuplicateCurrency, got %v", err)
+	}
+
+	currencies, err := r.GetCurrencies(context.Background(), models.DefaultTenantID)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetCurrencies: %v", err)
+	}
+	found := false
+	for _, currency := range currencies {
+		if currency == c {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Currency %v was not found in %v", c, currencies)
+	}
+}
+
+func testCreateAccount(t *testing.T, r models.Repository) {
+	ctx := context.Background()
+	c := makeCurrency(t, r)
+	a := models.Account{TenantID: models.DefaultTenantID,
+		CurrencyID: c.ID,
+		Name:       randomName("account"),
+		Metadata:   json.RawMessage(`{"source":"test"}`),
+		Amount:     decimal.RequireFromString("123.456")}
+	if err := r.CreateAccount(ctx, &a); err != nil {
+		t.Fatalf("Unexpected error in CreateAccount: %v", err)
+	}
+	if a.ID == 0 {
+		t.Fatal("Account ID should not be zero")
+	}
+
+	a1, err := r.GetAccount(ctx, models.DefaultTenantID, a.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetAccount: %v", err)
+	}
+	if a1.Name != a.Name || a1.CurrencyID != c.ID || a1.CurrencyName != c.Name || !a1.Amount.Equals(a.Amount) {
+		t.Errorf("Expected account %v, got %v", a, a1)
+	}
+	var metadata map[string]string
+	if err := json.Unmarshal(a1.Metadata, &metadata); err != nil || metadata["source"] != "test" {
+		t.Errorf("Expected metadata to round trip, got %s", a1.Metadata)
+	}
+
+	accounts, err := r.GetAccounts(ctx, models.DefaultTenantID)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetAccounts: %v", err)
+	}
+	found := false
+	for _, account := range accounts {
+		if account.ID == a.ID {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("Account %d was not found in GetAccounts result", a.ID)
+	}
+
+	if _, err := r.GetAccount(ctx, otherTenantID, a.ID); err != sql.ErrNoRows {
+		t.Errorf("Expected GetAccount of other tenant to return sql.ErrNoRows, got %v", err)
+	}
+	if _, err := r.GetAccount(ctx, models.DefaultTenantID, -1); err != sql.ErrNoRows {
+		t.Errorf("Expected GetAccount of missing account to return sql.ErrNoRows, got %v", err)
+	}
+
+	bad := models.Account{TenantID: models.DefaultTenantID, CurrencyID: -1, Name: randomName("account")}
+	if err := r.CreateAccount(ctx, &bad); err != models.ErrCurrencyNotFound {
+		t.Errorf("Expected CreateAccount to return ErrCurrencyNotFound, got %v", err)
+	}
+
+	bad = models.Account{TenantID: models.DefaultTenantID,
+		CurrencyID: c.ID,
+		Name:       randomName("account"),
+		Amount:     decimal.New(-1, 0)}
+	if err := r.CreateAccount(ctx, &bad); err != models.ErrNegativeBalance {
+		t.Errorf("Expected CreateAccount to return ErrNegativeBalance, got %v", err)
+	}
+}
+
+func testGetAccountByExternalID(t *testing.T, r models.Repository) {
+	ctx := context.Background()
+	c := makeCurrency(t, r)
+	a := models.Account{TenantID: models.DefaultTenantID,
+		CurrencyID: c.ID,
+		Name:       randomName("account"),
+		ExternalID: randomName("ext")}
+	if err := r.CreateAccount(ctx, &a); err != nil {
+		t.Fatalf("Unexpected error in CreateAccount: %v", err)
+	}
+
+	dup := models.Account{TenantID: models.DefaultTenantID,
+		CurrencyID: c.ID,
+		Name:       randomName("account"),
+		ExternalID: a.ExternalID}
+	if err := r.CreateAccount(ctx, &dup); err != models.ErrDuplicateExternalID {
+		t.Errorf("Expected CreateAccount to return ErrDuplicateExternalID, got %v", err)
+	}
+
+	a1, err := r.GetAccountByExternalID(ctx, models.DefaultTenantID, a.ExternalID)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetAccountByExternalID: %v", err)
+	}
+	if a1.ID != a.ID {
+		t.Errorf("Expected account %d, got %d", a.ID, a1.ID)
+	}
+
+	if _, err := r.GetAccountByExternalID(ctx, otherTenantID, a.ExternalID); err != sql.ErrNoRows {
+		t.Errorf("Expected GetAccountByExternalID of other tenant to return sql.ErrNoRows, got %v", err)
+	}
+	if _, err := r.GetAccountByExternalID(ctx, models.DefaultTenantID, randomName("ext")); err != sql.ErrNoRows {
+		t.Errorf("Expected GetAccountByExternalID to return sql.ErrNoRows, got %v", err)
+	}
+}
+
+func testSetAccountShards(t *testing.T, r models.Repository) {
+	ctx := context.Background()
+	c := makeCurrency(t, r)
+	a := makeAccount(t, r, c.ID, "10")
+
+	if err := r.SetAccountShards(ctx, models.DefaultTenantID, a.ID, 0); err != models.ErrInvalidShards {
+		t.Errorf("Expected SetAccountShards to return ErrInvalidShards, got %v", err)
+	}
+	if err := r.SetAccountShards(ctx, models.DefaultTenantID, a.ID, 4); err != nil {
+		t.Fatalf("Unexpected error in SetAccountShards: %v", err)
+	}
+	if err := r.SetAccountShards(ctx, models.DefaultTenantID, a.ID, 2); err != models.ErrInvalidShards {
+		t.Errorf("Expected SetAccountShards to return ErrInvalidShards, got %v", err)
+	}
+	if err := r.SetAccountShards(ctx, otherTenantID, a.ID, 8); err != sql.ErrNoRows {
+		t.Errorf("Expected SetAccountShards of other tenant to return sql.ErrNoRows, got %v", err)
+	}
+	if amount := getAmount(t, r, a.ID); !amount.Equals(a.Amount) {
+		t.Errorf("Expected sharded account amount to be %s, got %s", a.Amount, amount)
+	}
+}
+
+func testMakePayment(t *testing.T, r models.Repository) {
+	ctx := context.Background()
+	c1 := makeCurrency(t, r)
+	c2 := makeCurrency(t, r)
+	amount := decimal.RequireFromString("250.00000001")
+
+	b := makeAccount(t, r, c1.ID, "500.0")
+	s := makeAccount(t, r, c1.ID, "0")
+	s2 := makeAccount(t, r, c2.ID, "0")
+
+	_, err := r.MakePayment(ctx, models.DefaultTenantID, b.ID, s2.ID, amount)
+	if err != models.ErrCurrencyMismatch {
+		t.Errorf("Expected MakePayment to return ErrCurrencyMismatch, got %v", err)
+	}
+
+	_, err = r.MakePayment(ctx, models.DefaultTenantID, b.ID, b.ID, amount)
+	if err != models.ErrNoPaymentToSelf {
+		t.Errorf("Expected MakePayment to return ErrNoPaymentToSelf, got %v", err)
+	}
+
+	_, err = r.MakePayment(ctx, models.DefaultTenantID, b.ID, s.ID, decimal.Zero)
+	if err != models.ErrNonPositiveAmount {
+		t.Errorf("Expected MakePayment to return ErrNonPositiveAmount, got %v", err)
+	}
+
+	_, err = r.MakePayment(ctx, models.DefaultTenantID, b.ID, -1, amount)
+	if err != sql.ErrNoRows {
+		t.Errorf("Expected MakePayment to return sql.ErrNoRows, got %v", err)
+	}
+
+	p, err := r.MakePayment(ctx, models.DefaultTenantID, b.ID, s.ID, amount)
+	if err != nil {
+		t.Fatalf("Unexpected error in MakePayment: %v", err)
+	}
+	if p.ID == 0 {
+		t.Error("Payment ID should not be zero")
+	}
+	if !p.Amount.Equals(amount) {
+		t.Errorf("Expected payment amount to be %s, but got %s", amount, p.Amount)
+	}
+	if p.CurrencyID != c1.ID || p.BuyerAccountID != b.ID || p.SellerAccountID != s.ID {
+		t.Errorf("Expected payment from %d to %d in %d, got %v", b.ID, s.ID, c1.ID, p)
+	}
+	if time.Since(p.OperationTimestamp) > time.Minute {
+		t.Errorf("Operation timestamp is far from Now: %s", p.OperationTimestamp)
+	}
+
+	expected := decimal.RequireFromString("249.99999999")
+	if amount := getAmount(t, r, b.ID); !amount.Equals(expected) {
+		t.Errorf("Buyer amount expected to be %s, got %s", expected, amount)
+	}
+	if sAmount := getAmount(t, r, s.ID); !sAmount.Equals(amount) {
+		t.Errorf("Seller amount expected to be %s, got %s", amount, sAmount)
+	}
+
+	_, err = r.MakePayment(ctx, models.DefaultTenantID, b.ID, s.ID, amount)
+	if err != models.ErrInsufficientAmount {
+		t.Errorf("Expected MakePayment to return ErrInsufficientAmount, got %v", err)
+	}
+}
+
+func testMakePaymentOtherTenant(t *testing.T, r models.Repository) {
+	c := makeCurrency(t, r)
+	b := makeAccount(t, r, c.ID, "10")
+	s := makeAccount(t, r, c.ID, "0")
+
+	_, err := r.MakePayment(context.Background(), otherTenantID, b.ID, s.ID, decimal.New(1, 0))
+	if err != sql.ErrNoRows {
+		t.Errorf("Expected MakePayment in other tenant to return sql.ErrNoRows, got %v", err)
+	}
+	if amount := getAmount(t, r, b.ID); !amount.Equals(b.Amount) {
+		t.Errorf("Expected buyer amount to stay %s, got %s", b.Amount, amount)
+	}
+}
+
+func testMakePaymentFrozen(t *testing.T, r models.Repository) {
+	ctx := context.Background()
+	c := makeCurrency(t, r)
+	b := makeAccount(t, r, c.ID, "10")
+	s := makeAccount(t, r, c.ID, "0")
+
+	if err := r.SetAccountFrozen(ctx, otherTenantID, s.ID, true); err != sql.ErrNoRows {
+		t.Errorf("Expected SetAccountFrozen in other tenant to return sql.ErrNoRows, got %v", err)
+	}
+	if err := r.SetAccountFrozen(ctx, models.DefaultTenantID, s.ID, true); err != nil {
+		t.Fatalf("Unexpected error in SetAccountFrozen: %v", err)
+	}
+	if a, err := r.GetAccount(ctx, models.DefaultTenantID, s.ID); err != nil || !a.Frozen {
+		t.Errorf("Expected account to be frozen, got %v (%v)", a, err)
+	}
+	if _, err := r.MakePayment(ctx, models.DefaultTenantID, b.ID, s.ID, decimal.New(1, 0)); err != models.ErrAccountFrozen {
+		t.Errorf("Expected payment to frozen account to return ErrAccountFrozen, got %v", err)
+	}
+	if _, err := r.MakePayment(ctx, models.DefaultTenantID, s.ID, b.ID, decimal.New(1, 0)); err != models.ErrAccountFrozen {
+		t.Errorf("Expected payment from frozen account to return ErrAccountFrozen, got %v", err)
+	}
+	if amount := getAmount(t, r, b.ID); !amount.Equals(b.Amount) {
+		t.Errorf("Expected buyer amount to stay %s, got %s", b.Amount, amount)
+	}
+
+	if err := r.SetAccountFrozen(ctx, models.DefaultTenantID, s.ID, false); err != nil {
+		t.Fatalf("Unexpected error in SetAccountFrozen: %v", err)
+	}
+	if _, err := r.MakePayment(ctx, models.DefaultTenantID, b.ID, s.ID, decimal.New(1, 0)); err != nil {
+		t.Errorf("Unexpected error in MakePayment to unfrozen account: %v", err)
+	}
+}
+
+func testMakePaymentCanceled(t *testing.T, r models.Repository) {
+	c := makeCurrency(t, r)
+	b := makeAccount(t, r, c.ID, "500.0")
+	s := makeAccount(t, r, c.ID, "0")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := r.MakePayment(ctx, models.DefaultTenantID, b.ID, s.ID, decimal.New(1, 0)); err != context.Canceled {
+		t.Errorf("Expected MakePayment to return context.Canceled, got %v", err)
+	}
+	if amount := getAmount(t, r, b.ID); !amount.Equals(b.Amount) {
+		t.Errorf("Expected buyer amount to stay %s, got %s", b.Amount, amount)
+	}
+}
+
+func testGetPayments(t *testing.T, r models.Repository) {
+	c := makeCurrency(t, r)
+	b := makeAccount(t, r, c.ID, "500.0")
+	s := makeAccount(t, r, c.ID, "0")
+	satoshi := decimal.RequireFromString("0.00000001")
+
+	p, err := r.MakePayment(context.Background(), models.DefaultTenantID, b.ID, s.ID, satoshi)
+	if err != nil {
+		t.Fatalf("Unexpected error in MakePayment: %v", err)
+	}
+
+	payments, err := r.GetPayments(context.Background(), models.DefaultTenantID)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetPayments: %v", err)
+	}
+	found := false
+	for _, payment := range payments {
+		if payment.ID == p.ID {
+			found = true
+			if !payment.Amount.Equals(satoshi) || payment.CurrencyName != c.Name {
+				t.Errorf("Expected payment of %s %s, got %s %s", satoshi, c.Name, payment.Amount, payment.CurrencyName)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("Payment %d was not found in GetPayments result", p.ID)
+	}
+
+	payments, err = r.GetPayments(context.Background(), otherTenantID)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetPayments: %v", err)
+	}
+	if len(payments) != 0 {
+		t.Errorf("Expected no payments in other tenant, got %d", len(payments))
+	}
+}
+
+func testMakeDeposit(t *testing.T, r models.Repository) {
+	ctx := context.Background()
+	c := makeCurrency(t, r)
+	a := makeAccount(t, r, c.ID, "10")
+	s := makeAccount(t, r, c.ID, "0")
+
+	d, err := r.MakeDeposit(ctx, models.DefaultTenantID, a.ID, decimal.RequireFromString("2.5"))
+	if err != nil {
+		t.Fatalf("Unexpected error in MakeDeposit: %v", err)
+	}
+	if d.ID == 0 || d.AccountID != a.ID || d.CurrencyID != c.ID || !d.Amount.Equals(decimal.RequireFromString("2.5")) {
+		t.Errorf("Expected deposit of 2.5 to account %d, got %+v", a.ID, d)
+	}
+	if amount := getAmount(t, r, a.ID); !amount.Equals(decimal.RequireFromString("12.5")) {
+		t.Errorf("Expected amount 12.5 after deposit, got %s", amount)
+	}
+
+	for _, amount := range []decimal.Decimal{decimal.Zero, decimal.New(-1, 0)} {
+		if _, err := r.MakeDeposit(ctx, models.DefaultTenantID, a.ID, amount); err != models.ErrNonPositiveAmount {
+			t.Errorf("Expected deposit of %s to return ErrNonPositiveAmount, got %v", amount, err)
+		}
+	}
+	if _, err := r.MakeDeposit(ctx, otherTenantID, a.ID, decimal.New(1, 0)); err != sql.ErrNoRows {
+		t.Errorf("Expected deposit in other tenant to return sql.ErrNoRows, got %v", err)
+	}
+	if err := r.SetAccountFrozen(ctx, models.DefaultTenantID, a.ID, true); err != nil {
+		t.Fatalf("Unexpected error in SetAccountFrozen: %v", err)
+	}
+	if _, err := r.MakeDeposit(ctx, models.DefaultTenantID, a.ID, decimal.New(1, 0)); err != models.ErrAccountFrozen {
+		t.Errorf("Expected deposit to frozen account to return ErrAccountFrozen, got %v", err)
+	}
+	if err := r.SetAccountFrozen(ctx, models.DefaultTenantID, a.ID, false); err != nil {
+		t.Fatalf("Unexpected error in SetAccountFrozen: %v", err)
+	}
+	if amount := getAmount(t, r, a.ID); !amount.Equals(decimal.RequireFromString("12.5")) {
+		t.Errorf("Expected amount to stay 12.5 after failed deposits, got %s", amount)
+	}
+
+	// deposit to a sharded account is spendable together with its shards
+	if err := r.SetAccountShards(ctx, models.DefaultTenantID, s.ID, 4); err != nil {
+		t.Fatalf("Unexpected error in SetAccountShards: %v", err)
+	}
+	if _, err := r.MakePayment(ctx, models.DefaultTenantID, a.ID, s.ID, decimal.New(2, 0)); err != nil {
+		t.Fatalf("Unexpected error in MakePayment: %v", err)
+	}
+	if _, err := r.MakeDeposit(ctx, models.DefaultTenantID, s.ID, decimal.New(3, 0)); err != nil {
+		t.Fatalf("Unexpected error in MakeDeposit: %v", err)
+	}
+	if _, err := r.MakePayment(ctx, models.DefaultTenantID, s.ID, a.ID, decimal.New(5, 0)); err != nil {
+		t.Fatalf("Unexpected error in MakePayment of deposited amount: %v", err)
+	}
+	if amount := getAmount(t, r, s.ID); !amount.IsZero() {
+		t.Errorf("Expected sharded account to be empty, got %s", amount)
+	}
+}
+
+func testMakeDepositTotals(t *testing.T, r models.Repository) {
+	ctx := context.Background()
+	c := makeCurrency(t, r)
+	b := makeAccount(t, r, c.ID, "0")
+	s := makeAccount(t, r, c.ID, "0")
+	if _, err := r.MakeDeposit(ctx, models.DefaultTenantID, b.ID, decimal.New(100, 0)); err != nil {
+		t.Fatalf("Unexpected error in MakeDeposit: %v", err)
+	}
+	if _, err := r.MakePayment(ctx, models.DefaultTenantID, b.ID, s.ID, decimal.New(30, 0)); err != nil {
+		t.Fatalf("Unexpected error in MakePayment: %v", err)
+	}
+
+	// deposits are part of the expected balance
+	result, err := r.Reconcile(ctx, models.DefaultTenantID)
+	if err != nil {
+		t.Fatalf("Unexpected error in Reconcile: %v", err)
+	}
+	for _, m := range result.Accounts {
+		if m.AccountID == b.ID || m.AccountID == s.ID {
+			t.Errorf("Unexpected balance mismatch %+v", m)
+		}
+	}
+	for _, totals := range result.Currencies {
+		if totals.CurrencyID != c.ID {
+			continue
+		}
+		if totals.Deposits != 1 || !totals.Deposited.Equals(decimal.New(100, 0)) || !totals.Balance.Equals(decimal.New(100, 0)) {
+			t.Errorf("Expected 1 deposit of 100 and balance 100, got %+v", totals)
+		}
+	}
+
+	now := time.Now()
+	totals := getCurrencyTotals(t, r, c.ID, now.Add(-time.Hour), now.Add(time.Hour))
+	if totals.Deposits != 1 || !totals.Deposited.Equals(decimal.New(100, 0)) || !totals.Balance.Equals(decimal.New(100, 0)) {
+		t.Errorf("Expected 1 deposit of 100 and balance 100 in the period, got %+v", totals)
+	}
+
+	// deposit made after the period is reverted from the period's balance
+	time.Sleep(10 * time.Millisecond)
+	if _, err := r.MakeDeposit(ctx, models.DefaultTenantID, s.ID, decimal.New(7, 0)); err != nil {
+		t.Fatalf("Unexpected error in MakeDeposit: %v", err)
+	}
+	totals = getCurrencyTotals(t, r, c.ID, now.Add(-time.Hour), now)
+	if totals.Deposits != 1 || !totals.Balance.Equals(decimal.New(100, 0)) {
+		t.Errorf("Expected 1 deposit and balance 100 before the second deposit, got %+v", totals)
+	}
+}
+
+func testReconcile(t *testing.T, r models.Repository) {
+	c := makeCurrency(t, r)
+	b := makeAccount(t, r, c.ID, "500.0")
+	s := makeAccount(t, r, c.ID, "10")
+	if _, err := r.MakePayment(context.Background(), models.DefaultTenantID, b.ID, s.ID, decimal.New(20, 0)); err != nil {
+		t.Fatalf("Unexpected error in MakePayment: %v", err)
+	}
+
+	result, err := r.Reconcile(context.Background(), models.DefaultTenantID)
+	if err != nil {
+		t.Fatalf("Unexpected error in Reconcile: %v", err)
+	}
+	found := false
+	for _, totals := range result.Currencies {
+		if totals.CurrencyID != c.ID {
+			continue
+		}
+		found = true
+		if totals.CurrencyName != c.Name || totals.Accounts != 2 || totals.Unverifiable != 0 || totals.Payments != 1 {
+			t.Errorf("Expected 2 verifiable accounts and 1 payment in %s, got %+v", c.Name, totals)
+		}
+		if !totals.Opening.Equals(decimal.New(510, 0)) || !totals.Balance.Equals(decimal.New(510, 0)) || !totals.Volume.Equals(decimal.New(20, 0)) {
+			t.Errorf("Expected opening and balance 510 and volume 20, got %s, %s and %s", totals.Opening, totals.Balance, totals.Volume)
+		}
+	}
+	if !found {
+		t.Errorf("Currency %d was not found in reconciliation", c.ID)
+	}
+	for _, m := range result.Accounts {
+		if m.AccountID == b.ID || m.AccountID == s.ID {
+			t.Errorf("Unexpected balance mismatch %+v", m)
+		}
+	}
+	for _, m := range result.Payments {
+		if m.AccountID == b.ID || m.AccountID == s.ID {
+			t.Errorf("Unexpected payment mismatch %+v", m)
+		}
+	}
+
+	result, err = r.Reconcile(context.Background(), otherTenantID)
+	if err != nil {
+		t.Fatalf("Unexpected error in Reconcile: %v", err)
+	}
+	if len(result.Currencies) != 0 || len(result.Accounts) != 0 || len(result.Payments) != 0 {
+		t.Errorf("Expected empty reconciliation of other tenant, got %+v", result)
+	}
+}
+
+func testGetCurrencyTotals(t *testing.T, r models.Repository) {
+	c := makeCurrency(t, r)
+	b := makeAccount(t, r, c.ID, "500.0")
+	s := makeAccount(t, r, c.ID, "10")
+	makeAccount(t, r, c.ID, "1.5")
+	for _, amount := range []int64{20, 5} {
+		if _, err := r.MakePayment(context.Background(), models.DefaultTenantID, b.ID, s.ID, decimal.New(amount, 0)); err != nil {
+			t.Fatalf("Unexpected error in MakePayment: %v", err)
+		}
+	}
+
+	now := time.Now()
+	totals := getCurrencyTotals(t, r, c.ID, now.Add(-time.Hour), now.Add(time.Hour))
+	if totals.CurrencyName != c.Name || totals.Accounts != 3 || totals.ActiveAccounts != 2 || totals.Payments != 2 {
+		t.Errorf("Expected 3 accounts, 2 active and 2 payments in %s, got %+v", c.Name, totals)
+	}
+	if !totals.Balance.Equals(decimal.RequireFromString("511.5")) || !totals.Volume.Equals(decimal.New(25, 0)) {
+		t.Errorf("Expected balance 511.5 and volume 25, got %s and %s", totals.Balance, totals.Volume)
+	}
+
+	// accounts did not exist yet in the past period
+	totals = getCurrencyTotals(t, r, c.ID, now.Add(-2*time.Hour), now.Add(-time.Hour))
+	if totals.Accounts != 0 || totals.ActiveAccounts != 0 || totals.Payments != 0 || !totals.Volume.IsZero() || !totals.Balance.IsZero() {
+		t.Errorf("Expected no accounts and payments in the past period, got %+v", totals)
+	}
+
+	// payment to an account opened after the period is reverted from the period's balance
+	time.Sleep(10 * time.Millisecond)
+	n := makeAccount(t, r, c.ID, "0")
+	if _, err := r.MakePayment(context.Background(), models.DefaultTenantID, b.ID, n.ID, decimal.New(7, 0)); err != nil {
+		t.Fatalf("Unexpected error in MakePayment: %v", err)
+	}
+	totals = getCurrencyTotals(t, r, c.ID, now.Add(-time.Hour), now)
+	if totals.Accounts != 3 || totals.Payments != 2 || !totals.Balance.Equals(decimal.RequireFromString("511.5")) {
+		t.Errorf("Expected balance 511.5 of 3 accounts and 2 payments before the new account, got %+v", totals)
+	}
+
+	other, err := r.GetCurrencyTotals(context.Background(), otherTenantID, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("Unexpected error in GetCurrencyTotals: %v", err)
+	}
+	for _, totals := range other {
+		if totals.CurrencyID == c.ID {
+			t.Errorf("Currency %d of default tenant is in other tenant's totals", c.ID)
+		}
+	}
+}
+
+// getCurrencyTotals returns totals of currency currencyID failing the test if there are none
+func getCurrencyTotals(t *testing.T, r models.Repository, currencyID int64, from, to time.Time) models.CurrencyTotals {
+	t.Helper()
+	totals, err := r.GetCurrencyTotals(context.Background(), models.DefaultTenantID, from, to)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetCurrencyTotals: %v", err)
+	}
+	for _, ct := range totals {
+		if ct.CurrencyID == currencyID {
+			return ct
+		}
+	}
+	t.Fatalf("Currency %d was not found in totals", currencyID)
+	return models.CurrencyTotals{}
+}
+
+// testMakePaymentParallel creates 1 account with 500 in one currency and 1 account with 600 in another,
+// and 98 more empty accounts in both currencies. Then 100 goroutines make 100 payments each
+// between random accounts. Total balance in each currency must stay the same.
+func testMakePaymentParallel(t *testing.T, r models.Repository) {
+	c1 := makeCurrency(t, r)
+	c2 := makeCurrency(t, r)
+	currencies := []int64{c1.ID, c2.ID}
+
+	accounts := []models.Account{
+		makeAccount(t, r, c1.ID, "500.0"),
+		makeAccount(t, r, c2.ID, "600.0"),
+	}
+	for i := 1; i < 98; i++ {
+		accounts = append(accounts, makeAccount(t, r, currencies[i%2], "0"))
+	}
+
+	goodErrors := make(map[error]struct{})
+	goodErrors[models.ErrCurrencyMismatch] = struct{}{}
+	goodErrors[models.ErrInsufficientAmount] = struct{}{}
+	goodErrors[models.ErrNoPaymentToSelf] = struct{}{}
+	goodErrors[models.ErrNonPositiveAmount] = struct{}{}
+
+	var wg sync.WaitGroup
+	wg.Add(100)
+
+	for j := 0; j < 100; j++ {
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				amount := decimal.New(rand.Int63n(1000), -2)
+				bID := accounts[rand.Int63n(int64(len(accounts)))].ID
+				sID := accounts[rand.Int63n(int64(len(accounts)))].ID
+				_, err := r.MakePayment(context.Background(), models.DefaultTenantID, bID, sID, amount)
+				if _, ok := goodErrors[err]; !ok && err != nil {
+					t.Errorf("Unexpected error in MakePayment: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	sum1 := decimal.Zero
+	sum2 := decimal.Zero
+	for _, a := range accounts {
+		amount := getAmount(t, r, a.ID)
+		if amount.Sign() < 0 {
+			t.Errorf("Account %d has negative balance %s", a.ID, amount)
+		}
+		if a.CurrencyID == c1.ID {
+			sum1 = sum1.Add(amount)
+		} else {
+			sum2 = sum2.Add(amount)
+		}
+	}
+
+	if !sum1.Equals(decimal.New(500, 0)) {
+		t.Errorf("Sum %s is expected to be 500, but got %s", c1.Name, sum1)
+	}
+	if !sum2.Equals(decimal.New(600, 0)) {
+		t.Errorf("Sum %s is expected to be 600, but got %s", c2.Name, sum2)
+	}
+}
+
+// testMakePaymentHotAccount makes concurrent payments to and from one sharded account
+// and checks its balance matches successful payments
+func testMakePaymentHotAccount(t *testing.T, r models.Repository) {
+	c := makeCurrency(t, r)
+	hot := makeAccount(t, r, c.ID, "0")
+	buyers := []models.Account{}
+	for i := 0; i < 20; i++ {
+		buyers = append(buyers, makeAccount(t, r, c.ID, "100"))
+	}
+	if err := r.SetAccountShards(context.Background(), models.DefaultTenantID, hot.ID, 4); err != nil {
+		t.Fatalf("Unexpected error in SetAccountShards: %v", err)
+	}
+
+	goodErrors := make(map[error]struct{})
+	goodErrors[models.ErrInsufficientAmount] = struct{}{}
+	goodErrors[models.ErrLockFailed] = struct{}{}
+
+	// hot account balance is tracked in whole units
+	var balance int64
+	var wg sync.WaitGroup
+	wg.Add(20)
+	for j := 0; j < 20; j++ {
+		go func(j int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				other := buyers[rand.Intn(len(buyers))].ID
+				bID, sID, delta := other, hot.ID, int64(1)
+				// every fourth payment is made from the hot account
+				if (i+j)%4 == 0 {
+					bID, sID, delta = hot.ID, other, -1
+				}
+				_, err := r.MakePayment(context.Background(), models.DefaultTenantID, bID, sID, decimal.New(1, 0))
+				if _, ok := goodErrors[err]; !ok && err != nil {
+					t.Errorf("Unexpected error in MakePayment: %v", err)
+					return
+				}
+				if err == nil {
+					atomic.AddInt64(&balance, delta)
+				}
+			}
+		}(j)
+	}
+	wg.Wait()
+
+	amount := getAmount(t, r, hot.ID)
+	if !amount.Equals(decimal.New(balance, 0)) {
+		t.Errorf("Expected hot account amount to be %d, got %s", balance, amount)
+	}
+	sum := amount
+	for _, b := range buyers {
+		sum = sum.Add(getAmount(t, r, b.ID))
+	}
+	if !sum.Equals(decimal.New(2000, 0)) {
+		t.Errorf("Sum is expected to be 2000, but got %s", sum)
+	}
+}
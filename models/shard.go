@@ -0,0 +1,139 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+	"github.com/shopspring/decimal"
+)
+
+// MaxAccountShards is a maximum number of balance shards an account can have
+const MaxAccountShards = 256
+
+// ErrInvalidShards is returned when number of shards is out of range or decreased
+var ErrInvalidShards = errors.New("Number of shards should be between 1 and 256 and can not be decreased")
+
+// GetAccountShards returns number of balance shards of the tenant's account.
+// Zero means account is not sharded.
+func GetAccountShards(ctx context.Context, tx *sql.Tx, tenantID, accountID int64) (int, error) {
+	shards := 0
+	query := `select count(s.shard)
+				from accounts a
+				left join account_shards s on (s.account_id = a.id)
+				where a.id = $1
+				  and a.tenant_id = $2
+				group by a.id`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	ctx, span := startQuerySpan(ctx, "select account shards", query)
+	err := tx.QueryRowContext(ctx, query, accountID, tenantID).Scan(&shards)
+	span.End(err)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return 0, err
+	}
+	return shards, nil
+}
+
+// SetAccountShards designates tenant's account as hot by splitting its balance into shards.
+// Payments to a sharded account credit a random shard without locking the account itself,
+// so many payments to the account can be made concurrently. Payments from the account
+// consolidate shards back to the main balance. Account balance is always a sum of all shards.
+// Number of shards can only be increased.
+func SetAccountShards(ctx context.Context, tx *sql.Tx, tenantID, accountID int64, shards int) error {
+	if shards < 1 || shards > MaxAccountShards {
+		return ErrInvalidShards
+	}
+	// wait for payments in progress, so they don't miss new shards
+	if err := lockAccountsOrdered(ctx, tx, tenantID, []int64{accountID}); err != nil {
+		return err
+	}
+	current, err := GetAccountShards(ctx, tx, tenantID, accountID)
+	if err != nil {
+		return err
+	}
+	if shards < current {
+		return ErrInvalidShards
+	}
+	query := `insert into account_shards(tenant_id, account_id, shard)
+			  select $1, $2, generate_series($3::integer, $4::integer - 1)`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	_, err = tx.ExecContext(ctx, query, tenantID, accountID, current, shards)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// consolidateShards moves balances of all shards of locked accounts to their main balances.
+// Shards stay locked till the end of transaction, so Account.Save can safely update the main balance.
+func consolidateShards(ctx context.Context, tx *sql.Tx, ids []int64) error {
+	query := `with moved as (
+				update account_shards s
+				   set amount = 0
+				  from (select account_id, shard, amount
+						  from account_shards
+						 where account_id = any($1)
+						for update) o
+				 where s.account_id = o.account_id
+				   and s.shard = o.shard
+				returning o.account_id, o.amount
+			  )
+			  update accounts a
+				 set amount = a.amount + m.amount
+				from (select account_id, sum(amount) amount
+						from moved
+					   group by account_id) m
+			   where a.id = m.account_id`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	ctx, span := startQuerySpan(ctx, "consolidate shards", query)
+	_, err := tx.ExecContext(ctx, query, pq.Array(ids))
+	span.End(err)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return err
+	}
+	return nil
+}
+
+// creditShard adds amount to a shard of the account
+func creditShard(ctx context.Context, tx *sql.Tx, accountID int64, shard int, amount decimal.Decimal) error {
+	query := `update account_shards
+			  set amount = amount + $1
+			  where account_id = $2
+			    and shard = $3`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	ctx, span := startQuerySpan(ctx, "credit shard", query)
+	res, err := tx.ExecContext(ctx, query, amount, accountID, shard)
+	span.End(err)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n != 1 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestSetAccountShards(t *testing.T) {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+
+	a := makeAccount(tx, 1, "10")
+	ctx := context.Background()
+
+	if err := SetAccountShards(ctx, tx, DefaultTenantID, a.ID, 0); err != ErrInvalidShards {
+		t.Errorf("Expected SetAccountShards to return ErrInvalidShards, got %v", err)
+	}
+	if err := SetAccountShards(ctx, tx, DefaultTenantID, a.ID, 4); err != nil {
+		t.Fatalf("Unexpected error in SetAccountShards: %v", err)
+	}
+	if err := SetAccountShards(ctx, tx, DefaultTenantID, a.ID, 2); err != ErrInvalidShards {
+		t.Errorf("Expected SetAccountShards to return ErrInvalidShards, got %v", err)
+	}
+	if err := SetAccountShards(ctx, tx, DefaultTenantID, a.ID, 8); err != nil {
+		t.Fatalf("Unexpected error in SetAccountShards: %v", err)
+	}
+	shards, err := GetAccountShards(ctx, tx, DefaultTenantID, a.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetAccountShards: %v", err)
+	}
+	if shards != 8 {
+		t.Errorf("Expected account to have 8 shards, got %d", shards)
+	}
+
+	a2, err := GetAccount(ctx, tx, DefaultTenantID, a.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetAccount: %v", err)
+	}
+	if !a2.Amount.Equals(a.Amount) {
+		t.Errorf("Expected sharded account amount to be %s, got %s", a.Amount, a2.Amount)
+	}
+
+	if err := SetAccountShards(ctx, tx, -1, a.ID, 16); err != sql.ErrNoRows {
+		t.Errorf("Expected SetAccountShards to return sql.ErrNoRows, got %v", err)
+	}
+}
+
+func testMakePaymentHotAccount(t *testing.T) {
+	cleanDb(t)
+	defer cleanDb(t)
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	hot := makeAccount(tx, 1, "0")
+	buyers := []Account{}
+	for i := 0; i < 20; i++ {
+		buyers = append(buyers, makeAccount(tx, 1, "100"))
+	}
+	if err := SetAccountShards(context.Background(), tx, DefaultTenantID, hot.ID, 4); err != nil {
+		t.Fatalf("Unexpected error in SetAccountShards: %v", err)
+	}
+	tx.Commit()
+
+	goodErrors := make(map[error]struct{})
+	goodErrors[ErrInsufficientAmount] = struct{}{}
+	goodErrors[ErrLockFailed] = struct{}{}
+
+	// payments are linked into the chain concurrently, as the service does
+	stopLinker := startLinker(t, DefaultTenantID)
+
+	// hot account balance is tracked in whole units
+	var balance, made int64
+	var wg sync.WaitGroup
+	wg.Add(20)
+	for j := 0; j < 20; j++ {
+		go func(j int) {
+			defer wg.Done()
+			for i := 0; i < 20; i++ {
+				other := buyers[rand.Intn(len(buyers))].ID
+				bID, sID, delta := other, hot.ID, int64(1)
+				// every fourth payment is made from the hot account
+				if (i+j)%4 == 0 {
+					bID, sID, delta = hot.ID, other, -1
+				}
+				_, err := MakePayment(context.Background(), db, DefaultTenantID, bID, sID, decimal.New(1, 0))
+				if _, ok := goodErrors[err]; !ok && err != nil {
+					t.Errorf("Unexpected error in MakePayment: %v", err)
+					return
+				}
+				if err == nil {
+					atomic.AddInt64(&balance, delta)
+					atomic.AddInt64(&made, 1)
+				}
+			}
+		}(j)
+	}
+	wg.Wait()
+	stopLinker()
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+
+	h, err := GetAccount(context.Background(), tx, DefaultTenantID, hot.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetAccount: %v", err)
+	}
+	if !h.Amount.Equals(decimal.New(balance, 0)) {
+		t.Errorf("Expected hot account amount to be %d, got %s", balance, h.Amount)
+	}
+
+	sum := h.Amount
+	for _, b := range buyers {
+		account, err := GetAccount(context.Background(), tx, DefaultTenantID, b.ID)
+		if err != nil {
+			t.Fatalf("Unexpected error in GetAccount: %v", err)
+		}
+		sum = sum.Add(account.Amount)
+	}
+	if !sum.Equals(decimal.New(2000, 0)) {
+		t.Errorf("Sum is expected to be 2000, but got %s", sum)
+	}
+
+	// concurrent payments to sharded account are chained without gaps
+	if _, err := ChainPayments(context.Background(), tx, DefaultTenantID); err != nil {
+		t.Fatalf("Unexpected error in ChainPayments: %v", err)
+	}
+	report, err := VerifyPaymentChain(context.Background(), tx, DefaultTenantID, nil)
+	if err != nil {
+		t.Fatalf("Unexpected error in VerifyPaymentChain: %v", err)
+	}
+	if report.Broken != nil || int64(report.Payments) != made {
+		t.Errorf("Expected intact chain of %d payments, got %+v", made, report)
+	}
+}
+
+// startLinker links tenant's payments in a loop until the returned function is called
+func startLinker(t testing.TB, tenantID int64) func() {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			tx, err := db.Begin()
+			if err != nil {
+				t.Errorf("Unexpected error in db.Begin(): %v", err)
+				return
+			}
+			if _, err := ChainPayments(context.Background(), tx, tenantID); err != nil {
+				tx.Rollback()
+				t.Errorf("Unexpected error in ChainPayments: %v", err)
+				return
+			}
+			if err := tx.Commit(); err != nil {
+				t.Errorf("Unexpected error in tx.Commit(): %v", err)
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+func TestMakePaymentHotAccount(t *testing.T) {
+	testMakePaymentHotAccount(t)
+}
+
+func TestMakePaymentHotAccountOrdered(t *testing.T) {
+	SetLockStrategy(LockOrdered)
+	defer SetLockStrategy(LockSkipLocked)
+	testMakePaymentHotAccount(t)
+}
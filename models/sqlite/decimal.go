@@ -0,0 +1,91 @@
+package sqlite
+
+import (
+	"database/sql"
+
+	"github.com/mattn/go-sqlite3"
+	"github.com/shopspring/decimal"
+)
+
+// driverName is sqlite3 driver with decimal functions registered on every connection.
+// Amounts are stored as text and SQLite arithmetic on them would be floating point,
+// so queries aggregate them with these functions instead:
+//
+//	decimal_sum(x)    - exact sum of x, '0' if there are no rows
+//	decimal_add(x, y) - x + y
+//	decimal_sub(x, y) - x - y
+//	decimal_cmp(x, y) - -1, 0 or 1 as x is less than, equal to or greater than y
+const driverName = "sqlite3_decimal"
+
+func init() {
+	sql.Register(driverName, &sqlite3.SQLiteDriver{ConnectHook: registerDecimalFunctions})
+}
+
+// registerDecimalFunctions registers decimal functions on a new connection
+func registerDecimalFunctions(conn *sqlite3.SQLiteConn) error {
+	if err := conn.RegisterAggregator("decimal_sum", newDecimalSum, true); err != nil {
+		return err
+	}
+	if err := conn.RegisterFunc("decimal_add", decimalAdd, true); err != nil {
+		return err
+	}
+	if err := conn.RegisterFunc("decimal_sub", decimalSub, true); err != nil {
+		return err
+	}
+	return conn.RegisterFunc("decimal_cmp", decimalCmp, true)
+}
+
+// decimalSum is decimal_sum aggregate state
+type decimalSum struct {
+	sum decimal.Decimal
+}
+
+func newDecimalSum() *decimalSum {
+	return &decimalSum{}
+}
+
+func (s *decimalSum) Step(x string) error {
+	d, err := decimal.NewFromString(x)
+	if err != nil {
+		return err
+	}
+	s.sum = s.sum.Add(d)
+	return nil
+}
+
+func (s *decimalSum) Done() string {
+	return s.sum.String()
+}
+
+func decimalAdd(x, y string) (string, error) {
+	a, b, err := parseDecimals(x, y)
+	if err != nil {
+		return "", err
+	}
+	return a.Add(b).String(), nil
+}
+
+func decimalSub(x, y string) (string, error) {
+	a, b, err := parseDecimals(x, y)
+	if err != nil {
+		return "", err
+	}
+	return a.Sub(b).String(), nil
+}
+
+func decimalCmp(x, y string) (int, error) {
+	a, b, err := parseDecimals(x, y)
+	if err != nil {
+		return 0, err
+	}
+	return a.Cmp(b), nil
+}
+
+func parseDecimals(x, y string) (decimal.Decimal, decimal.Decimal, error) {
+	a, err := decimal.NewFromString(x)
+	if err != nil {
+		return a, decimal.Zero, err
+	}
+	b, err := decimal.NewFromString(y)
+	return a, b, err
+}
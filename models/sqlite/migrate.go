@@ -0,0 +1,133 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/c-pro/wallet-test/models"
+)
+
+// migrationFiles are versioned schema migrations named <version>_<name>.sql.
+// SQLite files are only migrated up when opened, so there are no down migrations.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migration is a versioned schema change
+type migration struct {
+	version int
+	sql     string
+}
+
+var migrationName = regexp.MustCompile(`^(\d+)_\w+\.sql$`)
+
+// migrations are embedded migrations sorted by version
+var migrations = mustParseMigrations()
+
+// mustParseMigrations reads embedded migrations. Versions should start with 1 and have no gaps.
+// Migrations are embedded at compile time, so any error here is a programming error.
+func mustParseMigrations() []migration {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		panic(err)
+	}
+	result := []migration{}
+	for _, e := range entries {
+		m := migrationName.FindStringSubmatch(e.Name())
+		if m == nil {
+			panic(fmt.Sprintf("bad migration file name %q", e.Name()))
+		}
+		version, _ := strconv.Atoi(m[1])
+		b, err := migrationFiles.ReadFile(path.Join("migrations", e.Name()))
+		if err != nil {
+			panic(err)
+		}
+		result = append(result, migration{version, string(b)})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].version < result[j].version })
+	for i, m := range result {
+		if m.version != i+1 {
+			panic(fmt.Sprintf("migration %d is missing", i+1))
+		}
+	}
+	return result
+}
+
+// LatestSchemaVersion returns version of the newest embedded migration
+func LatestSchemaVersion() int {
+	return len(migrations)
+}
+
+// SchemaVersion returns schema version of the file, it is kept in user_version pragma
+func SchemaVersion(ctx context.Context, db *sql.DB) (int, error) {
+	var version int
+	err := db.QueryRowContext(ctx, `pragma user_version`).Scan(&version)
+	return version, err
+}
+
+// legacyColumns tell schema version of files created before versions were recorded:
+// a file having the column is at least at that version
+var legacyColumns = []struct {
+	version       int
+	table, column string
+}{
+	{3, "accounts", "opening_amount"},
+	{2, "accounts", "frozen"},
+}
+
+// legacyVersion returns schema version of a file created before versions were recorded.
+// The initial migration only creates missing tables, so it is applied to such files first.
+func legacyVersion(tx *sql.Tx) (int, error) {
+	if _, err := tx.Exec(migrations[0].sql); err != nil {
+		return 0, err
+	}
+	for _, c := range legacyColumns {
+		exists := false
+		query := `select count(*) > 0 from pragma_table_info(?) where name = ?`
+		if err := tx.QueryRow(query, c.table, c.column).Scan(&exists); err != nil {
+			return 0, err
+		}
+		if exists {
+			return c.version, nil
+		}
+	}
+	return 1, nil
+}
+
+// migrate applies migrations the file is missing. Transaction takes the write lock
+// when it begins, so processes opening the same file migrate it one at a time.
+func migrate(db *sql.DB) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var version int
+	if err := tx.QueryRow(`pragma user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version > len(migrations) {
+		return models.ErrSchemaAhead
+	}
+	if version == 0 {
+		if version, err = legacyVersion(tx); err != nil {
+			return err
+		}
+	}
+	for _, m := range migrations[version:] {
+		if _, err := tx.Exec(m.sql); err != nil {
+			return fmt.Errorf("migration %d failed: %v", m.version, err)
+		}
+	}
+	// pragma does not accept parameters, version is an integer
+	if _, err := tx.Exec(fmt.Sprintf(`pragma user_version = %d`, len(migrations))); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,46 @@
+-- SQLite has no numeric type with enough precision, so amounts are stored as text
+-- and arithmetic is done by the service or by decimal functions it registers.
+-- Tenants and owners are not stored, their IDs are not checked.
+-- Tables are created only if missing, as files created before schema versions
+-- were recorded are migrated starting with this migration.
+
+create table if not exists currencies (
+    id integer primary key autoincrement,
+    tenant_id integer not null,
+    name text not null,
+    constraint currencies_name_key unique (tenant_id, name)
+);
+
+create table if not exists accounts (
+    id integer primary key autoincrement,
+    tenant_id integer not null,
+    currency_id integer not null references currencies(id),
+    owner_id integer,
+    name text not null default '',
+    external_id text,
+    metadata text not null default '{}',
+    amount text not null,
+    shards integer not null default 0,
+    constraint accounts_external_id_key unique (tenant_id, external_id)
+);
+
+create index if not exists accounts_owner_id_idx on accounts(tenant_id, owner_id);
+
+create table if not exists payments (
+    id integer primary key autoincrement,
+    tenant_id integer not null,
+    currency_id integer not null references currencies(id),
+    amount text not null,
+    buyer_account_id integer not null references accounts(id),
+    seller_account_id integer not null references accounts(id),
+    operation_timestamp timestamp not null
+);
+
+create index if not exists payments_tenant_id_idx on payments(tenant_id, operation_timestamp);
+
+-- same currencies the initial postgres migration creates for the default tenant
+insert or ignore into currencies(id, tenant_id, name)
+    values(1, 1, 'USD'),
+          (2, 1, 'RUB'),
+          (3, 1, 'BTC'),
+          (4, 1, 'ETC');
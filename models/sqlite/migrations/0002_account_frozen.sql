@@ -0,0 +1,2 @@
+-- frozen account can neither pay nor be paid
+alter table accounts add column frozen integer not null default 0;
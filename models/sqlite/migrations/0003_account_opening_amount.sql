@@ -0,0 +1,2 @@
+-- balance the account was created with, null for accounts created before it was recorded
+alter table accounts add column opening_amount text;
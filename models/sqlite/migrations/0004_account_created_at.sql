@@ -0,0 +1,2 @@
+-- creation time in UTC, it is unknown for accounts created before it was recorded
+alter table accounts add column created_at timestamp;
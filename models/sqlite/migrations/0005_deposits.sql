@@ -0,0 +1,10 @@
+-- money coming into accounts from outside the service
+create table deposits (
+    id integer primary key autoincrement,
+    tenant_id integer not null,
+    account_id integer not null references accounts(id),
+    amount text not null,
+    operation_timestamp timestamp not null
+);
+
+create index deposits_account_id_idx on deposits(tenant_id, account_id, operation_timestamp);
@@ -0,0 +1,783 @@
+// Package sqlite implements models.Repository on top of an embedded SQLite database file.
+// It is meant for single-node deployments and developer laptops without postgres.
+//
+// SQLite has no row locks (and no FOR UPDATE SKIP LOCKED), so every write transaction
+// takes the database write lock when it begins (BEGIN IMMEDIATE). Writers are serialized
+// and wait for each other up to busyTimeout, after that payment fails with models.ErrLockFailed.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/c-pro/wallet-test/models"
+	"github.com/mattn/go-sqlite3"
+	"github.com/shopspring/decimal"
+)
+
+// busyTimeout is how long a transaction waits for the write lock held by another one
+const busyTimeout = time.Second * 5
+
+// maxOpenConns limits number of connections. Readers do not block each other
+// in WAL mode, but there is no point in many connections waiting for the write lock.
+const maxOpenConns = 4
+
+// Open opens SQLite database file creating it if needed and migrates its schema to the latest version
+func Open(path string) (*sql.DB, error) {
+	dsn := fmt.Sprintf("file:%s?_txlock=immediate&_busy_timeout=%d&_journal_mode=WAL&_foreign_keys=on",
+		path, busyTimeout.Milliseconds())
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(maxOpenConns)
+	if err := migrate(db); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Repository is a models.Repository stored in SQLite database.
+// Tenants and owners are not stored, so their IDs are not checked,
+// but data of different tenants is isolated.
+type Repository struct {
+	db *sql.DB
+}
+
+var _ models.Repository = (*Repository)(nil)
+
+// NewRepository returns repository using database opened with Open
+func NewRepository(db *sql.DB) *Repository {
+	return &Repository{db}
+}
+
+// isConstraint tells if err is a violation of given SQLite constraint kind
+func isConstraint(err error, code sqlite3.ErrNoExtended) bool {
+	sqliteErr, ok := err.(sqlite3.Error)
+	return ok && sqliteErr.ExtendedCode == code
+}
+
+// isBusy tells if err is caused by the write lock held by another transaction for too long
+func isBusy(err error) bool {
+	sqliteErr, ok := err.(sqlite3.Error)
+	return ok && (sqliteErr.Code == sqlite3.ErrBusy || sqliteErr.Code == sqlite3.ErrLocked)
+}
+
+// accountColumns is a list of columns scanAccount expects to be selected
+const accountColumns = `a.id,
+					 a.tenant_id,
+					 a.currency_id,
+					 c.name,
+					 a.amount,
+					 a.name,
+					 coalesce(a.external_id, ''),
+					 a.metadata,
+					 coalesce(a.owner_id, 0),
+					 a.frozen`
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanAccount reads accountColumns from a row into account
+func scanAccount(row rowScanner, account *models.Account) error {
+	var metadata string
+	err := row.Scan(&account.ID,
+		&account.TenantID,
+		&account.CurrencyID,
+		&account.CurrencyName,
+		&account.Amount,
+		&account.Name,
+		&account.ExternalID,
+		&metadata,
+		&account.OwnerID,
+		&account.Frozen,
+	)
+	if err != nil {
+		return err
+	}
+	account.Metadata = []byte(metadata)
+	return nil
+}
+
+// querier is satisfied by both *sql.DB and *sql.Tx
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// getAccount returns tenant's account with given ID
+func getAccount(ctx context.Context, q querier, tenantID, id int64) (models.Account, error) {
+	account := models.Account{}
+	query := `select ` + accountColumns + `
+				from accounts a
+				join currencies c on (a.currency_id = c.id)
+				where a.id = ?
+				  and a.tenant_id = ?`
+	err := scanAccount(q.QueryRowContext(ctx, query, id, tenantID), &account)
+	return account, err
+}
+
+// GetCurrencies returns all tenant's currencies
+func (r *Repository) GetCurrencies(ctx context.Context, tenantID int64) ([]models.Currency, error) {
+	currencies := []models.Currency{}
+	query := `select id, tenant_id, name
+				from currencies
+				where tenant_id = ?
+				order by id`
+	rows, err := r.db.QueryContext(ctx, query, tenantID)
+	if err != nil {
+		return currencies, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		currency := models.Currency{}
+		if err := rows.Scan(&currency.ID, &currency.TenantID, &currency.Name); err != nil {
+			return currencies, err
+		}
+		currencies = append(currencies, currency)
+	}
+	return currencies, rows.Err()
+}
+
+// CreateCurrency creates a new currency in currency.TenantID tenant
+func (r *Repository) CreateCurrency(ctx context.Context, currency *models.Currency) error {
+	query := `insert into currencies(tenant_id, name)
+			  values(?, ?)`
+	res, err := r.db.ExecContext(ctx, query, currency.TenantID, currency.Name)
+	if err != nil {
+		if isConstraint(err, sqlite3.ErrConstraintUnique) {
+			err = models.ErrDuplicateCurrency
+		}
+		return err
+	}
+	currency.ID, err = res.LastInsertId()
+	return err
+}
+
+// GetAccounts returns all tenant's accounts
+func (r *Repository) GetAccounts(ctx context.Context, tenantID int64) ([]models.Account, error) {
+	accounts := []models.Account{}
+	query := `select ` + accountColumns + `
+				from accounts a
+				join currencies c on (a.currency_id = c.id)
+				where a.tenant_id = ?
+				order by a.id`
+	rows, err := r.db.QueryContext(ctx, query, tenantID)
+	if err != nil {
+		return accounts, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		account := models.Account{}
+		if err := scanAccount(rows, &account); err != nil {
+			return accounts, err
+		}
+		accounts = append(accounts, account)
+	}
+	return accounts, rows.Err()
+}
+
+// GetAccount returns tenant's account with given ID
+func (r *Repository) GetAccount(ctx context.Context, tenantID, id int64) (models.Account, error) {
+	return getAccount(ctx, r.db, tenantID, id)
+}
+
+// GetAccountByExternalID returns tenant's account with given external ID
+func (r *Repository) GetAccountByExternalID(ctx context.Context, tenantID int64, externalID string) (models.Account, error) {
+	account := models.Account{}
+	query := `select ` + accountColumns + `
+				from accounts a
+				join currencies c on (a.currency_id = c.id)
+				where a.external_id = ?
+				  and a.tenant_id = ?`
+	err := scanAccount(r.db.QueryRowContext(ctx, query, externalID, tenantID), &account)
+	return account, err
+}
+
+// GetOwnerAccountID returns ID of tenant's owner primary (oldest) account in given currency
+func (r *Repository) GetOwnerAccountID(ctx context.Context, tenantID, ownerID, currencyID int64) (int64, error) {
+	query := `select min(id)
+				from accounts
+				where owner_id = ?
+				  and currency_id = ?
+				  and tenant_id = ?`
+	var nullID sql.NullInt64
+	if err := r.db.QueryRowContext(ctx, query, ownerID, currencyID, tenantID).Scan(&nullID); err != nil {
+		return 0, err
+	}
+	if !nullID.Valid {
+		return 0, models.ErrOwnerAccountNotFound
+	}
+	return nullID.Int64, nil
+}
+
+// CreateAccount creates a new account in account.TenantID tenant
+func (r *Repository) CreateAccount(ctx context.Context, account *models.Account) error {
+	if account.Amount.Sign() < 0 {
+		return models.ErrNegativeBalance
+	}
+	metadata := "{}"
+	if len(account.Metadata) != 0 {
+		metadata = string(account.Metadata)
+	}
+	// currency is checked in the same statement, as foreign key does not know about tenants
+	query := `insert into accounts(tenant_id, currency_id, amount, opening_amount, name, external_id, metadata, owner_id, created_at)
+			  select c.tenant_id, c.id, ?, ?, ?, nullif(?, ''), ?, nullif(?, 0), ?
+			    from currencies c
+			   where c.id = ?
+			     and c.tenant_id = ?`
+	res, err := r.db.ExecContext(ctx, query,
+		account.Amount,
+		account.Amount,
+		account.Name,
+		account.ExternalID,
+		metadata,
+		account.OwnerID,
+		time.Now().UTC(),
+		account.CurrencyID,
+		account.TenantID)
+	if err != nil {
+		if isConstraint(err, sqlite3.ErrConstraintUnique) {
+			err = models.ErrDuplicateExternalID
+		}
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = models.ErrCurrencyNotFound
+		}
+		return err
+	}
+	account.ID, err = res.LastInsertId()
+	return err
+}
+
+// SetAccountShards records number of balance shards of tenant's account.
+// Writers are serialized by SQLite anyway, so balance is not actually split,
+// but number of shards is validated the same way as in postgres.
+func (r *Repository) SetAccountShards(ctx context.Context, tenantID, id int64, shards int) error {
+	if shards < 1 || shards > models.MaxAccountShards {
+		return models.ErrInvalidShards
+	}
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	current := 0
+	query := `select shards from accounts where id = ? and tenant_id = ?`
+	if err := tx.QueryRowContext(ctx, query, id, tenantID).Scan(&current); err != nil {
+		return err
+	}
+	if shards < current {
+		return models.ErrInvalidShards
+	}
+	query = `update accounts set shards = ? where id = ?`
+	if _, err := tx.ExecContext(ctx, query, shards, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetAccountFrozen freezes or unfreezes tenant's account
+func (r *Repository) SetAccountFrozen(ctx context.Context, tenantID, id int64, frozen bool) error {
+	query := `update accounts set frozen = ? where id = ? and tenant_id = ?`
+	res, err := r.db.ExecContext(ctx, query, frozen, id, tenantID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil || n == 0 {
+		if err == nil {
+			err = sql.ErrNoRows
+		}
+		return err
+	}
+	return nil
+}
+
+// GetPayments returns all tenant's payments
+func (r *Repository) GetPayments(ctx context.Context, tenantID int64) ([]models.Payment, error) {
+	payments := []models.Payment{}
+	query := `select p.id,
+					 p.tenant_id,
+					 p.currency_id,
+					 c.name,
+					 p.amount,
+					 p.buyer_account_id,
+					 p.seller_account_id,
+					 p.operation_timestamp
+				from payments p
+				join currencies c on (p.currency_id = c.id)
+				where p.tenant_id = ?
+				order by p.operation_timestamp, p.id`
+	rows, err := r.db.QueryContext(ctx, query, tenantID)
+	if err != nil {
+		return payments, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		payment := models.Payment{}
+		err := rows.Scan(&payment.ID,
+			&payment.TenantID,
+			&payment.CurrencyID,
+			&payment.CurrencyName,
+			&payment.Amount,
+			&payment.BuyerAccountID,
+			&payment.SellerAccountID,
+			&payment.OperationTimestamp,
+		)
+		if err != nil {
+			return payments, err
+		}
+		payments = append(payments, payment)
+	}
+	return payments, rows.Err()
+}
+
+// Reconcile checks tenant's balances against deposits and payments in one read transaction.
+// Sums are computed by SQLite with decimal functions, only mismatches are read.
+func (r *Repository) Reconcile(ctx context.Context, tenantID int64) (models.Reconciliation, error) {
+	result := models.Reconciliation{
+		Currencies: []models.ReconcileTotals{},
+		Payments:   []models.PaymentMismatch{},
+		Accounts:   []models.BalanceMismatch{},
+	}
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return result, err
+	}
+	defer tx.Rollback()
+
+	query := `with balances as (
+				select a.currency_id,
+					   count(*) as accounts,
+					   sum(a.opening_amount is null) as unverifiable,
+					   decimal_sum(coalesce(a.opening_amount, '0')) as opening,
+					   decimal_sum(a.amount) as balance
+				  from accounts a
+				 where a.tenant_id = ?1
+				 group by a.currency_id
+			  ), volumes as (
+				select p.currency_id,
+					   count(*) as payments,
+					   decimal_sum(p.amount) as volume
+				  from payments p
+				 where p.tenant_id = ?1
+				 group by p.currency_id
+			  ), deposited as (
+				select a.currency_id,
+					   count(*) as deposits,
+					   decimal_sum(d.amount) as amount
+				  from deposits d
+				  join accounts a on (a.id = d.account_id)
+				 where d.tenant_id = ?1
+				 group by a.currency_id
+			  )
+			  select c.id,
+					 c.name,
+					 coalesce(b.accounts, 0),
+					 coalesce(b.unverifiable, 0),
+					 coalesce(b.opening, '0'),
+					 coalesce(b.balance, '0'),
+					 coalesce(v.payments, 0),
+					 coalesce(v.volume, '0'),
+					 coalesce(d.deposits, 0),
+					 coalesce(d.amount, '0')
+				from currencies c
+				left join balances b on (b.currency_id = c.id)
+				left join volumes v on (v.currency_id = c.id)
+				left join deposited d on (d.currency_id = c.id)
+				where c.tenant_id = ?1
+				  and (b.currency_id is not null or v.currency_id is not null)
+				order by c.id`
+	rows, err := tx.QueryContext(ctx, query, tenantID)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		t := models.ReconcileTotals{}
+		err := rows.Scan(&t.CurrencyID,
+			&t.CurrencyName,
+			&t.Accounts,
+			&t.Unverifiable,
+			&t.Opening,
+			&t.Balance,
+			&t.Payments,
+			&t.Volume,
+			&t.Deposits,
+			&t.Deposited)
+		if err != nil {
+			return result, err
+		}
+		result.Currencies = append(result.Currencies, t)
+	}
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	query = `select p.id, a.id, c.name
+			   from payments p
+			   join accounts a on (a.id in (p.buyer_account_id, p.seller_account_id))
+			   join currencies c on (c.id = p.currency_id)
+			  where p.tenant_id = ?
+				and a.currency_id <> p.currency_id
+			  order by p.id, a.id`
+	rows, err = tx.QueryContext(ctx, query, tenantID)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		m := models.PaymentMismatch{}
+		if err := rows.Scan(&m.PaymentID, &m.AccountID, &m.CurrencyName); err != nil {
+			return result, err
+		}
+		result.Payments = append(result.Payments, m)
+	}
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	query = `with deposited as (
+				select d.account_id, decimal_sum(d.amount) as amount
+				  from deposits d
+				 where d.tenant_id = ?1
+				 group by d.account_id
+			  ), paid as (
+				select p.buyer_account_id as account_id, decimal_sum(p.amount) as amount
+				  from payments p
+				 where p.tenant_id = ?1
+				 group by p.buyer_account_id
+			  ), received as (
+				select p.seller_account_id as account_id, decimal_sum(p.amount) as amount
+				  from payments p
+				 where p.tenant_id = ?1
+				 group by p.seller_account_id
+			  ), checked as (
+				select a.id,
+					   a.amount as balance,
+					   a.opening_amount as opening,
+					   coalesce(d.amount, '0') as deposited,
+					   coalesce(r.amount, '0') as received,
+					   coalesce(pd.amount, '0') as paid
+				  from accounts a
+				  left join deposited d on (d.account_id = a.id)
+				  left join paid pd on (pd.account_id = a.id)
+				  left join received r on (r.account_id = a.id)
+				 where a.tenant_id = ?1
+				   and a.opening_amount is not null
+			  )
+			  select id, balance, opening, deposited, received, paid
+				from checked
+				where decimal_cmp(decimal_sub(decimal_add(decimal_add(opening, deposited), received), paid), balance) <> 0
+				order by id`
+	rows, err = tx.QueryContext(ctx, query, tenantID)
+	if err != nil {
+		return result, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		m := models.BalanceMismatch{}
+		if err := rows.Scan(&m.AccountID, &m.Balance, &m.Opening, &m.Deposited, &m.Received, &m.Paid); err != nil {
+			return result, err
+		}
+		result.Accounts = append(result.Accounts, m)
+	}
+	return result, rows.Err()
+}
+
+// GetCurrencyTotals returns totals of tenant's currencies ordered by ID
+// with deposits and payments made from from (inclusive) to to (exclusive) and balances at to
+// in one read transaction. Sums are computed by SQLite with decimal functions.
+// Times are stored in UTC, so they are compared as text.
+func (r *Repository) GetCurrencyTotals(ctx context.Context, tenantID int64, from, to time.Time) ([]models.CurrencyTotals, error) {
+	totals := []models.CurrencyTotals{}
+	tx, err := r.db.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return totals, err
+	}
+	defer tx.Rollback()
+
+	// balance at to is the current one minus deposited and received since then plus paid since then
+	query := `with existing as (
+				select a.id, a.currency_id, a.amount
+				  from accounts a
+				 where a.tenant_id = ?1
+				   and (a.created_at is null or a.created_at < ?3)
+			  ), paid as (
+				select p.buyer_account_id as account_id, decimal_sum(p.amount) as amount
+				  from payments p
+				 where p.tenant_id = ?1
+				   and p.operation_timestamp >= ?3
+				 group by p.buyer_account_id
+			  ), received as (
+				select p.seller_account_id as account_id, decimal_sum(p.amount) as amount
+				  from payments p
+				 where p.tenant_id = ?1
+				   and p.operation_timestamp >= ?3
+				 group by p.seller_account_id
+			  ), deposited as (
+				select d.account_id, decimal_sum(d.amount) as amount
+				  from deposits d
+				 where d.tenant_id = ?1
+				   and d.operation_timestamp >= ?3
+				 group by d.account_id
+			  ), balances as (
+				select e.currency_id,
+					   count(*) as accounts,
+					   decimal_sum(decimal_sub(decimal_sub(decimal_add(e.amount, coalesce(pd.amount, '0')),
+						   coalesce(r.amount, '0')), coalesce(d.amount, '0'))) as balance
+				  from existing e
+				  left join paid pd on (pd.account_id = e.id)
+				  left join received r on (r.account_id = e.id)
+				  left join deposited d on (d.account_id = e.id)
+				 group by e.currency_id
+			  ), period as (
+				select p.currency_id,
+					   count(*) as payments,
+					   decimal_sum(p.amount) as volume
+				  from payments p
+				 where p.tenant_id = ?1
+				   and p.operation_timestamp >= ?2
+				   and p.operation_timestamp < ?3
+				 group by p.currency_id
+			  ), active as (
+				select currency_id,
+					   count(distinct account_id) as accounts
+				  from (select p.currency_id, p.buyer_account_id as account_id
+						  from payments p
+						 where p.tenant_id = ?1
+						   and p.operation_timestamp >= ?2
+						   and p.operation_timestamp < ?3
+						 union all
+						select p.currency_id, p.seller_account_id
+						  from payments p
+						 where p.tenant_id = ?1
+						   and p.operation_timestamp >= ?2
+						   and p.operation_timestamp < ?3)
+				 group by currency_id
+			  ), period_deposits as (
+				select a.currency_id,
+					   count(*) as deposits,
+					   decimal_sum(d.amount) as amount
+				  from deposits d
+				  join accounts a on (a.id = d.account_id)
+				 where d.tenant_id = ?1
+				   and d.operation_timestamp >= ?2
+				   and d.operation_timestamp < ?3
+				 group by a.currency_id
+			  )
+			  select c.id,
+					 c.name,
+					 coalesce(b.accounts, 0),
+					 coalesce(act.accounts, 0),
+					 coalesce(b.balance, '0'),
+					 coalesce(pp.payments, 0),
+					 coalesce(pp.volume, '0'),
+					 coalesce(pd.deposits, 0),
+					 coalesce(pd.amount, '0')
+				from currencies c
+				left join balances b on (b.currency_id = c.id)
+				left join period pp on (pp.currency_id = c.id)
+				left join active act on (act.currency_id = c.id)
+				left join period_deposits pd on (pd.currency_id = c.id)
+				where c.tenant_id = ?1
+				order by c.id`
+	rows, err := tx.QueryContext(ctx, query, tenantID, from.UTC(), to.UTC())
+	if err != nil {
+		return totals, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		t := models.CurrencyTotals{}
+		err := rows.Scan(&t.CurrencyID,
+			&t.CurrencyName,
+			&t.Accounts,
+			&t.ActiveAccounts,
+			&t.Balance,
+			&t.Payments,
+			&t.Volume,
+			&t.Deposits,
+			&t.Deposited)
+		if err != nil {
+			return totals, err
+		}
+		totals = append(totals, t)
+	}
+	return totals, rows.Err()
+}
+
+// MakePayment makes atomic payment operation for given amount between seller and buyer accounts.
+// Transaction holds the database write lock from the start, so balances read
+// in it can not be changed by concurrent payments.
+// Checks are made in the same order as in models.MakePayment, so both report the same errors.
+func (r *Repository) MakePayment(ctx context.Context,
+	tenantID,
+	buyerAccountID,
+	sellerAccountID int64,
+	amount decimal.Decimal) (models.Payment, error) {
+
+	payment, err := r.makePayment(ctx, tenantID, buyerAccountID, sellerAccountID, amount)
+	if isBusy(err) {
+		err = models.ErrLockFailed
+	}
+	return payment, err
+}
+
+func (r *Repository) makePayment(ctx context.Context,
+	tenantID,
+	buyerAccountID,
+	sellerAccountID int64,
+	amount decimal.Decimal) (models.Payment, error) {
+
+	payment := models.Payment{}
+
+	// could not pay to self
+	if buyerAccountID == sellerAccountID {
+		return payment, models.ErrNoPaymentToSelf
+	}
+
+	// amount should be greater then zero
+	if amount.Cmp(decimal.Zero) <= 0 {
+		return payment, models.ErrNonPositiveAmount
+	}
+
+	// BEGIN IMMEDIATE acquires the write lock
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return payment, err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+
+	buyer, err := getAccount(ctx, tx, tenantID, buyerAccountID)
+	if err != nil {
+		return payment, err
+	}
+
+	seller, err := getAccount(ctx, tx, tenantID, sellerAccountID)
+	if err != nil {
+		return payment, err
+	}
+
+	// frozen accounts can neither pay nor be paid
+	if buyer.Frozen || seller.Frozen {
+		return payment, models.ErrAccountFrozen
+	}
+
+	// buyer account should have enough money
+	if buyer.Amount.Cmp(amount) < 0 {
+		return payment, models.ErrInsufficientAmount
+	}
+
+	// buyer and seller currencies should match
+	if buyer.CurrencyID != seller.CurrencyID {
+		return payment, models.ErrCurrencyMismatch
+	}
+
+	query := `update accounts set amount = ? where id = ?`
+	if _, err := tx.ExecContext(ctx, query, buyer.Amount.Sub(amount), buyer.ID); err != nil {
+		return payment, err
+	}
+	if _, err := tx.ExecContext(ctx, query, seller.Amount.Add(amount), seller.ID); err != nil {
+		return payment, err
+	}
+
+	payment.TenantID = tenantID
+	payment.CurrencyID = buyer.CurrencyID
+	payment.BuyerAccountID = buyerAccountID
+	payment.SellerAccountID = sellerAccountID
+	payment.Amount = amount
+	payment.OperationTimestamp = time.Now().UTC()
+
+	query = `insert into payments(tenant_id,
+								  currency_id,
+								  amount,
+								  buyer_account_id,
+								  seller_account_id,
+								  operation_timestamp)
+			 values(?, ?, ?, ?, ?, ?)`
+	res, err := tx.ExecContext(ctx, query,
+		payment.TenantID,
+		payment.CurrencyID,
+		payment.Amount,
+		payment.BuyerAccountID,
+		payment.SellerAccountID,
+		payment.OperationTimestamp)
+	if err != nil {
+		return payment, err
+	}
+	if payment.ID, err = res.LastInsertId(); err != nil {
+		return payment, err
+	}
+
+	return payment, tx.Commit()
+}
+
+// MakeDeposit adds amount coming from outside the service to tenant's account.
+// Checks are made in the same order as in models.MakeDeposit, so both report the same errors.
+func (r *Repository) MakeDeposit(ctx context.Context, tenantID, accountID int64, amount decimal.Decimal) (models.Deposit, error) {
+	deposit, err := r.makeDeposit(ctx, tenantID, accountID, amount)
+	if isBusy(err) {
+		err = models.ErrLockFailed
+	}
+	return deposit, err
+}
+
+func (r *Repository) makeDeposit(ctx context.Context, tenantID, accountID int64, amount decimal.Decimal) (models.Deposit, error) {
+	deposit := models.Deposit{}
+
+	// amount should be greater then zero
+	if amount.Cmp(decimal.Zero) <= 0 {
+		return deposit, models.ErrNonPositiveAmount
+	}
+
+	// BEGIN IMMEDIATE acquires the write lock
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return deposit, err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+
+	account, err := getAccount(ctx, tx, tenantID, accountID)
+	if err != nil {
+		return deposit, err
+	}
+
+	// frozen accounts can neither pay nor be paid
+	if account.Frozen {
+		return deposit, models.ErrAccountFrozen
+	}
+
+	query := `update accounts set amount = ? where id = ?`
+	if _, err := tx.ExecContext(ctx, query, account.Amount.Add(amount), account.ID); err != nil {
+		return deposit, err
+	}
+
+	deposit.TenantID = tenantID
+	deposit.AccountID = accountID
+	deposit.CurrencyID = account.CurrencyID
+	deposit.Amount = amount
+	deposit.OperationTimestamp = time.Now().UTC()
+
+	query = `insert into deposits(tenant_id, account_id, amount, operation_timestamp)
+			 values(?, ?, ?, ?)`
+	res, err := tx.ExecContext(ctx, query,
+		deposit.TenantID,
+		deposit.AccountID,
+		deposit.Amount,
+		deposit.OperationTimestamp)
+	if err != nil {
+		return deposit, err
+	}
+	if deposit.ID, err = res.LastInsertId(); err != nil {
+		return deposit, err
+	}
+
+	return deposit, tx.Commit()
+}
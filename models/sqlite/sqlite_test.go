@@ -0,0 +1,222 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/c-pro/wallet-test/models"
+	"github.com/c-pro/wallet-test/models/repotest"
+	"github.com/shopspring/decimal"
+)
+
+func TestRepository(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "wallet.db"))
+	if err != nil {
+		t.Fatalf("Unexpected error in Open: %v", err)
+	}
+	defer db.Close()
+	repotest.Run(t, func(t *testing.T) models.Repository {
+		return NewRepository(db)
+	})
+}
+
+func TestOpenTwice(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wallet.db")
+	for i := 0; i < 2; i++ {
+		db, err := Open(path)
+		if err != nil {
+			t.Fatalf("Unexpected error in Open: %v", err)
+		}
+		db.Close()
+	}
+}
+
+func TestOpenRecordsSchemaVersion(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "wallet.db"))
+	if err != nil {
+		t.Fatalf("Unexpected error in Open: %v", err)
+	}
+	defer db.Close()
+	version, err := SchemaVersion(context.Background(), db)
+	if err != nil {
+		t.Fatalf("Unexpected error in SchemaVersion: %v", err)
+	}
+	if version != LatestSchemaVersion() {
+		t.Errorf("Expected schema version %d, got %d", LatestSchemaVersion(), version)
+	}
+}
+
+func TestOpenNewerSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wallet.db")
+	db, err := Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error in Open: %v", err)
+	}
+	_, err = db.Exec(fmt.Sprintf(`pragma user_version = %d`, LatestSchemaVersion()+1))
+	db.Close()
+	if err != nil {
+		t.Fatalf("Failed to set schema version: %v", err)
+	}
+	if _, err := Open(path); err != models.ErrSchemaAhead {
+		t.Errorf("Expected ErrSchemaAhead, got %v", err)
+	}
+}
+
+func TestOpenOldSchema(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wallet.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Unexpected error in sql.Open: %v", err)
+	}
+	// accounts table as created before frozen column was added
+	_, err = db.Exec(`create table accounts (
+						  id integer primary key autoincrement,
+						  tenant_id integer not null,
+						  currency_id integer not null,
+						  owner_id integer,
+						  name text not null default '',
+						  external_id text,
+						  metadata text not null default '{}',
+						  amount text not null,
+						  shards integer not null default 0,
+						  constraint accounts_external_id_key unique (tenant_id, external_id)
+					  )`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("Failed to create old schema: %v", err)
+	}
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error in Open: %v", err)
+	}
+	defer db.Close()
+	if version, err := SchemaVersion(context.Background(), db); err != nil || version != LatestSchemaVersion() {
+		t.Fatalf("Expected schema version %d, got %d (%v)", LatestSchemaVersion(), version, err)
+	}
+	repotest.Run(t, func(t *testing.T) models.Repository {
+		return NewRepository(db)
+	})
+}
+
+func TestReconcileLegacyAccounts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "wallet.db")
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		t.Fatalf("Unexpected error in sql.Open: %v", err)
+	}
+	// accounts and payments of a file created before opening amounts were recorded
+	_, err = db.Exec(`create table accounts (
+						  id integer primary key autoincrement,
+						  tenant_id integer not null,
+						  currency_id integer not null,
+						  owner_id integer,
+						  name text not null default '',
+						  external_id text,
+						  metadata text not null default '{}',
+						  amount text not null,
+						  shards integer not null default 0,
+						  frozen integer not null default 0,
+						  constraint accounts_external_id_key unique (tenant_id, external_id)
+					  );
+					  create table payments (
+						  id integer primary key autoincrement,
+						  tenant_id integer not null,
+						  currency_id integer not null,
+						  amount text not null,
+						  buyer_account_id integer not null,
+						  seller_account_id integer not null,
+						  operation_timestamp timestamp not null
+					  );
+					  insert into accounts(tenant_id, currency_id, amount) values(1, 1, '7.5'), (1, 1, '2.5'), (1, 1, '1');
+					  insert into payments(tenant_id, currency_id, amount, buyer_account_id, seller_account_id, operation_timestamp)
+						  values(1, 1, '2.5', 1, 2, '2020-01-01 00:00:00'),
+								(1, 1, '0.5', 2, 1, '2020-01-01 00:00:01')`)
+	db.Close()
+	if err != nil {
+		t.Fatalf("Failed to create old schema: %v", err)
+	}
+
+	db, err = Open(path)
+	if err != nil {
+		t.Fatalf("Unexpected error in Open: %v", err)
+	}
+	defer db.Close()
+	r := NewRepository(db)
+	ctx := context.Background()
+	account := models.Account{TenantID: models.DefaultTenantID, CurrencyID: 1, Amount: decimal.RequireFromString("0.1")}
+	if err := r.CreateAccount(ctx, &account); err != nil {
+		t.Fatalf("Unexpected error in CreateAccount: %v", err)
+	}
+	if _, err := db.Exec(`update accounts set amount = '0.100000000000001' where id = ?`, account.ID); err != nil {
+		t.Fatalf("Failed to edit balance: %v", err)
+	}
+
+	result, err := r.Reconcile(ctx, models.DefaultTenantID)
+	if err != nil {
+		t.Fatalf("Unexpected error in Reconcile: %v", err)
+	}
+	// opening amounts of old accounts are unknown, so only the new one is checked
+	if len(result.Currencies) != 1 || result.Currencies[0].Accounts != 4 || result.Currencies[0].Unverifiable != 3 ||
+		result.Currencies[0].Opening.String() != "0.1" || result.Currencies[0].Volume.String() != "3" {
+		t.Errorf("Unexpected totals %+v", result.Currencies)
+	}
+	if len(result.Accounts) != 1 || result.Accounts[0].AccountID != account.ID || result.Accounts[0].Expected().String() != "0.1" {
+		t.Errorf("Expected balance mismatch of account %d, got %+v", account.ID, result.Accounts)
+	}
+}
+
+func TestGetCurrencyTotalsYesterday(t *testing.T) {
+	db, err := Open(filepath.Join(t.TempDir(), "wallet.db"))
+	if err != nil {
+		t.Fatalf("Unexpected error in Open: %v", err)
+	}
+	defer db.Close()
+	r := NewRepository(db)
+	ctx := context.Background()
+	accounts := []models.Account{}
+	for _, amount := range []string{"10", "0", "3"} {
+		a := models.Account{TenantID: models.DefaultTenantID, CurrencyID: 1, Amount: decimal.RequireFromString(amount)}
+		if err := r.CreateAccount(ctx, &a); err != nil {
+			t.Fatalf("Unexpected error in CreateAccount: %v", err)
+		}
+		accounts = append(accounts, a)
+	}
+	// the first two accounts were opened two days ago, the last one today
+	_, err = db.Exec(`update accounts set created_at = ? where id in (?, ?)`,
+		time.Now().UTC().AddDate(0, 0, -2), accounts[0].ID, accounts[1].ID)
+	if err != nil {
+		t.Fatalf("Failed to backdate accounts: %v", err)
+	}
+	// today the first account paid 4 to the second and 1 to the new one
+	for _, p := range []struct {
+		seller int64
+		amount int64
+	}{{accounts[1].ID, 4}, {accounts[2].ID, 1}} {
+		if _, err := r.MakePayment(ctx, models.DefaultTenantID, accounts[0].ID, p.seller, decimal.New(p.amount, 0)); err != nil {
+			t.Fatalf("Unexpected error in MakePayment: %v", err)
+		}
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	totals, err := r.GetCurrencyTotals(ctx, models.DefaultTenantID, today.AddDate(0, 0, -1), today)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetCurrencyTotals: %v", err)
+	}
+	if len(totals) == 0 || totals[0].Accounts != 2 || totals[0].Payments != 0 || totals[0].Balance.String() != "10" {
+		t.Errorf("Expected yesterday's balance 10 of 2 accounts and no payments, got %+v", totals)
+	}
+
+	totals, err = r.GetCurrencyTotals(ctx, models.DefaultTenantID, today, today.AddDate(0, 0, 1))
+	if err != nil {
+		t.Fatalf("Unexpected error in GetCurrencyTotals: %v", err)
+	}
+	if len(totals) == 0 || totals[0].Accounts != 3 || totals[0].ActiveAccounts != 3 || totals[0].Payments != 2 ||
+		totals[0].Balance.String() != "13" || totals[0].Volume.String() != "5" {
+		t.Errorf("Expected today's balance 13 of 3 accounts and 2 payments, got %+v", totals)
+	}
+}
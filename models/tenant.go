@@ -0,0 +1,135 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"github.com/lib/pq"
+)
+
+// DefaultTenantID is the tenant created by the initial schema
+const DefaultTenantID = 1
+
+// Constant errors
+var (
+	ErrTenantNotFound    = errors.New("Tenant not found")
+	ErrDuplicateTenant   = errors.New("Tenant with this name already exists")
+	ErrDuplicateCurrency = errors.New("Currency with this name already exists")
+)
+
+// Tenant is a brand running its own isolated set of currencies, owners, accounts and payments
+type Tenant struct {
+	ID   int64
+	Name string
+}
+
+// Currency is a currency accounts of a tenant can hold
+type Currency struct {
+	ID       int64
+	TenantID int64 `json:"-"`
+	Name     string
+}
+
+// GetTenants returns all tenants from the database
+func GetTenants(ctx context.Context, tx *sql.Tx) ([]Tenant, error) {
+	tenants := []Tenant{}
+	query := `select id, name
+				from tenants
+				order by id`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	rows, err := tx.QueryContext(ctx, query)
+	if err != nil {
+		return tenants, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		tenant := Tenant{}
+		if err := rows.Scan(&tenant.ID, &tenant.Name); err != nil {
+			// If it was a context timeout, return context error
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return tenants, err
+		}
+		tenants = append(tenants, tenant)
+	}
+	return tenants, nil
+}
+
+// Save inserts Tenant record in the database.
+// Tenants can not be renamed, so only new records are saved.
+func (t *Tenant) Save(ctx context.Context, tx *sql.Tx) error {
+	query := `insert into tenants(name)
+			  values($1)
+			  returning id`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	err := tx.QueryRowContext(ctx, query, t.Name).Scan(&t.ID)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if pqErr, ok := err.(*pq.Error); ok && pqErr.Code == uniqueViolation {
+			err = ErrDuplicateTenant
+		}
+		return err
+	}
+	return nil
+}
+
+// GetCurrencies returns all tenant's currencies from the database
+func GetCurrencies(ctx context.Context, tx *sql.Tx, tenantID int64) ([]Currency, error) {
+	currencies := []Currency{}
+	query := `select id, tenant_id, name
+				from currencies
+				where tenant_id = $1
+				order by id`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	rows, err := tx.QueryContext(ctx, query, tenantID)
+	if err != nil {
+		return currencies, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		currency := Currency{}
+		if err := rows.Scan(&currency.ID, &currency.TenantID, &currency.Name); err != nil {
+			// If it was a context timeout, return context error
+			if ctx.Err() != nil {
+				err = ctx.Err()
+			}
+			return currencies, err
+		}
+		currencies = append(currencies, currency)
+	}
+	return currencies, nil
+}
+
+// Save inserts Currency record in the Currency.TenantID tenant
+func (c *Currency) Save(ctx context.Context, tx *sql.Tx) error {
+	query := `insert into currencies(tenant_id, name)
+			  values($1, $2)
+			  returning id`
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout)
+	defer cancel()
+	err := tx.QueryRowContext(ctx, query, c.TenantID, c.Name).Scan(&c.ID)
+	if err != nil {
+		// If it was a context timeout, return context error
+		if ctx.Err() != nil {
+			err = ctx.Err()
+		}
+		if pqErr, ok := err.(*pq.Error); ok {
+			switch pqErr.Code {
+			case uniqueViolation:
+				err = ErrDuplicateCurrency
+			case foreignKeyViolation:
+				err = ErrTenantNotFound
+			}
+		}
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestSaveTenant(t *testing.T) {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+
+	tenant := Tenant{Name: randomName()}
+	if err := tenant.Save(context.Background(), tx); err != nil {
+		t.Fatalf("Unexpected error in Tenant.Save: %v", err)
+	}
+	if tenant.ID == 0 {
+		t.Fatal("Tenant ID should not be zero")
+	}
+
+	// currency names are unique only within a tenant
+	c := Currency{TenantID: tenant.ID, Name: "USD"}
+	if err := c.Save(context.Background(), tx); err != nil {
+		t.Fatalf("Unexpected error in Currency.Save: %v", err)
+	}
+
+	currencies, err := GetCurrencies(context.Background(), tx, tenant.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetCurrencies: %v", err)
+	}
+	if len(currencies) != 1 || currencies[0].ID != c.ID {
+		t.Errorf("Expected to get only currency %d, got %v", c.ID, currencies)
+	}
+
+	tenants, err := GetTenants(context.Background(), tx)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetTenants: %v", err)
+	}
+	if len(tenants) < 2 {
+		t.Errorf("Expected at least 2 tenants, got %d", len(tenants))
+	}
+}
+
+func TestSaveTenantDuplicates(t *testing.T) {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+
+	dup := Currency{TenantID: DefaultTenantID, Name: "USD"}
+	if err := dup.Save(context.Background(), tx); err != ErrDuplicateCurrency {
+		t.Errorf("Expected Currency.Save to return ErrDuplicateCurrency, got %v", err)
+	}
+}
+
+func TestSaveCurrencyNoTenant(t *testing.T) {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+
+	c := Currency{TenantID: -1, Name: "USD"}
+	if err := c.Save(context.Background(), tx); err != ErrTenantNotFound {
+		t.Errorf("Expected Currency.Save to return ErrTenantNotFound, got %v", err)
+	}
+}
+
+func TestSaveAccountForeignCurrency(t *testing.T) {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+
+	tenant := Tenant{Name: randomName()}
+	if err := tenant.Save(context.Background(), tx); err != nil {
+		t.Fatalf("Unexpected error in Tenant.Save: %v", err)
+	}
+
+	// currency 1 belongs to the default tenant
+	a := Account{TenantID: tenant.ID, CurrencyID: 1, Amount: decimal.Zero, Name: randomName()}
+	if err := a.Save(context.Background(), tx); err != ErrCurrencyNotFound {
+		t.Errorf("Expected Account.Save to return ErrCurrencyNotFound, got %v", err)
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	tx, err := db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+
+	tenant := Tenant{Name: randomName()}
+	if err := tenant.Save(context.Background(), tx); err != nil {
+		t.Fatalf("Unexpected error in Tenant.Save: %v", err)
+	}
+	c := Currency{TenantID: tenant.ID, Name: "USD"}
+	if err := c.Save(context.Background(), tx); err != nil {
+		t.Fatalf("Unexpected error in Currency.Save: %v", err)
+	}
+	amount, _ := decimal.NewFromString("100")
+	other := Account{TenantID: tenant.ID, CurrencyID: c.ID, Amount: amount, Name: randomName()}
+	if err := other.Save(context.Background(), tx); err != nil {
+		t.Fatalf("Unexpected error in Account.Save: %v", err)
+	}
+	own := makeAccount(tx, 1, "100")
+	tx.Commit()
+
+	defer cleanDb(t)
+
+	// payment between tenants is impossible whichever tenant is used
+	if _, err := MakePayment(context.Background(), db, DefaultTenantID, own.ID, other.ID, amount); err != sql.ErrNoRows {
+		t.Errorf("Expected MakePayment to return sql.ErrNoRows, got %v", err)
+	}
+	if _, err := MakePayment(context.Background(), db, tenant.ID, other.ID, own.ID, amount); err != sql.ErrNoRows {
+		t.Errorf("Expected MakePayment to return sql.ErrNoRows, got %v", err)
+	}
+
+	tx, err = db.Begin()
+	if err != nil {
+		t.Fatalf("Unexpected error in db.Begin(): %v", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := GetAccount(context.Background(), tx, DefaultTenantID, other.ID); err != sql.ErrNoRows {
+		t.Errorf("Expected GetAccount to return sql.ErrNoRows, got %v", err)
+	}
+
+	// updating account through another tenant does not touch it
+	other.TenantID = DefaultTenantID
+	other.Amount = decimal.Zero
+	if err := other.Save(context.Background(), tx); err != sql.ErrNoRows {
+		t.Errorf("Expected Account.Save to return sql.ErrNoRows, got %v", err)
+	}
+
+	a, err := GetAccount(context.Background(), tx, tenant.ID, other.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetAccount: %v", err)
+	}
+	if !a.Amount.Equals(amount) {
+		t.Errorf("Expected amount to be %s, got %s", amount, a.Amount)
+	}
+}
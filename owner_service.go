@@ -0,0 +1,81 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/c-pro/wallet-test/models"
+)
+
+// OwnerService provides methods to access owners and their accounts
+type OwnerService interface {
+	GetOwners(ctx context.Context, tenantID int64) ([]models.Owner, error)
+	GetOwner(ctx context.Context, tenantID, id int64) (models.Owner, error)
+	CreateOwner(ctx context.Context, owner models.Owner) (models.Owner, error)
+	GetOwnerAccounts(ctx context.Context, tenantID, id int64) ([]models.Account, error)
+	GetOwnerHoldings(ctx context.Context, tenantID, id int64) ([]models.Holding, error)
+}
+
+// ownerService implements interface above
+type ownerService struct {
+	db *sql.DB
+}
+
+// GetOwners returns all tenant's owners in database
+func (o *ownerService) GetOwners(ctx context.Context, tenantID int64) ([]models.Owner, error) {
+	tx, err := o.db.BeginTx(ctx, nil)
+	if err != nil {
+		return []models.Owner{}, err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	return models.GetOwners(ctx, tx, tenantID)
+}
+
+// GetOwner returns a particular owner from the database
+func (o *ownerService) GetOwner(ctx context.Context, tenantID, id int64) (models.Owner, error) {
+	tx, err := o.db.BeginTx(ctx, nil)
+	if err != nil {
+		return models.Owner{}, err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	return models.GetOwner(ctx, tx, tenantID, id)
+}
+
+// CreateOwner creates a new owner in the database in owner.TenantID tenant
+func (o *ownerService) CreateOwner(ctx context.Context, owner models.Owner) (models.Owner, error) {
+	tx, err := o.db.BeginTx(ctx, nil)
+	if err != nil {
+		return owner, err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	if err := owner.Save(ctx, tx); err != nil {
+		return owner, err
+	}
+	return owner, models.Commit(ctx, tx, owner.TenantID, models.AuditObject("owner", owner.ID))
+}
+
+// GetOwnerAccounts returns all accounts of a particular owner
+func (o *ownerService) GetOwnerAccounts(ctx context.Context, tenantID, id int64) ([]models.Account, error) {
+	tx, err := o.db.BeginTx(ctx, nil)
+	if err != nil {
+		return []models.Account{}, err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	if _, err := models.GetOwner(ctx, tx, tenantID, id); err != nil {
+		return []models.Account{}, err
+	}
+	return models.GetOwnerAccounts(ctx, tx, tenantID, id)
+}
+
+// GetOwnerHoldings returns owner's total balances in each currency
+func (o *ownerService) GetOwnerHoldings(ctx context.Context, tenantID, id int64) ([]models.Holding, error) {
+	tx, err := o.db.BeginTx(ctx, nil)
+	if err != nil {
+		return []models.Holding{}, err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	if _, err := models.GetOwner(ctx, tx, tenantID, id); err != nil {
+		return []models.Holding{}, err
+	}
+	return models.GetOwnerHoldings(ctx, tx, tenantID, id)
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/c-pro/wallet-test/models"
+	"github.com/go-kit/kit/endpoint"
+)
+
+type getOwnersResponse struct {
+	Owners []models.Owner `json:"Owners,omitempty"`
+}
+
+type getOwnerRequest struct {
+	OwnerID int64
+}
+
+type getOwnerHoldingsResponse struct {
+	Holdings []models.Holding `json:"Holdings,omitempty"`
+}
+
+type createOwnerRequest struct {
+	Name string
+}
+
+func makeGetOwnersEndpoint(svc OwnerService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		owners, err := svc.GetOwners(ctx, tenantFromContext(ctx))
+		if err != nil {
+			return errorResponse{err.Error(), 500}, nil
+		}
+		return getOwnersResponse{owners}, nil
+	}
+}
+
+func makeGetOwnerEndpoint(svc OwnerService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getOwnerRequest)
+		owner, err := svc.GetOwner(ctx, tenantFromContext(ctx), req.OwnerID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return errorResponse{"Owner not found", 404}, nil
+			}
+			return errorResponse{err.Error(), 500}, nil
+		}
+		return owner, nil
+	}
+}
+
+func makeCreateOwnerEndpoint(svc OwnerService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(createOwnerRequest)
+		owner, err := svc.CreateOwner(ctx, models.Owner{TenantID: tenantFromContext(ctx), Name: req.Name})
+		if err != nil {
+			return errorResponse{err.Error(), 500}, nil
+		}
+		return owner, nil
+	}
+}
+
+func makeGetOwnerAccountsEndpoint(svc OwnerService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getOwnerRequest)
+		accounts, err := svc.GetOwnerAccounts(ctx, tenantFromContext(ctx), req.OwnerID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return errorResponse{"Owner not found", 404}, nil
+			}
+			return errorResponse{err.Error(), 500}, nil
+		}
+		return getAccountsResponse{accounts}, nil
+	}
+}
+
+func makeGetOwnerHoldingsEndpoint(svc OwnerService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getOwnerRequest)
+		holdings, err := svc.GetOwnerHoldings(ctx, tenantFromContext(ctx), req.OwnerID)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return errorResponse{"Owner not found", 404}, nil
+			}
+			return errorResponse{err.Error(), 500}, nil
+		}
+		return getOwnerHoldingsResponse{holdings}, nil
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"testing"
+
+	"github.com/c-pro/wallet-test/models"
+	"github.com/shopspring/decimal"
+)
+
+func postSomething(t *testing.T, route string, body string, dest interface{}) {
+	c := client
+	res, err := c.Post(URL(route),
+		"Application/json",
+		bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatalf("Unexpected error in Post request: %s", err)
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 200 {
+		t.Logf("body: %s", string(b))
+		t.Fatalf("Error code %d", res.StatusCode)
+	}
+	if err := json.Unmarshal(b, dest); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func addTestOwner(t *testing.T) models.Owner {
+	owner := models.Owner{}
+	postSomething(t, "/owners", fmt.Sprintf(`{"Name": "%s"}`, randomName()), &owner)
+	if owner.ID == 0 {
+		t.Fatal("Owner ID should not be zero")
+	}
+	return owner
+}
+
+func addTestOwnerAccount(t *testing.T, ownerID int64, amount decimal.Decimal) {
+	resp := struct{}{}
+	postSomething(t, "/accounts", fmt.Sprintf(`{
+		"Name": "%s",
+		"OwnerID": %d,
+		"Amount": "%s",
+		"CurrencyId": 3
+	}`, randomName(), ownerID, amount), &resp)
+}
+
+func TestGetOwners(t *testing.T) {
+	requireDB(t)
+	owner := addTestOwner(t)
+
+	ownersResp := getOwnersResponse{}
+	getSomething(t, "/owners", &ownersResp)
+	found := false
+	for _, o := range ownersResp.Owners {
+		if o.ID == owner.ID && o.Name == owner.Name {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Errorf("Owner %d was not found in GET /owners result", owner.ID)
+	}
+
+	ownerResp := models.Owner{}
+	getSomething(t, fmt.Sprintf("/owner/%d", owner.ID), &ownerResp)
+	if ownerResp.Name != owner.Name {
+		t.Errorf("Owner name does not match. Expected %s, got %s", owner.Name, ownerResp.Name)
+	}
+}
+
+func TestOwnerPayment(t *testing.T) {
+	requireDB(t)
+	buyer := addTestOwner(t)
+	seller := addTestOwner(t)
+	addTestOwnerAccount(t, buyer.ID, decimal.New(10, 0))
+	addTestOwnerAccount(t, buyer.ID, decimal.New(5, 0))
+	addTestOwnerAccount(t, seller.ID, decimal.Zero)
+
+	payment := models.Payment{}
+	postSomething(t, "/payments", fmt.Sprintf(`{
+		"BuyerOwnerID": %d,
+		"SellerOwnerID": %d,
+		"CurrencyID": 3,
+		"Amount": "7.5"}`, buyer.ID, seller.ID), &payment)
+
+	accountsResp := getAccountsResponse{}
+	getSomething(t, fmt.Sprintf("/owner/%d/accounts", buyer.ID), &accountsResp)
+	if len(accountsResp.Accounts) != 2 {
+		t.Fatalf("Expected buyer to have 2 accounts, got %d", len(accountsResp.Accounts))
+	}
+	if payment.BuyerAccountID != accountsResp.Accounts[0].ID {
+		t.Errorf("Expected payment from primary account %d, got %d",
+			accountsResp.Accounts[0].ID,
+			payment.BuyerAccountID)
+	}
+
+	holdingsResp := getOwnerHoldingsResponse{}
+	getSomething(t, fmt.Sprintf("/owner/%d/holdings", buyer.ID), &holdingsResp)
+	if len(holdingsResp.Holdings) != 1 {
+		t.Fatalf("Expected holdings in 1 currency, got %d", len(holdingsResp.Holdings))
+	}
+	expected, _ := decimal.NewFromString("7.5")
+	if !holdingsResp.Holdings[0].Amount.Equals(expected) {
+		t.Errorf("Expected buyer to hold %s, got %s", expected, holdingsResp.Holdings[0].Amount)
+	}
+
+	holdingsResp = getOwnerHoldingsResponse{}
+	getSomething(t, fmt.Sprintf("/owner/%d/holdings", seller.ID), &holdingsResp)
+	if len(holdingsResp.Holdings) != 1 || !holdingsResp.Holdings[0].Amount.Equals(expected) {
+		t.Errorf("Expected seller to hold %s, got %v", expected, holdingsResp.Holdings)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+const paymentUsage = `Usage:
+  wallet payment make [-tenant <tenant id>] <buyer account id> <seller account id> <amount>
+  wallet payment list [-tenant <tenant id>]`
+
+// runPaymentCommand makes and lists payments from the command line
+func runPaymentCommand(ctx context.Context, svc PaymentService, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%v\n%s", errUnknownCommand, paymentUsage)
+	}
+	switch args[0] {
+	case "make":
+		fs, tenantID := newTenantFlagSet("make", out)
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 3 {
+			return fmt.Errorf("buyer, seller and amount are required\n%s", paymentUsage)
+		}
+		buyerID, err := strconv.ParseInt(fs.Arg(0), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid buyer account ID %q", fs.Arg(0))
+		}
+		sellerID, err := strconv.ParseInt(fs.Arg(1), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid seller account ID %q", fs.Arg(1))
+		}
+		amount, err := decimal.NewFromString(fs.Arg(2))
+		if err != nil {
+			return fmt.Errorf("invalid amount %q", fs.Arg(2))
+		}
+		payment, err := svc.MakePayment(ctx, *tenantID, buyerID, sellerID, amount)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Made payment %d\n", payment.ID)
+		return nil
+	case "list":
+		tenantID, err := parseTenantArgs(args[1:], out)
+		if err != nil {
+			return err
+		}
+		payments, err := svc.GetPayments(ctx, tenantID)
+		if err != nil {
+			return err
+		}
+		for _, p := range payments {
+			fmt.Fprintf(out, "%d\t%s\t%d -> %d\t%s %s\n",
+				p.ID, p.OperationTimestamp.Format(time.RFC3339), p.BuyerAccountID, p.SellerAccountID, p.Amount, p.CurrencyName)
+		}
+		return nil
+	}
+	return fmt.Errorf("%v %q\n%s", errUnknownCommand, args[0], paymentUsage)
+}
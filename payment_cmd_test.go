@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/c-pro/wallet-test/models"
+	"github.com/shopspring/decimal"
+)
+
+func TestPaymentCommand(t *testing.T) {
+	repo := newMemoryRepository()
+	ctx := context.Background()
+	for _, amount := range []int64{10, 0} {
+		account := models.Account{TenantID: models.DefaultTenantID, CurrencyID: 2, Amount: decimal.New(amount, 0)}
+		if err := repo.CreateAccount(ctx, &account); err != nil {
+			t.Fatalf("Unexpected error in CreateAccount: %v", err)
+		}
+	}
+
+	svc := &paymentService{repo}
+	out := &bytes.Buffer{}
+	if err := runPaymentCommand(ctx, svc, []string{"make", "1", "2", "2.5"}, out); err != nil {
+		t.Fatalf("Unexpected error in payment make: %v", err)
+	}
+	if out.String() != "Made payment 1\n" {
+		t.Errorf("Unexpected payment make output %q", out.String())
+	}
+	if err := runPaymentCommand(ctx, svc, []string{"make", "1", "2", "100"}, out); err != models.ErrInsufficientAmount {
+		t.Errorf("Expected ErrInsufficientAmount, got %v", err)
+	}
+	if err := runPaymentCommand(ctx, svc, []string{"make", "1", "2", "abc"}, out); err == nil {
+		t.Error("Expected payment with invalid amount to fail")
+	}
+
+	out.Reset()
+	if err := runPaymentCommand(ctx, svc, []string{"list"}, out); err != nil {
+		t.Fatalf("Unexpected error in payment list: %v", err)
+	}
+	if !strings.Contains(out.String(), "1 -> 2\t2.5 RUB") {
+		t.Errorf("Expected payment in payment list output, got %q", out.String())
+	}
+}
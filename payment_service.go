@@ -1,7 +1,7 @@
 package main
 
 import (
-	"database/sql"
+	"context"
 
 	"github.com/c-pro/wallet-test/models"
 	"github.com/shopspring/decimal"
@@ -9,28 +9,42 @@ import (
 
 // PaymentService provides methods to access Payments
 type PaymentService interface {
-	GetPayments() ([]models.Payment, error)
-	MakePayment(int64, int64, decimal.Decimal) (models.Payment, error)
+	GetPayments(ctx context.Context, tenantID int64) ([]models.Payment, error)
+	MakePayment(ctx context.Context, tenantID, buyerAccountID, sellerAccountID int64, amount decimal.Decimal) (models.Payment, error)
+	MakeOwnerPayment(ctx context.Context, tenantID, buyerOwnerID, sellerOwnerID, currencyID int64, amount decimal.Decimal) (models.Payment, error)
 }
 
 // paymentService implements interface above
 type paymentService struct {
-	db *sql.DB
+	repo models.Repository
 }
 
-// GetPayments returns all payments in database
-func (p *paymentService) GetPayments() ([]models.Payment, error) {
-	tx, err := p.db.Begin()
-	if err != nil {
-		return []models.Payment{}, err
-	}
-	defer models.RollbackWithLog(tx)
-	return models.GetPayments(tx)
+// GetPayments returns all tenant's payments in repository
+func (p *paymentService) GetPayments(ctx context.Context, tenantID int64) ([]models.Payment, error) {
+	return p.repo.GetPayments(ctx, tenantID)
 }
 
-// MakePayment makes payment from one account to another
-func (p *paymentService) MakePayment(buyerAccountID,
+// MakePayment makes payment from one tenant's account to another
+func (p *paymentService) MakePayment(ctx context.Context, tenantID,
+	buyerAccountID,
 	sellerAccountID int64,
 	amount decimal.Decimal) (models.Payment, error) {
-	return models.MakePayment(p.db, buyerAccountID, sellerAccountID, amount)
+	return p.repo.MakePayment(ctx, tenantID, buyerAccountID, sellerAccountID, amount)
+}
+
+// MakeOwnerPayment makes payment between primary accounts of two owners in a given currency
+func (p *paymentService) MakeOwnerPayment(ctx context.Context, tenantID,
+	buyerOwnerID,
+	sellerOwnerID,
+	currencyID int64,
+	amount decimal.Decimal) (models.Payment, error) {
+	buyerAccountID, err := p.repo.GetOwnerAccountID(ctx, tenantID, buyerOwnerID, currencyID)
+	if err != nil {
+		return models.Payment{}, err
+	}
+	sellerAccountID, err := p.repo.GetOwnerAccountID(ctx, tenantID, sellerOwnerID, currencyID)
+	if err != nil {
+		return models.Payment{}, err
+	}
+	return p.repo.MakePayment(ctx, tenantID, buyerAccountID, sellerAccountID, amount)
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/c-pro/wallet-test/models"
+	"github.com/shopspring/decimal"
+)
+
+func TestMakeOwnerPaymentService(t *testing.T) {
+	repo := newMemoryRepository()
+	svc := &paymentService{repo}
+	ctx := context.Background()
+	for _, account := range []models.Account{
+		{TenantID: models.DefaultTenantID, OwnerID: 1, CurrencyID: 1, Amount: decimal.New(10, 0)},
+		{TenantID: models.DefaultTenantID, OwnerID: 1, CurrencyID: 1},
+		{TenantID: models.DefaultTenantID, OwnerID: 2, CurrencyID: 1},
+	} {
+		if err := repo.CreateAccount(ctx, &account); err != nil {
+			t.Fatalf("Unexpected error in CreateAccount: %v", err)
+		}
+	}
+
+	payment, err := svc.MakeOwnerPayment(ctx, models.DefaultTenantID, 1, 2, 1, decimal.New(3, 0))
+	if err != nil {
+		t.Fatalf("Unexpected error in MakeOwnerPayment: %v", err)
+	}
+	// oldest account of the owner is primary
+	if payment.BuyerAccountID != 1 || payment.SellerAccountID != 3 {
+		t.Errorf("Expected payment from account 1 to 3, got %d to %d", payment.BuyerAccountID, payment.SellerAccountID)
+	}
+
+	if _, err := svc.MakeOwnerPayment(ctx, models.DefaultTenantID, 1, 2, 2, decimal.New(3, 0)); err != models.ErrOwnerAccountNotFound {
+		t.Errorf("Expected ErrOwnerAccountNotFound, got %v", err)
+	}
+}
@@ -13,15 +13,20 @@ type getPaymentsResponse struct {
 	Payments []models.Payment `json:"Payments,omitempty"`
 }
 
+// makePaymentRequest identifies payment parties either by account IDs
+// or by owner IDs and currency (payment between owners' primary accounts)
 type makePaymentRequest struct {
 	BuyerAccountID  int64
 	SellerAccountID int64
+	BuyerOwnerID    int64
+	SellerOwnerID   int64
+	CurrencyID      int64
 	Amount          decimal.Decimal
 }
 
 func makeGetPaymentsEndpoint(svc PaymentService) endpoint.Endpoint {
-	return func(_ context.Context, request interface{}) (interface{}, error) {
-		payments, err := svc.GetPayments()
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		payments, err := svc.GetPayments(ctx, tenantFromContext(ctx))
 		if err != nil {
 			return errorResponse{err.Error(), 500}, nil
 		}
@@ -30,14 +35,34 @@ func makeGetPaymentsEndpoint(svc PaymentService) endpoint.Endpoint {
 }
 
 func makeMakePaymentEndpoint(svc PaymentService) endpoint.Endpoint {
-	return func(_ context.Context, request interface{}) (interface{}, error) {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
 		req := request.(makePaymentRequest)
-		payment, err := svc.MakePayment(req.BuyerAccountID, req.SellerAccountID, req.Amount)
+		var (
+			payment models.Payment
+			err     error
+		)
+		if req.BuyerOwnerID != 0 || req.SellerOwnerID != 0 {
+			if req.BuyerAccountID != 0 || req.SellerAccountID != 0 {
+				return errorResponse{"Use either account IDs or owner IDs, not both", 400}, nil
+			}
+			payment, err = svc.MakeOwnerPayment(ctx, tenantFromContext(ctx),
+				req.BuyerOwnerID,
+				req.SellerOwnerID,
+				req.CurrencyID,
+				req.Amount)
+		} else {
+			payment, err = svc.MakePayment(ctx, tenantFromContext(ctx),
+				req.BuyerAccountID,
+				req.SellerAccountID,
+				req.Amount)
+		}
 		if err != nil {
 			if err == models.ErrCurrencyMismatch ||
+				err == models.ErrOwnerAccountNotFound ||
 				err == models.ErrInsufficientAmount ||
 				err == models.ErrNoPaymentToSelf ||
 				err == models.ErrNonPositiveAmount ||
+				err == models.ErrAccountFrozen ||
 				err == sql.ErrNoRows {
 				return errorResponse{err.Error(), 400}, nil
 			}
@@ -5,7 +5,6 @@ import (
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
-	"net/http"
 	"testing"
 
 	"github.com/c-pro/wallet-test/models"
@@ -13,7 +12,7 @@ import (
 )
 
 func addTestPayment(t *testing.T, amount decimal.Decimal) models.Payment {
-	c := http.DefaultClient
+	c := client
 	sellerName := randomName()
 	buyerName := randomName()
 	addTestAccount(t, buyerName, amount)
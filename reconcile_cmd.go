@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/c-pro/wallet-test/models"
+	"github.com/shopspring/decimal"
+)
+
+const reconcileUsage = `Usage:
+  wallet reconcile [-tenant <tenant id>]`
+
+var errDiscrepancies = errors.New("reconciliation found discrepancies")
+
+// currencyTotals are sums over all tenant's accounts, deposits and payments in a currency.
+// Opening is total of verifiable accounts only.
+type currencyTotals struct {
+	ID           int64
+	Name         string
+	Accounts     int
+	Unverifiable int
+	Opening      decimal.Decimal
+	Balance      decimal.Decimal
+	Payments     int
+	Volume       decimal.Decimal
+	Deposits     int
+	Deposited    decimal.Decimal
+}
+
+// discrepancy is an account which balance does not agree with the payment log
+type discrepancy struct {
+	AccountID int64
+	Reason    string
+}
+
+// reconciliation is a result of reconcile
+type reconciliation struct {
+	Currencies    []currencyTotals
+	Discrepancies []discrepancy
+}
+
+// reconcile turns mismatches found by models.Repository.Reconcile into discrepancies.
+// Every account balance is expected to be exactly its opening amount plus deposited
+// plus received minus paid, and every payment should move money between accounts of the payment currency.
+// Accounts created before opening amounts were recorded can not be checked,
+// they are only counted as unverifiable.
+func reconcile(r models.Reconciliation) reconciliation {
+	result := reconciliation{Currencies: []currencyTotals{}, Discrepancies: []discrepancy{}}
+	for _, t := range r.Currencies {
+		result.Currencies = append(result.Currencies, currencyTotals{
+			ID:           t.CurrencyID,
+			Name:         t.CurrencyName,
+			Accounts:     t.Accounts,
+			Unverifiable: t.Unverifiable,
+			Opening:      t.Opening,
+			Balance:      t.Balance,
+			Payments:     t.Payments,
+			Volume:       t.Volume,
+			Deposits:     t.Deposits,
+			Deposited:    t.Deposited,
+		})
+	}
+	for _, m := range r.Payments {
+		result.Discrepancies = append(result.Discrepancies, discrepancy{m.AccountID,
+			fmt.Sprintf("payment %d in %s does not match the account", m.PaymentID, m.CurrencyName)})
+	}
+	for _, m := range r.Accounts {
+		result.Discrepancies = append(result.Discrepancies, discrepancy{m.AccountID,
+			fmt.Sprintf("balance %s does not match expected %s: opening %s, deposited %s, received %s, paid %s",
+				m.Balance, m.Expected(), m.Opening, m.Deposited, m.Received, m.Paid)})
+	}
+	return result
+}
+
+// runReconcileCommand reports per-currency totals and accounts which balances
+// do not agree with their opening amounts, deposits and payments. Accounts and payments
+// are read at the same point in time, so it can be run while payments are made.
+func runReconcileCommand(ctx context.Context, svc ReconcileService, args []string, out io.Writer) error {
+	fs, tenantID := newTenantFlagSet("reconcile", out)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return fmt.Errorf("unexpected arguments\n%s", reconcileUsage)
+	}
+	result, err := svc.Reconcile(ctx, *tenantID)
+	if err != nil {
+		return err
+	}
+	for _, t := range result.Currencies {
+		fmt.Fprintf(out, "%d\t%s\taccounts=%d\tunverifiable=%d\topening=%s\tbalance=%s\tpayments=%d\tvolume=%s\tdeposits=%d\tdeposited=%s\n",
+			t.ID, t.Name, t.Accounts, t.Unverifiable, t.Opening, t.Balance, t.Payments, t.Volume, t.Deposits, t.Deposited)
+	}
+	for _, d := range result.Discrepancies {
+		fmt.Fprintf(out, "account %d: %s\n", d.AccountID, d.Reason)
+	}
+	if len(result.Discrepancies) > 0 {
+		return errDiscrepancies
+	}
+	return nil
+}
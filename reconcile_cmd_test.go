@@ -0,0 +1,55 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"testing"
+
+	"github.com/c-pro/wallet-test/models"
+	"github.com/shopspring/decimal"
+)
+
+func TestReconcile(t *testing.T) {
+	result := reconcile(models.Reconciliation{
+		Currencies: []models.ReconcileTotals{
+			{CurrencyID: 1, CurrencyName: "USD", Accounts: 3, Unverifiable: 1, Opening: decimal.New(10, 0), Balance: decimal.New(12, 0), Payments: 2, Volume: decimal.New(3, 0)},
+		},
+		Payments: []models.PaymentMismatch{{PaymentID: 2, AccountID: 3, CurrencyName: "USD"}},
+		Accounts: []models.BalanceMismatch{
+			{AccountID: 2, Balance: decimal.RequireFromString("3.000000000000001"), Received: decimal.New(3, 0)},
+		},
+	})
+	if len(result.Currencies) != 1 || result.Currencies[0].ID != 1 || result.Currencies[0].Unverifiable != 1 ||
+		!result.Currencies[0].Opening.Equals(decimal.New(10, 0)) || !result.Currencies[0].Volume.Equals(decimal.New(3, 0)) {
+		t.Errorf("Unexpected totals %v", result.Currencies)
+	}
+	// payment mismatches go first
+	if len(result.Discrepancies) != 2 || result.Discrepancies[0].AccountID != 3 || result.Discrepancies[1].AccountID != 2 ||
+		result.Discrepancies[1].Reason != "balance 3.000000000000001 does not match expected 3: opening 0, deposited 0, received 3, paid 0" {
+		t.Errorf("Unexpected discrepancies %v", result.Discrepancies)
+	}
+}
+
+func TestReconcileCommand(t *testing.T) {
+	repo := newMemoryRepository()
+	ctx := context.Background()
+	for _, amount := range []int64{10, 0} {
+		account := models.Account{TenantID: models.DefaultTenantID, CurrencyID: 1, Amount: decimal.New(amount, 0)}
+		if err := repo.CreateAccount(ctx, &account); err != nil {
+			t.Fatalf("Unexpected error in CreateAccount: %v", err)
+		}
+	}
+	if _, err := repo.MakePayment(ctx, models.DefaultTenantID, 1, 2, decimal.New(4, 0)); err != nil {
+		t.Fatalf("Unexpected error in MakePayment: %v", err)
+	}
+	if _, err := repo.MakeDeposit(ctx, models.DefaultTenantID, 2, decimal.New(5, 0)); err != nil {
+		t.Fatalf("Unexpected error in MakeDeposit: %v", err)
+	}
+	out := &bytes.Buffer{}
+	if err := runReconcileCommand(ctx, &reconcileService{repo}, nil, out); err != nil {
+		t.Fatalf("Unexpected error in reconcile: %v", err)
+	}
+	if out.String() != "1\tUSD\taccounts=2\tunverifiable=0\topening=10\tbalance=15\tpayments=1\tvolume=4\tdeposits=1\tdeposited=5\n" {
+		t.Errorf("Unexpected reconcile output %q", out.String())
+	}
+}
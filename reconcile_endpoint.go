@@ -0,0 +1,19 @@
+package main
+
+import (
+	"context"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+// makeReconcileEndpoint returns reconciliation of tenant's accounts and payments.
+// Discrepancies are a part of successful response.
+func makeReconcileEndpoint(svc ReconcileService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		result, err := svc.Reconcile(ctx, tenantFromContext(ctx))
+		if err != nil {
+			return errorResponse{err.Error(), 500}, nil
+		}
+		return result, nil
+	}
+}
@@ -0,0 +1,28 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestReconcileEndpoint(t *testing.T) {
+	payment := addTestPayment(t, decimal.New(5, 0))
+
+	result := reconciliation{}
+	getSomething(t, "/admin/reconciliation", &result)
+	found := false
+	for _, c := range result.Currencies {
+		if c.ID == payment.CurrencyID {
+			found = c.Payments > 0 && c.Accounts >= 2
+		}
+	}
+	if !found {
+		t.Errorf("Expected totals of currency %d, got %+v", payment.CurrencyID, result.Currencies)
+	}
+	for _, d := range result.Discrepancies {
+		if d.AccountID == payment.BuyerAccountID || d.AccountID == payment.SellerAccountID {
+			t.Errorf("Unexpected discrepancy %+v", d)
+		}
+	}
+}
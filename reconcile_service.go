@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+
+	"github.com/c-pro/wallet-test/models"
+)
+
+// ReconcileService checks account balances against the payment log
+type ReconcileService interface {
+	Reconcile(ctx context.Context, tenantID int64) (reconciliation, error)
+}
+
+// reconcileService implements interface above
+type reconcileService struct {
+	repo models.Repository
+}
+
+// Reconcile reconciles tenant's accounts and payments read at the same point in time
+func (r *reconcileService) Reconcile(ctx context.Context, tenantID int64) (reconciliation, error) {
+	result, err := r.repo.Reconcile(ctx, tenantID)
+	if err != nil {
+		return reconciliation{}, err
+	}
+	return reconcile(result), nil
+}
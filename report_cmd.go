@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+const reportUsage = `Usage:
+  wallet report [-tenant <tenant id>] [-date YYYY-MM-DD] [-format json|csv]`
+
+// writeTrialBalanceCSV writes report as CSV with a header line
+func writeTrialBalanceCSV(w io.Writer, report trialBalance) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"date", "currency_id", "currency", "accounts", "active_accounts", "balance", "payments", "volume", "deposits", "deposited"})
+	for _, c := range report.Currencies {
+		cw.Write([]string{
+			report.Date,
+			strconv.FormatInt(c.CurrencyID, 10),
+			c.CurrencyName,
+			strconv.Itoa(c.Accounts),
+			strconv.Itoa(c.ActiveAccounts),
+			c.Balance.String(),
+			strconv.Itoa(c.Payments),
+			c.Volume.String(),
+			strconv.Itoa(c.Deposits),
+			c.Deposited.String(),
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// runReportCommand prints trial balance report of a day, yesterday (UTC) by default
+func runReportCommand(ctx context.Context, svc ReportService, args []string, out io.Writer) error {
+	fs, tenantID := newTenantFlagSet("report", out)
+	yesterday := time.Now().UTC().AddDate(0, 0, -1).Format(reportDateLayout)
+	date := fs.String("date", yesterday, "report day (UTC)")
+	format := fs.String("format", "json", "output format: json or csv")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 || (*format != "json" && *format != "csv") {
+		return fmt.Errorf("unexpected arguments\n%s", reportUsage)
+	}
+	day, err := time.Parse(reportDateLayout, *date)
+	if err != nil {
+		return fmt.Errorf("bad date %q\n%s", *date, reportUsage)
+	}
+	report, err := svc.TrialBalance(ctx, *tenantID, day)
+	if err != nil {
+		return err
+	}
+	if *format == "csv" {
+		return writeTrialBalanceCSV(out, report)
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(report)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c-pro/wallet-test/models"
+	"github.com/shopspring/decimal"
+)
+
+func TestReportCommand(t *testing.T) {
+	repo := newMemoryRepository()
+	ctx := context.Background()
+	for _, amount := range []int64{10, 0, 1} {
+		account := models.Account{TenantID: models.DefaultTenantID, CurrencyID: 1, Amount: decimal.New(amount, 0)}
+		if err := repo.CreateAccount(ctx, &account); err != nil {
+			t.Fatalf("Unexpected error in CreateAccount: %v", err)
+		}
+	}
+	if _, err := repo.MakePayment(ctx, models.DefaultTenantID, 1, 2, decimal.New(4, 0)); err != nil {
+		t.Fatalf("Unexpected error in MakePayment: %v", err)
+	}
+	if _, err := repo.MakeDeposit(ctx, models.DefaultTenantID, 3, decimal.New(2, 0)); err != nil {
+		t.Fatalf("Unexpected error in MakeDeposit: %v", err)
+	}
+	today := time.Now().UTC().Format(reportDateLayout)
+
+	out := &bytes.Buffer{}
+	if err := runReportCommand(ctx, &reportService{repo}, []string{"-date", today, "-format", "csv"}, out); err != nil {
+		t.Fatalf("Unexpected error in report command: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	if len(lines) < 2 || lines[0] != "date,currency_id,currency,accounts,active_accounts,balance,payments,volume,deposits,deposited" ||
+		lines[1] != today+",1,USD,3,2,13,1,4,1,2" {
+		t.Errorf("Unexpected report:\n%s", out)
+	}
+
+	// accounts were opened, payment and deposit were made today, so yesterday's report has none
+	out.Reset()
+	if err := runReportCommand(ctx, &reportService{repo}, nil, out); err != nil {
+		t.Fatalf("Unexpected error in report command: %v", err)
+	}
+	report := trialBalance{}
+	if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+		t.Fatalf("Failed to decode report %q: %v", out, err)
+	}
+	if len(report.Currencies) == 0 || report.Currencies[0].Accounts != 0 || report.Currencies[0].Payments != 0 ||
+		!report.Currencies[0].Balance.IsZero() ||
+		report.To.Sub(report.From) != 24*time.Hour {
+		t.Errorf("Unexpected report %+v", report)
+	}
+
+	for _, args := range [][]string{{"-date", "yesterday"}, {"-format", "xml"}, {"extra"}} {
+		if err := runReportCommand(ctx, &reportService{repo}, args, out); err == nil {
+			t.Errorf("Expected error for arguments %v", args)
+		}
+	}
+}
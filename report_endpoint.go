@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-kit/kit/endpoint"
+)
+
+type trialBalanceRequest struct {
+	Date   time.Time
+	Format string
+}
+
+// trialBalanceResponse is trial balance report written in requested format
+type trialBalanceResponse struct {
+	trialBalance
+	Format string `json:"-"`
+}
+
+func makeTrialBalanceEndpoint(svc ReportService) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(trialBalanceRequest)
+		report, err := svc.TrialBalance(ctx, tenantFromContext(ctx), req.Date)
+		if err != nil {
+			return errorResponse{err.Error(), 500}, nil
+		}
+		return trialBalanceResponse{report, req.Format}, nil
+	}
+}
+
+// decodeTrialBalanceRequest reads report day from date query parameter (YYYY-MM-DD, yesterday by default)
+// and output format from format parameter (json or csv, json by default)
+func decodeTrialBalanceRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	q := r.URL.Query()
+	req := trialBalanceRequest{Date: time.Now().UTC().AddDate(0, 0, -1), Format: q.Get("format")}
+	if s := q.Get("date"); s != "" {
+		var err error
+		if req.Date, err = time.Parse(reportDateLayout, s); err != nil {
+			return nil, errBadRequest
+		}
+	}
+	switch req.Format {
+	case "":
+		req.Format = "json"
+	case "json", "csv":
+	default:
+		return nil, errBadRequest
+	}
+	return req, nil
+}
+
+// encodeTrialBalanceResponse writes CSV report as a file download,
+// other responses are written by encodeResponse
+func encodeTrialBalanceResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
+	resp, ok := response.(trialBalanceResponse)
+	if !ok || resp.Format != "csv" {
+		return encodeResponse(ctx, w, response)
+	}
+	w.Header().Add("Content-Type", "text/csv")
+	w.Header().Add("Content-Disposition", `attachment; filename="trial-balance-`+resp.Date+`.csv"`)
+	return writeTrialBalanceCSV(w, resp.trialBalance)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/shopspring/decimal"
+)
+
+func TestTrialBalanceEndpoint(t *testing.T) {
+	payment := addTestPayment(t, decimal.New(5, 0))
+	today := time.Now().UTC().Format(reportDateLayout)
+
+	report := trialBalance{}
+	getSomething(t, "/admin/reports/trial-balance?date="+today, &report)
+	found := false
+	for _, c := range report.Currencies {
+		if c.CurrencyID == payment.CurrencyID {
+			found = c.Payments > 0 && c.ActiveAccounts >= 2 && c.Volume.GreaterThanOrEqual(payment.Amount)
+		}
+	}
+	if report.Date != today || !found {
+		t.Errorf("Expected today's totals of currency %d, got %+v", payment.CurrencyID, report)
+	}
+
+	res, err := client.Get(URL("/admin/reports/trial-balance?format=csv&date=" + today))
+	if err != nil {
+		t.Fatalf("Unexpected error in Get request: %s", err)
+	}
+	b, err := ioutil.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != 200 || res.Header.Get("Content-Type") != "text/csv" {
+		t.Fatalf("Expected CSV, got status %d and content type %q", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(string(b), "\n"+today+","+strconv.FormatInt(payment.CurrencyID, 10)+",") {
+		t.Errorf("Currency %d was not found in report:\n%s", payment.CurrencyID, b)
+	}
+}
+
+func TestDecodeTrialBalanceRequest(t *testing.T) {
+	req, err := decodeTrialBalanceRequest(context.Background(), httptest.NewRequest("GET", "/admin/reports/trial-balance?date=2024-05-01", nil))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if r := req.(trialBalanceRequest); r.Format != "json" || r.Date.Format(reportDateLayout) != "2024-05-01" {
+		t.Errorf("Unexpected request %+v", r)
+	}
+	for _, query := range []string{"date=01.05.2024", "format=xml"} {
+		if _, err := decodeTrialBalanceRequest(context.Background(), httptest.NewRequest("GET", "/admin/reports/trial-balance?"+query, nil)); err != errBadRequest {
+			t.Errorf("Expected errBadRequest for %q, got %v", query, err)
+		}
+	}
+}
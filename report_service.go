@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/c-pro/wallet-test/models"
+)
+
+// reportDateLayout is the format of trial balance report dates
+const reportDateLayout = "2006-01-02"
+
+// trialBalance is a daily report of per currency totals.
+// Deposits and payments made from From (inclusive) till To (exclusive) are counted,
+// accounts and balances are the ones at To.
+type trialBalance struct {
+	Date       string
+	From       time.Time
+	To         time.Time
+	Currencies []models.CurrencyTotals
+}
+
+// ReportService makes finance reports
+type ReportService interface {
+	TrialBalance(ctx context.Context, tenantID int64, date time.Time) (trialBalance, error)
+}
+
+// reportService implements interface above
+type reportService struct {
+	repo models.Repository
+}
+
+// TrialBalance returns tenant's currency totals with deposits and payments of UTC day date
+func (r *reportService) TrialBalance(ctx context.Context, tenantID int64, date time.Time) (trialBalance, error) {
+	y, m, d := date.Date()
+	from := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	report := trialBalance{Date: from.Format(reportDateLayout), From: from, To: from.AddDate(0, 0, 1)}
+	var err error
+	report.Currencies, err = r.repo.GetCurrencyTotals(ctx, tenantID, report.From, report.To)
+	return report, err
+}
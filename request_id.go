@@ -0,0 +1,35 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/c-pro/wallet-test/logging"
+)
+
+// requestIDHeader is a header request ID is accepted from and returned in
+const requestIDHeader = "X-Request-ID"
+
+// withRequestID takes request ID from X-Request-ID header or generates a new one,
+// returns it in response header and puts it in request context, so it is added to all
+// log lines written while serving the request. Every request is logged when it is finished.
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !logging.ValidRequestID(id) {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set(requestIDHeader, id)
+		ctx := logging.WithRequestID(r.Context(), id)
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		logging.FromContext(ctx).Log("msg", "request",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.status,
+			"duration", time.Since(start),
+			"remote_addr", r.RemoteAddr)
+	})
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/c-pro/wallet-test/logging"
+	kitlog "github.com/go-kit/kit/log"
+)
+
+func TestWithRequestID(t *testing.T) {
+	buf := bytes.Buffer{}
+	logger, _ := logging.NewLogger("logfmt", &buf)
+	logging.SetLogger(logger)
+	defer logging.SetLogger(logging.New(kitlog.NewLogfmtLogger(os.Stderr)))
+
+	handler := withRequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, r, errorResponse{"boom", http.StatusInternalServerError})
+	}))
+
+	req := httptest.NewRequest("GET", "/accounts", nil)
+	req.Header.Set(requestIDHeader, "client-id-1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if id := rec.Header().Get(requestIDHeader); id != "client-id-1" {
+		t.Errorf("Expected request ID from client to be returned, got %q", id)
+	}
+	resp := struct{ Error, RequestID string }{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if resp.RequestID != "client-id-1" || resp.Error != "boom" {
+		t.Errorf("Expected error response with request ID, got %+v", resp)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("Expected error and request log lines, got %q", buf.String())
+	}
+	for _, line := range lines {
+		if !strings.Contains(line, "request_id=client-id-1") {
+			t.Errorf("Expected request ID in log line %q", line)
+		}
+	}
+	if !strings.Contains(lines[1], "status=500") {
+		t.Errorf("Expected response status in request log line %q", lines[1])
+	}
+
+	// invalid request ID is replaced
+	req = httptest.NewRequest("GET", "/accounts", nil)
+	req.Header.Set(requestIDHeader, "bad id\n")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	if id := rec.Header().Get(requestIDHeader); !logging.ValidRequestID(id) || id == "bad id\n" {
+		t.Errorf("Expected generated request ID, got %q", id)
+	}
+}
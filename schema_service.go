@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/c-pro/wallet-test/models"
+	"github.com/c-pro/wallet-test/models/sqlite"
+)
+
+// SchemaService provides methods to inspect and migrate database schema
+type SchemaService interface {
+	SchemaVersion(ctx context.Context) (int, error)
+	Migrate(ctx context.Context, target int) (int, error)
+}
+
+// schemaChecker reports schema version of the database and the latest one the service supports
+type schemaChecker interface {
+	SchemaVersion(ctx context.Context) (int, error)
+	LatestSchemaVersion() int
+}
+
+// schemaService implements SchemaService for postgres
+type schemaService struct {
+	db *sql.DB
+}
+
+// SchemaVersion returns version of the latest migration applied to the database
+func (s *schemaService) SchemaVersion(ctx context.Context) (int, error) {
+	return models.SchemaVersion(ctx, s.db)
+}
+
+// LatestSchemaVersion returns version of the latest postgres migration
+func (s *schemaService) LatestSchemaVersion() int {
+	return models.LatestSchemaVersion()
+}
+
+// Migrate migrates database schema to target version and returns version it had before
+func (s *schemaService) Migrate(ctx context.Context, target int) (int, error) {
+	return models.Migrate(ctx, s.db, target)
+}
+
+// sqliteSchemaService implements schemaChecker for SQLite file.
+// SQLite schema is migrated when the file is opened (see sqlite.Open).
+type sqliteSchemaService struct {
+	db *sql.DB
+}
+
+// SchemaVersion returns schema version recorded in the file
+func (s *sqliteSchemaService) SchemaVersion(ctx context.Context) (int, error) {
+	return sqlite.SchemaVersion(ctx, s.db)
+}
+
+// LatestSchemaVersion returns version of the latest SQLite migration
+func (s *sqliteSchemaService) LatestSchemaVersion() int {
+	return sqlite.LatestSchemaVersion()
+}
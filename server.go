@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/c-pro/wallet-test/logging"
+)
+
+// drainState tells if the server is shutting down, see serveUntilDone
+type drainState struct {
+	draining int32
+}
+
+func (d *drainState) start() {
+	atomic.StoreInt32(&d.draining, 1)
+}
+
+func (d *drainState) isDraining() bool {
+	return atomic.LoadInt32(&d.draining) == 1
+}
+
+// serveUntilDone serves HTTP requests on ln until ctx is done, then shuts the server down gracefully.
+// Server is marked as draining and keeps serving for delay, so load balancer notices it is not ready
+// and stops sending new requests. Then listener is closed and requests in progress get up to timeout to finish.
+// Requests still running after timeout are canceled, so their transactions are rolled back,
+// and an error is returned.
+func serveUntilDone(ctx context.Context,
+	handler http.Handler,
+	ln net.Listener,
+	drain *drainState,
+	delay,
+	timeout time.Duration) error {
+	requestsCtx, cancelRequests := context.WithCancel(context.Background())
+	defer cancelRequests()
+	server := &http.Server{
+		Handler: handler,
+		// requests are not canceled by ctx, they can finish during shutdown
+		BaseContext: func(net.Listener) context.Context { return requestsCtx },
+	}
+
+	errc := make(chan error, 1)
+	go func() {
+		errc <- server.Serve(ln)
+	}()
+	select {
+	case err := <-errc:
+		return err
+	case <-ctx.Done():
+	}
+
+	drain.start()
+	if delay > 0 {
+		logging.Default().Log("msg", "shutting down", "drain_delay", delay)
+		time.Sleep(delay)
+	}
+
+	logging.Default().Log("msg", "waiting for requests in progress", "timeout", timeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		cancelRequests()
+		server.Close()
+		return fmt.Errorf("requests did not finish in %s: %v", timeout, err)
+	}
+	return nil
+}
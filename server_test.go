@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// startServer serves handler with serveUntilDone and returns server URL and channel with its result
+func startServer(t *testing.T, ctx context.Context, handler http.Handler, timeout time.Duration) (string, chan error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error in Listen: %v", err)
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- serveUntilDone(ctx, handler, ln, &drainState{}, 0, timeout)
+	}()
+	return "http://" + ln.Addr().String(), done
+}
+
+func TestServeUntilDoneDrains(t *testing.T) {
+	started, release := make(chan struct{}), make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-release
+		if r.Context().Err() != nil {
+			t.Error("Request in progress should not be canceled during graceful shutdown")
+		}
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	url, done := startServer(t, ctx, handler, time.Second*5)
+
+	resc := make(chan error, 1)
+	go func() {
+		res, err := http.Get(url)
+		if err == nil {
+			res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				t.Errorf("Expected request in progress to succeed, got %d", res.StatusCode)
+			}
+		}
+		resc <- err
+	}()
+	<-started
+	cancel()
+
+	// listener is closed while request is still in progress
+	deadline := time.Now().Add(time.Second)
+	for {
+		res, err := (&http.Client{Transport: &http.Transport{DisableKeepAlives: true}}).Get(url)
+		if err != nil {
+			break
+		}
+		res.Body.Close()
+		if time.Now().After(deadline) {
+			t.Fatal("Expected new connections to be refused during shutdown")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	close(release)
+	if err := <-resc; err != nil {
+		t.Errorf("Unexpected error in request in progress: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("Unexpected error in serveUntilDone: %v", err)
+	}
+}
+
+func TestServeUntilDoneTimeout(t *testing.T) {
+	started, canceled := make(chan struct{}), make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		<-r.Context().Done()
+		close(canceled)
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	url, done := startServer(t, ctx, handler, time.Millisecond*100)
+
+	go func() {
+		if res, err := http.Get(url); err == nil {
+			res.Body.Close()
+		}
+	}()
+	<-started
+	cancel()
+
+	if err := <-done; err == nil {
+		t.Error("Expected serveUntilDone to report requests which did not finish")
+	}
+	select {
+	case <-canceled:
+	case <-time.After(time.Second):
+		t.Error("Expected request to be canceled after shutdown timeout")
+	}
+}
+
+func TestServeUntilDoneDelay(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error in Listen: %v", err)
+	}
+	drain := &drainState{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- serveUntilDone(ctx, http.NotFoundHandler(), ln, drain, time.Millisecond*300, time.Second)
+	}()
+	cancel()
+	for !drain.isDraining() {
+		time.Sleep(time.Millisecond)
+	}
+
+	// requests are still served during drain delay
+	res, err := http.Get("http://" + ln.Addr().String())
+	if err != nil {
+		t.Fatalf("Expected requests to be served during drain delay, got %v", err)
+	}
+	res.Body.Close()
+	if err := <-done; err != nil {
+		t.Errorf("Unexpected error in serveUntilDone: %v", err)
+	}
+}
@@ -0,0 +1,158 @@
+// Package signing implements HMAC-SHA256 request signing for server-to-server clients.
+//
+// Signature is calculated over the string
+//
+//	METHOD + "\n" + REQUEST_URI + "\n" + TIMESTAMP + "\n" + NONCE + "\n" + hex(sha256(BODY))
+//
+// with the key secret and sent in hex encoding along with the key ID,
+// unix timestamp and a unique nonce in request headers.
+package signing
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Request headers carrying signature
+const (
+	HeaderKey       = "X-Signature-Key"
+	HeaderTimestamp = "X-Signature-Timestamp"
+	HeaderNonce     = "X-Signature-Nonce"
+	HeaderSignature = "X-Signature"
+)
+
+// MaxNonceLength limits nonce size, so it can be stored cheaply
+const MaxNonceLength = 64
+
+// Constant errors
+var (
+	ErrMissingHeaders = errors.New("Signature headers are missing")
+	ErrBadTimestamp   = errors.New("Invalid signature timestamp")
+	ErrBadNonce       = errors.New("Nonce should be 1 to 64 characters long")
+	ErrBodyTooLarge   = errors.New("Request body is too large")
+)
+
+// StringToSign returns canonical representation of the request covered by signature
+func StringToSign(method, uri, timestamp, nonce string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	return strings.Join([]string{
+		strings.ToUpper(method),
+		uri,
+		timestamp,
+		nonce,
+		hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+}
+
+// Signature returns hex encoded HMAC-SHA256 of the string with the secret
+func Signature(secret, stringToSign string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(stringToSign))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// readBody reads request body and replaces it with a copy, so it can be read again.
+// Body size is not limited if maxBody is not positive.
+func readBody(r *http.Request, maxBody int64) ([]byte, error) {
+	if r.Body == nil {
+		return nil, nil
+	}
+	reader := io.Reader(r.Body)
+	if maxBody > 0 {
+		reader = io.LimitReader(r.Body, maxBody+1)
+	}
+	body, err := ioutil.ReadAll(reader)
+	r.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	if maxBody > 0 && int64(len(body)) > maxBody {
+		return nil, ErrBodyTooLarge
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// Sign adds signature headers to the request using current time and a random nonce
+func Sign(r *http.Request, keyID, secret string) error {
+	body, err := readBody(r, 0)
+	if err != nil {
+		return err
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	nonce := hex.EncodeToString(b)
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	r.Header.Set(HeaderKey, keyID)
+	r.Header.Set(HeaderTimestamp, timestamp)
+	r.Header.Set(HeaderNonce, nonce)
+	r.Header.Set(HeaderSignature, Signature(secret,
+		StringToSign(r.Method, r.URL.RequestURI(), timestamp, nonce, body)))
+	return nil
+}
+
+// Signed is a signed request as received by the server
+type Signed struct {
+	KeyID        string
+	Timestamp    time.Time
+	Nonce        string
+	Signature    string
+	StringToSign string
+}
+
+// IsSigned returns true if request carries signature
+func IsSigned(r *http.Request) bool {
+	return r.Header.Get(HeaderSignature) != ""
+}
+
+// Parse extracts signature from request headers. Request body is read
+// (up to maxBody bytes) to calculate its hash and then restored.
+func Parse(r *http.Request, maxBody int64) (Signed, error) {
+	s := Signed{
+		KeyID:     r.Header.Get(HeaderKey),
+		Nonce:     r.Header.Get(HeaderNonce),
+		Signature: r.Header.Get(HeaderSignature),
+	}
+	timestamp := r.Header.Get(HeaderTimestamp)
+	if s.KeyID == "" || s.Signature == "" || timestamp == "" {
+		return s, ErrMissingHeaders
+	}
+	if len(s.Nonce) == 0 || len(s.Nonce) > MaxNonceLength {
+		return s, ErrBadNonce
+	}
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return s, ErrBadTimestamp
+	}
+	s.Timestamp = time.Unix(unix, 0)
+	body, err := readBody(r, maxBody)
+	if err != nil {
+		return s, err
+	}
+	s.StringToSign = StringToSign(r.Method, r.URL.RequestURI(), timestamp, s.Nonce, body)
+	return s, nil
+}
+
+// Fresh returns true if signature timestamp is within window from now in either direction
+func (s Signed) Fresh(now time.Time, window time.Duration) bool {
+	diff := now.Sub(s.Timestamp)
+	return diff <= window && diff >= -window
+}
+
+// Valid checks signature with the secret in constant time
+func (s Signed) Valid(secret string) bool {
+	expected := Signature(secret, s.StringToSign)
+	return hmac.Equal([]byte(expected), []byte(strings.ToLower(s.Signature)))
+}
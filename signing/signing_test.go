@@ -0,0 +1,101 @@
+package signing
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func signedRequest(t *testing.T, body string) *http.Request {
+	r, err := http.NewRequest("POST", "http://wallet/payments?x=1", bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Sign(r, "7", "secret"); err != nil {
+		t.Fatalf("Unexpected error in Sign: %v", err)
+	}
+	return r
+}
+
+func TestSignAndVerify(t *testing.T) {
+	r := signedRequest(t, `{"Amount": 1}`)
+	if !IsSigned(r) {
+		t.Fatal("Expected request to be signed")
+	}
+	s, err := Parse(r, 1024)
+	if err != nil {
+		t.Fatalf("Unexpected error in Parse: %v", err)
+	}
+	if s.KeyID != "7" {
+		t.Errorf("Expected key ID 7, got %s", s.KeyID)
+	}
+	if !s.Valid("secret") {
+		t.Error("Expected signature to be valid")
+	}
+	if s.Valid("other secret") {
+		t.Error("Expected signature to be invalid with another secret")
+	}
+	if !s.Fresh(time.Now(), time.Minute) {
+		t.Error("Expected signature to be fresh")
+	}
+	if s.Fresh(time.Now().Add(time.Hour), time.Minute) {
+		t.Error("Expected signature to be stale an hour later")
+	}
+	if s.Fresh(time.Now().Add(-time.Hour), time.Minute) {
+		t.Error("Expected signature from the future to be rejected")
+	}
+
+	body, _ := ioutil.ReadAll(r.Body)
+	if string(body) != `{"Amount": 1}` {
+		t.Errorf("Expected body to be restored after Parse, got %q", body)
+	}
+}
+
+func TestTampering(t *testing.T) {
+	tamper := []func(r *http.Request){
+		func(r *http.Request) { r.Body = ioutil.NopCloser(bytes.NewBufferString(`{"Amount": 100}`)) },
+		func(r *http.Request) { r.Method = "PUT" },
+		func(r *http.Request) { r.URL.RawQuery = "x=2" },
+		func(r *http.Request) { r.URL.Path = "/accounts" },
+		func(r *http.Request) { r.Header.Set(HeaderNonce, "other") },
+		func(r *http.Request) { r.Header.Set(HeaderTimestamp, "1") },
+	}
+	for i, f := range tamper {
+		r := signedRequest(t, `{"Amount": 1}`)
+		f(r)
+		s, err := Parse(r, 1024)
+		if err != nil {
+			t.Fatalf("%d: unexpected error in Parse: %v", i, err)
+		}
+		if s.Valid("secret") {
+			t.Errorf("%d: expected tampered request signature to be invalid", i)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	r := signedRequest(t, "")
+	r.Header.Del(HeaderKey)
+	if _, err := Parse(r, 1024); err != ErrMissingHeaders {
+		t.Errorf("Expected ErrMissingHeaders, got %v", err)
+	}
+
+	r = signedRequest(t, "")
+	r.Header.Set(HeaderTimestamp, "yesterday")
+	if _, err := Parse(r, 1024); err != ErrBadTimestamp {
+		t.Errorf("Expected ErrBadTimestamp, got %v", err)
+	}
+
+	r = signedRequest(t, "")
+	r.Header.Set(HeaderNonce, string(make([]byte, MaxNonceLength+1)))
+	if _, err := Parse(r, 1024); err != ErrBadNonce {
+		t.Errorf("Expected ErrBadNonce, got %v", err)
+	}
+
+	r = signedRequest(t, "0123456789")
+	if _, err := Parse(r, 5); err != ErrBodyTooLarge {
+		t.Errorf("Expected ErrBodyTooLarge, got %v", err)
+	}
+}
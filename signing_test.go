@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/c-pro/wallet-test/signing"
+)
+
+func signedRequest(t *testing.T, hmacKey issueHMACKeyResponse, method, route, body string) *http.Request {
+	req, err := http.NewRequest(method, URL(route), bytes.NewBufferString(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := signing.Sign(req, strconv.FormatInt(hmacKey.ID, 10), hmacKey.Secret); err != nil {
+		t.Fatalf("Unexpected error in signing.Sign: %v", err)
+	}
+	return req
+}
+
+func sendSigned(t *testing.T, req *http.Request, body string) int {
+	req.Body = ioutil.NopCloser(bytes.NewBufferString(body))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error in signed request: %v", err)
+	}
+	res.Body.Close()
+	return res.StatusCode
+}
+
+func TestSignedRequests(t *testing.T) {
+	requireDB(t)
+	hmacKey := issueHMACKeyResponse{}
+	postSomething(t, "/admin/hmac-keys", fmt.Sprintf(`{"Name": "%s", "Role": "operator"}`,
+		randomName()), &hmacKey)
+	if hmacKey.Secret == "" {
+		t.Fatal("Expected HMAC secret in response")
+	}
+
+	body := `{"Name": "partner"}`
+	req := signedRequest(t, hmacKey, "POST", "/owners", body)
+	if code := sendSigned(t, req, body); code != 200 {
+		t.Fatalf("Expected signed request to succeed, got %d", code)
+	}
+	if code := sendSigned(t, req, body); code != 401 {
+		t.Errorf("Expected replayed request to get 401, got %d", code)
+	}
+
+	req = signedRequest(t, hmacKey, "POST", "/owners", body)
+	if code := sendSigned(t, req, `{"Name": "mallory"}`); code != 401 {
+		t.Errorf("Expected request with tampered body to get 401, got %d", code)
+	}
+
+	req = signedRequest(t, hmacKey, "GET", "/accounts", "")
+	stale := time.Now().Add(-signatureWindow - time.Minute).Unix()
+	req.Header.Set(signing.HeaderTimestamp, strconv.FormatInt(stale, 10))
+	if code := sendSigned(t, req, ""); code != 401 {
+		t.Errorf("Expected request with stale timestamp to get 401, got %d", code)
+	}
+
+	wrongSecret := hmacKey
+	wrongSecret.Secret = "guess"
+	req = signedRequest(t, wrongSecret, "GET", "/accounts", "")
+	if code := sendSigned(t, req, ""); code != 401 {
+		t.Errorf("Expected request with wrong secret to get 401, got %d", code)
+	}
+
+	if code, _ := getStatus(t, client, "DELETE", fmt.Sprintf("/admin/hmac-key/%d", hmacKey.ID)); code != 200 {
+		t.Fatalf("Expected HMAC key revoke to succeed, got %d", code)
+	}
+	req = signedRequest(t, hmacKey, "GET", "/accounts", "")
+	if code := sendSigned(t, req, ""); code != 401 {
+		t.Errorf("Expected request signed with revoked key to get 401, got %d", code)
+	}
+}
@@ -1,7 +0,0 @@
-\c wallet wallet
-
-insert into currencies(name)
-    values('USD'),
-          ('RUB'),
-          ('BTC'),
-          ('ETC');
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/c-pro/wallet-test/models"
+	"github.com/shopspring/decimal"
+)
+
+func TestOpenStorage(t *testing.T) {
+	if _, _, _, err := openStorage(StorageConfig{Backend: "mysql"}); err == nil {
+		t.Error("Expected openStorage to fail for unknown backend")
+	}
+
+	cfg := StorageConfig{Backend: "sqlite", SQLitePath: filepath.Join(t.TempDir(), "wallet.db")}
+	db, repo, pool, err := openStorage(cfg)
+	if err != nil {
+		t.Fatalf("Unexpected error in openStorage: %v", err)
+	}
+	defer pool.Close()
+	if db != nil {
+		t.Error("Expected no postgres connection with sqlite backend")
+	}
+
+	s := httptest.NewServer(makeHandlers(nil, repo, testVerifier()))
+	defer s.Close()
+	c := newClient(signTestToken(map[string]interface{}{
+		"iss": "test", "sub": "test", "exp": time.Now().Add(time.Minute).Unix(),
+		"tenant_id": models.DefaultTenantID, "role": models.RoleAdmin}))
+
+	post := func(route, body string) int {
+		res, err := c.Post(s.URL+route, "application/json", strings.NewReader(body))
+		if err != nil {
+			t.Fatalf("Unexpected error in Post request: %s", err)
+		}
+		res.Body.Close()
+		return res.StatusCode
+	}
+	if code := post("/accounts", `{"Name": "buyer", "Amount": "10", "CurrencyID": 1}`); code != 200 {
+		t.Fatalf("Expected account to be created, got %d", code)
+	}
+	if code := post("/accounts", `{"Name": "seller", "Amount": "0", "CurrencyID": 1}`); code != 200 {
+		t.Fatalf("Expected account to be created, got %d", code)
+	}
+	if code := post("/payments", `{"BuyerAccountID": 1, "SellerAccountID": 2, "Amount": "3"}`); code != 200 {
+		t.Errorf("Expected payment to be made, got %d", code)
+	}
+	seller, err := repo.GetAccount(context.Background(), models.DefaultTenantID, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error in GetAccount: %v", err)
+	}
+	if !seller.Amount.Equals(decimal.New(3, 0)) {
+		t.Errorf("Expected seller amount to be 3, got %s", seller.Amount)
+	}
+
+	// owners are stored only in postgres
+	res, err := c.Get(s.URL + "/owners")
+	if err != nil {
+		t.Fatalf("Unexpected error in Get request: %s", err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusNotFound {
+		t.Errorf("Expected owners route to be missing, got %d", res.StatusCode)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+)
+
+const tenantUsage = `Usage:
+  wallet tenant list
+  wallet tenant add [-currencies USD,EUR,...] <name>`
+
+// runTenantCommand manages tenants from the command line.
+// Tenants are not manageable through the API, because every API client belongs to some tenant.
+func runTenantCommand(ctx context.Context, svc TenantService, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%v\n%s", errUnknownCommand, tenantUsage)
+	}
+	switch args[0] {
+	case "list":
+		tenants, err := svc.GetTenants(ctx)
+		if err != nil {
+			return err
+		}
+		for _, t := range tenants {
+			fmt.Fprintf(out, "%d\t%s\n", t.ID, t.Name)
+		}
+		return nil
+	case "add":
+		fs := flag.NewFlagSet("add", flag.ContinueOnError)
+		fs.SetOutput(out)
+		currencyList := fs.String("currencies", "", "comma separated currency names")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return fmt.Errorf("tenant name is required\n%s", tenantUsage)
+		}
+		currencies := []string{}
+		for _, name := range strings.Split(*currencyList, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				currencies = append(currencies, name)
+			}
+		}
+		tenant, created, err := svc.CreateTenant(ctx, fs.Arg(0), currencies)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(out, "Created tenant %d\n", tenant.ID)
+		for _, c := range created {
+			fmt.Fprintf(out, "Created currency %d\t%s\n", c.ID, c.Name)
+		}
+		return nil
+	}
+	return fmt.Errorf("%v %q\n%s", errUnknownCommand, args[0], tenantUsage)
+}
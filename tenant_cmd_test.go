@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/c-pro/wallet-test/models"
+	"github.com/shopspring/decimal"
+)
+
+func TestTenantCommand(t *testing.T) {
+	requireDB(t)
+	name := randomName()
+	out := &bytes.Buffer{}
+	args := []string{"add", "-currencies", "USD, EUR", name}
+	if err := runTenantCommand(context.Background(), &tenantService{db}, args, out); err != nil {
+		t.Fatalf("Unexpected error in tenant add: %v", err)
+	}
+	if !strings.Contains(out.String(), "EUR") {
+		t.Errorf("Expected created currencies in tenant add output, got %q", out.String())
+	}
+
+	out.Reset()
+	if err := runTenantCommand(context.Background(), &tenantService{db}, []string{"list"}, out); err != nil {
+		t.Fatalf("Unexpected error in tenant list: %v", err)
+	}
+	if !strings.Contains(out.String(), name) {
+		t.Errorf("Expected created tenant in tenant list output, got %q", out.String())
+	}
+
+	if err := runTenantCommand(context.Background(), &tenantService{db}, []string{"add", name}, out); err != models.ErrDuplicateTenant {
+		t.Errorf("Expected ErrDuplicateTenant, got %v", err)
+	}
+}
+
+func TestTenantIsolation(t *testing.T) {
+	requireDB(t)
+	tenant, currencies, err := (&tenantService{db}).CreateTenant(context.Background(), randomName(), []string{"BTC"})
+	if err != nil {
+		t.Fatalf("Unexpected error in CreateTenant: %v", err)
+	}
+	_, key, err := (&apiKeyService{db}).IssueAPIKey(context.Background(), tenant.ID, "other", models.RoleAdmin, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error in IssueAPIKey: %v", err)
+	}
+	other := newClient(key)
+
+	owner := addTestOwner(t)
+	addTestOwnerAccount(t, owner.ID, decimal.New(10, 0))
+	accounts := getAccountsResponse{}
+	getSomething(t, fmt.Sprintf("/owner/%d/accounts", owner.ID), &accounts)
+	ownID := accounts.Accounts[0].ID
+
+	// currency 3 belongs to the default tenant
+	body := fmt.Sprintf(`{"Name": "%s", "Amount": "10", "CurrencyId": 3}`, randomName())
+	if code, _ := requestStatus(t, other, "POST", "/accounts", body); code != 400 {
+		t.Errorf("Expected account in currency of another tenant to get 400, got %d", code)
+	}
+	body = fmt.Sprintf(`{"Name": "%s", "Amount": "10", "CurrencyId": %d}`, randomName(), currencies[0].ID)
+	if code, errResp := requestStatus(t, other, "POST", "/accounts", body); code != 200 {
+		t.Fatalf("Expected account creation to get 200, got %d (%s)", code, errResp.Error)
+	}
+
+	if code, _ := getStatus(t, other, "GET", fmt.Sprintf("/account/%d", ownID)); code != 404 {
+		t.Errorf("Expected account of another tenant to get 404, got %d", code)
+	}
+	if code, _ := getStatus(t, other, "GET", fmt.Sprintf("/owner/%d", owner.ID)); code != 404 {
+		t.Errorf("Expected owner of another tenant to get 404, got %d", code)
+	}
+
+	otherAccounts := getAccountsResponse{}
+	res, err := other.Get(URL("/accounts"))
+	if err != nil {
+		t.Fatalf("Unexpected error in GET /accounts: %v", err)
+	}
+	defer res.Body.Close()
+	if err := json.NewDecoder(res.Body).Decode(&otherAccounts); err != nil {
+		t.Fatal(err)
+	}
+	if len(otherAccounts.Accounts) != 1 {
+		t.Fatalf("Expected tenant to see only its own account, got %v", otherAccounts.Accounts)
+	}
+	payment := fmt.Sprintf(`{"BuyerAccountID": %d, "SellerAccountID": %d, "Amount": "1"}`,
+		otherAccounts.Accounts[0].ID, ownID)
+	if code, _ := requestStatus(t, other, "POST", "/payments", payment); code != 400 {
+		t.Errorf("Expected payment to account of another tenant to get 400, got %d", code)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/c-pro/wallet-test/models"
+)
+
+// TenantService provides methods to manage tenants
+type TenantService interface {
+	GetTenants(ctx context.Context) ([]models.Tenant, error)
+	CreateTenant(ctx context.Context, name string, currencies []string) (models.Tenant, []models.Currency, error)
+}
+
+// tenantService implements interface above
+type tenantService struct {
+	db *sql.DB
+}
+
+// GetTenants returns all tenants in database
+func (t *tenantService) GetTenants(ctx context.Context) ([]models.Tenant, error) {
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return []models.Tenant{}, err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	return models.GetTenants(ctx, tx)
+}
+
+// CreateTenant creates a new tenant along with its currencies in one transaction
+func (t *tenantService) CreateTenant(ctx context.Context, name string, currencies []string) (models.Tenant, []models.Currency, error) {
+	tenant := models.Tenant{Name: name}
+	created := []models.Currency{}
+	tx, err := t.db.BeginTx(ctx, nil)
+	if err != nil {
+		return tenant, created, err
+	}
+	defer models.RollbackWithLog(ctx, tx)
+	if err := tenant.Save(ctx, tx); err != nil {
+		return tenant, created, err
+	}
+	for _, name := range currencies {
+		currency := models.Currency{TenantID: tenant.ID, Name: name}
+		if err := currency.Save(ctx, tx); err != nil {
+			return tenant, created, err
+		}
+		created = append(created, currency)
+	}
+	return tenant, created, models.Commit(ctx, tx, tenant.ID, models.AuditObject("tenant", tenant.ID))
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/c-pro/wallet-test/logging"
+	"github.com/c-pro/wallet-test/tracing"
+	"github.com/go-kit/kit/endpoint"
+	"github.com/gorilla/mux"
+)
+
+// setupTracing enables tracing with exporter selected in configuration.
+// Spans are never written to stdout, so they do not mix with command output.
+// Returned function sends spans which were not exported yet.
+func setupTracing(cfg TracingConfig) (func(ctx context.Context) error, error) {
+	switch cfg.Exporter {
+	case "stderr":
+		tracing.SetExporter(tracing.NewWriterExporter(os.Stderr))
+	case "file":
+		f, err := os.OpenFile(cfg.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		tracing.SetExporter(tracing.NewWriterExporter(f))
+		return func(context.Context) error { return f.Close() }, nil
+	case "otlp":
+		e := tracing.NewOTLPExporter(strings.TrimSuffix(cfg.OTLPEndpoint, "/"), cfg.ServiceName)
+		tracing.SetExporter(e)
+		return e.Shutdown, nil
+	}
+	return func(context.Context) error { return nil }, nil
+}
+
+// traceHTTP starts a server span for every request. Trace is continued
+// if request has valid traceparent header, otherwise a new one is started.
+func traceHTTP(router *mux.Router, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if sc, err := tracing.ParseTraceparent(r.Header.Get(tracing.TraceparentHeader)); err == nil {
+			ctx = tracing.ContextWithRemote(ctx, sc)
+		}
+		route := routeName(router, r)
+		ctx, span := tracing.Start(ctx, r.Method+" "+route, tracing.SpanKindServer)
+		span.SetAttribute("http.method", r.Method)
+		span.SetAttribute("http.route", route)
+		span.SetAttribute("http.target", r.URL.Path)
+		span.SetAttribute("request_id", logging.RequestID(ctx))
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+		span.SetAttribute("http.status_code", rec.status)
+		var err error
+		if rec.status >= http.StatusInternalServerError {
+			err = fmt.Errorf("%d %s", rec.status, http.StatusText(rec.status))
+		}
+		span.End(err)
+	})
+}
+
+// traced is an endpoint middleware recording span of a service call.
+// Error responses are recorded as span errors.
+func traced(name string) endpoint.Middleware {
+	return func(next endpoint.Endpoint) endpoint.Endpoint {
+		return func(ctx context.Context, request interface{}) (interface{}, error) {
+			ctx, span := tracing.Start(ctx, name, tracing.SpanKindInternal)
+			response, err := next(ctx, request)
+			if errResp, ok := response.(errorResponse); ok && err == nil {
+				span.SetAttribute("response.code", errResp.Code)
+				err = errors.New(errResp.Error)
+				span.End(err)
+				return response, nil
+			}
+			span.End(err)
+			return response, err
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/c-pro/wallet-test/tracing"
+)
+
+// spanRecorder keeps exported spans
+type spanRecorder struct {
+	mu    sync.Mutex
+	spans []*tracing.Span
+}
+
+func (r *spanRecorder) ExportSpan(s *tracing.Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func (r *spanRecorder) find(name string) *tracing.Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, s := range r.spans {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+func TestSetupTracingFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "spans.json")
+	shutdown, err := setupTracing(TracingConfig{Exporter: "file", File: path})
+	if err != nil {
+		t.Fatalf("Unexpected error in setupTracing: %v", err)
+	}
+	defer tracing.SetExporter(nil)
+	_, span := tracing.Start(context.Background(), "test span", tracing.SpanKindInternal)
+	span.End(nil)
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatalf("Unexpected error in shutdown: %v", err)
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"Name":"test span"`) {
+		t.Errorf("Expected span in tracing file, got %q", b)
+	}
+}
+
+func TestTraceHTTP(t *testing.T) {
+	rec := &spanRecorder{}
+	tracing.SetExporter(rec)
+	defer tracing.SetExporter(nil)
+
+	traceparent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req, _ := http.NewRequest("GET", URL("/accounts"), nil)
+	req.Header.Set(tracing.TraceparentHeader, traceparent)
+	res, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("Unexpected error in GET /accounts: %v", err)
+	}
+	res.Body.Close()
+
+	server := rec.find("GET /accounts")
+	if server == nil {
+		t.Fatal("Expected server span of the request")
+	}
+	if server.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || server.ParentSpanID.String() != "00f067aa0ba902b7" {
+		t.Errorf("Expected request span to continue trace from traceparent, got %s", server.Context().Traceparent())
+	}
+	if server.Attributes["http.status_code"] != http.StatusOK || server.Attributes["request_id"] == "" {
+		t.Errorf("Unexpected request span attributes %v", server.Attributes)
+	}
+	endpoint := rec.find("GetAccounts")
+	if endpoint == nil || endpoint.ParentSpanID != server.SpanID {
+		t.Fatal("Expected service call span as a child of request span")
+	}
+}
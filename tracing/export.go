@@ -0,0 +1,289 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// WriterExporter writes every span as a JSON line to a writer, e.g. to stdout
+type WriterExporter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+// NewWriterExporter returns exporter writing spans to w
+func NewWriterExporter(w io.Writer) *WriterExporter {
+	return &WriterExporter{w: w}
+}
+
+// spanJSON is a span in WriterExporter output
+type spanJSON struct {
+	Name         string
+	Kind         SpanKind
+	TraceID      string
+	SpanID       string
+	ParentSpanID string `json:",omitempty"`
+	StartTime    time.Time
+	Duration     string
+	Attributes   map[string]interface{} `json:",omitempty"`
+	Error        string                 `json:",omitempty"`
+}
+
+// ExportSpan writes span to the writer
+func (e *WriterExporter) ExportSpan(s *Span) {
+	line := spanJSON{Name: s.Name,
+		Kind:       s.Kind,
+		TraceID:    s.TraceID.String(),
+		SpanID:     s.SpanID.String(),
+		StartTime:  s.StartTime,
+		Duration:   s.EndTime.Sub(s.StartTime).String(),
+		Attributes: s.Attributes,
+		Error:      s.Error}
+	if s.ParentSpanID.IsValid() {
+		line.ParentSpanID = s.ParentSpanID.String()
+	}
+	b, err := json.Marshal(line)
+	if err != nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.w.Write(append(b, '\n'))
+}
+
+// OTLP exporter defaults
+const (
+	otlpBatchSize     = 512
+	otlpQueueSize     = 4096
+	otlpFlushInterval = time.Second * 5
+	otlpTimeout       = time.Second * 10
+)
+
+// OTLPExporter sends spans in batches to OpenTelemetry collector
+// with OTLP/HTTP JSON protocol. Spans are dropped if collector can not keep up.
+type OTLPExporter struct {
+	url         string
+	serviceName string
+	client      *http.Client
+	queue       chan *Span
+	flush       chan chan struct{}
+	done        chan struct{}
+
+	mu      sync.Mutex
+	dropped int
+	lastErr error
+}
+
+// NewOTLPExporter starts exporter sending spans to collector endpoint,
+// e.g. http://localhost:4318. Spans are posted to /v1/traces.
+func NewOTLPExporter(endpoint, serviceName string) *OTLPExporter {
+	e := &OTLPExporter{url: endpoint + "/v1/traces",
+		serviceName: serviceName,
+		client:      &http.Client{Timeout: otlpTimeout},
+		queue:       make(chan *Span, otlpQueueSize),
+		flush:       make(chan chan struct{}),
+		done:        make(chan struct{})}
+	go e.run()
+	return e
+}
+
+// ExportSpan queues span to be sent, it is dropped if queue is full
+func (e *OTLPExporter) ExportSpan(s *Span) {
+	select {
+	case e.queue <- s:
+	default:
+		e.mu.Lock()
+		e.dropped++
+		e.mu.Unlock()
+	}
+}
+
+// Err returns error of the last failed batch and number of dropped spans
+func (e *OTLPExporter) Err() (int, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.dropped, e.lastErr
+}
+
+// Shutdown sends queued spans and stops the exporter.
+// Spans exported after Shutdown are dropped.
+func (e *OTLPExporter) Shutdown(ctx context.Context) error {
+	flushed := make(chan struct{})
+	select {
+	case e.flush <- flushed:
+	case <-e.done:
+		close(flushed)
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	select {
+	case <-flushed:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	_, err := e.Err()
+	return err
+}
+
+func (e *OTLPExporter) run() {
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+	batch := []*Span{}
+	send := func() {
+		if len(batch) > 0 {
+			e.send(batch)
+			batch = []*Span{}
+		}
+	}
+	for {
+		select {
+		case s := <-e.queue:
+			batch = append(batch, s)
+			if len(batch) >= otlpBatchSize {
+				send()
+			}
+		case <-ticker.C:
+			send()
+		case flushed := <-e.flush:
+			// drain spans queued so far
+			for len(e.queue) > 0 {
+				batch = append(batch, <-e.queue)
+			}
+			send()
+			close(e.done)
+			close(flushed)
+			return
+		}
+	}
+}
+
+func (e *OTLPExporter) send(batch []*Span) {
+	body, err := json.Marshal(otlpRequest(e.serviceName, batch))
+	if err == nil {
+		var res *http.Response
+		res, err = e.client.Post(e.url, "application/json", bytes.NewReader(body))
+		if err == nil {
+			res.Body.Close()
+			if res.StatusCode != http.StatusOK {
+				err = fmt.Errorf("collector responded with %s", res.Status)
+			}
+		}
+	}
+	e.mu.Lock()
+	e.lastErr = err
+	e.mu.Unlock()
+}
+
+// OTLP JSON encoding of ExportTraceServiceRequest. IDs are hex strings
+// and 64 bit integers are decimal strings as the protocol requires.
+type (
+	otlpKeyValue struct {
+		Key   string       `json:"key"`
+		Value otlpAnyValue `json:"value"`
+	}
+	otlpAnyValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+	otlpStatus struct {
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+	otlpSpan struct {
+		TraceID           string         `json:"traceId"`
+		SpanID            string         `json:"spanId"`
+		ParentSpanID      string         `json:"parentSpanId,omitempty"`
+		Name              string         `json:"name"`
+		Kind              SpanKind       `json:"kind"`
+		StartTimeUnixNano string         `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+		Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+		Status            otlpStatus     `json:"status"`
+	}
+	otlpScopeSpans struct {
+		Scope struct {
+			Name string `json:"name"`
+		} `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+	otlpResourceSpans struct {
+		Resource struct {
+			Attributes []otlpKeyValue `json:"attributes"`
+		} `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+	otlpTraces struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+)
+
+// otlpStatusError is OTLP status code of failed span, status of other spans is left unset
+const otlpStatusError = 2
+
+func otlpValue(v interface{}) otlpAnyValue {
+	switch v := v.(type) {
+	case string:
+		return otlpAnyValue{StringValue: &v}
+	case bool:
+		return otlpAnyValue{BoolValue: &v}
+	case int:
+		s := strconv.Itoa(v)
+		return otlpAnyValue{IntValue: &s}
+	case int64:
+		s := strconv.FormatInt(v, 10)
+		return otlpAnyValue{IntValue: &s}
+	case float64:
+		return otlpAnyValue{DoubleValue: &v}
+	}
+	s := fmt.Sprint(v)
+	return otlpAnyValue{StringValue: &s}
+}
+
+// otlpAttributes converts attributes sorted by key
+func otlpAttributes(attrs map[string]interface{}) []otlpKeyValue {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	kvs := []otlpKeyValue{}
+	for _, k := range keys {
+		kvs = append(kvs, otlpKeyValue{k, otlpValue(attrs[k])})
+	}
+	return kvs
+}
+
+// otlpRequest builds OTLP export request with spans of a service
+func otlpRequest(serviceName string, spans []*Span) otlpTraces {
+	scope := otlpScopeSpans{Spans: []otlpSpan{}}
+	scope.Scope.Name = "github.com/c-pro/wallet-test/tracing"
+	for _, s := range spans {
+		span := otlpSpan{TraceID: s.TraceID.String(),
+			SpanID:            s.SpanID.String(),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.StartTime.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.EndTime.UnixNano(), 10),
+			Attributes:        otlpAttributes(s.Attributes)}
+		if s.ParentSpanID.IsValid() {
+			span.ParentSpanID = s.ParentSpanID.String()
+		}
+		if s.Error != "" {
+			span.Status = otlpStatus{otlpStatusError, s.Error}
+		}
+		scope.Spans = append(scope.Spans, span)
+	}
+	resource := otlpResourceSpans{ScopeSpans: []otlpScopeSpans{scope}}
+	resource.Resource.Attributes = otlpAttributes(map[string]interface{}{"service.name": serviceName})
+	return otlpTraces{ResourceSpans: []otlpResourceSpans{resource}}
+}
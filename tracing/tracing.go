@@ -0,0 +1,242 @@
+// Package tracing records spans of HTTP requests, service calls and SQL statements
+// and propagates trace context in W3C traceparent header. Spans are compatible
+// with OpenTelemetry and can be exported with OTLP to a collector or written to stdout.
+// Tracing is disabled until exporter is set with SetExporter.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TraceparentHeader is W3C trace context header
+const TraceparentHeader = "traceparent"
+
+// ErrInvalidTraceparent is returned by ParseTraceparent for malformed headers
+var ErrInvalidTraceparent = errors.New("Invalid traceparent header")
+
+// TraceID identifies a trace
+type TraceID [16]byte
+
+// SpanID identifies a span in a trace
+type SpanID [8]byte
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// IsValid tells if trace ID is not all zeroes
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+
+// IsValid tells if span ID is not all zeroes
+func (s SpanID) IsValid() bool { return s != SpanID{} }
+
+// SpanContext is a part of span propagated to other services
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid tells if both trace and span IDs are set
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent formats span context as traceparent header value
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + flags
+}
+
+// ParseTraceparent parses traceparent header value, version 00 format:
+// 00-<32 hex trace id>-<16 hex parent span id>-<2 hex flags>.
+// Headers of future versions are accepted if they start with the same fields.
+func ParseTraceparent(s string) (SpanContext, error) {
+	sc := SpanContext{}
+	parts := strings.Split(strings.TrimSpace(s), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		(parts[0] == "00" && len(parts) != 4) {
+		return sc, ErrInvalidTraceparent
+	}
+	if _, err := decodeHex(parts[0], 1); err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	traceID, err := decodeHex(parts[1], 16)
+	if err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	spanID, err := decodeHex(parts[2], 8)
+	if err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	flags, err := decodeHex(parts[3], 1)
+	if err != nil {
+		return sc, ErrInvalidTraceparent
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Sampled = flags[0]&1 == 1
+	if !sc.IsValid() {
+		return sc, ErrInvalidTraceparent
+	}
+	return sc, nil
+}
+
+// decodeHex decodes lowercase hex string of n bytes
+func decodeHex(s string, n int) ([]byte, error) {
+	if len(s) != n*2 || strings.ToLower(s) != s {
+		return nil, ErrInvalidTraceparent
+	}
+	return hex.DecodeString(s)
+}
+
+// SpanKind tells the role of a span, values match OpenTelemetry
+type SpanKind int
+
+// Span kinds
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// Span is a timed operation in a trace. All methods are safe to call on nil span,
+// which is returned when tracing is disabled or the trace is not sampled.
+type Span struct {
+	Name         string
+	Kind         SpanKind
+	TraceID      TraceID
+	SpanID       SpanID
+	ParentSpanID SpanID
+	StartTime    time.Time
+	EndTime      time.Time
+	Attributes   map[string]interface{}
+	// Error is a message of error the operation failed with
+	Error string
+
+	mu       sync.Mutex
+	ended    bool
+	exporter Exporter
+}
+
+// Context returns span context to propagate
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return SpanContext{TraceID: s.TraceID, SpanID: s.SpanID, Sampled: true}
+}
+
+// SetAttribute sets attribute of the span. Values are strings, numbers or bools.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Attributes[key] = value
+}
+
+// End finishes the span and exports it. Span is marked failed if err is not nil.
+// Only the first call has effect.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.EndTime = time.Now()
+	if err != nil {
+		s.Error = err.Error()
+	}
+	s.mu.Unlock()
+	s.exporter.ExportSpan(s)
+}
+
+// Exporter sends finished spans somewhere. ExportSpan should not block.
+type Exporter interface {
+	ExportSpan(s *Span)
+}
+
+var (
+	exporterMu sync.RWMutex
+	exporter   Exporter
+)
+
+// SetExporter enables tracing with spans exported to e. Nil e disables tracing.
+func SetExporter(e Exporter) {
+	exporterMu.Lock()
+	defer exporterMu.Unlock()
+	exporter = e
+}
+
+func getExporter() Exporter {
+	exporterMu.RLock()
+	defer exporterMu.RUnlock()
+	return exporter
+}
+
+type contextKey int
+
+const (
+	spanKey contextKey = iota
+	remoteKey
+)
+
+// ContextWithRemote returns context with span context received from another service,
+// spans started with it become its children
+func ContextWithRemote(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey, sc)
+}
+
+// SpanFromContext returns current span of ctx or nil
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey).(*Span)
+	return s
+}
+
+// Start starts a span as a child of the current span of ctx, or of remote span context,
+// or as a root of a new trace. Returns context with the new span.
+// Returns nil span if tracing is disabled or remote parent is not sampled.
+func Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	e := getExporter()
+	if e == nil {
+		return ctx, nil
+	}
+	s := &Span{Name: name,
+		Kind:       kind,
+		StartTime:  time.Now(),
+		Attributes: map[string]interface{}{},
+		exporter:   e}
+	if parent := SpanFromContext(ctx); parent != nil {
+		s.TraceID, s.ParentSpanID = parent.TraceID, parent.SpanID
+	} else if remote, ok := ctx.Value(remoteKey).(SpanContext); ok && remote.IsValid() {
+		if !remote.Sampled {
+			return ctx, nil
+		}
+		s.TraceID, s.ParentSpanID = remote.TraceID, remote.SpanID
+	} else {
+		randomID(s.TraceID[:])
+	}
+	randomID(s.SpanID[:])
+	return context.WithValue(ctx, spanKey, s), s
+}
+
+func randomID(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("failed to generate trace ID: %v", err))
+	}
+}
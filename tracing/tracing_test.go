@@ -0,0 +1,176 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// recorder keeps exported spans
+type recorder struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+func (r *recorder) ExportSpan(s *Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func TestParseTraceparent(t *testing.T) {
+	header := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, err := ParseTraceparent(header)
+	if err != nil {
+		t.Fatalf("Unexpected error in ParseTraceparent: %v", err)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" || !sc.Sampled {
+		t.Errorf("Unexpected span context %+v", sc)
+	}
+	if sc.Traceparent() != header {
+		t.Errorf("Expected %s, got %s", header, sc.Traceparent())
+	}
+	// future versions can have more fields
+	if _, err := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra"); err != nil {
+		t.Errorf("Unexpected error for future version: %v", err)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e47-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceparent(invalid); err != ErrInvalidTraceparent {
+			t.Errorf("Expected ErrInvalidTraceparent for %q, got %v", invalid, err)
+		}
+	}
+}
+
+func TestStart(t *testing.T) {
+	rec := &recorder{}
+	SetExporter(rec)
+	defer SetExporter(nil)
+
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, parent := Start(ContextWithRemote(context.Background(), remote), "parent", SpanKindServer)
+	_, child := Start(ctx, "child", SpanKindClient)
+	child.SetAttribute("db.statement", "select 1")
+	child.End(errors.New("boom"))
+	child.End(nil)
+	parent.End(nil)
+
+	if len(rec.spans) != 2 {
+		t.Fatalf("Expected 2 spans exported once each, got %d", len(rec.spans))
+	}
+	if parent.TraceID != remote.TraceID || parent.ParentSpanID != remote.SpanID {
+		t.Errorf("Expected parent span to continue remote trace, got %+v", parent.Context())
+	}
+	if child.TraceID != parent.TraceID || child.ParentSpanID != parent.SpanID {
+		t.Error("Expected child span to be in parent's trace")
+	}
+	if child.Error != "boom" || child.Attributes["db.statement"] != "select 1" {
+		t.Errorf("Unexpected child span %+v", child)
+	}
+
+	// not sampled remote trace is not recorded
+	remote.Sampled = false
+	if _, s := Start(ContextWithRemote(context.Background(), remote), "skipped", SpanKindServer); s != nil {
+		t.Error("Expected no span for not sampled trace")
+	}
+}
+
+func TestDisabled(t *testing.T) {
+	SetExporter(nil)
+	ctx, s := Start(context.Background(), "span", SpanKindInternal)
+	if s != nil || SpanFromContext(ctx) != nil {
+		t.Fatal("Expected no span when tracing is disabled")
+	}
+	// nil span methods do nothing
+	s.SetAttribute("key", "value")
+	s.End(nil)
+	if s.Context().IsValid() {
+		t.Error("Expected invalid span context of nil span")
+	}
+}
+
+func TestWriterExporter(t *testing.T) {
+	buf := bytes.Buffer{}
+	SetExporter(NewWriterExporter(&buf))
+	defer SetExporter(nil)
+
+	_, s := Start(context.Background(), "span", SpanKindInternal)
+	s.End(nil)
+	line := map[string]interface{}{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("Expected JSON line, got %q: %v", buf.String(), err)
+	}
+	if line["Name"] != "span" || line["TraceID"] != s.TraceID.String() {
+		t.Errorf("Unexpected span line %v", line)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || !strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			t.Errorf("Unexpected request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		bodies <- b
+	}))
+	defer collector.Close()
+
+	e := NewOTLPExporter(collector.URL, "wallet")
+	SetExporter(e)
+	defer SetExporter(nil)
+	_, s := Start(context.Background(), "span", SpanKindServer)
+	s.SetAttribute("http.status_code", 500)
+	s.End(errors.New("failed"))
+	if err := e.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Unexpected error in Shutdown: %v", err)
+	}
+
+	req := struct {
+		ResourceSpans []struct {
+			Resource struct {
+				Attributes []otlpKeyValue
+			}
+			ScopeSpans []struct {
+				Spans []otlpSpan
+			}
+		}
+	}{}
+	if err := json.Unmarshal(<-bodies, &req); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.ResourceSpans) != 1 || len(req.ResourceSpans[0].ScopeSpans) != 1 ||
+		len(req.ResourceSpans[0].ScopeSpans[0].Spans) != 1 {
+		t.Fatalf("Expected one span, got %+v", req)
+	}
+	if attr := req.ResourceSpans[0].Resource.Attributes[0]; attr.Key != "service.name" || *attr.Value.StringValue != "wallet" {
+		t.Errorf("Unexpected resource attribute %+v", attr)
+	}
+	span := req.ResourceSpans[0].ScopeSpans[0].Spans[0]
+	if span.TraceID != s.TraceID.String() || span.Name != "span" || span.Kind != SpanKindServer {
+		t.Errorf("Unexpected span %+v", span)
+	}
+	if span.Status.Code != otlpStatusError || span.Status.Message != "failed" {
+		t.Errorf("Expected error status, got %+v", span.Status)
+	}
+	if len(span.Attributes) != 1 || *span.Attributes[0].Value.IntValue != "500" {
+		t.Errorf("Unexpected attributes %+v", span.Attributes)
+	}
+}
@@ -8,6 +8,9 @@ import (
 	"net/http"
 	"strconv"
 
+	"github.com/c-pro/wallet-test/jwt"
+	"github.com/c-pro/wallet-test/logging"
+	"github.com/c-pro/wallet-test/models"
 	httptransport "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
 )
@@ -15,47 +18,194 @@ import (
 var errBadRoute = errors.New("bad route")
 var errBadRequest = errors.New("bad request")
 
-func makeHandlers(db *sql.DB) http.Handler {
-	accSvc := &accountService{db}
-	paySvc := &paymentService{db}
+// makeHandlers builds API handler. Accounts and payments are kept in repo,
+// while owners and keys are stored only in postgres db. If db is nil,
+// owners and keys API is not available and clients authenticate with JWT only.
+func makeHandlers(db *sql.DB, repo models.Repository, verifier *jwt.Verifier) http.Handler {
+	accSvc := &accountService{repo}
+	paySvc := &instrumentedPaymentService{&paymentService{repo}}
+	// audit log is kept only in postgres
+	var auditSvc AuditService
+	if db != nil {
+		auditSvc = &auditService{db}
+	}
+
+	canPay := anyOf(allowRoles(models.RoleAdmin), clientOwnBuyer(accSvc))
 
 	getAccountsHandler := httptransport.NewServer(
-		makeGetAccountsEndpoint(accSvc),
-		decodeNilRequest,
+		traced("GetAccounts")(authorize(canRead)(makeGetAccountsEndpoint(accSvc))),
+		decodeGetAccountsRequest,
 		encodeResponse,
 	)
 
 	getAccountHandler := httptransport.NewServer(
-		makeGetAccountEndpoint(accSvc),
+		traced("GetAccount")(authorize(canRead)(makeGetAccountEndpoint(accSvc))),
 		decodeGetAccountRequest,
 		encodeResponse,
 	)
 
 	createAccountHandler := httptransport.NewServer(
-		makeCreateAccountEndpoint(accSvc),
+		traced("CreateAccount")(audited(auditSvc, "account.create")(authorize(canCreate)(makeCreateAccountEndpoint(accSvc)))),
 		decodeCreateAccountRequest,
 		encodeResponse,
 	)
 
 	getPaymentsHandler := httptransport.NewServer(
-		makeGetPaymentsEndpoint(paySvc),
+		traced("GetPayments")(authorize(canRead)(makeGetPaymentsEndpoint(paySvc))),
 		decodeNilRequest,
 		encodeResponse,
 	)
 
 	makePaymentsHandler := httptransport.NewServer(
-		makeMakePaymentEndpoint(paySvc),
+		traced("MakePayment")(audited(auditSvc, "payment.create")(authorize(canPay)(makeMakePaymentEndpoint(paySvc)))),
 		decodeMakePaymentRequest,
 		encodeResponse,
 	)
 
+	setAccountShardsHandler := httptransport.NewServer(
+		traced("SetAccountShards")(audited(auditSvc, "account.set_shards")(authorize(canAdmin)(makeSetAccountShardsEndpoint(accSvc)))),
+		decodeSetAccountShardsRequest,
+		encodeResponse,
+	)
+
+	depositHandler := httptransport.NewServer(
+		traced("Deposit")(audited(auditSvc, "account.deposit")(authorize(canCreate)(makeDepositEndpoint(accSvc)))),
+		decodeDepositRequest,
+		encodeResponse,
+	)
+
+	reconcileHandler := httptransport.NewServer(
+		traced("Reconcile")(authorize(canAudit)(makeReconcileEndpoint(&reconcileService{repo}))),
+		decodeNilRequest,
+		encodeResponse,
+	)
+
+	trialBalanceHandler := httptransport.NewServer(
+		traced("TrialBalance")(authorize(canAudit)(makeTrialBalanceEndpoint(&reportService{repo}))),
+		decodeTrialBalanceRequest,
+		encodeTrialBalanceResponse,
+	)
+
 	r := mux.NewRouter()
 	r.Handle("/accounts", getAccountsHandler).Methods("GET")
 	r.Handle("/account/{id}", getAccountHandler).Methods("GET")
 	r.Handle("/accounts", createAccountHandler).Methods("POST")
+	r.Handle("/account/{id}/shards", setAccountShardsHandler).Methods("PUT")
+	r.Handle("/account/{id}/deposits", depositHandler).Methods("POST")
 	r.Handle("/payments", getPaymentsHandler).Methods("GET")
 	r.Handle("/payments", makePaymentsHandler).Methods("POST")
-	return r
+	r.Handle("/admin/reconciliation", reconcileHandler).Methods("GET")
+	r.Handle("/admin/reports/trial-balance", trialBalanceHandler).Methods("GET")
+
+	auth := &authenticator{verifier: verifier}
+	if db != nil {
+		keySvc := &apiKeyService{db}
+		hmacSvc := &hmacKeyService{db}
+		addOwnerHandlers(r, &ownerService{db}, auditSvc)
+		addKeyHandlers(r, keySvc, hmacSvc, auditSvc)
+		addAuditHandlers(r, auditSvc)
+		auth.apiKeys = keySvc
+		auth.hmacKeys = hmacSvc
+	}
+	return withRequestID(traceHTTP(r, instrumentHTTP(r, auth.middleware(withAuditRequest(r)))))
+}
+
+// addOwnerHandlers adds owners API routes to r
+func addOwnerHandlers(r *mux.Router, ownSvc OwnerService, auditSvc AuditService) {
+	canReadOwner := anyOf(canRead, clientOwnOwner)
+
+	getOwnersHandler := httptransport.NewServer(
+		traced("GetOwners")(authorize(canRead)(makeGetOwnersEndpoint(ownSvc))),
+		decodeNilRequest,
+		encodeResponse,
+	)
+
+	getOwnerHandler := httptransport.NewServer(
+		traced("GetOwner")(authorize(canReadOwner)(makeGetOwnerEndpoint(ownSvc))),
+		decodeGetOwnerRequest,
+		encodeResponse,
+	)
+
+	createOwnerHandler := httptransport.NewServer(
+		traced("CreateOwner")(audited(auditSvc, "owner.create")(authorize(canCreate)(makeCreateOwnerEndpoint(ownSvc)))),
+		decodeCreateOwnerRequest,
+		encodeResponse,
+	)
+
+	getOwnerAccountsHandler := httptransport.NewServer(
+		traced("GetOwnerAccounts")(authorize(canReadOwner)(makeGetOwnerAccountsEndpoint(ownSvc))),
+		decodeGetOwnerRequest,
+		encodeResponse,
+	)
+
+	getOwnerHoldingsHandler := httptransport.NewServer(
+		traced("GetOwnerHoldings")(authorize(canReadOwner)(makeGetOwnerHoldingsEndpoint(ownSvc))),
+		decodeGetOwnerRequest,
+		encodeResponse,
+	)
+
+	r.Handle("/owners", getOwnersHandler).Methods("GET")
+	r.Handle("/owners", createOwnerHandler).Methods("POST")
+	r.Handle("/owner/{id}", getOwnerHandler).Methods("GET")
+	r.Handle("/owner/{id}/accounts", getOwnerAccountsHandler).Methods("GET")
+	r.Handle("/owner/{id}/holdings", getOwnerHoldingsHandler).Methods("GET")
+}
+
+// addKeyHandlers adds API keys and HMAC keys admin routes to r
+func addKeyHandlers(r *mux.Router, keySvc APIKeyService, hmacSvc HMACKeyService, auditSvc AuditService) {
+	getAPIKeysHandler := httptransport.NewServer(
+		traced("GetAPIKeys")(authorize(canAdmin)(makeGetAPIKeysEndpoint(keySvc))),
+		decodeNilRequest,
+		encodeResponse,
+	)
+
+	issueAPIKeyHandler := httptransport.NewServer(
+		traced("IssueAPIKey")(audited(auditSvc, "api_key.issue")(authorize(canAdmin)(makeIssueAPIKeyEndpoint(keySvc)))),
+		decodeIssueAPIKeyRequest,
+		encodeResponse,
+	)
+
+	revokeAPIKeyHandler := httptransport.NewServer(
+		traced("RevokeAPIKey")(audited(auditSvc, "api_key.revoke")(authorize(canAdmin)(makeRevokeAPIKeyEndpoint(keySvc)))),
+		decodeRevokeAPIKeyRequest,
+		encodeResponse,
+	)
+
+	getHMACKeysHandler := httptransport.NewServer(
+		traced("GetHMACKeys")(authorize(canAdmin)(makeGetHMACKeysEndpoint(hmacSvc))),
+		decodeNilRequest,
+		encodeResponse,
+	)
+
+	issueHMACKeyHandler := httptransport.NewServer(
+		traced("IssueHMACKey")(audited(auditSvc, "hmac_key.issue")(authorize(canAdmin)(makeIssueHMACKeyEndpoint(hmacSvc)))),
+		decodeIssueAPIKeyRequest,
+		encodeResponse,
+	)
+
+	revokeHMACKeyHandler := httptransport.NewServer(
+		traced("RevokeHMACKey")(audited(auditSvc, "hmac_key.revoke")(authorize(canAdmin)(makeRevokeHMACKeyEndpoint(hmacSvc)))),
+		decodeRevokeAPIKeyRequest,
+		encodeResponse,
+	)
+
+	r.Handle("/admin/api-keys", getAPIKeysHandler).Methods("GET")
+	r.Handle("/admin/api-keys", issueAPIKeyHandler).Methods("POST")
+	r.Handle("/admin/api-key/{id}", revokeAPIKeyHandler).Methods("DELETE")
+	r.Handle("/admin/hmac-keys", getHMACKeysHandler).Methods("GET")
+	r.Handle("/admin/hmac-keys", issueHMACKeyHandler).Methods("POST")
+	r.Handle("/admin/hmac-key/{id}", revokeHMACKeyHandler).Methods("DELETE")
+}
+
+// addAuditHandlers adds audit log route to r, it is available to admins and auditors
+func addAuditHandlers(r *mux.Router, auditSvc AuditService) {
+	getAuditLogHandler := httptransport.NewServer(
+		traced("GetAuditLog")(authorize(canAudit)(makeGetAuditLogEndpoint(auditSvc))),
+		decodeGetAuditLogRequest,
+		encodeResponse,
+	)
+
+	r.Handle("/admin/audit", getAuditLogHandler).Methods("GET")
 }
 
 // For requests w/o bodies
@@ -63,14 +213,28 @@ func decodeNilRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	return nil, nil
 }
 
-func encodeResponse(_ context.Context, w http.ResponseWriter, response interface{}) error {
+// encodeResponse writes response as JSON. Error responses get their status code
+// and request ID, so client can refer to the request when reporting errors.
+// Server errors are logged.
+func encodeResponse(ctx context.Context, w http.ResponseWriter, response interface{}) error {
 	w.Header().Add("Content-Type", "application/json")
 	if errResp, ok := response.(errorResponse); ok {
+		if errResp.Code >= http.StatusInternalServerError {
+			logging.FromContext(ctx).Log("msg", "request failed", "status", errResp.Code, "err", errResp.Error)
+		}
 		w.WriteHeader(errResp.Code)
+		response = struct {
+			errorResponse
+			RequestID string `json:"RequestID,omitempty"`
+		}{errResp, logging.RequestID(ctx)}
 	}
 	return json.NewEncoder(w).Encode(response)
 }
 
+func decodeGetAccountsRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	return getAccountsRequest{ExternalID: r.URL.Query().Get("external_id")}, nil
+}
+
 func decodeGetAccountRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	vars := mux.Vars(r)
 	id, ok := vars["id"]
@@ -92,6 +256,53 @@ func decodeCreateAccountRequest(_ context.Context, r *http.Request) (interface{}
 	return req, nil
 }
 
+func decodeSetAccountShardsRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	req, err := decodeGetAccountRequest(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	shardsReq := setAccountShardsRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&shardsReq); err != nil {
+		return nil, err
+	}
+	shardsReq.AccountID = req.(getAccountRequest).AccountID
+	return shardsReq, nil
+}
+
+func decodeDepositRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	req, err := decodeGetAccountRequest(ctx, r)
+	if err != nil {
+		return nil, err
+	}
+	depositReq := depositRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&depositReq); err != nil {
+		return nil, err
+	}
+	depositReq.AccountID = req.(getAccountRequest).AccountID
+	return depositReq, nil
+}
+
+func decodeGetOwnerRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, errBadRoute
+	}
+	ownerID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, errBadRequest
+	}
+	return getOwnerRequest{ownerID}, nil
+}
+
+func decodeCreateOwnerRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	req := createOwnerRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
 func decodeMakePaymentRequest(_ context.Context, r *http.Request) (interface{}, error) {
 	req := makePaymentRequest{}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -99,3 +310,24 @@ func decodeMakePaymentRequest(_ context.Context, r *http.Request) (interface{},
 	}
 	return req, nil
 }
+
+func decodeIssueAPIKeyRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	req := issueAPIKeyRequest{}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+func decodeRevokeAPIKeyRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	vars := mux.Vars(r)
+	id, ok := vars["id"]
+	if !ok {
+		return nil, errBadRoute
+	}
+	keyID, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		return nil, errBadRequest
+	}
+	return revokeAPIKeyRequest{keyID}, nil
+}